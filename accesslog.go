@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLog writes a line for each request, in text or JSON
+// The request-id is logged to match a request a manager sent to the simulator's response in a capture.
+type AccessLog struct {
+	lock   sync.Mutex
+	out    io.Writer
+	json   bool
+	closer io.Closer // nil if not a file
+}
+
+// AccessEntry is the line of a request in the access log
+type AccessEntry struct {
+	Time        time.Time `json:"time"`
+	Source      string    `json:"source"`
+	Version     string    `json:"version,omitempty"`
+	Community   string    `json:"community,omitempty"`
+	Pdu         string    `json:"pdu,omitempty"`
+	RequestId   int       `json:"requestId"`
+	Varbinds    int       `json:"varbinds"`
+	ErrorStatus int       `json:"errorStatus"`
+	Bytes       int       `json:"bytes"`      // of the response, 0 if dropped
+	Millis      float64   `json:"durationMs"` // to process the request
+	Error       string    `json:"error,omitempty"`
+	RunId       string    `json:"runId"` // of the snmprun process, not in the text log
+}
+
+// checkAccessLogFormat checks the -access-log-format is text or json
+func checkAccessLogFormat(format string) (isJson bool, err error) {
+	switch strings.ToLower(format) {
+	case "", "text":
+		return false, nil
+	case "json":
+		return true, nil
+	}
+	return false, fmt.Errorf("Invalid access log format %s, expecting text or json", format)
+}
+
+func newAccessLog(out io.Writer, format string) (*AccessLog, error) {
+	isJson, err := checkAccessLogFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessLog{out: out, json: isJson}, nil
+}
+
+// openAccessLog appends to the access log file, - for stdout
+func openAccessLog(filename string, format string) (*AccessLog, error) {
+	if filename == "-" {
+		return newAccessLog(os.Stdout, format)
+	}
+	isJson, err := checkAccessLogFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessLog{out: f, json: isJson, closer: f}, nil
+}
+
+// accessEntry is the entry of a request from the summary the agent returned
+func accessEntry(start time.Time, source string, summary RequestSummary, response []byte, err error) AccessEntry {
+	entry := AccessEntry{
+		Time:        start,
+		Source:      source,
+		Community:   summary.Community,
+		Pdu:         summary.Pdu,
+		RequestId:   summary.RequestId,
+		Varbinds:    summary.Varbinds,
+		ErrorStatus: summary.ErrorStatus,
+		Bytes:       len(response),
+		Millis:      float64(time.Since(start).Microseconds()) / 1000,
+		RunId:       runId,
+	}
+	if summary.Pdu != "" {
+		entry.Version = versionName(summary.Version)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+// versionName is the name of an SNMP version number in a message
+func versionName(version int) string {
+	switch version {
+	case 0:
+		return "v1"
+	case 1:
+		return "v2c"
+	case 3:
+		return "v3"
+	}
+	return fmt.Sprintf("%d", version)
+}
+
+// Log writes the line of a request
+func (accessLog *AccessLog) Log(entry AccessEntry) {
+	var line string
+	if accessLog.json {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			logger.Errorf("Failed to format access log entry: %v\n", err)
+			return
+		}
+		line = string(data) + "\n"
+	} else {
+		line = fmt.Sprintf("%s %s %s %s %s id=%d varbinds=%d status=%d bytes=%d %.3fms",
+			entry.Time.Format(time.RFC3339Nano), entry.Source, orDash(entry.Version), orDash(entry.Community),
+			orDash(entry.Pdu), entry.RequestId, entry.Varbinds, entry.ErrorStatus, entry.Bytes, entry.Millis)
+		if entry.Error != "" {
+			line += fmt.Sprintf(" error=%q", entry.Error)
+		}
+		line += "\n"
+	}
+
+	accessLog.lock.Lock()
+	defer accessLog.lock.Unlock()
+	_, err := io.WriteString(accessLog.out, line)
+	if err != nil {
+		logger.Errorf("Failed to write access log: %v\n", err)
+	}
+}
+
+func orDash(str string) string {
+	if str == "" {
+		return "-"
+	}
+	return str
+}
+
+// Close closes the access log file
+func (accessLog *AccessLog) Close() error {
+	if accessLog.closer == nil {
+		return nil
+	}
+	return accessLog.closer.Close()
+}
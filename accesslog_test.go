@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PromonLogicalis/snmp"
+)
+
+func TestAccessLogRequestId(t *testing.T) {
+	agent, _ := newTestAgent(t, `
+var
+  descr: 2.1.1.1.0 string = "access log"
+endvar
+run
+endrun`)
+
+	tests := []struct {
+		community string
+		pdu       interface{}
+		want      AccessEntry
+		wantErr   bool
+	}{
+		{"public", snmp.GetRequestPdu{Identifier: 4242, Variables: oidVars(t, nil, "2.1.1.1.0")},
+			AccessEntry{Version: "v2c", Community: "public", Pdu: "get", RequestId: 4242, Varbinds: 1}, false},
+		{"public", snmp.SetRequestPdu{Identifier: 17, Variables: oidVars(t, nil, "2.1.1.1.0")},
+			AccessEntry{Version: "v2c", Community: "public", Pdu: "set", RequestId: 17, Varbinds: 1, ErrorStatus: snmp.NoAccess}, false},
+		{"wrong", snmp.GetNextRequestPdu{Identifier: 99, Variables: oidVars(t, nil, "2.1.1")},
+			AccessEntry{Version: "v2c", Community: "wrong", Pdu: "getnext", RequestId: 99, Varbinds: 1}, true},
+	}
+	for _, test := range tests {
+		reqBuf, err := agent.ctx.Encode(snmp.Message{Version: snmp.V2C, Community: []byte(test.community), Pdu: test.pdu})
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		response, summary, err := agent.ProcessRequest(reqBuf)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%T: error = %v, want error %v", test.pdu, err, test.wantErr)
+		}
+
+		var out bytes.Buffer
+		accessLog, err := newAccessLog(&out, "json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		accessLog.Log(accessEntry(start, "192.0.2.1:4000", summary, response, err))
+		var got AccessEntry
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatalf("%s: %v", out.String(), err)
+		}
+		if got.Source != "192.0.2.1:4000" || got.Version != test.want.Version || got.Community != test.want.Community ||
+			got.Pdu != test.want.Pdu || got.RequestId != test.want.RequestId || got.Varbinds != test.want.Varbinds ||
+			got.ErrorStatus != test.want.ErrorStatus {
+			t.Errorf("entry = %s, want %+v", out.String(), test.want)
+		}
+		if !strings.Contains(out.String(), `"requestId":`) {
+			t.Errorf("entry = %s, want a requestId field", out.String())
+		}
+		if got.RunId != runId {
+			t.Errorf("entry = %s, want the run id %s", out.String(), runId)
+		}
+	}
+}
+
+func TestAccessLogServerResponses(t *testing.T) {
+	agent, _ := newTestAgent(t, `
+var
+  descr: 2.1.1.1.0 string = "access log"
+endvar
+run
+endrun`)
+	ctx := snmp.Asn1Context()
+	datagrams, err := readPcapUDP(bytes.NewReader(replayTestCapture(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replyConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replyConn.Close()
+	manager, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	var out bytes.Buffer
+	accessLog, err := newAccessLog(&out, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &SNMPServer{agent: agent, ctx: ctx, accessLog: accessLog, responseSizes: newSizeHistogram(),
+		config: &ServerConfig{readCommunity: "public", writeCommunity: "private", maxMsgSize: maxDatagramSize}}
+	lockedOut := newAuthLockout(1, time.Minute, time.Minute)
+	lockedOut.Failure("127.0.0.1", time.Now())
+
+	tests := []struct {
+		name    string
+		setup   func()
+		pdu     interface{}
+		status  int
+		sent    bool
+		wantErr string
+	}{
+		{"startup genErr", func() { server.readyAt = time.Now().Add(time.Hour); server.config.startupResp = "genErr" },
+			snmp.GetRequestPdu{Identifier: 1, Variables: oidVars(t, nil, "2.1.1.1.0")}, snmp.GenErr, true, ""},
+		{"startup drop", func() { server.config.startupResp = "drop" },
+			snmp.GetRequestPdu{Identifier: 2, Variables: oidVars(t, nil, "2.1.1.1.0")}, 0, false, errStartupDrop.Error()},
+		{"lockout drop", func() { server.readyAt = time.Time{}; server.lockout = lockedOut },
+			snmp.GetRequestPdu{Identifier: 3, Variables: oidVars(t, nil, "2.1.1.1.0")}, 0, false, errLockoutDrop.Error()},
+		{"replay", func() { server.lockout = nil; server.replay = newReplay(datagrams, 161, ctx) },
+			snmp.GetRequestPdu{Identifier: 4, Variables: oidVars(t, nil, "2.1.1.1.0")}, 0, true, ""},
+		{"agent", func() {},
+			snmp.GetNextRequestPdu{Identifier: 5, Variables: oidVars(t, nil, "2.1.1.1.0")}, snmp.NoError, true, ""},
+	}
+	for _, test := range tests {
+		test.setup()
+		request, err := ctx.Encode(snmp.Message{Version: snmp.V2C, Community: []byte("public"), Pdu: test.pdu})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Reset()
+		server.handleRequest(replyConn, request, manager.LocalAddr())
+
+		var got AccessEntry
+		if strings.Count(out.String(), "\n") != 1 || json.Unmarshal(out.Bytes(), &got) != nil {
+			t.Errorf("%s: log = %q, want one entry", test.name, out.String())
+			continue
+		}
+		id, _, _ := getRequestInfo(test.pdu)
+		if got.RequestId != id || got.Community != "public" || got.ErrorStatus != test.status ||
+			(got.Bytes > 0) != test.sent || got.Error != test.wantErr {
+			t.Errorf("%s: entry = %s", test.name, out.String())
+		}
+	}
+}
+
+func TestAccessLogText(t *testing.T) {
+	var out bytes.Buffer
+	accessLog, err := newAccessLog(&out, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := RequestSummary{RequestInfo: RequestInfo{Version: snmp.V1, Community: "public", RequestId: 7}, Pdu: "get", Varbinds: 2}
+	accessLog.Log(accessEntry(time.Now(), "192.0.2.1:4000", summary, make([]byte, 60), nil))
+	accessLog.Log(accessEntry(time.Now(), "192.0.2.1:4000", RequestSummary{}, nil, errors.New("bad message")))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("log = %q, want 2 lines", out.String())
+	}
+	if !strings.Contains(lines[0], " 192.0.2.1:4000 v1 public get id=7 varbinds=2 status=0 bytes=60 ") {
+		t.Errorf("line = %q", lines[0])
+	}
+	if !strings.Contains(lines[1], " - - - id=0 ") || !strings.HasSuffix(lines[1], `error="bad message"`) {
+		t.Errorf("dropped line = %q", lines[1])
+	}
+
+	if _, err := newAccessLog(&out, "xml"); err == nil {
+		t.Error("format xml: expecting an error")
+	}
+}
@@ -0,0 +1,827 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+// GetHandler returns the value of a managed object
+// The context has the RequestInfo of the request being processed.
+type GetHandler func(ctx context.Context, oid asn1.Oid) (interface{}, error)
+
+// SetHandler checks a value can be set for a managed object, returning the function which sets it
+// The agent checks every variable of a SET before it commits any of them.
+type SetHandler func(ctx context.Context, oid asn1.Oid, value interface{}) (commit func() error, err error)
+
+// RowCreator checks a SET to an OID in a table which has no managed object, returning the function which does it,
+// like a SetHandler. That creates the row for a SET of its RowStatus column, creates being true, or sets a column
+// of a row which another of the variables of the request creates.
+type RowCreator func(ctx context.Context, oid asn1.Oid, value interface{}, reqVars []snmp.Variable) (commit func() error, creates bool, err error)
+
+// DeclaredFunc returns whether an OID which is not served is at other times, such as a variable which is absent
+type DeclaredFunc func(oid asn1.Oid) bool
+
+// RequestInfo describes the request a handler is called for
+type RequestInfo struct {
+	Version   int
+	Community string
+	RequestId int
+}
+
+type requestInfoKey struct{}
+
+// RequestInfoFrom returns the request from the context of a handler, e.g. to vary a value by community
+func RequestInfoFrom(ctx context.Context) (info RequestInfo, ok bool) {
+	info, ok = ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info, ok
+}
+
+// RequestSummary describes a request and its response for the access log
+// The fields are those decoded before any error, e.g. an invalid community has no PDU type.
+type RequestSummary struct {
+	RequestInfo
+	Pdu         string // get, getnext, getbulk, set or inform, empty if not decoded
+	Varbinds    int    // in the request
+	ErrorStatus int    // of the response
+}
+
+// pduTypeNames are the PDU types for the RequestSummary
+var pduTypeNames = map[string]string{
+	"snmp.GetRequestPdu":     "get",
+	"snmp.GetNextRequestPdu": "getnext",
+	"snmp.GetBulkRequestPdu": "getbulk",
+	"snmp.SetRequestPdu":     "set",
+	"snmp.InformRequestPdu":  "inform",
+}
+
+// RequestFilter is called with each request before it is processed, to simulate quirks of real devices
+// such as failing requests with many variable bindings. Returning a VarError responds with its error status,
+// any other error drops the request.
+type RequestFilter func(version int, pdu interface{}, vars []snmp.Variable) error
+
+// VarError is an error from a handler for a particular SNMP error-status
+type VarError struct {
+	Status  int
+	Message string
+}
+
+func (e VarError) Error() string {
+	return e.Message
+}
+
+func varErrorf(status int, format string, a ...interface{}) error {
+	return VarError{Status: status, Message: fmt.Sprintf(format, a...)}
+}
+
+// ManagedObject is an OID served by the agent
+type ManagedObject struct {
+	oid    asn1.Oid
+	getter GetHandler
+	setter SetHandler // nil if read-only
+}
+
+type managedTable struct {
+	entryOid asn1.Oid
+	creator  RowCreator
+}
+
+// Agent answers SNMP v1 and v2c requests for its managed objects
+type Agent struct {
+	ctx            *asn1.Context
+	readCommunity  string
+	writeCommunity string
+
+	lock           sync.RWMutex
+	objects        []*ManagedObject // sorted by OID for GETNEXT
+	objectsFromOid map[string]*ManagedObject
+	tables         []*managedTable
+	filter         RequestFilter // optional
+	readOnly       bool          // refuse all SET requests
+	walkLimit      *WalkLimit    // optional
+	lenient        bool          // a GET of a scalar without its .0 instance gets the scalar
+	declared       DeclaredFunc  // optional
+
+	responseCommunity []byte // sent in every response instead of the request's, nil to echo it
+
+	unsupportedStatus int // error-status of the response to an inform, noError to drop it
+
+	requests int64 // datagrams processed, atomic
+}
+
+// errBadCommunity is the error for a request with neither the read-only nor the read-write community
+var errBadCommunity = errors.New("Invalid community")
+
+// errUnsupportedPdu is the error for a PDU the agent does not process, such as a trap or an inform
+var errUnsupportedPdu = errors.New("Unsupported PDU type")
+
+// errUnsupportedVersion is the error for a message of an SNMP version the agent does not serve, such as v3
+var errUnsupportedVersion = errors.New("Unsupported SNMP version")
+
+// messageVersion returns the version at the start of an SNMP message, which is the same for every version,
+// so a message of a version that can not be decoded is still told apart from a garbled one
+func messageVersion(msg []byte) (version int, ok bool) {
+	// SEQUENCE with a short or long form length
+	if len(msg) < 2 || msg[0] != 0x30 {
+		return 0, false
+	}
+	i := 2
+	if msg[1]&0x80 != 0 {
+		i += int(msg[1] & 0x7f)
+	}
+	// INTEGER of up to 4 octets
+	if len(msg) < i+2 || msg[i] != 0x02 || msg[i+1] < 1 || msg[i+1] > 4 || len(msg) < i+2+int(msg[i+1]) {
+		return 0, false
+	}
+	for _, b := range msg[i+2 : i+2+int(msg[i+1])] {
+		version = version<<8 | int(b)
+	}
+	return version, true
+}
+
+// unsupportedVersionError explains which versions are served to the sender of a message of another version
+func unsupportedVersionError(version int) error {
+	return fmt.Errorf("%w: received %s request but only v1 and v2c are served", errUnsupportedVersion, versionName(version))
+}
+
+func NewAgent() *Agent {
+	return &Agent{
+		ctx:            snmp.Asn1Context(),
+		readCommunity:  "public",
+		writeCommunity: "private",
+		objectsFromOid: make(map[string]*ManagedObject),
+	}
+}
+
+// SetReadOnly makes the agent refuse all SET requests, whatever the community and access of the OIDs
+func (agent *Agent) SetReadOnly(readOnly bool) {
+	agent.readOnly = readOnly
+}
+
+// SetScalarLeniency makes a GET of a scalar's OID without the .0 instance answer with the scalar, as some devices
+// do, rather than noSuchInstance. A GETNEXT of it gets the scalar either way.
+func (agent *Agent) SetScalarLeniency(lenient bool) {
+	agent.lenient = lenient
+}
+
+// SetResponseCommunity makes every response carry the community rather than echo the request's. This breaks
+// RFC 1157 and RFC 1901 on purpose, to emulate a broken device that always answers with a fixed community.
+func (agent *Agent) SetResponseCommunity(community string) {
+	agent.responseCommunity = []byte(community)
+}
+
+// responseCommunityFor returns the community of the response to a request with the community
+func (agent *Agent) responseCommunityFor(community []byte) []byte {
+	if agent.responseCommunity != nil {
+		return agent.responseCommunity
+	}
+	return community
+}
+
+// SetUnsupportedPduStatus sets the error-status to respond to an inform with, noError to drop informs.
+// Unconfirmed PDUs such as traps and responses are always dropped as they never get a response.
+func (agent *Agent) SetUnsupportedPduStatus(status int) {
+	agent.unsupportedStatus = status
+}
+
+// SetMaxWalk sets the most OIDs a walk of GETNEXT or GETBULK requests returns before endOfMibView, 0 for no limit
+func (agent *Agent) SetMaxWalk(max int) {
+	agent.walkLimit = nil
+	if max > 0 {
+		agent.walkLimit = newWalkLimit(max)
+	}
+}
+
+// SetCommunities sets the read-only and read-write communities
+func (agent *Agent) SetCommunities(readCommunity string, writeCommunity string) {
+	agent.readCommunity = readCommunity
+	agent.writeCommunity = writeCommunity
+}
+
+// SetDeclaredFunc sets the function a SET of an OID which is not served asks whether it is at other times,
+// to answer inconsistentName rather than noCreation, nil for none
+func (agent *Agent) SetDeclaredFunc(declared DeclaredFunc) {
+	agent.declared = declared
+}
+
+// SetRequestFilter sets the filter called before each request is processed, nil for none
+func (agent *Agent) SetRequestFilter(filter RequestFilter) {
+	agent.filter = filter
+}
+
+// AddRoManagedObject adds a read-only OID
+func (agent *Agent) AddRoManagedObject(oid asn1.Oid, getter GetHandler) {
+	agent.addManagedObject(&ManagedObject{oid: oid, getter: getter})
+}
+
+// AddRwManagedObject adds a read-write OID
+func (agent *Agent) AddRwManagedObject(oid asn1.Oid, getter GetHandler, setter SetHandler) {
+	agent.addManagedObject(&ManagedObject{oid: oid, getter: getter, setter: setter})
+}
+
+func (agent *Agent) addManagedObject(object *ManagedObject) {
+	agent.lock.Lock()
+	defer agent.lock.Unlock()
+
+	oidStr := object.oid.String()
+	if _, ok := agent.objectsFromOid[oidStr]; ok {
+		// replace the existing object
+		i := agent.searchObjects(object.oid)
+		agent.objects[i] = object
+		agent.objectsFromOid[oidStr] = object
+		return
+	}
+
+	// insert keeping the OID order
+	i := agent.searchObjects(object.oid)
+	agent.objects = append(agent.objects, nil)
+	copy(agent.objects[i+1:], agent.objects[i:])
+	agent.objects[i] = object
+	agent.objectsFromOid[oidStr] = object
+}
+
+// addManagedObjects adds many objects at once, sorting them once rather than inserting each in order
+func (agent *Agent) addManagedObjects(objects []*ManagedObject) {
+	agent.lock.Lock()
+	defer agent.lock.Unlock()
+
+	if len(agent.objectsFromOid) == 0 {
+		agent.objectsFromOid = make(map[string]*ManagedObject, len(objects))
+	}
+	if cap(agent.objects)-len(agent.objects) < len(objects) {
+		grown := make([]*ManagedObject, len(agent.objects), len(agent.objects)+len(objects))
+		copy(grown, agent.objects)
+		agent.objects = grown
+	}
+	added := false
+	for _, object := range objects {
+		oidStr := object.oid.String()
+		if _, ok := agent.objectsFromOid[oidStr]; ok {
+			// replace the existing object, which may be one of those just added
+			for i, existing := range agent.objects {
+				if compareOIDs(existing.oid, object.oid) == 0 {
+					agent.objects[i] = object
+				}
+			}
+		} else {
+			agent.objects = append(agent.objects, object)
+			added = true
+		}
+		agent.objectsFromOid[oidStr] = object
+	}
+	if added {
+		sort.Slice(agent.objects, func(i, j int) bool {
+			return compareOIDs(agent.objects[i].oid, agent.objects[j].oid) < 0
+		})
+	}
+}
+
+// RequestCount returns the number of datagrams processed, including those dropped
+func (agent *Agent) RequestCount() int64 {
+	return atomic.LoadInt64(&agent.requests)
+}
+
+// ManagedOids returns the OIDs the agent serves in order
+func (agent *Agent) ManagedOids() []asn1.Oid {
+	agent.lock.RLock()
+	defer agent.lock.RUnlock()
+	oids := make([]asn1.Oid, len(agent.objects))
+	for i, object := range agent.objects {
+		oids[i] = object.oid
+	}
+	return oids
+}
+
+// RemoveManagedObject removes an OID so it is no longer served
+func (agent *Agent) RemoveManagedObject(oid asn1.Oid) {
+	agent.lock.Lock()
+	defer agent.lock.Unlock()
+
+	oidStr := oid.String()
+	if _, ok := agent.objectsFromOid[oidStr]; !ok {
+		return
+	}
+	i := agent.searchObjects(oid)
+	agent.objects = append(agent.objects[:i], agent.objects[i+1:]...)
+	delete(agent.objectsFromOid, oidStr)
+}
+
+// AddTable adds a table whose rows can be created by SET
+func (agent *Agent) AddTable(entryOid asn1.Oid, creator RowCreator) {
+	agent.lock.Lock()
+	defer agent.lock.Unlock()
+
+	agent.tables = append(agent.tables, &managedTable{entryOid: entryOid, creator: creator})
+}
+
+// searchObjects returns the index of the first object at or after the OID
+// Must be called with the lock held
+func (agent *Agent) searchObjects(oid asn1.Oid) int {
+	return sort.Search(len(agent.objects), func(i int) bool {
+		return compareOIDs(agent.objects[i].oid, oid) >= 0
+	})
+}
+
+func (agent *Agent) getObject(oid asn1.Oid) (object *ManagedObject, found bool) {
+	agent.lock.RLock()
+	defer agent.lock.RUnlock()
+
+	object, found = agent.objectsFromOid[oid.String()]
+	return object, found
+}
+
+// getNextObject returns the first object after the OID, which need not be served,
+// by a binary search of the objects in numeric OID order
+func (agent *Agent) getNextObject(oid asn1.Oid) (object *ManagedObject, found bool) {
+	agent.lock.RLock()
+	defer agent.lock.RUnlock()
+
+	i := sort.Search(len(agent.objects), func(i int) bool {
+		return compareOIDs(agent.objects[i].oid, oid) > 0
+	})
+	if i == len(agent.objects) {
+		return nil, false
+	}
+	return agent.objects[i], true
+}
+
+// hasObjectInstances reports whether the OID without its last (instance) component has objects under it
+// This distinguishes noSuchInstance from noSuchObject
+func (agent *Agent) hasObjectInstances(oid asn1.Oid) bool {
+	if len(oid) < 2 {
+		return false
+	}
+	parent := oid[:len(oid)-1]
+	next, found := agent.getNextObject(parent)
+	return found && isOidPrefix(parent, next.oid)
+}
+
+func (agent *Agent) getTableFor(oid asn1.Oid) (table *managedTable, found bool) {
+	agent.lock.RLock()
+	defer agent.lock.RUnlock()
+
+	for _, table := range agent.tables {
+		if isOidPrefix(table.entryOid, oid) {
+			return table, true
+		}
+	}
+	return nil, false
+}
+
+// isOidPrefix reports whether prefix is the start of (or equal to) oid
+func isOidPrefix(prefix asn1.Oid, oid asn1.Oid) bool {
+	if len(prefix) > len(oid) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != oid[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// v1ErrorStatus maps v2 error-status values onto the v1 values as per RFC 2576 section 4.4
+func v1ErrorStatus(status int) int {
+	switch status {
+	case snmp.WrongValue, snmp.WrongEncoding, snmp.WrongType, snmp.WrongLength, snmp.InconsistentValue:
+		return snmp.BadValue
+	case snmp.NoAccess, snmp.NotWritable, snmp.NoCreation, snmp.InconsistentName, snmp.AuthorizationError:
+		return snmp.NoSuchName
+	case snmp.ResourceUnavailable, snmp.CommitFailed, snmp.UndoFailed:
+		return snmp.GenErr
+	}
+	return status
+}
+
+// errorStatus returns the error-status for an error returned by a handler
+func errorStatus(err error, defaultStatus int) int {
+	var varErr VarError
+	if errors.As(err, &varErr) {
+		return varErr.Status
+	}
+	return defaultStatus
+}
+
+// setErrorStatuses are the SNMPv2 error-status of the kinds of error of a SET
+var setErrorStatuses = []struct {
+	kind   error
+	status int
+}{
+	{ErrTypeMismatch, snmp.WrongType},
+	{ErrWrongLength, snmp.WrongLength},
+	{ErrWrongValue, snmp.WrongValue},
+	{ErrNotWritable, snmp.NotWritable},
+	{ErrUnknownOID, snmp.NoCreation},
+}
+
+// setErrorStatus returns the error-status for an error returned by a SetHandler
+// A v1 response maps it to badValue or noSuchName.
+func setErrorStatus(err error) int {
+	var varErr VarError
+	if errors.As(err, &varErr) {
+		return varErr.Status
+	}
+	for _, kind := range setErrorStatuses {
+		if errors.Is(err, kind.kind) {
+			return kind.status
+		}
+	}
+	return snmp.WrongValue
+}
+
+// pduError is an error-status to respond with for the variable at index (from 1)
+type pduError struct {
+	status int
+	index  int
+}
+
+// ProcessDatagram decodes a request and returns the encoded response
+func (agent *Agent) ProcessDatagram(request []byte) (response []byte, err error) {
+	response, _, err = agent.ProcessRequest(request)
+	return response, err
+}
+
+// ProcessRequest decodes a request and returns the encoded response and a summary of both
+// The summary has what was decoded even if the request is dropped with an error.
+func (agent *Agent) ProcessRequest(request []byte) (response []byte, summary RequestSummary, err error) {
+	return agent.ProcessRequestFrom(request, "")
+}
+
+// ProcessRequestFrom is ProcessRequest for a request from the address of a manager, which tells its walks apart
+func (agent *Agent) ProcessRequestFrom(request []byte, source string) (response []byte, summary RequestSummary, err error) {
+	atomic.AddInt64(&agent.requests, 1)
+	response, err = agent.processDatagram(request, source, &summary)
+	return response, summary, err
+}
+
+// summarizeRequest is the summary of a request the agent does not process, such as one dropped or answered
+// by the server, with neither an error-status nor a response
+func (agent *Agent) summarizeRequest(request []byte) (summary RequestSummary) {
+	if version, ok := messageVersion(request); ok && version != snmp.V1 && version != snmp.V2C {
+		summary.Version = version
+		return summary
+	}
+	var reqMsg snmp.Message
+	if _, err := agent.ctx.Decode(request, &reqMsg); err == nil {
+		summarizeMessage(reqMsg, &summary)
+	}
+	return summary
+}
+
+// summarizeMessage fills the summary of a decoded request message
+func summarizeMessage(reqMsg snmp.Message, summary *RequestSummary) {
+	summary.Version = reqMsg.Version
+	summary.Community = string(reqMsg.Community)
+	summary.Pdu = pduTypeNames[fmt.Sprintf("%T", reqMsg.Pdu)]
+	id, reqVars, _ := getRequestInfo(reqMsg.Pdu)
+	summary.RequestId = id
+	summary.Varbinds = len(reqVars)
+	if inform, ok := reqMsg.Pdu.(snmp.InformRequestPdu); ok {
+		summary.RequestId = inform.Identifier
+		summary.Varbinds = len(inform.Variables)
+	}
+}
+
+func (agent *Agent) processDatagram(request []byte, source string, summary *RequestSummary) (response []byte, err error) {
+	if version, ok := messageVersion(request); ok && version != snmp.V1 && version != snmp.V2C {
+		// a v3 message does not decode as a community one
+		summary.Version = version
+		return nil, unsupportedVersionError(version)
+	}
+	var reqMsg snmp.Message
+	_, err = agent.ctx.Decode(request, &reqMsg)
+	if err != nil {
+		return nil, err
+	}
+	summarizeMessage(reqMsg, summary)
+	id, reqVars, ok := getRequestInfo(reqMsg.Pdu)
+	inform, isInform := reqMsg.Pdu.(snmp.InformRequestPdu)
+
+	if reqMsg.Version != snmp.V1 && reqMsg.Version != snmp.V2C {
+		return nil, unsupportedVersionError(reqMsg.Version)
+	}
+
+	community := string(reqMsg.Community)
+	if community != agent.readCommunity && community != agent.writeCommunity {
+		return nil, fmt.Errorf("%w: %s", errBadCommunity, community)
+	}
+
+	if !ok {
+		if !isInform || reqMsg.Version == snmp.V1 || agent.unsupportedStatus == snmp.NoError {
+			return nil, fmt.Errorf("%w: %T", errUnsupportedPdu, reqMsg.Pdu)
+		}
+		summary.ErrorStatus = agent.unsupportedStatus
+		// an inform is confirmed so the sender retries until it gets a response
+		return agent.ctx.Encode(snmp.Message{
+			Version:   reqMsg.Version,
+			Community: agent.responseCommunityFor(reqMsg.Community),
+			Pdu: snmp.GetResponsePdu{
+				Identifier:  inform.Identifier,
+				ErrorStatus: agent.unsupportedStatus,
+				Variables:   inform.Variables,
+			},
+		})
+	}
+
+	ctx := context.WithValue(context.Background(), requestInfoKey{},
+		RequestInfo{Version: reqMsg.Version, Community: community, RequestId: id})
+	var vars []snmp.Variable
+	var pduErr *pduError
+	if agent.filter != nil {
+		// a filtered request is not processed
+		err = agent.filter(reqMsg.Version, reqMsg.Pdu, reqVars)
+		var varErr VarError
+		if errors.As(err, &varErr) {
+			pduErr = &pduError{status: varErr.Status}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	var w *walk
+	if agent.walkLimit != nil && pduErr == nil {
+		switch reqMsg.Pdu.(type) {
+		case snmp.GetNextRequestPdu, snmp.GetBulkRequestPdu:
+			ctx, w = agent.walkLimit.begin(ctx, source, reqVars, time.Now())
+		}
+	}
+	if pduErr == nil {
+		switch pdu := reqMsg.Pdu.(type) {
+		case snmp.GetRequestPdu:
+			vars, pduErr = agent.processGet(ctx, reqMsg.Version, pdu.Variables)
+		case snmp.GetNextRequestPdu:
+			vars, pduErr = agent.processGetNext(ctx, reqMsg.Version, pdu.Variables)
+		case snmp.GetBulkRequestPdu:
+			if reqMsg.Version == snmp.V1 {
+				return nil, errors.New("GetBulk request is not supported in SNMPv1")
+			}
+			vars, pduErr = agent.processGetBulk(ctx, pdu.NonRepeaters, pdu.MaxRepetitions, pdu.Variables)
+		case snmp.SetRequestPdu:
+			if community != agent.writeCommunity {
+				// the read-only community has no write access, noSuchName for v1 (RFC 2576 section 4.4)
+				logger.Warnf("Set request %d refused as %s is the read-only community\n", id, community)
+				pduErr = &pduError{snmp.NoAccess, 1}
+				break
+			}
+			if agent.readOnly {
+				logger.Warnf("Set request %d refused as the agent is read-only (-read-only)\n", id)
+				pduErr = &pduError{snmp.NotWritable, 1}
+				if reqMsg.Version == snmp.V1 {
+					pduErr.status = snmp.ReadOnly
+				}
+				break
+			}
+			vars, pduErr = agent.processSet(ctx, reqMsg.Version, pdu.Variables)
+		}
+	}
+	if w != nil && pduErr == nil {
+		agent.walkLimit.end(w, source, vars, time.Now())
+	}
+
+	respPdu := snmp.GetResponsePdu{Identifier: id, Variables: vars}
+	if pduErr != nil {
+		// an error response has the variable bindings of the request
+		respPdu.ErrorStatus = pduErr.status
+		if reqMsg.Version == snmp.V1 {
+			respPdu.ErrorStatus = v1ErrorStatus(pduErr.status)
+		}
+		respPdu.ErrorIndex = pduErr.index
+		respPdu.Variables = reqVars
+	}
+	summary.ErrorStatus = respPdu.ErrorStatus
+
+	respMsg := snmp.Message{
+		Version:   reqMsg.Version,
+		Community: agent.responseCommunityFor(reqMsg.Community),
+		Pdu:       respPdu,
+	}
+	return agent.ctx.Encode(respMsg)
+}
+
+func (agent *Agent) processGet(ctx context.Context, version int, reqVars []snmp.Variable) (vars []snmp.Variable, pduErr *pduError) {
+	vars = make([]snmp.Variable, 0, len(reqVars))
+	for i, reqVar := range reqVars {
+		object, found := agent.getObject(reqVar.Name)
+		if !found && agent.lenient {
+			// the .0 instance of a scalar, which a manager left off
+			instance := append(append(asn1.Oid{}, reqVar.Name...), 0)
+			if object, found = agent.getObject(instance); found {
+				reqVar.Name = instance
+			}
+		}
+		if !found {
+			if version == snmp.V1 {
+				return nil, &pduError{snmp.NoSuchName, i + 1}
+			}
+			// v2 reports missing OIDs in the variable binding
+			var exception interface{} = snmp.NoSuchObject{}
+			if agent.hasObjectInstances(reqVar.Name) {
+				exception = snmp.NoSuchInstance{}
+			}
+			vars = append(vars, snmp.Variable{Name: reqVar.Name, Value: exception})
+			continue
+		}
+		value, err := object.getter(ctx, reqVar.Name)
+		if isHole(err) {
+			// the object is registered but has no value, such as a row being destroyed
+			if version == snmp.V1 {
+				return nil, &pduError{snmp.NoSuchName, i + 1}
+			}
+			vars = append(vars, snmp.Variable{Name: reqVar.Name, Value: snmp.NoSuchInstance{}})
+			continue
+		}
+		if err != nil {
+			logger.Warnf("Get of %s failed: %s\n", reqVar.Name, err)
+			return nil, &pduError{errorStatus(err, snmp.GenErr), i + 1}
+		}
+		if version == snmp.V1 && isCounter64(value) {
+			// v1 has no Counter64 so it is not visible (RFC 2576 section 4.2.2.1)
+			return nil, &pduError{snmp.NoSuchName, i + 1}
+		}
+		vars = append(vars, snmp.Variable{Name: reqVar.Name, Value: value})
+	}
+	return vars, nil
+}
+
+// getNext returns the variable binding for the first OID after the given one
+// or endOfMibView if there is none
+// A hole, an object whose value has gone such as a row being destroyed, is skipped
+// so a walk of a sparse table goes on to the next instance.
+func (agent *Agent) getNext(ctx context.Context, oid asn1.Oid) (v snmp.Variable, endOfMib bool, err error) {
+	for {
+		object, found := agent.getNextObject(oid)
+		if !found {
+			return snmp.Variable{Name: oid, Value: snmp.EndOfMibView{}}, true, nil
+		}
+		value, err := object.getter(ctx, object.oid)
+		if isHole(err) {
+			oid = object.oid
+			continue
+		}
+		if err != nil {
+			return v, false, err
+		}
+		if walkEnded(ctx) {
+			// the walk has returned the most OIDs allowed, as if there were no more
+			return snmp.Variable{Name: oid, Value: snmp.EndOfMibView{}}, true, nil
+		}
+		return snmp.Variable{Name: object.oid, Value: value}, false, nil
+	}
+}
+
+// isHole returns true for the error of a getter whose object has no value
+func isHole(err error) bool {
+	var varErr VarError
+	if errors.As(err, &varErr) {
+		return varErr.Status == snmp.NoSuchName
+	}
+	return errors.Is(err, ErrUnknownOID)
+}
+
+func isCounter64(value interface{}) bool {
+	_, ok := value.(snmp.Counter64)
+	return ok
+}
+
+func (agent *Agent) processGetNext(ctx context.Context, version int, reqVars []snmp.Variable) (vars []snmp.Variable, pduErr *pduError) {
+	vars = make([]snmp.Variable, 0, len(reqVars))
+	for i, reqVar := range reqVars {
+		v, endOfMib, err := agent.getNext(ctx, reqVar.Name)
+		for err == nil && version == snmp.V1 && isCounter64(v.Value) {
+			// skip what v1 can not see (RFC 2576 section 4.2.2.1)
+			v, endOfMib, err = agent.getNext(ctx, v.Name)
+		}
+		if err != nil {
+			logger.Warnf("GetNext of %s failed: %s\n", reqVar.Name, err)
+			return nil, &pduError{errorStatus(err, snmp.GenErr), i + 1}
+		}
+		if endOfMib && version == snmp.V1 {
+			return nil, &pduError{snmp.NoSuchName, i + 1}
+		}
+		vars = append(vars, v)
+	}
+	return vars, nil
+}
+
+// processGetBulk as per RFC 3416 section 4.2.3
+// The first nonRepeaters variables get a single successor and the rest get up to maxRepetitions successors,
+// interleaved a row at a time.
+func (agent *Agent) processGetBulk(ctx context.Context, nonRepeaters int, maxRepetitions int, reqVars []snmp.Variable) (vars []snmp.Variable, pduErr *pduError) {
+	if nonRepeaters < 0 {
+		nonRepeaters = 0
+	}
+	if nonRepeaters > len(reqVars) {
+		nonRepeaters = len(reqVars)
+	}
+	if maxRepetitions < 0 {
+		maxRepetitions = 0
+	}
+
+	for i := 0; i < nonRepeaters; i++ {
+		v, _, err := agent.getNext(ctx, reqVars[i].Name)
+		if err != nil {
+			logger.Warnf("GetBulk of %s failed: %s\n", reqVars[i].Name, err)
+			return nil, &pduError{errorStatus(err, snmp.GenErr), i + 1}
+		}
+		vars = append(vars, v)
+	}
+
+	repeaters := reqVars[nonRepeaters:]
+	if len(repeaters) == 0 {
+		return vars, nil
+	}
+	lastOids := make([]asn1.Oid, len(repeaters))
+	for j, reqVar := range repeaters {
+		lastOids[j] = reqVar.Name
+	}
+	for r := 0; r < maxRepetitions; r++ {
+		allEnded := true
+		for j := range repeaters {
+			v, endOfMib, err := agent.getNext(ctx, lastOids[j])
+			if err != nil {
+				logger.Warnf("GetBulk of %s failed: %s\n", lastOids[j], err)
+				return nil, &pduError{errorStatus(err, snmp.GenErr), nonRepeaters + j + 1}
+			}
+			if !endOfMib {
+				allEnded = false
+				lastOids[j] = v.Name
+			}
+			vars = append(vars, v)
+		}
+		if allEnded {
+			// no point in more rows of endOfMibView
+			break
+		}
+	}
+	return vars, nil
+}
+
+// processSet checks all the variables can be set before setting any of them (RFC 3416 section 4.2.5), so a SET
+// which fails leaves the values and the rows of the tables as they were.
+// The rows are created before the other variables are set, so the columns of a new row can be set in the same
+// request whatever the order of the variables.
+func (agent *Agent) processSet(ctx context.Context, version int, reqVars []snmp.Variable) (vars []snmp.Variable, pduErr *pduError) {
+	commits := make([]func() error, len(reqVars))
+	creates := make([]bool, len(reqVars))
+	for i, reqVar := range reqVars {
+		setter, status := agent.setterFor(reqVar.Name)
+		if setter == nil {
+			return nil, &pduError{status, i + 1}
+		}
+		var err error
+		commits[i], creates[i], err = setter(ctx, reqVar.Name, reqVar.Value, reqVars)
+		if err != nil {
+			logger.Warnf("Set of %s failed: %s\n", reqVar.Name, err)
+			return nil, &pduError{setErrorStatus(err), i + 1}
+		}
+	}
+
+	for _, rows := range []bool{true, false} {
+		for i, commit := range commits {
+			if creates[i] != rows {
+				continue
+			}
+			if err := commit(); err != nil {
+				logger.Warnf("Set of %s failed: %s\n", reqVars[i].Name, err)
+				return nil, &pduError{snmp.CommitFailed, i + 1}
+			}
+		}
+	}
+	return reqVars, nil
+}
+
+// setterFor returns what checks a SET of the OID and returns the function doing it: the setter of its managed
+// object, or the creator of the table for a row to create or a column of one. It is nil if the OID can not be set,
+// with the error-status.
+func (agent *Agent) setterFor(oid asn1.Oid) (setter RowCreator, status int) {
+	if object, found := agent.getObject(oid); found {
+		if object.setter == nil {
+			return nil, snmp.NotWritable
+		}
+		return func(ctx context.Context, oid asn1.Oid, value interface{}, reqVars []snmp.Variable) (func() error, bool, error) {
+			commit, err := object.setter(ctx, oid, value)
+			return commit, false, err
+		}, snmp.NoError
+	}
+	if table, isTable := agent.getTableFor(oid); isTable {
+		return table.creator, snmp.NoError
+	}
+	return nil, agent.missingStatus(oid)
+}
+
+// missingStatus returns the error-status of a SET of an OID which is not served and not in a table
+// (RFC 3416 section 4.2.5): inconsistentName for one which can be at other times, such as a variable which is
+// absent, otherwise noCreation
+func (agent *Agent) missingStatus(oid asn1.Oid) int {
+	if agent.declared != nil && agent.declared(oid) {
+		return snmp.InconsistentName
+	}
+	return snmp.NoCreation
+}
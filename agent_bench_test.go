@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+var benchSizes = []int{10, 100, 1000}
+
+// benchProgram declares numOids integer OIDs in an interface-like table
+func benchProgram(numOids int) string {
+	var sb strings.Builder
+	sb.WriteString("var\n")
+	for i := 1; i <= numOids; i++ {
+		fmt.Fprintf(&sb, "  v%d: 2.1.2.2.1.10.%d integer\n", i, i)
+	}
+	sb.WriteString("endvar\nrun\nendrun\n")
+	return sb.String()
+}
+
+func benchAgent(b *testing.B, numOids int) *Agent {
+	agent, _ := newTestAgent(b, benchProgram(numOids))
+	return agent
+}
+
+func benchRequest(b *testing.B, agent *Agent, pdu interface{}) {
+	request, err := agent.ctx.Encode(snmp.Message{Version: snmp.V2C, Community: []byte("public"), Pdu: pdu})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := agent.ProcessDatagram(request)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// middleOid is an OID half way through the bench program's OIDs
+func middleOid(numOids int) asn1.Oid {
+	return asn1.Oid{1, 3, 6, 1, 2, 1, 2, 2, 1, 10, uint(numOids / 2)}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, numOids := range benchSizes {
+		b.Run(fmt.Sprintf("oids=%d", numOids), func(b *testing.B) {
+			agent := benchAgent(b, numOids)
+			benchRequest(b, agent, snmp.GetRequestPdu{
+				Identifier: 1,
+				Variables:  []snmp.Variable{{Name: middleOid(numOids), Value: asn1.Null{}}},
+			})
+		})
+	}
+}
+
+func BenchmarkGetNext(b *testing.B) {
+	for _, numOids := range benchSizes {
+		b.Run(fmt.Sprintf("oids=%d", numOids), func(b *testing.B) {
+			agent := benchAgent(b, numOids)
+			benchRequest(b, agent, snmp.GetNextRequestPdu{
+				Identifier: 1,
+				Variables:  []snmp.Variable{{Name: middleOid(numOids), Value: asn1.Null{}}},
+			})
+		})
+	}
+}
+
+func BenchmarkGetBulk(b *testing.B) {
+	for _, numOids := range benchSizes {
+		b.Run(fmt.Sprintf("oids=%d", numOids), func(b *testing.B) {
+			agent := benchAgent(b, numOids)
+			benchRequest(b, agent, snmp.GetBulkRequestPdu{
+				Identifier:     1,
+				MaxRepetitions: 10,
+				Variables:      []snmp.Variable{{Name: asn1.Oid{1, 3, 6, 1}, Value: asn1.Null{}}},
+			})
+		})
+	}
+}
+
+// BenchmarkStartup is the registration of a program's OIDs with the agent when the server starts
+func BenchmarkStartup(b *testing.B) {
+	for _, numOids := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("oids=%d", numOids), func(b *testing.B) {
+			_, interp := parseTestProgram(b, benchProgram(numOids))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := addProgramOIDs(NewAgent(), interp, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGetValueForOid is the lookup of a GET's type and value by the handlers from the OID of the request
+func BenchmarkGetValueForOid(b *testing.B) {
+	for _, numOids := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("oids=%d", numOids), func(b *testing.B) {
+			_, interp := parseTestProgram(b, benchProgram(numOids))
+			oid := middleOid(numOids)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				typ, found := interp.GetTypeForNumericOid(oid)
+				if !found {
+					b.Fatalf("%s not found", oid)
+				}
+				interp.GetValueForOid(typ.oid)
+			}
+		})
+	}
+}
@@ -0,0 +1,1565 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+// newTestAgent returns an agent serving the OIDs of a program
+func newTestAgent(t testing.TB, progStr string) (*Agent, *Interpreter) {
+	_, interp := parseTestProgram(t, progStr)
+	agent := NewAgent()
+	if err := addProgramOIDs(agent, interp, false); err != nil {
+		t.Fatal(err)
+	}
+	return agent, interp
+}
+
+// request sends a request PDU to the agent and returns the response PDU
+func request(t *testing.T, agent *Agent, version int, community string, pdu interface{}) snmp.GetResponsePdu {
+	msg := snmp.Message{Version: version, Community: []byte(community), Pdu: pdu}
+	reqBuf, err := agent.ctx.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	respBuf, err := agent.ProcessDatagram(reqBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var respMsg snmp.Message
+	_, err = agent.ctx.Decode(respBuf, &respMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, ok := respMsg.Pdu.(snmp.GetResponsePdu)
+	if !ok {
+		t.Fatalf("pdu type = %T, want snmp.GetResponsePdu", respMsg.Pdu)
+	}
+	return resp
+}
+
+func oidVars(t *testing.T, values map[string]interface{}, oidStrs ...string) []snmp.Variable {
+	vars := make([]snmp.Variable, len(oidStrs))
+	for i, oidStr := range oidStrs {
+		oid, err := strToOID(oidStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var value interface{} = asn1.Null{}
+		if v, ok := values[oidStr]; ok {
+			value = v
+		}
+		vars[i] = snmp.Variable{Name: oid, Value: value}
+	}
+	return vars
+}
+
+const agentTestProg = `
+var
+  descr: 2.1.1.1.0 string
+  contact: 2.1.1.4.0 rw string
+  ifNumber: 2.1.2.1.0 integer
+endvar
+run
+  descr = "test agent"
+  ifNumber = 2
+endrun`
+
+func TestAgentGet(t *testing.T) {
+	agent, _ := newTestAgent(t, agentTestProg)
+
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Identifier: 7,
+		Variables: oidVars(t, nil, "1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.1.1", "1.3.6.1.2.1.9.1.0")})
+	if resp.Identifier != 7 || resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("id %d, status %d", resp.Identifier, resp.ErrorStatus)
+	}
+	if _, ok := resp.Variables[1].Value.(snmp.NoSuchInstance); !ok {
+		t.Errorf("missing instance = %T, want snmp.NoSuchInstance", resp.Variables[1].Value)
+	}
+	if _, ok := resp.Variables[2].Value.(snmp.NoSuchObject); !ok {
+		t.Errorf("missing object = %T, want snmp.NoSuchObject", resp.Variables[2].Value)
+	}
+
+	resp = request(t, agent, snmp.V1, "public", snmp.GetRequestPdu{Identifier: 8,
+		Variables: oidVars(t, nil, "1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.2.0")})
+	if resp.ErrorStatus != snmp.NoSuchName || resp.ErrorIndex != 2 {
+		t.Errorf("v1 missing OID: status %d, index %d", resp.ErrorStatus, resp.ErrorIndex)
+	}
+}
+
+func TestAgentRequestInfo(t *testing.T) {
+	agent, _ := newTestAgent(t, agentTestProg)
+	oid := asn1.Oid{1, 3, 6, 1, 4, 1, 99, 1, 0}
+	var setInfo RequestInfo
+	agent.AddRwManagedObject(oid, func(ctx context.Context, oid asn1.Oid) (interface{}, error) {
+		// vary the value by community
+		info, ok := RequestInfoFrom(ctx)
+		if !ok {
+			return nil, errors.New("no request info")
+		}
+		return fmt.Sprintf("%s %d", info.Community, info.Version), nil
+	}, func(ctx context.Context, oid asn1.Oid, value interface{}) (func() error, error) {
+		setInfo, _ = RequestInfoFrom(ctx)
+		return func() error { return nil }, nil
+	})
+
+	for _, community := range []string{"public", "private"} {
+		resp := request(t, agent, snmp.V2C, community, snmp.GetRequestPdu{Variables: []snmp.Variable{{Name: oid}}})
+		if want := fmt.Sprintf("%s %d", community, snmp.V2C); resp.Variables[0].Value != want {
+			t.Errorf("get = %v, want %s", resp.Variables[0].Value, want)
+		}
+	}
+	resp := request(t, agent, snmp.V1, "public", snmp.GetNextRequestPdu{Variables: oidVars(t, nil, "1.3.6.1.4.1.99")})
+	if want := fmt.Sprintf("public %d", snmp.V1); resp.Variables[0].Value != want {
+		t.Errorf("getnext = %v, want %s", resp.Variables[0].Value, want)
+	}
+
+	request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{Identifier: 42,
+		Variables: []snmp.Variable{{Name: oid, Value: "x"}}})
+	if want := (RequestInfo{Version: snmp.V2C, Community: "private", RequestId: 42}); setInfo != want {
+		t.Errorf("set request info %+v, want %+v", setInfo, want)
+	}
+}
+
+func TestAgentLatency(t *testing.T) {
+	agent, _ := newTestAgent(t, `
+var
+  load: 4.1.99.2.0 integer latency 50 msecs
+  name: 4.1.99.3.0 string
+  hosts: 4.1.99.1.1 table {
+    name: 2 string,
+    status: 3 rowstatus
+  } latency 30 msecs
+endvar
+run
+endrun`)
+	timeGet := func(oidStr string) time.Duration {
+		start := time.Now()
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, oidStr)})
+		if resp.ErrorStatus != snmp.NoError {
+			t.Errorf("get %s: status %d", oidStr, resp.ErrorStatus)
+		}
+		return time.Since(start)
+	}
+	if took := timeGet("1.3.6.1.4.1.99.2.0"); took < 50*time.Millisecond {
+		t.Errorf("slow OID answered in %s", took)
+	}
+	if took := timeGet("1.3.6.1.4.1.99.3.0"); took > 30*time.Millisecond {
+		t.Errorf("other OID took %s", took)
+	}
+
+	status, name := "1.3.6.1.4.1.99.1.1.3.7", "1.3.6.1.4.1.99.1.1.2.7"
+	resp := request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{status: RowStatusCreateAndGo}, status)})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("createAndGo: status %d", resp.ErrorStatus)
+	}
+	for _, oidStr := range []string{status, name} {
+		if took := timeGet(oidStr); took < 30*time.Millisecond {
+			t.Errorf("table cell %s answered in %s", oidStr, took)
+		}
+	}
+
+	_, err := NewParser(lex("test", "var\n  x: integer latency 5 secs\nendvar\nrun\nendrun")).ParseProgram()
+	if err == nil || !strings.Contains(err.Error(), "Latency needs an OID") {
+		t.Errorf("latency without an OID: error %v", err)
+	}
+}
+
+func TestAgentErrorIndex(t *testing.T) {
+	agent, _ := newTestAgent(t, agentTestProg)
+	agent.AddRoManagedObject(asn1.Oid{1, 3, 6, 1, 4, 1, 99, 1, 0}, func(ctx context.Context, oid asn1.Oid) (interface{}, error) {
+		return nil, varErrorf(snmp.ResourceUnavailable, "unavailable")
+	})
+	descr, ifNumber := "1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.2.1.0"
+
+	// the middle OID is not defined
+	vars := oidVars(t, nil, descr, "1.3.6.1.2.1.1.2.0", ifNumber)
+	resp := request(t, agent, snmp.V1, "public", snmp.GetRequestPdu{Variables: vars})
+	if resp.ErrorStatus != snmp.NoSuchName || resp.ErrorIndex != 2 || len(resp.Variables) != 3 {
+		t.Errorf("v1: status %d, index %d, %d variables", resp.ErrorStatus, resp.ErrorIndex, len(resp.Variables))
+	}
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: vars})
+	if resp.ErrorStatus != snmp.NoError || resp.ErrorIndex != 0 {
+		t.Errorf("v2c: status %d, index %d", resp.ErrorStatus, resp.ErrorIndex)
+	}
+	if _, ok := resp.Variables[1].Value.(snmp.NoSuchObject); !ok || resp.Variables[2].Value != 0 {
+		t.Errorf("v2c variables = %v, want noSuchObject in the middle", resp.Variables)
+	}
+
+	// the middle OID fails to be read
+	vars = oidVars(t, nil, descr, "1.3.6.1.4.1.99.1.0", ifNumber)
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: vars})
+	if resp.ErrorStatus != snmp.ResourceUnavailable || resp.ErrorIndex != 2 {
+		t.Errorf("v2c failed read: status %d, index %d", resp.ErrorStatus, resp.ErrorIndex)
+	}
+	resp = request(t, agent, snmp.V1, "public", snmp.GetRequestPdu{Variables: vars})
+	if resp.ErrorStatus != snmp.GenErr || resp.ErrorIndex != 2 {
+		t.Errorf("v1 failed read: status %d, index %d", resp.ErrorStatus, resp.ErrorIndex)
+	}
+}
+
+func TestAgentGetNext(t *testing.T) {
+	agent, _ := newTestAgent(t, agentTestProg)
+
+	want := []string{".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.4.0", ".1.3.6.1.2.1.2.1.0"}
+	oid := asn1.Oid{1, 3, 6, 1}
+	for _, w := range want {
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetNextRequestPdu{
+			Variables: []snmp.Variable{{Name: oid, Value: asn1.Null{}}}})
+		oid = resp.Variables[0].Name
+		if oid.String() != w {
+			t.Fatalf("next = %s, want %s", oid, w)
+		}
+	}
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetNextRequestPdu{
+		Variables: []snmp.Variable{{Name: oid, Value: asn1.Null{}}}})
+	if _, ok := resp.Variables[0].Value.(snmp.EndOfMibView); !ok {
+		t.Errorf("after last = %T, want snmp.EndOfMibView", resp.Variables[0].Value)
+	}
+}
+
+func TestAgentGetNextBetween(t *testing.T) {
+	agent, _ := newTestAgent(t, `
+var
+  ifInOctets.[1..3]: 2.1.2.2.1.10 counter
+  ifInOctets-10: 2.1.2.2.1.10.10 counter
+  ifOutOctets-1: 2.1.2.2.1.16.1 counter
+endvar
+run
+endrun`)
+
+	// GETNEXT from OIDs which are not served gets the next one in numeric order
+	tests := []struct {
+		from string
+		want string
+	}{
+		{"1.3.6.1.2.1.2.2.1.10.0", ".1.3.6.1.2.1.2.2.1.10.1"},
+		{"1.3.6.1.2.1.2.2.1.10", ".1.3.6.1.2.1.2.2.1.10.1"},
+		{"1.3.6.1.2.1.2.2.1.10.1.5", ".1.3.6.1.2.1.2.2.1.10.2"},
+		{"1.3.6.1.2.1.2.2.1.10.4", ".1.3.6.1.2.1.2.2.1.10.10"},
+		{"1.3.6.1.2.1.2.2.1.10.9.99", ".1.3.6.1.2.1.2.2.1.10.10"},
+		{"1.3.6.1.2.1.2.2.1.11", ".1.3.6.1.2.1.2.2.1.16.1"},
+		{"1.3.6.1.2.1.2.2.1.1.999", ".1.3.6.1.2.1.2.2.1.10.1"},
+		{"1.3.6.1.2.1.2.2.1.16.0", ".1.3.6.1.2.1.2.2.1.16.1"},
+	}
+	for _, test := range tests {
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetNextRequestPdu{Variables: oidVars(t, nil, test.from)})
+		if got := resp.Variables[0].Name.String(); got != test.want {
+			t.Errorf("next of %s = %s, want %s", test.from, got, test.want)
+		}
+	}
+
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetNextRequestPdu{Variables: oidVars(t, nil, "1.3.6.1.2.1.2.2.1.16.1.1")})
+	if _, ok := resp.Variables[0].Value.(snmp.EndOfMibView); !ok {
+		t.Errorf("after last = %T, want snmp.EndOfMibView", resp.Variables[0].Value)
+	}
+}
+
+func TestAgentGetNextHoles(t *testing.T) {
+	agent, interp := newTestAgent(t, `
+var
+  ifDescr-1: 2.1.2.2.1.2.1 string = "eth1"
+  ifDescr-2: 2.1.2.2.1.2.2 string = "eth2"
+  ifDescr-5: 2.1.2.2.1.2.5 string = "eth5"
+  ifDescr-10: 2.1.2.2.1.2.10 string = "eth10"
+  ifDescr-12: 2.1.2.2.1.2.12 string = "eth12"
+  ifMtu-1: 2.1.2.2.1.4.1 integer = 1500
+  ifMtu-10: 2.1.2.2.1.4.10 integer = 9000
+endvar
+run
+endrun`)
+
+	// a row going away while it is walked leaves its objects without values
+	interp.valLock.Lock()
+	delete(interp.oid2Values, ".1.3.6.1.2.1.2.2.1.2.10")
+	interp.valLock.Unlock()
+
+	want := []string{
+		".1.3.6.1.2.1.2.2.1.2.1", ".1.3.6.1.2.1.2.2.1.2.2", ".1.3.6.1.2.1.2.2.1.2.5", ".1.3.6.1.2.1.2.2.1.2.12",
+		".1.3.6.1.2.1.2.2.1.4.1", ".1.3.6.1.2.1.2.2.1.4.10",
+	}
+	oid := asn1.Oid{1, 3, 6, 1, 2, 1, 2, 2}
+	for _, w := range want {
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetNextRequestPdu{
+			Variables: []snmp.Variable{{Name: oid, Value: asn1.Null{}}}})
+		if resp.ErrorStatus != snmp.NoError {
+			t.Fatalf("next of %s: status %d, want %s", oid, resp.ErrorStatus, w)
+		}
+		oid = resp.Variables[0].Name
+		if oid.String() != w {
+			t.Fatalf("next = %s, want %s", oid, w)
+		}
+		switch resp.Variables[0].Value.(type) {
+		case snmp.NoSuchInstance, snmp.NoSuchObject:
+			t.Errorf("%s = %T mid-walk", oid, resp.Variables[0].Value)
+		}
+	}
+
+	// the hole is skipped from any OID before it, including one in the gap
+	for _, from := range []string{"1.3.6.1.2.1.2.2.1.2.5", "1.3.6.1.2.1.2.2.1.2.7"} {
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetNextRequestPdu{Variables: oidVars(t, nil, from)})
+		if got := resp.Variables[0].Name.String(); got != ".1.3.6.1.2.1.2.2.1.2.12" {
+			t.Errorf("next of %s = %s, want .1.3.6.1.2.1.2.2.1.2.12", from, got)
+		}
+	}
+}
+
+func TestAgentGetHole(t *testing.T) {
+	agent, interp := newTestAgent(t, `
+var
+  ifDescr-1: 2.1.2.2.1.2.1 string = "eth1"
+  ifDescr-2: 2.1.2.2.1.2.2 string = "eth2"
+endvar
+run
+endrun`)
+	interp.valLock.Lock()
+	delete(interp.oid2Values, ".1.3.6.1.2.1.2.2.1.2.2")
+	interp.valLock.Unlock()
+
+	vars := oidVars(t, nil, "1.3.6.1.2.1.2.2.1.2.1", "1.3.6.1.2.1.2.2.1.2.2")
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: vars})
+	if resp.ErrorStatus != snmp.NoError || resp.ErrorIndex != 0 {
+		t.Fatalf("v2c: status %d, index %d", resp.ErrorStatus, resp.ErrorIndex)
+	}
+	if _, ok := resp.Variables[1].Value.(snmp.NoSuchInstance); !ok || resp.Variables[0].Value != "eth1" {
+		t.Errorf("v2c variables = %v, want noSuchInstance for the hole", resp.Variables)
+	}
+
+	resp = request(t, agent, snmp.V1, "public", snmp.GetRequestPdu{Variables: vars})
+	if resp.ErrorStatus != snmp.NoSuchName || resp.ErrorIndex != 2 || len(resp.Variables) != 2 {
+		t.Errorf("v1: status %d, index %d, %d variables", resp.ErrorStatus, resp.ErrorIndex, len(resp.Variables))
+	}
+}
+
+func TestAgentScalarLeniency(t *testing.T) {
+	prog := `
+var
+  sysName: 2.1.1.5.0 string = "router"
+endvar
+run
+endrun`
+	scalar := oidVars(t, nil, "1.3.6.1.2.1.1.5")
+	for _, lenient := range []bool{false, true} {
+		agent, _ := newTestAgent(t, prog)
+		agent.SetScalarLeniency(lenient)
+
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: scalar})
+		v := resp.Variables[0]
+		if lenient {
+			if v.Name.String() != ".1.3.6.1.2.1.1.5.0" || v.Value != "router" {
+				t.Errorf("lenient get = %s %v, want sysName.0", v.Name, v.Value)
+			}
+		} else if _, ok := v.Value.(snmp.NoSuchInstance); !ok {
+			t.Errorf("strict get = %s %v, want noSuchInstance", v.Name, v.Value)
+		}
+
+		resp = request(t, agent, snmp.V1, "public", snmp.GetRequestPdu{Variables: scalar})
+		if lenient && (resp.ErrorStatus != snmp.NoError || resp.Variables[0].Value != "router") {
+			t.Errorf("lenient v1 get: status %d, variables %v", resp.ErrorStatus, resp.Variables)
+		} else if !lenient && resp.ErrorStatus != snmp.NoSuchName {
+			t.Errorf("strict v1 get: status %d, want noSuchName", resp.ErrorStatus)
+		}
+
+		// the next OID after the scalar is its instance in both modes
+		resp = request(t, agent, snmp.V2C, "public", snmp.GetNextRequestPdu{Variables: scalar})
+		if v := resp.Variables[0]; v.Name.String() != ".1.3.6.1.2.1.1.5.0" || v.Value != "router" {
+			t.Errorf("lenient %t getnext = %s %v, want sysName.0", lenient, v.Name, v.Value)
+		}
+	}
+}
+
+func TestAgentResponseCommunity(t *testing.T) {
+	agent, _ := newTestAgent(t, agentTestProg)
+	responseCommunity := func() string {
+		reqBuf, err := agent.ctx.Encode(snmp.Message{Version: snmp.V2C, Community: []byte("public"),
+			Pdu: snmp.GetRequestPdu{Variables: oidVars(t, nil, "1.3.6.1.2.1.1.1.0")}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		respBuf, err := agent.ProcessDatagram(reqBuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var respMsg snmp.Message
+		if _, err = agent.ctx.Decode(respBuf, &respMsg); err != nil {
+			t.Fatal(err)
+		}
+		return string(respMsg.Community)
+	}
+
+	if got := responseCommunity(); got != "public" {
+		t.Errorf("community = %s, want the request's", got)
+	}
+	agent.SetResponseCommunity("quirky")
+	if got := responseCommunity(); got != "quirky" {
+		t.Errorf("community = %s, want quirky", got)
+	}
+}
+
+func TestAgentGetBulk(t *testing.T) {
+	agent, _ := newTestAgent(t, `
+var
+  descr: 2.1.1.1.0 string = "bulk"
+  name: 2.1.1.5.0 string = "router"
+  ifNumber: 2.1.2.1.0 integer = 3
+  ifDescr.[1..3]: 2.1.2.2.1.2 string = "eth%d"
+  ifMtu.[1..3]: 2.1.2.2.1.4 integer = 1500
+endvar
+run
+endrun`)
+
+	tests := []struct {
+		nonRepeaters   int
+		maxRepetitions int
+		oids           []string
+		want           []string // OIDs of the response, - for endOfMibView
+	}{
+		// the scalars get one successor each, then the two columns a row at a time, running off the end of
+		// ifDescr into ifMtu and ifMtu off the end of the MIB with endOfMibView
+		{2, 5, []string{"1.3.6.1.2.1.1.1", "1.3.6.1.2.1.1.5.0", "1.3.6.1.2.1.2.2.1.2", "1.3.6.1.2.1.2.2.1.4"}, []string{
+			".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.2.1.0",
+			".1.3.6.1.2.1.2.2.1.2.1", ".1.3.6.1.2.1.2.2.1.4.1",
+			".1.3.6.1.2.1.2.2.1.2.2", ".1.3.6.1.2.1.2.2.1.4.2",
+			".1.3.6.1.2.1.2.2.1.2.3", ".1.3.6.1.2.1.2.2.1.4.3",
+			".1.3.6.1.2.1.2.2.1.4.1", "-",
+			".1.3.6.1.2.1.2.2.1.4.2", "-",
+		}},
+		// no repetitions leaves only the non-repeaters
+		{2, 0, []string{"1.3.6.1.2.1.1.1", "1.3.6.1.2.1.1.5.0", "1.3.6.1.2.1.2.2.1.2"}, []string{
+			".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.2.1.0",
+		}},
+		// more non-repeaters than variables and a negative count are clamped
+		{5, 3, []string{"1.3.6.1.2.1.2.1.0"}, []string{".1.3.6.1.2.1.2.2.1.2.1"}},
+		{-1, 2, []string{"1.3.6.1.2.1.2.2.1.4.2"}, []string{".1.3.6.1.2.1.2.2.1.4.3", "-"}},
+		// the rows stop once every repeater is at the end of the MIB
+		{0, 10, []string{"1.3.6.1.2.1.2.2.1.4.3"}, []string{"-"}},
+	}
+	for _, test := range tests {
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetBulkRequestPdu{
+			NonRepeaters: test.nonRepeaters, MaxRepetitions: test.maxRepetitions, Variables: oidVars(t, nil, test.oids...)})
+		if resp.ErrorStatus != snmp.NoError {
+			t.Errorf("non-repeaters %d, max-repetitions %d: status %d", test.nonRepeaters, test.maxRepetitions, resp.ErrorStatus)
+			continue
+		}
+		got := make([]string, len(resp.Variables))
+		for i, v := range resp.Variables {
+			got[i] = v.Name.String()
+			if _, ok := v.Value.(snmp.EndOfMibView); ok {
+				got[i] = "-"
+			}
+		}
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("non-repeaters %d, max-repetitions %d of %v:\n got %v\nwant %v",
+				test.nonRepeaters, test.maxRepetitions, test.oids, got, test.want)
+		}
+	}
+}
+
+func TestAgentSet(t *testing.T) {
+	agent, interp := newTestAgent(t, agentTestProg)
+
+	contact := "1.3.6.1.2.1.1.4.0"
+	resp := request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{contact: "ops"}, contact)})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("set status %d", resp.ErrorStatus)
+	}
+	val, _ := interp.GetValueForId("contact")
+	if val.stringVal != "ops" {
+		t.Errorf("contact = %v, want ops", val)
+	}
+
+	descr := "1.3.6.1.2.1.1.1.0"
+	resp = request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{contact: "x", descr: "x"}, contact, descr)})
+	if resp.ErrorStatus != snmp.NotWritable || resp.ErrorIndex != 2 {
+		t.Errorf("set read-only: status %d, index %d", resp.ErrorStatus, resp.ErrorIndex)
+	}
+	val, _ = interp.GetValueForId("contact")
+	if val.stringVal != "ops" {
+		t.Errorf("contact = %v, want unchanged on failed set", val)
+	}
+}
+
+func TestAgentSetAtomic(t *testing.T) {
+	agent, interp := newTestAgent(t, `
+var
+  level: 4.1.99.1.0 rw integer(1..10)
+  limit: 4.1.99.2.0 rw integer(1..10)
+endvar
+run
+endrun`)
+	level, limit := "1.3.6.1.4.1.99.1.0", "1.3.6.1.4.1.99.2.0"
+	for _, value := range []interface{}{"high", 11} {
+		resp := request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+			Variables: oidVars(t, map[string]interface{}{level: 5, limit: value}, level, limit)})
+		if resp.ErrorStatus == snmp.NoError || resp.ErrorIndex != 2 {
+			t.Errorf("set limit %v: status %d, index %d", value, resp.ErrorStatus, resp.ErrorIndex)
+		}
+		// nothing is set unless every variable can be
+		val, _ := interp.GetValueForId("level")
+		if val.intVal != 0 {
+			t.Errorf("level = %v after a failed set of limit %v, want unchanged", val, value)
+		}
+	}
+}
+
+func TestSetErrorStatus(t *testing.T) {
+	agent, interp := newTestAgent(t, `
+var
+  name: 2.1.1.5.0 rw string(8)
+  level: 4.1.99.1.0 rw integer(1..10)
+  offset: 4.1.99.2.0 rw integer(-5..-1)
+  uptime: 2.1.1.3.0 timeticks
+endvar
+run
+endrun`)
+
+	tests := []struct {
+		oid    string
+		value  interface{}
+		status int
+		v1     int
+	}{
+		{"1.3.6.1.2.1.1.5.0", 42, snmp.WrongType, snmp.BadValue},
+		{"1.3.6.1.2.1.1.5.0", "too long a name", snmp.WrongLength, snmp.BadValue},
+		{"1.3.6.1.2.1.1.5.0", "router", snmp.NoError, snmp.NoError},
+		{"1.3.6.1.4.1.99.1.0", "5", snmp.WrongType, snmp.BadValue},
+		{"1.3.6.1.4.1.99.1.0", 11, snmp.WrongValue, snmp.BadValue},
+		{"1.3.6.1.4.1.99.1.0", 0, snmp.WrongValue, snmp.BadValue},
+		{"1.3.6.1.4.1.99.1.0", 10, snmp.NoError, snmp.NoError},
+		{"1.3.6.1.4.1.99.2.0", 0, snmp.WrongValue, snmp.BadValue},
+		{"1.3.6.1.4.1.99.2.0", -5, snmp.NoError, snmp.NoError},
+		{"1.3.6.1.2.1.1.3.0", snmp.TimeTicks(5), snmp.NotWritable, snmp.NoSuchName},
+	}
+	for _, test := range tests {
+		for _, version := range []int{snmp.V2C, snmp.V1} {
+			want := test.status
+			if version == snmp.V1 {
+				want = test.v1
+			}
+			resp := request(t, agent, version, "private", snmp.SetRequestPdu{
+				Variables: oidVars(t, map[string]interface{}{test.oid: test.value}, test.oid)})
+			if resp.ErrorStatus != want {
+				t.Errorf("v%d set %s = %v: status %d, want %d", version+1, test.oid, test.value, resp.ErrorStatus, want)
+			}
+		}
+	}
+	if val, _ := interp.GetValueForId("level"); val.intVal != 10 {
+		t.Errorf("level = %d, want 10", val.intVal)
+	}
+
+	for _, decl := range []string{"x: 2.1.1 integer(10..1)", "x: 2.1.1 integer(1..)", "x: 2.1.1 integer(1)"} {
+		_, err := NewParser(lex("test", "var\n  "+decl+"\nendvar\nrun\nendrun")).ParseProgram()
+		if err == nil {
+			t.Errorf("%s: no error", decl)
+		}
+	}
+}
+
+func TestAgentMixedVersions(t *testing.T) {
+	agent, _ := newTestAgent(t, `
+var
+  descr: 2.1.1.1.0 string
+  hc-in-octets: 2.1.31.1.1.1.6.1 counter64
+  hc-out-octets: 2.1.31.1.1.1.10.1 counter64
+  alias: 2.1.31.1.1.1.18.1 string
+endvar
+run
+endrun`)
+	hcIn := "1.3.6.1.2.1.31.1.1.1.6.1"
+
+	// both versions are answered by the same agent
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, hcIn)})
+	if resp.ErrorStatus != snmp.NoError || resp.Variables[0].Value != snmp.Counter64(0) {
+		t.Errorf("v2c get counter64: status %d value %v", resp.ErrorStatus, resp.Variables[0].Value)
+	}
+	resp = request(t, agent, snmp.V1, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, "1.3.6.1.2.1.1.1.0", hcIn)})
+	if resp.ErrorStatus != snmp.NoSuchName || resp.ErrorIndex != 2 {
+		t.Errorf("v1 get counter64: status %d index %d, want noSuchName at 2", resp.ErrorStatus, resp.ErrorIndex)
+	}
+
+	// v1 walks skip the counter64 objects
+	resp = request(t, agent, snmp.V1, "public", snmp.GetNextRequestPdu{Variables: oidVars(t, nil, "1.3.6.1.2.1.31")})
+	if got := resp.Variables[0].Name.String(); got != ".1.3.6.1.2.1.31.1.1.1.18.1" {
+		t.Errorf("v1 next = %s, want the alias", got)
+	}
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetNextRequestPdu{Variables: oidVars(t, nil, "1.3.6.1.2.1.31")})
+	if got := resp.Variables[0].Name.String(); got != "."+hcIn {
+		t.Errorf("v2c next = %s, want %s", got, hcIn)
+	}
+
+	// there is no GetBulk in v1
+	msg := snmp.Message{Version: snmp.V1, Community: []byte("public"),
+		Pdu: snmp.GetBulkRequestPdu{MaxRepetitions: 2, Variables: oidVars(t, nil, "1.3.6.1.2.1.1")}}
+	reqBuf, err := agent.ctx.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.ProcessDatagram(reqBuf); err == nil {
+		t.Errorf("v1 GetBulk was answered")
+	}
+}
+
+func TestAgentUnsupportedPdu(t *testing.T) {
+	agent, _ := newTestAgent(t, agentTestProg)
+	process := func(version int, pdu interface{}) ([]byte, error) {
+		reqBuf, err := agent.ctx.Encode(snmp.Message{Version: version, Community: []byte("public"), Pdu: pdu})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent.ProcessDatagram(reqBuf)
+	}
+	inform := snmp.InformRequestPdu{Identifier: 5, Variables: oidVars(t, nil, "1.3.6.1.2.1.1.3.0")}
+
+	pdus := []interface{}{inform, snmp.V2TrapPdu{Identifier: 6}, snmp.GetResponsePdu{Identifier: 7}}
+	for _, pdu := range pdus {
+		if _, err := process(snmp.V2C, pdu); !errors.Is(err, errUnsupportedPdu) {
+			t.Errorf("%T: error = %v, want dropped as unsupported", pdu, err)
+		}
+	}
+
+	agent.SetUnsupportedPduStatus(snmp.GenErr)
+	respBuf, err := process(snmp.V2C, inform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var respMsg snmp.Message
+	if _, err = agent.ctx.Decode(respBuf, &respMsg); err != nil {
+		t.Fatal(err)
+	}
+	resp := respMsg.Pdu.(snmp.GetResponsePdu)
+	if resp.Identifier != 5 || resp.ErrorStatus != snmp.GenErr || len(resp.Variables) != 1 {
+		t.Errorf("inform response: id %d, status %d, %d variables", resp.Identifier, resp.ErrorStatus, len(resp.Variables))
+	}
+	if _, err := process(snmp.V2C, snmp.V2TrapPdu{Identifier: 6}); !errors.Is(err, errUnsupportedPdu) {
+		t.Errorf("trap error = %v, want it still dropped", err)
+	}
+}
+
+func TestAgentReadOnly(t *testing.T) {
+	agent, interp := newTestAgent(t, agentTestProg)
+	agent.SetReadOnly(true)
+
+	contact := "1.3.6.1.2.1.1.4.0"
+	resp := request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{contact: "ops"}, contact)})
+	if resp.ErrorStatus != snmp.NotWritable || resp.ErrorIndex != 1 {
+		t.Errorf("v2c set: status %d, index %d, want notWritable", resp.ErrorStatus, resp.ErrorIndex)
+	}
+	resp = request(t, agent, snmp.V1, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{contact: "ops"}, contact)})
+	if resp.ErrorStatus != snmp.ReadOnly {
+		t.Errorf("v1 set: status %d, want readOnly", resp.ErrorStatus)
+	}
+	if val, _ := interp.GetValueForId("contact"); val.stringVal != "" {
+		t.Errorf("contact = %v, want unchanged", val)
+	}
+
+	// gets are still answered
+	resp = request(t, agent, snmp.V2C, "private", snmp.GetRequestPdu{Variables: oidVars(t, nil, contact)})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Errorf("get status %d", resp.ErrorStatus)
+	}
+}
+
+func TestAgentCommunities(t *testing.T) {
+	agent, interp := newTestAgent(t, agentTestProg)
+	agent.SetCommunities("ro", "rw")
+
+	contact := "1.3.6.1.2.1.1.4.0"
+	get := snmp.GetRequestPdu{Variables: oidVars(t, nil, contact)}
+	set := func(value string) snmp.SetRequestPdu {
+		return snmp.SetRequestPdu{Variables: oidVars(t, map[string]interface{}{contact: value}, contact)}
+	}
+	for _, community := range []string{"ro", "rw"} {
+		if resp := request(t, agent, snmp.V2C, community, get); resp.ErrorStatus != snmp.NoError {
+			t.Errorf("get with %s: status %d", community, resp.ErrorStatus)
+		}
+	}
+
+	resp := request(t, agent, snmp.V2C, "ro", set("ro"))
+	if resp.ErrorStatus != snmp.NoAccess || resp.ErrorIndex != 1 {
+		t.Errorf("v2c set with ro: status %d, index %d, want noAccess", resp.ErrorStatus, resp.ErrorIndex)
+	}
+	resp = request(t, agent, snmp.V1, "ro", set("ro"))
+	if resp.ErrorStatus != snmp.NoSuchName || resp.ErrorIndex != 1 {
+		t.Errorf("v1 set with ro: status %d, index %d, want noSuchName", resp.ErrorStatus, resp.ErrorIndex)
+	}
+	if val, _ := interp.GetValueForId("contact"); val.stringVal != "" {
+		t.Errorf("contact = %v after sets with ro, want unchanged", val)
+	}
+
+	resp = request(t, agent, snmp.V2C, "rw", set("rw"))
+	if resp.ErrorStatus != snmp.NoError {
+		t.Errorf("set with rw: status %d", resp.ErrorStatus)
+	}
+	if val, _ := interp.GetValueForId("contact"); val.stringVal != "rw" {
+		t.Errorf("contact = %v, want rw", val)
+	}
+
+	// the default communities no longer work
+	reqBuf, err := agent.ctx.Encode(snmp.Message{Version: snmp.V2C, Community: []byte("public"), Pdu: get})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.ProcessDatagram(reqBuf); !errors.Is(err, errBadCommunity) {
+		t.Errorf("get with public: error %v, want a bad community", err)
+	}
+}
+
+func TestWritableUntil(t *testing.T) {
+	agent, interp := newTestAgent(t, `
+var
+  password: 4.1.99.6.0 string writable until 30 secs
+endvar
+run
+endrun`)
+	password := "1.3.6.1.4.1.99.6.0"
+	set := func(value string) snmp.GetResponsePdu {
+		return request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+			Variables: oidVars(t, map[string]interface{}{password: value}, password)})
+	}
+	if resp := set("first"); resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("set in the window: status %d", resp.ErrorStatus)
+	}
+
+	interp.valLock.Lock()
+	interp.startTime = time.Now().Add(-time.Minute)
+	interp.valLock.Unlock()
+	if resp := set("second"); resp.ErrorStatus != snmp.NotWritable || resp.ErrorIndex != 1 {
+		t.Errorf("set after the window: status %d, index %d, want notWritable", resp.ErrorStatus, resp.ErrorIndex)
+	}
+	if val, _ := interp.GetValueForId("password"); val.stringVal != "first" {
+		t.Errorf("password = %v, want first", val)
+	}
+
+	// a reboot opens the window again
+	interp.reboot()
+	if resp := set("third"); resp.ErrorStatus != snmp.NoError {
+		t.Errorf("set after a reboot: status %d", resp.ErrorStatus)
+	}
+
+	for _, decl := range []string{
+		"n: integer writable until 30 secs",
+		"n: 4.1.99.7.0 counter writable until 30 secs",
+		"n: 4.1.99.7.0 integer writable 30 secs",
+		"n: 4.1.99.7.0 integer writable until 0 secs",
+	} {
+		_, err := Parse("writable", "var\n  "+decl+"\nendvar\nrun\nendrun")
+		if err == nil || !strings.Contains(strings.ToLower(err.Error()), "writable") {
+			t.Errorf("%s: error %v", decl, err)
+		}
+	}
+}
+
+func TestAgentRowCreation(t *testing.T) {
+	prog := `
+var
+  hosts: 4.1.99.1.1 table {
+    name: 2 string,
+    status: 3 rowstatus
+  }
+endvar
+run
+endrun`
+	agent, interp := newTestAgent(t, prog)
+
+	status := "1.3.6.1.4.1.99.1.1.3.7"
+	name := "1.3.6.1.4.1.99.1.1.2.7"
+
+	// can not set a column of a row that does not exist until it is created
+	resp := request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{name: "server"}, name)})
+	if resp.ErrorStatus != snmp.InconsistentName {
+		t.Errorf("set of missing row: status %d, want inconsistentName", resp.ErrorStatus)
+	}
+
+	resp = request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{status: RowStatusCreateAndGo, name: "server"}, status, name)})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("createAndGo: status %d, index %d", resp.ErrorStatus, resp.ErrorIndex)
+	}
+	val, found := interp.GetValueForOid("." + name)
+	if !found || val.stringVal != "server" {
+		t.Errorf("name = %v, want server", val)
+	}
+
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, status)})
+	if resp.Variables[0].Value != RowStatusActive {
+		t.Errorf("row status = %v, want active", resp.Variables[0].Value)
+	}
+
+	resp = request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{status: RowStatusCreateAndWait}, status)})
+	if resp.ErrorStatus != snmp.InconsistentValue {
+		t.Errorf("create existing row: status %d, want inconsistentValue", resp.ErrorStatus)
+	}
+
+	resp = request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{status: RowStatusDestroy}, status)})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("destroy: status %d", resp.ErrorStatus)
+	}
+	if _, found := interp.GetValueForOid("." + name); found {
+		t.Error("name still exists after destroy")
+	}
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, name)})
+	if _, ok := resp.Variables[0].Value.(snmp.NoSuchObject); !ok {
+		t.Errorf("destroyed cell = %T, want snmp.NoSuchObject", resp.Variables[0].Value)
+	}
+}
+
+func TestAgentRowCreationAtomic(t *testing.T) {
+	agent, interp := newTestAgent(t, `
+var
+  level: 4.1.99.2.0 rw integer(1..10)
+  hosts: 4.1.99.1.1 table {
+    name: 2 string,
+    status: 3 rowstatus
+  }
+endvar
+run
+endrun`)
+	status, name, level := "1.3.6.1.4.1.99.1.1.3.7", "1.3.6.1.4.1.99.1.1.2.7", "1.3.6.1.4.1.99.2.0"
+
+	// a later variable which can not be set leaves no row behind
+	for _, test := range []struct {
+		values map[string]interface{}
+		oids   []string
+		want   int
+		index  int
+	}{
+		{map[string]interface{}{status: RowStatusCreateAndGo, name: 42}, []string{status, name}, snmp.WrongType, 2},
+		{map[string]interface{}{status: RowStatusCreateAndGo, level: 11}, []string{status, level}, snmp.WrongValue, 2},
+		{map[string]interface{}{status: RowStatusCreateAndGo}, []string{status, status}, snmp.InconsistentValue, 1},
+	} {
+		resp := request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{Variables: oidVars(t, test.values, test.oids...)})
+		if resp.ErrorStatus != test.want || resp.ErrorIndex != test.index {
+			t.Errorf("set of %v: status %d, index %d, want %d at %d", test.values, resp.ErrorStatus, resp.ErrorIndex, test.want, test.index)
+		}
+		if _, found := interp.GetValueForOid("." + status); found {
+			t.Fatalf("set of %v created the row", test.values)
+		}
+		resp = request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, status)})
+		if _, ok := resp.Variables[0].Value.(snmp.NoSuchObject); !ok {
+			t.Errorf("after set of %v the row status is %v, want snmp.NoSuchObject", test.values, resp.Variables[0].Value)
+		}
+	}
+
+	// a column before the RowStatus which creates its row
+	resp := request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{name: "server", status: RowStatusCreateAndWait}, name, status)})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("createAndWait after the name: status %d, index %d", resp.ErrorStatus, resp.ErrorIndex)
+	}
+	if val, _ := interp.GetValueForOid("." + name); val == nil || val.stringVal != "server" {
+		t.Errorf("name = %v, want server", val)
+	}
+	if val, _ := interp.GetValueForOid("." + status); val == nil || val.intVal != RowStatusNotInService {
+		t.Errorf("status = %v, want notInService", val)
+	}
+}
+
+func TestAgentSetMissingInstance(t *testing.T) {
+	agent, interp := newTestAgent(t, `
+var
+  sys-name: 2.1.1.5.0 rw string = "router"
+  spare: 4.1.99.2.0 rw integer absent
+  hosts: 4.1.99.1.1 table {
+    name: 2 string,
+    status: 3 rowstatus
+  }
+endvar
+run
+endrun`)
+	tests := []struct {
+		name   string
+		values map[string]interface{}
+		oids   []string
+		status int
+		index  int
+	}{
+		{"scalar instance", map[string]interface{}{"1.3.6.1.2.1.1.5.1": "x"}, []string{"1.3.6.1.2.1.1.5.1"}, snmp.NoCreation, 1},
+		{"under a scalar", map[string]interface{}{"1.3.6.1.2.1.1.5.0.1": "x"}, []string{"1.3.6.1.2.1.1.5.0.1"}, snmp.NoCreation, 1},
+		{"absent variable", map[string]interface{}{"1.3.6.1.4.1.99.2.0": 1}, []string{"1.3.6.1.4.1.99.2.0"}, snmp.InconsistentName, 1},
+		{"not a column", map[string]interface{}{"1.3.6.1.4.1.99.1.1.9.7": 1}, []string{"1.3.6.1.4.1.99.1.1.9.7"}, snmp.NoCreation, 1},
+		{"column of a missing row", map[string]interface{}{"1.3.6.1.2.1.1.5.0": "y", "1.3.6.1.4.1.99.1.1.2.7": "server"},
+			[]string{"1.3.6.1.2.1.1.5.0", "1.3.6.1.4.1.99.1.1.2.7"}, snmp.InconsistentName, 2},
+	}
+	for _, test := range tests {
+		resp := request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{Variables: oidVars(t, test.values, test.oids...)})
+		if resp.ErrorStatus != test.status || resp.ErrorIndex != test.index {
+			t.Errorf("%s: status %d index %d, want %d at %d", test.name, resp.ErrorStatus, resp.ErrorIndex, test.status, test.index)
+		}
+		// v1 has neither
+		resp = request(t, agent, snmp.V1, "private", snmp.SetRequestPdu{Variables: oidVars(t, test.values, test.oids...)})
+		if resp.ErrorStatus != snmp.NoSuchName {
+			t.Errorf("%s: v1 status %d, want noSuchName", test.name, resp.ErrorStatus)
+		}
+	}
+	if val, _ := interp.GetValueForId("sys-name"); val.stringVal != "router" {
+		t.Errorf("sys-name = %s, want router as the SET failed", val.stringVal)
+	}
+
+	// a read-create column before the RowStatus which creates its row
+	name, status := "1.3.6.1.4.1.99.1.1.2.7", "1.3.6.1.4.1.99.1.1.3.7"
+	resp := request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{name: "server", status: RowStatusCreateAndGo}, name, status)})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("column then createAndGo: status %d index %d", resp.ErrorStatus, resp.ErrorIndex)
+	}
+	if val, found := interp.GetValueForOid("." + name); !found || val.stringVal != "server" {
+		t.Errorf("name = %v, want server", val)
+	}
+}
+
+func TestCountOf(t *testing.T) {
+	agent, _ := newTestAgent(t, `
+var
+  ifNumber: 2.1.2.1.0 integer count-of ifDescr
+  host-count: 4.1.99.2.0 guage count-of hosts
+  ifDescr.[1..3]: 2.1.2.2.1.2 string = "eth%d"
+  hosts: 4.1.99.1.1 table {
+    name: 2 string,
+    status: 3 rowstatus
+  }
+endvar
+run
+endrun`)
+	counts := func() []interface{} {
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{
+			Variables: oidVars(t, nil, "1.3.6.1.2.1.2.1.0", "1.3.6.1.4.1.99.2.0")})
+		return []interface{}{resp.Variables[0].Value, resp.Variables[1].Value}
+	}
+	setStatus := func(index int, status int) {
+		oidStr := fmt.Sprintf("1.3.6.1.4.1.99.1.1.3.%d", index)
+		resp := request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+			Variables: oidVars(t, map[string]interface{}{oidStr: status}, oidStr)})
+		if resp.ErrorStatus != snmp.NoError {
+			t.Fatalf("set status of row %d: %d", index, resp.ErrorStatus)
+		}
+	}
+
+	if got := counts(); got[0] != 3 || got[1] != snmp.Unsigned32(0) {
+		t.Errorf("counts = %v, want 3 instances and no rows", got)
+	}
+	setStatus(4, RowStatusCreateAndGo)
+	setStatus(9, RowStatusCreateAndWait)
+	if got := counts(); got[1] != snmp.Unsigned32(2) {
+		t.Errorf("rows = %v after creating 2", got[1])
+	}
+	setStatus(4, RowStatusDestroy)
+	if got := counts(); got[1] != snmp.Unsigned32(1) {
+		t.Errorf("rows = %v after destroying 1", got[1])
+	}
+
+	for _, decl := range []string{
+		"n: 2.1.2.1.0 integer count-of nothing",
+		"n: 2.1.2.1.0 string count-of ifDescr",
+		"n: 2.1.2.1.0 rw integer count-of ifDescr",
+		"n: integer count-of ifDescr",
+	} {
+		_, err := Parse("count-of", "var\n  ifDescr.[1..2]: 2.1.2.2.1.2 string\n  "+decl+"\nendvar\nrun\nendrun")
+		if err == nil || !strings.Contains(err.Error(), "count-of") {
+			t.Errorf("%s: error %v", decl, err)
+		}
+	}
+}
+
+func TestAppear(t *testing.T) {
+	program, interp := parseTestProgram(t, `
+var
+  descr: 2.1.1.1.0 string = "chassis"
+  module-temp: 4.1.99.5.0 integer absent
+  ifDescr.[1..2]: 2.1.2.2.1.2 string absent = "eth%d"
+endvar
+run
+  module-temp = 41
+  appear module-temp
+  appear ifDescr
+  disappear descr
+endrun`)
+	agent := NewAgent()
+	if err := addProgramOIDs(agent, interp, false); err != nil {
+		t.Fatal(err)
+	}
+	walk := func() []string {
+		var oids []string
+		oid := asn1.Oid{1, 3, 6, 1}
+		for {
+			resp := request(t, agent, snmp.V2C, "public", snmp.GetNextRequestPdu{
+				Variables: []snmp.Variable{{Name: oid, Value: asn1.Null{}}}})
+			if _, ok := resp.Variables[0].Value.(snmp.EndOfMibView); ok {
+				return oids
+			}
+			oid = resp.Variables[0].Name
+			oids = append(oids, oid.String())
+		}
+	}
+	initial := ".1.3.6.1.2.1.1.1.0"
+	if got := strings.Join(walk(), " "); got != initial {
+		t.Errorf("walk before appear = %s, want %s", got, initial)
+	}
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, "1.3.6.1.4.1.99.5.0")})
+	if _, ok := resp.Variables[0].Value.(snmp.NoSuchObject); !ok {
+		t.Errorf("absent = %T, want snmp.NoSuchObject", resp.Variables[0].Value)
+	}
+
+	if err := interp.InterpProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	want := ".1.3.6.1.2.1.2.2.1.2.1 .1.3.6.1.2.1.2.2.1.2.2 .1.3.6.1.4.1.99.5.0"
+	if got := strings.Join(walk(), " "); got != want {
+		t.Errorf("walk after appear = %s, want %s", got, want)
+	}
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, "1.3.6.1.4.1.99.5.0", "1.3.6.1.2.1.2.2.1.2.2")})
+	if resp.Variables[0].Value != 41 || resp.Variables[1].Value != "eth2" {
+		t.Errorf("appeared = %v, %v, want 41 and eth2", resp.Variables[0].Value, resp.Variables[1].Value)
+	}
+
+	// a reset goes back to the OIDs at the start
+	server := &SNMPServer{agent: agent}
+	server.reset(interp)
+	if got := strings.Join(walk(), " "); got != initial {
+		t.Errorf("walk after reset = %s, want %s", got, initial)
+	}
+
+	for _, stmt := range []string{"appear nothing", "disappear"} {
+		_, err := Parse("appear", "var\n  x: 2.1.1.1.0 integer absent\nendvar\nrun\n  "+stmt+"\nendrun")
+		if err == nil {
+			t.Errorf("%s: no error", stmt)
+		}
+	}
+	if _, err := Parse("absent", "var\n  x: integer absent\nendvar\nrun\nendrun"); err == nil {
+		t.Error("absent without an OID: no error")
+	}
+}
+
+func TestStandardMib(t *testing.T) {
+	agent, interp := newTestAgent(t, agentTestProg)
+	addStandardMib(agent, interp)
+
+	// the declared sysDescr and sysContact are not replaced
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{
+		Variables: oidVars(t, nil, "1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.3.0", "1.3.6.1.2.1.1.5.0", "1.3.6.1.2.1.1.8.0")})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("status %d", resp.ErrorStatus)
+	}
+	if resp.Variables[0].Value != "" {
+		t.Errorf("sysDescr = %v, want the declared (not run) value", resp.Variables[0].Value)
+	}
+	if _, ok := resp.Variables[1].Value.(snmp.TimeTicks); !ok {
+		t.Errorf("sysUpTime = %T, want snmp.TimeTicks", resp.Variables[1].Value)
+	}
+	if resp.Variables[2].Value != "snmprun" {
+		t.Errorf("sysName = %v", resp.Variables[2].Value)
+	}
+	if resp.Variables[3].Value != snmp.TimeTicks(0) {
+		t.Errorf("sysORLastChange = %v", resp.Variables[3].Value)
+	}
+
+	// the declared sysContact is still writable
+	contact := "1.3.6.1.2.1.1.4.0"
+	resp = request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{contact: "noc"}, contact)})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Errorf("set of declared sysContact: status %d", resp.ErrorStatus)
+	}
+}
+
+func TestOidAlias(t *testing.T) {
+	prog := `
+var
+  name: 2.1.1.5.0 string
+  alias 4.1.99.1.5.0 = 4.1.99.1.6.0
+  alias 4.1.99.1.6.0 = 2.1.1.5.0
+endvar
+run
+  name = "first"
+endrun`
+	program, interp := parseTestProgram(t, prog)
+	agent := NewAgent()
+	if err := addProgramOIDs(agent, interp, false); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func() interface{} {
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{
+			Variables: oidVars(t, nil, "1.3.6.1.4.1.99.1.5.0")})
+		return resp.Variables[0].Value
+	}
+	if err := interp.InterpProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(); got != "first" {
+		t.Errorf("alias = %v, want first", got)
+	}
+	interp.SetValueForIdOid("name", ".1.3.6.1.2.1.1.5.0", &Value{valueType: ValueString, stringVal: "second"})
+	if got := get(); got != "second" {
+		t.Errorf("alias = %v, want second after the target changed", got)
+	}
+}
+
+func TestOidAliasErrors(t *testing.T) {
+	tests := []struct {
+		aliases string
+		want    string
+	}{
+		{"alias 4.1.99.1 = 4.1.99.2\n  alias 4.1.99.2 = 4.1.99.1", "Alias OID .1.3.6.1.4.1.99.1 is in a cycle of aliases"},
+		{"alias 4.1.99.1 = 4.1.99.3", "Alias OID .1.3.6.1.4.1.99.1 refers to .1.3.6.1.4.1.99.3 which is not declared"},
+		{"alias 2.1.1.5.0 = 4.1.99.3", "Alias OID .1.3.6.1.2.1.1.5.0 is already declared by a variable"},
+	}
+	for _, test := range tests {
+		prog := "var\n  name: 2.1.1.5.0 string\n  " + test.aliases + "\nendvar\nrun\nendrun"
+		program, err := NewParser(lex("test", prog)).ParseProgram()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = new(Interpreter).Init(program, make(VariableInits))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Init error = %v, want %s", err, test.want)
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	program, interp := parseTestProgram(t, `
+var
+  ifDescr.[1..48]: 2.1.2.2.1.2 string = "GigabitEthernet0/%d"
+  ifMtu.[1..48]: 2.1.2.2.1.4 integer = 1500
+  ifAlias.[1..2]: 2.1.31.1.1.1.18 rw string
+endvar
+run
+endrun`)
+	agent := NewAgent()
+	if err := addProgramOIDs(agent, interp, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := interp.InterpProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(program.variables.types); n != 98 {
+		t.Errorf("%d variables, want 98", n)
+	}
+
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{
+		Variables: oidVars(t, nil, "1.3.6.1.2.1.2.2.1.2.1", "1.3.6.1.2.1.2.2.1.2.48", "1.3.6.1.2.1.2.2.1.4.7")})
+	want := []interface{}{"GigabitEthernet0/1", "GigabitEthernet0/48", 1500}
+	for i, w := range want {
+		if got := resp.Variables[i].Value; got != w {
+			t.Errorf("%s = %v, want %v", resp.Variables[i].Name, got, w)
+		}
+	}
+
+	alias := "1.3.6.1.2.1.31.1.1.1.18.2"
+	resp = request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{alias: "uplink"}, alias)})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("set status %d", resp.ErrorStatus)
+	}
+	if val, _ := interp.GetValueForId("ifAlias.2"); val.stringVal != "uplink" {
+		t.Errorf("ifAlias.2 = %v, want uplink", val)
+	}
+}
+
+func TestRangeIndexExpression(t *testing.T) {
+	_, interp := parseTestProgram(t, `
+var
+  index: 4.1.99.1.0 integer = 5
+  ifInOctets.[1..48]: 2.1.2.2.1.10 counter = index * 1000
+  ifType.[1..3]: 2.1.2.2.1.3 integer [6 = 'ethernetCsmacd', 24 = 'softwareLoopback'] = 'ethernetCsmacd' + 18 * (index / 3)
+  ifMtu.[1..2]: 2.1.2.2.1.4 integer = -1
+endvar
+run
+endrun`)
+	tests := map[string]int{
+		"ifInOctets.1": 1000, "ifInOctets.48": 48000,
+		"ifType.1": 6, "ifType.2": 6, "ifType.3": 24,
+		"ifMtu.2": -1, "index": 5,
+	}
+	for id, want := range tests {
+		if val, _ := interp.GetValueForId(id); val.intVal != want {
+			t.Errorf("%s = %d, want %d", id, val.intVal, want)
+		}
+	}
+}
+
+func TestRangeErrors(t *testing.T) {
+	tests := []struct {
+		decls string
+		want  string
+	}{
+		{"ifDescr.[1..4]: 2.1.2.2.1.2 string\n  descr3: 2.1.2.2.1.2.3 string",
+			"Reuse of OID in variable identifier: descr3 with OID: .1.3.6.1.2.1.2.2.1.2.3"},
+		{"descr3: 2.1.2.2.1.2.3 string\n  ifDescr.[1..4]: 2.1.2.2.1.2 string",
+			"Reuse of OID in range ifDescr.[1..4]: .1.3.6.1.2.1.2.2.1.2.3 is the OID of descr3"},
+		{"ifDescr.[1..4]: 2.1.2.2.1.2 string\n  ifDescr.[4..5]: 4.1.99.1 string",
+			"Redeclaration of variable identifier: ifDescr.4"},
+		{"ifDescr.[4..1]: 2.1.2.2.1.2 string", "Invalid range 4..1"},
+		{"ifDescr.[1..4]: string", "A range needs an OID"},
+		{"ifMtu.[1..4]: 2.1.2.2.1.4 integer = \"big\"", "Expecting an integer value"},
+		{"mtu: 4.1.99.1.0 integer = 1500\n  ifMtu.[1..4]: 2.1.2.2.1.4 integer = mtu + index",
+			"The value of a range can only use index and constants, not the variable mtu"},
+		{"ifSpeed.[1..4]: 2.1.2.2.1.5 guage = 100 - index * 50", "Invalid value of the range with index 3: -50 is out of the range of Guage"},
+		{"ifSpeed.[1..4]: 2.1.2.2.1.5 guage = 100 / (index - 1)", "Division by zero"},
+	}
+	for _, test := range tests {
+		prog := "var\n  " + test.decls + "\nendvar\nrun\nendrun"
+		_, err := NewParser(lex("test", prog)).ParseProgram()
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error = %v, want %s", test.decls, err, test.want)
+		}
+	}
+}
+
+func TestHexStringLiteral(t *testing.T) {
+	program, interp := parseTestProgram(t, `
+var
+  phys-addr: 2.1.2.2.1.6.1 string
+  wwn: 4.1.99.1.0 string
+endvar
+run
+  phys-addr = 0x000A0B0C0D0E
+  wwn = 0x5000C5 + 0x0012AB34
+endrun`)
+	agent := NewAgent()
+	if err := addProgramOIDs(agent, interp, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := interp.InterpProgram(program); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Identifier: 1,
+		Variables: oidVars(t, nil, "1.3.6.1.2.1.2.2.1.6.1", "1.3.6.1.4.1.99.1.0")})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("status %d", resp.ErrorStatus)
+	}
+	want := []string{"\x00\x0a\x0b\x0c\x0d\x0e", "\x50\x00\xc5\x00\x12\xab\x34"}
+	for i, w := range want {
+		if got := resp.Variables[i].Value; got != w {
+			t.Errorf("%s = %q, want %q", resp.Variables[i].Name, got, w)
+		}
+	}
+}
+
+func TestHexStringLiteralErrors(t *testing.T) {
+	for _, literal := range []string{"0x0A0", "0x", "10"} {
+		prog := "var\n  s: 4.1.99.1.0 string\nendvar\nrun\n  s = " + literal + "\nendrun"
+		_, err := NewParser(lex("test", prog)).ParseProgram()
+		if err == nil {
+			t.Errorf("%s: no error", literal)
+		}
+	}
+}
+
+func TestVendorObjectId(t *testing.T) {
+	getObjectId := func(agent *Agent) interface{} {
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{
+			Variables: oidVars(t, nil, sysObjectIdOid)})
+		return resp.Variables[0].Value
+	}
+
+	agent, interp := newTestAgent(t, agentTestProg)
+	if err := addVendorObjectId(agent, interp, "Cisco"); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := getObjectId(agent).(asn1.Oid); !ok || got.String() != ".1.3.6.1.4.1.9.1.1" {
+		t.Errorf("sysObjectID = %v, want .1.3.6.1.4.1.9.1.1", getObjectId(agent))
+	}
+
+	// a declared sysObjectID wins
+	program, interp := parseTestProgram(t, `
+var
+  sys-object-id: 2.1.1.2.0 oid
+endvar
+run
+  sys-object-id = .1.3.6.1.4.1.9.1.516
+endrun`)
+	agent = NewAgent()
+	if err := addProgramOIDs(agent, interp, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := addVendorObjectId(agent, interp, "juniper"); err != nil {
+		t.Fatal(err)
+	}
+	if err := interp.InterpProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := getObjectId(agent).(asn1.Oid); !ok || got.String() != ".1.3.6.1.4.1.9.1.516" {
+		t.Errorf("sysObjectID = %v, want the declared .1.3.6.1.4.1.9.1.516", getObjectId(agent))
+	}
+
+	if err := addVendorObjectId(agent, interp, "acme"); err == nil {
+		t.Error("no error for an unknown vendor")
+	}
+}
+
+func TestHealthOid(t *testing.T) {
+	prog := `
+var
+  descr: 2.1.1.1.0 string
+endvar
+run
+endrun`
+	_, interp := parseTestProgram(t, prog)
+	agent := NewAgent()
+	config := &ServerConfig{healthOid: "1.3.6.1.4.1.99999.1"}
+	if err := addServedOIDs(agent, interp, config); err != nil {
+		t.Fatal(err)
+	}
+	uptime := "1.3.6.1.4.1.99999.1.1.0"
+	requests := "1.3.6.1.4.1.99999.1.2.0"
+	request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, "2.1.1.1.0")})
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, uptime, requests)})
+	if _, ok := resp.Variables[0].Value.(snmp.TimeTicks); !ok {
+		t.Errorf("uptime = %T, want snmp.TimeTicks", resp.Variables[0].Value)
+	}
+	if resp.Variables[1].Value != snmp.Counter32(2) {
+		t.Errorf("requests = %v, want 2", resp.Variables[1].Value)
+	}
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, "1.3.6.1.4.1.99999.1.3.0")})
+	if resp.Variables[0].Value != runId {
+		t.Errorf("run id = %v, want %s", resp.Variables[0].Value, runId)
+	}
+
+	var out strings.Builder
+	if err := listOids(&out, interp, config); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), ".1.3.6.1.4.1.99999.1.2.0 requests (-health-oid)\n") {
+		t.Errorf("list\n%s\nwant the health OIDs marked", out.String())
+	}
+
+	for _, healthOid := range []string{"1.3.6.1.2.1.1", "1.3.6.1.2.1.1.1.0.5", "1.3.x"} {
+		err := addServedOIDs(NewAgent(), interp, &ServerConfig{healthOid: healthOid})
+		if err == nil {
+			t.Errorf("-health-oid %s: no error", healthOid)
+		}
+	}
+}
+
+func TestMaxVarbindsFilter(t *testing.T) {
+	agent, _ := newTestAgent(t, agentTestProg)
+	oids := []string{"1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.2.1.0"}
+
+	filter, err := maxVarbindsFilter(1, "tooBig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent.SetRequestFilter(filter)
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, oids[0])})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Errorf("one varbind: status %d, want noError", resp.ErrorStatus)
+	}
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, oids...)})
+	if resp.ErrorStatus != snmp.TooBig || resp.ErrorIndex != 0 || len(resp.Variables) != 2 {
+		t.Errorf("two varbinds: status %d index %d with %d varbinds, want tooBig", resp.ErrorStatus, resp.ErrorIndex, len(resp.Variables))
+	}
+
+	filter, _ = maxVarbindsFilter(1, "genErr")
+	agent.SetRequestFilter(filter)
+	resp = request(t, agent, snmp.V1, "public", snmp.GetNextRequestPdu{Variables: oidVars(t, nil, oids...)})
+	if resp.ErrorStatus != snmp.GenErr {
+		t.Errorf("genErr: status %d", resp.ErrorStatus)
+	}
+
+	filter, _ = maxVarbindsFilter(1, "drop")
+	agent.SetRequestFilter(filter)
+	reqBuf, err := agent.ctx.Encode(snmp.Message{Version: snmp.V2C, Community: []byte("public"),
+		Pdu: snmp.GetRequestPdu{Variables: oidVars(t, nil, oids...)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.ProcessDatagram(reqBuf); err == nil {
+		t.Error("drop: request was not dropped")
+	}
+
+	if _, err := maxVarbindsFilter(1, "reboot"); err == nil {
+		t.Error("no error for an invalid response")
+	}
+}
+
+func TestCounter64Wrap(t *testing.T) {
+	program, interp := parseTestProgram(t, `
+var
+  hc-in-octets: 2.1.31.1.1.1.6.1 counter64
+  hc-out-octets: 2.1.31.1.1.1.10.1 counter64
+  max: 4.1.99.1.0 counter64
+  half: 4.1.99.2.0 counter64
+endvar
+run
+  max = 18446744073709551615
+  hc-in-octets = 18446744073709551615 + 1
+  hc-out-octets = 0xFFFFFFFFFFFFFFF0
+  hc-out-octets = hc-out-octets + 20
+  half = max / 2 + 1
+endrun`)
+	agent := NewAgent()
+	if err := addProgramOIDs(agent, interp, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := interp.InterpProgram(program); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{
+		Variables: oidVars(t, nil, "1.3.6.1.4.1.99.1.0", "1.3.6.1.2.1.31.1.1.1.6.1", "1.3.6.1.2.1.31.1.1.1.10.1",
+			"1.3.6.1.4.1.99.2.0")})
+	want := []snmp.Counter64{18446744073709551615, 0, 4, 9223372036854775808}
+	for i, w := range want {
+		if got := resp.Variables[i].Value; got != w {
+			t.Errorf("%s = %v (%T), want %d", resp.Variables[i].Name, got, got, w)
+		}
+	}
+}
+
+func TestAccess(t *testing.T) {
+	agent, interp := newTestAgent(t, `
+var
+  contact: 2.1.1.4.0 rw string access read-only
+  name: 2.1.1.5.0 string access read-write
+  location: 2.1.1.6.0 string
+endvar
+run
+endrun`)
+
+	set := func(oidStr string) snmp.GetResponsePdu {
+		return request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+			Variables: oidVars(t, map[string]interface{}{oidStr: "new"}, oidStr)})
+	}
+	if resp := set("1.3.6.1.2.1.1.4.0"); resp.ErrorStatus != snmp.NotWritable || resp.ErrorIndex != 1 {
+		t.Errorf("read-only rw: status %d index %d, want notWritable", resp.ErrorStatus, resp.ErrorIndex)
+	}
+	if resp := set("1.3.6.1.2.1.1.6.0"); resp.ErrorStatus != snmp.NotWritable {
+		t.Errorf("default: status %d, want notWritable", resp.ErrorStatus)
+	}
+	if resp := set("1.3.6.1.2.1.1.5.0"); resp.ErrorStatus != snmp.NoError {
+		t.Errorf("read-write: status %d, want noError", resp.ErrorStatus)
+	}
+	if val, _ := interp.GetValueForId("name"); val.stringVal != "new" {
+		t.Errorf("name = %q, want new", val.stringVal)
+	}
+
+	for _, decl := range []string{"x: 2.1.1 counter access read-write", "x: 2.1.1 integer access write-only", "x: integer access read-only"} {
+		_, err := NewParser(lex("test", "var\n  "+decl+"\nendvar\nrun\nendrun")).ParseProgram()
+		if err == nil {
+			t.Errorf("%s: no error", decl)
+		}
+	}
+}
+
+func TestAgentTrackChange(t *testing.T) {
+	agent, interp := newTestAgent(t, `
+var
+  status: 2.1.2.2.1.8.1 rw integer track-change 2.1.2.2.1.9.1 = 1
+  speed.[1..2]: 2.1.2.2.1.5 rw guage track-change 2.1.2.2.1.19
+endvar
+run
+endrun`)
+	lastChange := func(oidStr string) snmp.TimeTicks {
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, oidStr)})
+		ticks, ok := resp.Variables[0].Value.(snmp.TimeTicks)
+		if !ok {
+			t.Fatalf("last change of %s = %#v, want TimeTicks", oidStr, resp.Variables[0].Value)
+		}
+		return ticks
+	}
+	set := func(oidStr string, value interface{}) {
+		resp := request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+			Variables: oidVars(t, map[string]interface{}{oidStr: value}, oidStr)})
+		if resp.ErrorStatus != snmp.NoError {
+			t.Fatalf("set of %s error %d", oidStr, resp.ErrorStatus)
+		}
+	}
+
+	if ticks := lastChange("1.3.6.1.2.1.2.2.1.9.1"); ticks > 100 {
+		t.Errorf("initial last change = %d, want the start", ticks)
+	}
+	interp.startTime = interp.startTime.Add(-10 * time.Second)
+	set("1.3.6.1.2.1.2.2.1.8.1", 2)
+	changed := lastChange("1.3.6.1.2.1.2.2.1.9.1")
+	if changed < 1000 {
+		t.Errorf("last change after set = %d, want at least 1000", changed)
+	}
+
+	// setting the same value is not a change
+	interp.startTime = interp.startTime.Add(-10 * time.Second)
+	set("1.3.6.1.2.1.2.2.1.8.1", 2)
+	if ticks := lastChange("1.3.6.1.2.1.2.2.1.9.1"); ticks != changed {
+		t.Errorf("last change after the same value = %d, want %d", ticks, changed)
+	}
+
+	// each instance of a range has its own
+	set("1.3.6.1.2.1.2.2.1.5.2", snmp.Unsigned32(1000))
+	if ticks := lastChange("1.3.6.1.2.1.2.2.1.19.2"); ticks < 2000 {
+		t.Errorf("last change of instance 2 = %d, want at least 2000", ticks)
+	}
+	if ticks := lastChange("1.3.6.1.2.1.2.2.1.19.1"); ticks > 100 {
+		t.Errorf("last change of instance 1 = %d, want the start", ticks)
+	}
+
+	// an assignment of the program is a change too
+	interp.SetValueForIdOid("status", interp.variables.types["status"].oid, &Value{valueType: ValueInteger, intVal: 1})
+	if ticks := lastChange("1.3.6.1.2.1.2.2.1.9.1"); ticks < 2000 {
+		t.Errorf("last change after assignment = %d, want at least 2000", ticks)
+	}
+
+	// a reset keeps the uptime, the initial values being changes at the time of the reset
+	before := snmp.TimeTicks(interp.UptimeTicks())
+	interp.Reset()
+	if ticks := lastChange("1.3.6.1.2.1.2.2.1.9.1"); ticks < before || ticks > before+100 {
+		t.Errorf("last change after reset = %d, want the uptime of %d", ticks, before)
+	}
+
+	_, err := NewParser(lex("test", "var\n  x: integer track-change 2.1.1\nendvar\nrun\nendrun")).ParseProgram()
+	if err == nil || !strings.Contains(err.Error(), "Track-change needs an OID") {
+		t.Errorf("track-change without an OID: error %v", err)
+	}
+	_, err = NewParser(lex("test", "var\n  x: 2.1.1 integer track-change 2.1.2\n  y: 2.1.2 integer\nendvar\nrun\nendrun")).ParseProgram()
+	if err == nil || !strings.Contains(err.Error(), "Reuse of OID") {
+		t.Errorf("track-change to a declared OID: error %v", err)
+	}
+}
+
+func TestAgentVersionMismatch(t *testing.T) {
+	agent, _ := newTestAgent(t, agentTestProg)
+
+	// the engine discovery request a v3 manager starts with
+	v3Probe, err := hex.DecodeString("303a020103300f02024a69020300ffe30401040201030410300e0400020100020100040004000400" +
+		"301204000400a00c020237f00201000201003000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, ok := messageVersion(v3Probe); !ok || version != 3 {
+		t.Errorf("version = %d, %t, want 3", version, ok)
+	}
+	resp, summary, err := agent.ProcessRequest(v3Probe)
+	if resp != nil || !errors.Is(err, errUnsupportedVersion) {
+		t.Fatalf("v3 request: response %v, error %v", resp, err)
+	}
+	if want := "received v3 request but only v1 and v2c are served"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error = %v, want %s", err, want)
+	}
+	if summary.Version != 3 {
+		t.Errorf("summary version = %d, want 3", summary.Version)
+	}
+
+	// not an SNMP message at all is a decode error
+	if _, err := agent.ProcessDatagram([]byte("GET / HTTP/1.0\r\n\r\n")); err == nil || errors.Is(err, errUnsupportedVersion) {
+		t.Errorf("garbage: error %v, want a decode error", err)
+	}
+	if _, ok := messageVersion([]byte{0x30, 0x82, 0x01}); ok {
+		t.Error("version of a truncated message")
+	}
+}
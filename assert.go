@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// assertProfile serves a program and GETs each OID of the expected values, returning the differences of
+// the values served from them. An OID that is not served is removed, as in a diff of the expected and
+// served. The program is not run so the values are its initial values, like those of an export.
+func assertProfile(interp *Interpreter, expected map[string]servedValue) ([]ProfileChange, error) {
+	// for the tables, which have no rows to GET until they are created
+	initial, err := servedValues(interp)
+	if err != nil {
+		return nil, err
+	}
+	client, stop, err := serveLocally(interp)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	served := make(map[string]servedValue)
+	for oidStr, expectedValue := range expected {
+		if expectedValue.Type == "Table" {
+			if table, ok := initial[oidStr]; ok {
+				served[oidStr] = table
+			}
+			continue
+		}
+		oid, err := strToOID(oidStr)
+		if err != nil {
+			return nil, err
+		}
+		vars, err := client.Get(oid)
+		if err != nil {
+			return nil, fmt.Errorf("GET of %s failed: %v", oidStr, err)
+		}
+		if len(vars) != 1 || isException(vars[0].Value) {
+			continue
+		}
+		typ, text := formatSnmpValue(vars[0].Value)
+		served[oidStr] = servedValue{Type: typ, Value: text}
+	}
+	return diffProfiles(expected, served)
+}
+
+// runAssert is the assert subcommand returning the exit status, which is 0 if the program serves the
+// expected values, 1 if not with the differences written as by diff and 2 for an error
+// snmprun assert [-V key=value] [-json] program.sim expected.sim
+func runAssert(args []string, out io.Writer) int {
+	varInits := make(VariableInits)
+	flags := flag.NewFlagSet("assert", flag.ExitOnError)
+	flags.Var(&varInits, "V", "variable initializers of the program")
+	format := flags.String("format", "", "format of the program file: sim, json or snmprec (default is from a .json or .snmprec extension otherwise sim)")
+	jsonLines := flags.Bool("json", false, "write each difference as a JSON object on a line")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		fmt.Fprintln(out, "Usage: snmprun assert [-V key=value] [-json] program.sim expected.sim")
+		return 2
+	}
+	logger = newLevelLogger(os.Stderr, "snmpsim", log.LstdFlags, LogWarn)
+
+	program, err := loadProgramAs(flags.Arg(0), *format, nil)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	interp := new(Interpreter)
+	err = interp.Init(program, varInits)
+	if err != nil {
+		fmt.Fprintf(out, "%s: Initialization error: %v\n", flags.Arg(0), err)
+		return 2
+	}
+	// the expected values are an export, or any program serving them
+	expected, err := loadServedValues(flags.Arg(1), "", nil)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	changes, err := assertProfile(interp, expected)
+	if err == nil {
+		err = writeProfileChanges(out, changes, *jsonLines)
+	}
+	if err != nil {
+		fmt.Fprintf(out, "assert failed: %s\n", err)
+		return 2
+	}
+	if len(changes) > 0 {
+		return 1
+	}
+	return 0
+}
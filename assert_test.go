@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const assertTestProg = `
+var
+  descr: 2.1.1.1.0 string = "router"
+  uptime: 2.1.1.3.0 timeticks = 100
+  ifDescr.[1..2]: 2.1.2.2.1.2 string = "eth%d"
+  ifInOctets.[1..2]: 2.1.2.2.1.10 counter = index * 1000
+  alias 2.1.1.6.0 = 2.1.1.1.0
+endvar
+run
+  descr = "changed by the program"
+endrun`
+
+func TestRunAssert(t *testing.T) {
+	dir := t.TempDir()
+	progFile := filepath.Join(dir, "profile.sim")
+	expectedFile := filepath.Join(dir, "expected.sim")
+	os.WriteFile(progFile, []byte(assertTestProg), 0644)
+
+	// capture then assert
+	_, interp := parseTestProgram(t, assertTestProg)
+	var exported bytes.Buffer
+	if err := exportProgram(&exported, interp); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(expectedFile, exported.Bytes(), 0644)
+	var out bytes.Buffer
+	if status := runAssert([]string{progFile, expectedFile}, &out); status != 0 || out.Len() != 0 {
+		t.Errorf("asserting the export: status %d, output %s", status, out.String())
+	}
+
+	os.WriteFile(expectedFile, []byte(`
+var
+  .1.3.6.1.2.1.1.1.0 string = "router"
+  .1.3.6.1.2.1.1.3.0 timeticks = 200
+  .1.3.6.1.2.1.1.5.0 string = "not served"
+  .1.3.6.1.2.1.2.2.1.10.2 integer = 2000
+endvar
+run
+endrun`), 0644)
+	out.Reset()
+	if status := runAssert([]string{progFile, expectedFile}, &out); status != 1 {
+		t.Errorf("status %d, want 1", status)
+	}
+	want := `~ .1.3.6.1.2.1.1.3.0 = Timeticks: 200 -> Timeticks: 100
+- .1.3.6.1.2.1.1.5.0 = STRING: "not served"
+~ .1.3.6.1.2.1.2.2.1.10.2 = INTEGER: 2000 -> Counter32: 2000
+`
+	if out.String() != want {
+		t.Errorf("assert =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	if status := runAssert([]string{progFile, filepath.Join(dir, "missing.sim")}, &out); status != 2 {
+		t.Errorf("missing expected values: status %d, want 2", status)
+	}
+}
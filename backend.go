@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBackendTimeout is how long a read waits for a backend without -backend-timeout
+const defaultBackendTimeout = 2 * time.Second
+
+// defaultBackendCache is how long a value fetched from a backend is served again without -backend-cache
+const defaultBackendCache = time.Second
+
+// maxBackendSize is the most of a backend's response that is read as the value
+const maxBackendSize = 64 * 1024
+
+// ValueBackend fetches the text of a value from outside the program, such as a metric of a monitoring system
+type ValueBackend interface {
+	Fetch(ctx context.Context) (text string, err error)
+	String() string // where the value is fetched from, for the log
+}
+
+// The policies of a backend for a fetch which fails or takes longer than the timeout
+const (
+	OnErrorLast    = "last"    // serve the last value fetched, or the initial value
+	OnErrorDefault = "default" // serve the default value of the backend
+	OnErrorGenErr  = "genErr"  // respond with genErr
+)
+
+// Backend is where a variable's value is fetched from when it is read, unless fetched within the cache time.
+// The value fetched is kept as the variable's value. What is served if a fetch fails is the on-error policy.
+type Backend struct {
+	source     ValueBackend
+	timeout    time.Duration
+	cache      time.Duration // value fetched is served again for this long, 0 to fetch on each read
+	fixedCache bool          // the cache was given in the program so -backend-cache does not change it
+	onError    string        // policy for a failed fetch
+	defaultVal *Value        // served for a failed fetch with OnErrorDefault
+}
+
+// httpBackend fetches the body of an HTTP GET of a URL
+type httpBackend struct {
+	url string
+}
+
+func (backend httpBackend) Fetch(ctx context.Context) (text string, err error) {
+	req, err := http.NewRequest("GET", backend.url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", backend.url, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBackendSize))
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+func (backend httpBackend) String() string {
+	return backend.url
+}
+
+// SourceCache keeps the values of cacheable sources, such as backends, until they expire
+type SourceCache struct {
+	lock    sync.Mutex
+	entries map[string]cachedValue
+}
+
+type cachedValue struct {
+	val     *Value
+	expires time.Time
+}
+
+func newSourceCache() *SourceCache {
+	return &SourceCache{entries: make(map[string]cachedValue)}
+}
+
+// get returns the value of the key unless it has expired
+func (cache *SourceCache) get(key string, now time.Time) (val *Value, found bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	entry, found := cache.entries[key]
+	if !found || !now.Before(entry.expires) {
+		return nil, false
+	}
+	return entry.val, true
+}
+
+func (cache *SourceCache) put(key string, val *Value, expires time.Time) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.entries[key] = cachedValue{val: val, expires: expires}
+}
+
+// clear drops all the values, such as when the program is reset
+func (cache *SourceCache) clear() {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.entries = make(map[string]cachedValue)
+}
+
+// backendValue fetches the value of a variable from its backend, converted to the variable's type, and keeps
+// it as the variable's value. If the fetch fails the on-error policy of the backend gives the value it already
+// has, the default value or an error for genErr.
+func (interp *Interpreter) backendValue(ctx context.Context, typ *Type) (*Value, error) {
+	ctx, cancel := context.WithTimeout(ctx, typ.backend.timeout)
+	defer cancel()
+
+	text, err := typ.backend.source.Fetch(ctx)
+	if err == nil {
+		val := &Value{valueType: typ.valueType}
+		err = textToValue(strings.TrimSpace(text), val, interp.variables)
+		if err == nil {
+			interp.SetValueForIdOid(typ.id, typ.oid, val)
+			return val, nil
+		}
+	}
+	switch typ.backend.onError {
+	case OnErrorGenErr:
+		// the agent logs the error with the OID
+		return nil, oidErrorf(typ.oid, ErrSourceFailed, "fetch of %s from %s failed: %v", typ.id, typ.backend.source, err)
+	case OnErrorDefault:
+		logger.Warnf("Serving the default value of %s %s as the fetch from %s failed: %v\n", typ.id, typ.oid,
+			typ.backend.source, err)
+		return typ.backend.defaultVal, nil
+	}
+	logger.Warnf("Serving the last value of %s %s as the fetch from %s failed: %v\n", typ.id, typ.oid,
+		typ.backend.source, err)
+	val, _ := interp.GetValueForId(typ.id)
+	return val, nil
+}
+
+// enableBackends sets the timeout and cache of the variables fetched from backends, which are only served
+// if enabled as the agent then makes requests of its own to other hosts
+func enableBackends(interp *Interpreter, enabled bool, timeout time.Duration, cache time.Duration) error {
+	for _, typ := range interp.variables.types {
+		if typ.backend == nil {
+			continue
+		}
+		if !enabled {
+			return fmt.Errorf("%s is fetched from %s, which needs -backends", typ.id, typ.backend.source)
+		}
+		if timeout > 0 {
+			typ.backend.timeout = timeout
+		}
+		if !typ.backend.fixedCache {
+			typ.backend.cache = cache
+		}
+	}
+	return nil
+}
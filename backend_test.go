@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PromonLogicalis/snmp"
+)
+
+func TestBackend(t *testing.T) {
+	var lock sync.Mutex
+	metrics := map[string]string{"/load": "42\n", "/if/1": "100", "/if/2": "200"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		metric, ok := metrics[r.URL.Path]
+		if !ok {
+			http.Error(w, "no metric", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, metric)
+	}))
+	defer server.Close()
+
+	agent, interp := newTestAgent(t, fmt.Sprintf(`
+var
+  load: 4.1.99.2.0 integer http "%s/load" = 7
+  speed.[1..2]: 2.1.2.2.1.5 guage http "%s/if/%%d"
+endvar
+run
+endrun`, server.URL, server.URL))
+	if err := enableBackends(interp, false, 0, 0); err == nil || !strings.Contains(err.Error(), "-backends") {
+		t.Errorf("backends not enabled: error %v", err)
+	}
+	if err := enableBackends(interp, true, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	get := func(oidStr string) interface{} {
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, oidStr)})
+		return resp.Variables[0].Value
+	}
+
+	if got := get("1.3.6.1.4.1.99.2.0"); got != 42 {
+		t.Errorf("load = %v, want 42 from the backend", got)
+	}
+	if val, _ := interp.GetValueForId("load"); val.intVal != 42 {
+		t.Errorf("value of load = %d, want the one fetched", val.intVal)
+	}
+	for index, want := range []snmp.Unsigned32{100, 200} {
+		if got := get(fmt.Sprintf("1.3.6.1.2.1.2.2.1.5.%d", index+1)); got != want {
+			t.Errorf("speed.%d = %v, want %d", index+1, got, want)
+		}
+	}
+
+	// the last value fetched is served while the backend fails
+	lock.Lock()
+	metrics["/load"] = "not a number"
+	lock.Unlock()
+	if got := get("1.3.6.1.4.1.99.2.0"); got != 42 {
+		t.Errorf("load with a bad backend value = %v, want the last 42", got)
+	}
+	lock.Lock()
+	delete(metrics, "/load")
+	lock.Unlock()
+	if got := get("1.3.6.1.4.1.99.2.0"); got != 42 {
+		t.Errorf("load with a failed backend = %v, want the last 42", got)
+	}
+
+	_, err := NewParser(lex("test", "var\n  x: 2.1.1 integer http \"ftp://host/x\"\nendvar\nrun\nendrun")).ParseProgram()
+	if err == nil || !strings.Contains(err.Error(), "Invalid http backend URL") {
+		t.Errorf("non http backend: error %v", err)
+	}
+}
+
+func TestBackendCache(t *testing.T) {
+	var lock sync.Mutex
+	fetches := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		fetches[r.URL.Path]++
+		fmt.Fprint(w, "5")
+	}))
+	defer server.Close()
+	fetched := func(path string) int {
+		lock.Lock()
+		defer lock.Unlock()
+		return fetches[path]
+	}
+
+	agent, interp := newTestAgent(t, fmt.Sprintf(`
+var
+  ifOperStatus.[1..100]: 2.1.2.2.1.8 integer http "%s/status"
+  load: 2.1.1.3.0 integer http "%s/load" cache 0 secs
+endvar
+run
+endrun`, server.URL, server.URL))
+	if err := enableBackends(interp, true, 0, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	walk := func() {
+		for oid := "1.3.6.1.2.1.2.2.1.8"; ; {
+			resp := request(t, agent, snmp.V2C, "public", snmp.GetNextRequestPdu{Variables: oidVars(t, nil, oid)})
+			v := resp.Variables[0]
+			if isException(v.Value) || !strings.HasPrefix(v.Name.String(), ".1.3.6.1.2.1.2.2.1.8.") {
+				return
+			}
+			if v.Value != 5 {
+				t.Fatalf("%s = %v, want 5", v.Name, v.Value)
+			}
+			oid = v.Name.String()
+		}
+	}
+
+	walk()
+	walk()
+	if n := fetched("/status"); n != 1 {
+		t.Errorf("%d fetches for two walks of 100 OIDs of the same URL, want 1", n)
+	}
+	for i := 0; i < 3; i++ {
+		request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, "1.3.6.1.2.1.1.3.0")})
+	}
+	if n := fetched("/load"); n != 3 {
+		t.Errorf("%d fetches for 3 GETs with no cache, want 3", n)
+	}
+
+	interp.Reset()
+	walk()
+	if n := fetched("/status"); n != 2 {
+		t.Errorf("%d fetches after a reset, want 2", n)
+	}
+}
+
+func TestBackendOnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	agent, interp := newTestAgent(t, fmt.Sprintf(`
+var
+  last: 4.1.99.1.0 integer http "%s/last" on-error last = 7
+  default: 4.1.99.2.0 integer http "%s/default" on-error default -1 = 7
+  failed: 4.1.99.3.0 integer http "%s/failed" on-error genErr = 7
+endvar
+run
+endrun`, server.URL, server.URL, server.URL))
+	if err := enableBackends(interp, true, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil,
+		"1.3.6.1.4.1.99.1.0", "1.3.6.1.4.1.99.2.0")})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("error status %d", resp.ErrorStatus)
+	}
+	for i, want := range []interface{}{7, -1} {
+		if got := resp.Variables[i].Value; got != want {
+			t.Errorf("%s = %v, want %v", resp.Variables[i].Name, got, want)
+		}
+	}
+	if val, _ := interp.GetValueForId("default"); val.intVal != 7 {
+		t.Errorf("value of default = %d, want 7 unchanged by the default served", val.intVal)
+	}
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, "1.3.6.1.4.1.99.3.0")})
+	if resp.ErrorStatus != snmp.GenErr || resp.ErrorIndex != 1 {
+		t.Errorf("genErr policy: error status %d index %d, want genErr at 1", resp.ErrorStatus, resp.ErrorIndex)
+	}
+
+	tests := []struct {
+		decl string
+		want string
+	}{
+		{`x: 2.1.1 integer http "http://host/x" on-error retry`, "Invalid on-error retry"},
+		{`x: 2.1.1 integer http "http://host/x" on-error default "none"`, "Expecting"},
+	}
+	for _, test := range tests {
+		_, err := NewParser(lex("test", "var\n  "+test.decl+"\nendvar\nrun\nendrun")).ParseProgram()
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error %v, want %s", test.decl, err, test.want)
+		}
+	}
+}
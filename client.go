@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+// Client is a minimal SNMP manager used by the subcommands to query an agent
+type Client struct {
+	conn      *net.UDPConn
+	ctx       *asn1.Context
+	community string
+	version   int
+	timeout   time.Duration
+	requestId int
+}
+
+func newClient(addr string, community string, version int, timeout time.Duration) (client *Client, err error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		conn:      conn,
+		ctx:       snmp.Asn1Context(),
+		community: community,
+		version:   version,
+		timeout:   timeout,
+	}, nil
+}
+
+func (client *Client) Close() error {
+	return client.conn.Close()
+}
+
+func (client *Client) nextRequestId() int {
+	client.requestId++
+	return client.requestId
+}
+
+// request sends a request PDU and waits for the response with the same request-id
+func (client *Client) request(id int, pdu interface{}) (resp snmp.GetResponsePdu, err error) {
+	msg := snmp.Message{Version: client.version, Community: []byte(client.community), Pdu: pdu}
+	buffer, err := client.ctx.Encode(msg)
+	if err != nil {
+		return resp, err
+	}
+	_, err = client.conn.Write(buffer)
+	if err != nil {
+		return resp, err
+	}
+
+	client.conn.SetReadDeadline(time.Now().Add(client.timeout))
+	buffer = make([]byte, maxDatagramSize)
+	for {
+		n, err := client.conn.Read(buffer)
+		if err != nil {
+			return resp, err
+		}
+		var respMsg snmp.Message
+		_, err = client.ctx.Decode(buffer[:n], &respMsg)
+		if err != nil {
+			return resp, fmt.Errorf("Bad response: %v", err)
+		}
+		resp, ok := respMsg.Pdu.(snmp.GetResponsePdu)
+		if !ok {
+			return resp, fmt.Errorf("Unexpected response PDU type %T", respMsg.Pdu)
+		}
+		if resp.Identifier != id {
+			// a late response to an earlier request
+			continue
+		}
+		return resp, nil
+	}
+}
+
+// StatusError is the error-status of a response
+type StatusError struct {
+	Status int
+	Index  int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("Error status %d at index %d", e.Status, e.Index)
+}
+
+func nullVars(oids []asn1.Oid) []snmp.Variable {
+	vars := make([]snmp.Variable, len(oids))
+	for i, oid := range oids {
+		vars[i] = snmp.Variable{Name: oid, Value: asn1.Null{}}
+	}
+	return vars
+}
+
+// Get returns the variables for the OIDs, an error status in the response is a StatusError
+func (client *Client) Get(oids ...asn1.Oid) ([]snmp.Variable, error) {
+	id := client.nextRequestId()
+	resp, err := client.request(id, snmp.GetRequestPdu{Identifier: id, Variables: nullVars(oids)})
+	if err != nil {
+		return nil, err
+	}
+	if resp.ErrorStatus != snmp.NoError {
+		return nil, StatusError{resp.ErrorStatus, resp.ErrorIndex}
+	}
+	return resp.Variables, nil
+}
+
+// GetNext returns the variables following the OIDs, an error status in the response is a StatusError
+func (client *Client) GetNext(oids ...asn1.Oid) ([]snmp.Variable, error) {
+	id := client.nextRequestId()
+	resp, err := client.request(id, snmp.GetNextRequestPdu{Identifier: id, Variables: nullVars(oids)})
+	if err != nil {
+		return nil, err
+	}
+	if resp.ErrorStatus != snmp.NoError {
+		return nil, StatusError{resp.ErrorStatus, resp.ErrorIndex}
+	}
+	return resp.Variables, nil
+}
+
+// Walk calls fn for each variable under the root OID in order using GETNEXT
+func (client *Client) Walk(root asn1.Oid, fn func(v snmp.Variable) error) error {
+	oid := root
+	for {
+		vars, err := client.GetNext(oid)
+		var statusErr StatusError
+		if errors.As(err, &statusErr) && statusErr.Status == snmp.NoSuchName && client.version == snmp.V1 {
+			// the end of the MIB in v1
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(vars) != 1 {
+			return fmt.Errorf("GetNext of %s got %d variables", oid, len(vars))
+		}
+		v := vars[0]
+		if _, ok := v.Value.(snmp.EndOfMibView); ok || !isOidPrefix(root, v.Name) {
+			return nil
+		}
+		if compareOIDs(v.Name, oid) <= 0 {
+			return fmt.Errorf("OID %s not increasing after %s", v.Name, oid)
+		}
+		err = fn(v)
+		if err != nil {
+			return err
+		}
+		oid = v.Name
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+// wallClock is the name of the clock rates use by default, which is the time of day
+const wallClock = "wall"
+
+// Clock is the time a rate is applied by. The wall clock follows the time of day and any other is a manual clock
+// which only moves when advanced, so a test can control exactly how much some counters increase while the
+// rest go up with time as usual.
+type Clock struct {
+	name    string
+	elapsed time.Duration // of a manual clock, since the start
+}
+
+// manualEpoch is the start of the manual clocks
+var manualEpoch = time.Unix(0, 0)
+
+// now returns the time of the clock
+func (clock *Clock) now() time.Time {
+	if clock.name == wallClock {
+		return time.Now()
+	}
+	return manualEpoch.Add(clock.elapsed)
+}
+
+// newClocks returns the wall clock and a manual clock for each other name the rates and waves use
+func (interp *Interpreter) newClocks() map[string]*Clock {
+	clocks := map[string]*Clock{wallClock: {name: wallClock}}
+	for _, typ := range interp.variables.typesFromOid {
+		if typ.rate != nil && typ.rate.clock != "" {
+			clocks[typ.rate.clock] = &Clock{name: typ.rate.clock}
+		}
+		if typ.wave != nil && typ.wave.clock != "" {
+			clocks[typ.wave.clock] = &Clock{name: typ.wave.clock}
+		}
+	}
+	return clocks
+}
+
+// clockNow returns the time of the clock of a rate
+// Must be called with the values locked
+func (interp *Interpreter) clockNow(rate *Rate) time.Time {
+	if clock, ok := interp.clocks[rate.clock]; ok {
+		return clock.now()
+	}
+	return time.Now()
+}
+
+// ManualClocks returns the names of the manual clocks in order
+func (interp *Interpreter) ManualClocks() []string {
+	interp.valLock.RLock()
+	defer interp.valLock.RUnlock()
+
+	var names []string
+	for name := range interp.clocks {
+		if name != wallClock {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ClockElapsed returns the time a manual clock has been advanced by since the start
+func (interp *Interpreter) ClockElapsed(name string) (time.Duration, error) {
+	interp.valLock.RLock()
+	defer interp.valLock.RUnlock()
+
+	clock, err := interp.manualClock(name)
+	if err != nil {
+		return 0, err
+	}
+	return clock.elapsed, nil
+}
+
+// AdvanceClock moves a manual clock forward, which the rates using it are applied for when next read
+func (interp *Interpreter) AdvanceClock(name string, d time.Duration) error {
+	interp.valLock.Lock()
+	defer interp.valLock.Unlock()
+
+	clock, err := interp.manualClock(name)
+	if err != nil {
+		return err
+	}
+	if d < 0 {
+		return fmt.Errorf("Clock %s can not go back %s", name, -d)
+	}
+	clock.elapsed += d
+	return nil
+}
+
+// manualClock returns the manual clock with the name
+// Must be called with the values locked
+func (interp *Interpreter) manualClock(name string) (*Clock, error) {
+	clock, ok := interp.clocks[name]
+	if !ok {
+		return nil, fmt.Errorf("No clock %s, expecting one a rate or wave uses", name)
+	}
+	if name == wallClock {
+		return nil, fmt.Errorf("The %s clock can not be advanced", wallClock)
+	}
+	return clock, nil
+}
+
+// addClockOids serves a row for each manual clock under the OID, so a test driving the simulator over SNMP can
+// advance them: <oid>.1.<n> is the name and <oid>.2.<n> the milliseconds it has been advanced by, which a SET
+// moves forward to. The clocks are numbered from 1 in order of their names.
+func addClockOids(agent *Agent, interp *Interpreter, clockOid string) error {
+	baseOid, err := canonicalOid(clockOid)
+	if err != nil {
+		return fmt.Errorf("Invalid -clock-oid %s: %v", clockOid, err)
+	}
+	err = checkOidOverlap(agent, interp, baseOid, "-clock-oid")
+	if err != nil {
+		return err
+	}
+	for i, name := range interp.ManualClocks() {
+		name := name
+		nameOid, _ := strToOID(fmt.Sprintf("%s.1.%d", baseOid, i+1))
+		agent.AddRoManagedObject(nameOid, constantValue(name))
+		timeOid, _ := strToOID(fmt.Sprintf("%s.2.%d", baseOid, i+1))
+		agent.AddRwManagedObject(timeOid,
+			func(ctx context.Context, oid asn1.Oid) (interface{}, error) {
+				elapsed, err := interp.ClockElapsed(name)
+				return snmp.Unsigned32(elapsed / time.Millisecond), err
+			},
+			func(ctx context.Context, oid asn1.Oid, value interface{}) (func() error, error) {
+				millis, ok := value.(snmp.Unsigned32)
+				if !ok {
+					return nil, oidErrorf(oid.String(), ErrTypeMismatch, "Bad guage type %T for the milliseconds of clock %s", value, name)
+				}
+				elapsed, err := interp.ClockElapsed(name)
+				if err != nil {
+					return nil, err
+				}
+				to := time.Duration(millis) * time.Millisecond
+				if to < elapsed {
+					return nil, oidErrorf(oid.String(), ErrWrongValue, "Clock %s is at %s and can not go back to %s", name, elapsed, to)
+				}
+				return func() error {
+					logger.Infof("Clock %s advanced to %s\n", name, to)
+					return interp.AdvanceClock(name, to-elapsed)
+				}, nil
+			})
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PromonLogicalis/snmp"
+)
+
+const clockTestProg = `
+var
+  in-octets: 2.1.2.2.1.10.1 counter rate 100/s clock test
+  out-octets: 2.1.2.2.1.16.1 counter rate 100/s
+endvar
+run
+endrun`
+
+func TestManualClock(t *testing.T) {
+	agent, interp := newTestAgent(t, clockTestProg)
+	read := func() int {
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, rateTestOid)})
+		return int(resp.Variables[0].Value.(snmp.Counter32))
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if got := read(); got != 0 {
+		t.Errorf("before advancing = %d, want 0", got)
+	}
+	if err := interp.AdvanceClock("test", 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); got != 300 {
+		t.Errorf("after 3s = %d, want 300", got)
+	}
+	if got := read(); got != 300 {
+		t.Errorf("read again = %d, want 300", got)
+	}
+
+	// the counter on the wall clock goes up with time as usual
+	interp.valLock.Lock()
+	interp.rateStates[".1.3.6.1.2.1.2.2.1.16.1"].last = time.Now().Add(-2 * time.Second)
+	interp.valLock.Unlock()
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, "1.3.6.1.2.1.2.2.1.16.1")})
+	if got := int(resp.Variables[0].Value.(snmp.Counter32)); got < 200 || got > 201 {
+		t.Errorf("wall clock counter after 2s = %d, want 200", got)
+	}
+
+	for _, name := range []string{"wall", "other"} {
+		if err := interp.AdvanceClock(name, time.Second); err == nil {
+			t.Errorf("advancing clock %s: expected error", name)
+		}
+	}
+	if names := interp.ManualClocks(); len(names) != 1 || names[0] != "test" {
+		t.Errorf("manual clocks = %v", names)
+	}
+}
+
+func TestClockOid(t *testing.T) {
+	agent, interp := newTestAgent(t, clockTestProg)
+	if err := addClockOids(agent, interp, ".1.3.6.1.4.1.99999.2"); err != nil {
+		t.Fatal(err)
+	}
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, "1.3.6.1.4.1.99999.2.1.1")})
+	if resp.Variables[0].Value != "test" {
+		t.Errorf("clock name = %v", resp.Variables[0].Value)
+	}
+
+	setTo := func(millis uint32) snmp.GetResponsePdu {
+		vars := oidVars(t, map[string]interface{}{"1.3.6.1.4.1.99999.2.2.1": snmp.Unsigned32(millis)}, "1.3.6.1.4.1.99999.2.2.1")
+		return request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{Variables: vars})
+	}
+	if resp := setTo(1500); resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("set: status %d", resp.ErrorStatus)
+	}
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, rateTestOid)})
+	if got := resp.Variables[0].Value; got != snmp.Counter32(150) {
+		t.Errorf("after 1500 ms = %v, want 150", got)
+	}
+	if resp := setTo(1000); resp.ErrorStatus != snmp.WrongValue {
+		t.Errorf("set back: status %d, want wrongValue", resp.ErrorStatus)
+	}
+
+	if err := addClockOids(agent, interp, ".1.3.6.1.2.1.2"); err == nil {
+		t.Error("expected error for a -clock-oid over the program's OIDs")
+	}
+}
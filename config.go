@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// configEnvPrefix is the prefix of the environment variables which set the command line options
+const configEnvPrefix = "SNMPRUN_"
+
+// configSetting is an option set by a line of a config file
+type configSetting struct {
+	name  string
+	value string
+	line  int
+}
+
+// parseConfig parses the options of a config file, which is a subset of TOML without tables
+// Each line is name = value where the name is that of a command line option and the value
+// is a quoted string, a number, a boolean or a duration. A # starts a comment.
+//
+//	p = 1161
+//	log-level = "warn"
+//	V = "ifSpeed=1000000000"
+func parseConfig(r io.Reader) (settings []configSetting, err error) {
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("Line %d: expecting name = value", lineNum)
+		}
+		name := strings.TrimSpace(line[:eq])
+		value, err := configValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %v", lineNum, err)
+		}
+		if len(name) == 0 {
+			return nil, fmt.Errorf("Line %d: missing option name", lineNum)
+		}
+		settings = append(settings, configSetting{name: name, value: value, line: lineNum})
+	}
+	return settings, scanner.Err()
+}
+
+// configValue returns the value of a setting without its quotes and any trailing comment
+func configValue(str string) (string, error) {
+	var value string
+	switch {
+	case strings.HasPrefix(str, "\""):
+		quoted, err := strconv.QuotedPrefix(str)
+		if err != nil {
+			return "", fmt.Errorf("Bad quoted string %s", str)
+		}
+		value, _ = strconv.Unquote(quoted)
+		str = str[len(quoted):]
+	case strings.HasPrefix(str, "'"):
+		// a literal string has no escapes
+		end := strings.Index(str[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("Bad literal string %s", str)
+		}
+		value = str[1 : end+1]
+		str = str[end+2:]
+	default:
+		if i := strings.Index(str, "#"); i >= 0 {
+			str = str[:i]
+		}
+		value = strings.TrimSpace(str)
+		if len(value) == 0 {
+			return "", fmt.Errorf("Missing value")
+		}
+		str = ""
+	}
+	str = strings.TrimSpace(str)
+	if len(str) > 0 && !strings.HasPrefix(str, "#") {
+		return "", fmt.Errorf("Unexpected %s after the value", str)
+	}
+	return value, nil
+}
+
+// applyConfig sets the options from a config file which are not already set on the command line
+// or by the environment, which take precedence
+func applyConfig(flags *flag.FlagSet, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	settings, err := parseConfig(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return applySettings(flags, filename, settings, map[string]bool{"config": true})
+}
+
+// programRefusedOptions are the options a program's config section can not set, as they are used before
+// the program is read
+var programRefusedOptions = map[string]bool{
+	"config": true, "format": true, "mib-index": true, "snmprec": true, "v": true,
+	"log-level": true, "log-max-size": true, "log-keep": true, "cpuprofile": true, "memprofile": true,
+}
+
+// applyProgramConfig sets the options of a program's config section which are not already set by the
+// command line, the environment or a config file, which all take precedence
+func applyProgramConfig(flags *flag.FlagSet, filename string, program *Program) error {
+	return applySettings(flags, filename, program.config, programRefusedOptions)
+}
+
+// applySettings sets the options which are not already set, the errors being for the source of the settings
+func applySettings(flags *flag.FlagSet, source string, settings []configSetting, refused map[string]bool) error {
+	alreadySet := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		alreadySet[f.Name] = true
+	})
+	for _, setting := range settings {
+		if flags.Lookup(setting.name) == nil {
+			return fmt.Errorf("%s: line %d: unknown option %s", source, setting.line, setting.name)
+		}
+		if refused[setting.name] {
+			return fmt.Errorf("%s: line %d: option %s can not be set here", source, setting.line, setting.name)
+		}
+		if alreadySet[setting.name] {
+			continue
+		}
+		err := flags.Set(setting.name, setting.value)
+		if err != nil {
+			return fmt.Errorf("%s: line %d: invalid value %q for %s: %v", source, setting.line, setting.value, setting.name, err)
+		}
+	}
+	return nil
+}
+
+// configEnvName is the environment variable for an option
+// e.g. SNMPRUN_MAX_VARBINDS for -max-varbinds. Single letter options keep their case, e.g. SNMPRUN_c and SNMPRUN_C.
+func configEnvName(name string) string {
+	if len(name) > 1 {
+		name = strings.ToUpper(strings.Replace(name, "-", "_", -1))
+	}
+	return configEnvPrefix + name
+}
+
+// repeatedValue is the value of an option which can be given more than once, each adding to it
+type repeatedValue interface {
+	flag.Value
+	Reset()
+}
+
+// applyEnv sets the options which have an environment variable, overriding the command line
+// The variable of an option given more than once, such as -listen, replaces all of its values with its one.
+func applyEnv(flags *flag.FlagSet) (err error) {
+	flags.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(configEnvName(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		if repeated, ok := f.Value.(repeatedValue); ok {
+			repeated.Reset()
+		}
+		if e := flags.Set(f.Name, value); e != nil {
+			err = fmt.Errorf("Invalid value %q of %s: %v", value, configEnvName(f.Name), e)
+		}
+	})
+	return err
+}
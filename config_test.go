@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	settings, err := parseConfig(strings.NewReader(`
+# snmprun options
+p = 1161
+log-level = "warn" # quieter soak tests
+C = 'pri"vate'
+V = "ifSpeed=1000000000"
+V = "ifName=eth0 # not a comment"
+startup-delay = 10s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []configSetting{
+		{"p", "1161", 3},
+		{"log-level", "warn", 4},
+		{"C", `pri"vate`, 5},
+		{"V", "ifSpeed=1000000000", 6},
+		{"V", "ifName=eth0 # not a comment", 7},
+		{"startup-delay", "10s", 8},
+	}
+	if len(settings) != len(want) {
+		t.Fatalf("got %d settings, want %d: %v", len(settings), len(want), settings)
+	}
+	for i, w := range want {
+		if settings[i] != w {
+			t.Errorf("setting %d = %v, want %v", i, settings[i], w)
+		}
+	}
+
+	for _, bad := range []string{"p", "p = ", `c = "public`, "c = 'public", `c = "public" x`, "= 1"} {
+		if _, err := parseConfig(strings.NewReader(bad)); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "snmprun.toml")
+	err := os.WriteFile(filename, []byte("p = 1161\nc = \"config\"\nC = \"config\"\nmax-varbinds = 1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	port := flags.Uint("p", 161, "")
+	readCommunity := flags.String("c", "public", "")
+	writeCommunity := flags.String("C", "private", "")
+	maxVarbinds := flags.Uint("max-varbinds", 0, "")
+	seed := flags.Int64("seed", 0, "")
+	if err := flags.Parse([]string{"-c", "flag", "-C", "flag"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SNMPRUN_C", "env")
+	t.Setenv("SNMPRUN_MAX_VARBINDS", "2")
+	if err := applyEnv(flags); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(flags, filename); err != nil {
+		t.Fatal(err)
+	}
+	if *port != 1161 || *readCommunity != "flag" || *writeCommunity != "env" || *maxVarbinds != 2 || *seed != 0 {
+		t.Errorf("got -p %d -c %s -C %s -max-varbinds %d -seed %d", *port, *readCommunity, *writeCommunity, *maxVarbinds, *seed)
+	}
+
+	// an option given more than once is replaced as a whole
+	listen := make(ListenAddrs, 0)
+	varInits := make(VariableInits)
+	flags.Var(&listen, "listen", "")
+	flags.Var(&varInits, "V", "")
+	if err := flags.Parse([]string{"-listen", "127.0.0.1:161", "-listen", "[::1]:161", "-V", "a=1", "-V", "b=2"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SNMPRUN_LISTEN", "127.0.0.1:1161")
+	t.Setenv("SNMPRUN_V", "c=3")
+	if err := applyEnv(flags); err != nil {
+		t.Fatal(err)
+	}
+	if listen.String() != "127.0.0.1:1161" || len(varInits) != 1 || varInits["c"] != "3" {
+		t.Errorf("got -listen %s -V %v, want only those of the environment", listen.String(), varInits)
+	}
+
+	os.WriteFile(filename, []byte("port = 1161\n"), 0644)
+	if err := applyConfig(flags, filename); err == nil || !strings.Contains(err.Error(), "unknown option port") {
+		t.Errorf("unknown option error = %v", err)
+	}
+	os.WriteFile(filename, []byte("seed = abc\n"), 0644)
+	if err := applyConfig(flags, filename); err == nil {
+		t.Errorf("no error for an invalid value")
+	}
+}
+
+func TestProgramConfig(t *testing.T) {
+	program, _ := parseTestProgram(t, `config
+  p = 1161
+  c = "monitor"
+  C = "profile"
+  read-only = true
+  http = "localhost:8161"
+endconfig
+var
+  config: 4.1.99.1.0 integer
+endvar
+run
+endrun`)
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	port := flags.Uint("p", 161, "")
+	readCommunity := flags.String("c", "public", "")
+	writeCommunity := flags.String("C", "private", "")
+	readOnly := flags.Bool("read-only", false, "")
+	httpAddr := flags.String("http", "", "")
+	flags.String("log-level", "info", "")
+	if err := flags.Parse([]string{"-c", "flag"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SNMPRUN_C", "env")
+	if err := applyEnv(flags); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyProgramConfig(flags, "profile.sim", program); err != nil {
+		t.Fatal(err)
+	}
+	if *port != 1161 || *readCommunity != "flag" || *writeCommunity != "env" || !*readOnly || *httpAddr != "localhost:8161" {
+		t.Errorf("got -p %d -c %s -C %s -read-only %t -http %s", *port, *readCommunity, *writeCommunity, *readOnly, *httpAddr)
+	}
+
+	for _, test := range []struct {
+		config string
+		want   string
+	}{
+		{"port = 1161", "profile.sim: line 2: unknown option port"},
+		{`log-level = "warn"`, "profile.sim: line 2: option log-level can not be set here"},
+		{`cpuprofile = "cpu.out"`, "profile.sim: line 2: option cpuprofile can not be set here"},
+		{"p = many", `profile.sim: line 2: invalid value "many" for p`},
+	} {
+		program, _ := parseTestProgram(t, "config\n  "+test.config+"\nendconfig\nrun\nendrun")
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.Uint("p", 161, "")
+		flags.String("log-level", "info", "")
+		flags.String("cpuprofile", "", "")
+		err := applyProgramConfig(flags, "profile.sim", program)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error %v, want %s", test.config, err, test.want)
+		}
+	}
+	for _, bad := range []string{"config\n  p 1161\nendconfig\nrun\nendrun", "config\n  p = 1161\nrun\nendrun",
+		"config\n  p = [1]\nendconfig\nrun\nendrun"} {
+		if _, err := Parse("bad", bad); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// Corrupter breaks the encoding of some of the responses, like a faulty device, to test how well managers
+// cope with malformed ASN.1: a response is cut short, has the length of one of its TLVs changed or has the
+// tag of one replaced by an invalid one.
+type Corrupter struct {
+	lock sync.Mutex
+	rate float64 // fraction of the responses corrupted
+	rng  *rand.Rand
+}
+
+// invalidTags are not used by SNMP, 0x1f starts a high tag number and 0x00 is reserved
+var invalidTags = []byte{0x00, 0x1f, 0x3f, 0xff}
+
+func newCorrupter(rate float64, seed int64) (*Corrupter, error) {
+	if rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("Invalid -corrupt-rate %g, expecting 0 to 1", rate)
+	}
+	return &Corrupter{rate: rate, rng: rand.New(rand.NewSource(seed))}, nil
+}
+
+// Corrupt returns a corrupted copy of the response and how it was corrupted, false if the response is left alone
+func (corrupter *Corrupter) Corrupt(response []byte) (corrupted []byte, how string, ok bool) {
+	corrupter.lock.Lock()
+	defer corrupter.lock.Unlock()
+
+	if len(response) < 2 || corrupter.rng.Float64() >= corrupter.rate {
+		return response, "", false
+	}
+	corrupted = append([]byte{}, response...)
+	offsets := berTLVOffsets(corrupted)
+	switch corrupter.rng.Intn(3) {
+	case 0:
+		n := 1 + corrupter.rng.Intn(len(corrupted)-1)
+		return corrupted[:n], fmt.Sprintf("truncated from %d to %d bytes", len(response), n), true
+	case 1:
+		offset := offsets[corrupter.rng.Intn(len(offsets))]
+		old := corrupted[offset+1]
+		corrupted[offset+1] = old ^ byte(1+corrupter.rng.Intn(0xff))
+		return corrupted, fmt.Sprintf("length byte at %d changed from 0x%02x to 0x%02x", offset+1, old, corrupted[offset+1]), true
+	default:
+		offset := offsets[corrupter.rng.Intn(len(offsets))]
+		old := corrupted[offset]
+		corrupted[offset] = invalidTags[corrupter.rng.Intn(len(invalidTags))]
+		return corrupted, fmt.Sprintf("tag at %d changed from 0x%02x to 0x%02x", offset, old, corrupted[offset]), true
+	}
+}
+
+// berTLVOffsets returns the offsets of the TLVs of an encoding, going into the constructed ones.
+// It stops at anything it can not decode, so there is always at least the first.
+func berTLVOffsets(data []byte) []int {
+	offsets := []int{0}
+	var walk func(start int, end int)
+	walk = func(start int, end int) {
+		for offset := start; offset < end; {
+			tag, headerLen, valueLen, err := berHeader(data[offset:end])
+			if err != nil {
+				return
+			}
+			if offset > 0 {
+				offsets = append(offsets, offset)
+			}
+			if tag&0x20 != 0 {
+				// constructed, such as a sequence or a PDU
+				walk(offset+headerLen, offset+headerLen+valueLen)
+			}
+			offset += headerLen + valueLen
+		}
+	}
+	walk(0, len(data))
+	return offsets
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/PromonLogicalis/snmp"
+)
+
+func TestCorrupt(t *testing.T) {
+	ctx := snmp.Asn1Context()
+	response, err := ctx.Encode(snmp.Message{Version: snmp.V2C, Community: []byte("public"),
+		Pdu: snmp.GetResponsePdu{Identifier: 7, Variables: oidVars(t, map[string]interface{}{"1.3.6.1.2.1.1.1.0": "corrupt"},
+			"1.3.6.1.2.1.1.1.0")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// message, version, community, PDU, request-id, error-status, error-index, varbinds, varbind, OID, value
+	if offsets := berTLVOffsets(response); len(offsets) != 11 {
+		t.Errorf("%d TLVs, want 11", len(offsets))
+	}
+
+	original := append([]byte{}, response...)
+	corrupter, err := newCorrupter(1, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		corrupted, how, ok := corrupter.Corrupt(response)
+		if !ok || bytes.Equal(corrupted, response) {
+			t.Fatalf("response not corrupted: %s", how)
+		}
+		kinds[strings.Fields(how)[0]] = true
+	}
+	if !kinds["truncated"] || !kinds["length"] || !kinds["tag"] {
+		t.Errorf("corruptions = %v, want truncations, lengths and tags", kinds)
+	}
+	if !bytes.Equal(response, original) {
+		t.Errorf("the response itself was changed")
+	}
+
+	corrupter, _ = newCorrupter(0.5, 42)
+	n := 0
+	for i := 0; i < 1000; i++ {
+		if _, _, ok := corrupter.Corrupt(response); ok {
+			n++
+		}
+	}
+	if n < 400 || n > 600 {
+		t.Errorf("%d of 1000 corrupted at a rate of 0.5", n)
+	}
+
+	for _, rate := range []float64{-0.1, 1.5} {
+		if _, err := newCorrupter(rate, 1); err == nil {
+			t.Errorf("rate %g accepted", rate)
+		}
+	}
+}
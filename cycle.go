@@ -0,0 +1,26 @@
+package main
+
+// nextCycleValue returns the value of a variable with a cycle for this read and moves on to the next one
+// The value is also set in the variable so the program sees what was last served.
+func (interp *Interpreter) nextCycleValue(typ *Type) *Value {
+	interp.valLock.Lock()
+	defer interp.valLock.Unlock()
+
+	pos := interp.cyclePositions[typ.oid]
+	val := typ.cycle.values[pos]
+	pos++
+	if pos == len(typ.cycle.values) {
+		if typ.cycle.once {
+			pos--
+		} else {
+			pos = 0
+		}
+	}
+	interp.cyclePositions[typ.oid] = pos
+
+	// copy as values are replaced rather than updated
+	served := *val
+	interp.oid2Values[typ.oid] = &served
+	interp.values[typ.id] = &served
+	return &served
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/PromonLogicalis/snmp"
+)
+
+const cycleTestProg = `
+var
+  status: 2.1.25.3.2.1.5.1 integer [2 = 'running', 3 = 'warning'] cycle ['running', 'warning', 5]
+  descr: 2.1.1.1.0 string once ["booting", "ready"]
+endvar
+run
+endrun`
+
+func TestCycle(t *testing.T) {
+	agent, interp := newTestAgent(t, cycleTestProg)
+	get := func() []interface{} {
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{
+			Variables: oidVars(t, nil, "1.3.6.1.2.1.25.3.2.1.5.1", "1.3.6.1.2.1.1.1.0")})
+		return []interface{}{resp.Variables[0].Value, resp.Variables[1].Value}
+	}
+
+	want := [][]interface{}{{2, "booting"}, {3, "ready"}, {5, "ready"}, {2, "ready"}}
+	for i, w := range want {
+		got := get()
+		if got[0] != w[0] || got[1] != w[1] {
+			t.Errorf("GET %d = %v, want %v", i, got, w)
+		}
+	}
+	if val, _ := interp.GetValueForId("status"); val.intVal != 2 {
+		t.Errorf("status variable = %d, want the last served 2", val.intVal)
+	}
+}
+
+func TestCycleConcurrent(t *testing.T) {
+	agent, _ := newTestAgent(t, cycleTestProg)
+	oid, _ := strToOID("1.3.6.1.2.1.25.3.2.1.5.1")
+	object, _ := agent.getObject(oid)
+
+	const reads = 300
+	var lock sync.Mutex
+	counts := make(map[int]int)
+	var wg sync.WaitGroup
+	for i := 0; i < reads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := object.getter(context.Background(), oid)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			lock.Lock()
+			counts[value.(int)]++
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// each value is served exactly as often as the others
+	for _, value := range []int{2, 3, 5} {
+		if counts[value] != reads/3 {
+			t.Errorf("value %d served %d times, want %d", value, counts[value], reads/3)
+		}
+	}
+}
+
+func TestCycleErrors(t *testing.T) {
+	tests := []string{
+		"x: 2.1.1 integer cycle []",
+		"x: 2.1.1 integer cycle [1, \"two\"]",
+		"x: integer cycle [1, 2]",
+		"x: 2.1.1 counter once [-1]",
+		"x: 2.1.1 integer cycle [1 2]",
+	}
+	for _, decl := range tests {
+		_, err := NewParser(lex("test", "var\n  "+decl+"\nendvar\nrun\nendrun")).ParseProgram()
+		if err == nil {
+			t.Errorf("%s: no error", decl)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// servedValue is the type and value an OID is served with, as written by get and walk
+type servedValue struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// ProfileChange is an OID served by one of two programs and not the other, or with a different type or value
+type ProfileChange struct {
+	Oid    string       `json:"oid"`
+	Change string       `json:"change"`        // added, removed or changed
+	Old    *servedValue `json:"old,omitempty"` // nil if added
+	New    *servedValue `json:"new,omitempty"` // nil if removed
+}
+
+// servedSnmpValues returns the OIDs a program serves in numeric order, as -list-oids gives them, and their
+// initial values as served: the first of a cycle and a wave at the start. The tables have no rows yet.
+func servedSnmpValues(interp *Interpreter) (oids []string, values map[string]interface{}, err error) {
+	agent := NewAgent()
+	err = addProgramOIDs(agent, interp, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	values = make(map[string]interface{})
+	for _, oid := range agent.ManagedOids() {
+		oidStr := oid.String()
+		targetOid := oidStr
+		if aliasTarget, ok := interp.aliasOids[oidStr]; ok {
+			targetOid = aliasTarget
+		}
+		typ, found := interp.GetTypeForOid(targetOid)
+		if !found {
+			continue
+		}
+		var val *Value
+		switch {
+		case typ.cycle != nil:
+			val = typ.cycle.values[0]
+		case typ.countOf != nil:
+			val = interp.countOfValue(typ)
+		case typ.wave != nil:
+			val = &Value{valueType: typ.valueType, intVal: typ.wave.valueAt(0)}
+		default:
+			val, found = interp.GetValueForOid(targetOid)
+			if !found {
+				continue
+			}
+		}
+		snmpValue, err := convertValueToSnmp(val, typ)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", oidStr, err)
+		}
+		oids = append(oids, oidStr)
+		values[oidStr] = snmpValue
+	}
+	return oids, values, nil
+}
+
+// servedValues returns the initial values of the OIDs a program serves, as -list-oids gives them: with the
+// instances of ranges and the aliases. A table is its entry OID with the columns as the value since it has
+// no rows until they are created.
+func servedValues(interp *Interpreter) (map[string]servedValue, error) {
+	oids, snmpValues, err := servedSnmpValues(interp)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]servedValue)
+	for _, oidStr := range oids {
+		typStr, text := formatSnmpValue(snmpValues[oidStr])
+		values[oidStr] = servedValue{Type: typStr, Value: text}
+	}
+	for _, table := range interp.variables.tables {
+		var columns []string
+		for _, column := range table.columns {
+			typStr := Type{valueType: column.valueType}.String()
+			if column == table.statusColumn {
+				typStr = "RowStatus"
+			}
+			columns = append(columns, fmt.Sprintf("%d %s %s", column.subId, column.id, typStr))
+		}
+		values[table.oid] = servedValue{Type: "Table", Value: strings.Join(columns, ", ")}
+	}
+	return values, nil
+}
+
+// diffProfiles returns the changes from the served values of one program to those of another in OID order
+func diffProfiles(oldValues map[string]servedValue, newValues map[string]servedValue) ([]ProfileChange, error) {
+	var oids []string
+	for oid := range oldValues {
+		oids = append(oids, oid)
+	}
+	for oid := range newValues {
+		if _, ok := oldValues[oid]; !ok {
+			oids = append(oids, oid)
+		}
+	}
+	err := sortOIDStrings(oids)
+	if err != nil {
+		return nil, err
+	}
+	var changes []ProfileChange
+	for _, oid := range oids {
+		oldValue, inOld := oldValues[oid]
+		newValue, inNew := newValues[oid]
+		switch {
+		case !inOld:
+			changes = append(changes, ProfileChange{Oid: oid, Change: "added", New: &newValue})
+		case !inNew:
+			changes = append(changes, ProfileChange{Oid: oid, Change: "removed", Old: &oldValue})
+		case oldValue != newValue:
+			changes = append(changes, ProfileChange{Oid: oid, Change: "changed", Old: &oldValue, New: &newValue})
+		}
+	}
+	return changes, nil
+}
+
+// writeProfileChanges writes the changes a line each, prefixed + for added, - for removed and ~ for changed,
+// or as JSON objects a line each
+func writeProfileChanges(out io.Writer, changes []ProfileChange, jsonLines bool) error {
+	encoder := json.NewEncoder(out)
+	for _, change := range changes {
+		var err error
+		switch {
+		case jsonLines:
+			err = encoder.Encode(change)
+		case change.Change == "added":
+			_, err = fmt.Fprintf(out, "+ %s = %s: %s\n", change.Oid, change.New.Type, change.New.Value)
+		case change.Change == "removed":
+			_, err = fmt.Fprintf(out, "- %s = %s: %s\n", change.Oid, change.Old.Type, change.Old.Value)
+		default:
+			_, err = fmt.Fprintf(out, "~ %s = %s: %s -> %s: %s\n", change.Oid, change.Old.Type, change.Old.Value,
+				change.New.Type, change.New.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadServedValues loads a program and returns the initial values of the OIDs it serves
+func loadServedValues(filename string, format string, varInits VariableInits) (map[string]servedValue, error) {
+	program, err := loadProgramAs(filename, format, nil)
+	if err != nil {
+		return nil, err
+	}
+	interp := new(Interpreter)
+	err = interp.Init(program, varInits)
+	if err != nil {
+		return nil, fmt.Errorf("%s: Initialization error: %v", filename, err)
+	}
+	return servedValues(interp)
+}
+
+// runDiff is the diff subcommand returning the exit status, which is 0 if the programs serve the same,
+// 1 if they differ and 2 for an error, like diff
+// snmprun diff [-V key=value] [-json] old.sim new.sim
+func runDiff(args []string, out io.Writer) int {
+	varInits := make(VariableInits)
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	flags.Var(&varInits, "V", "variable initializers for both programs")
+	format := flags.String("format", "", "format of the program files: sim, json or snmprec (default is from a .json or .snmprec extension otherwise sim)")
+	jsonLines := flags.Bool("json", false, "write each change as a JSON object on a line")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		fmt.Fprintln(out, "Usage: snmprun diff [-V key=value] [-json] old.sim new.sim")
+		return 2
+	}
+	logger = newLevelLogger(os.Stderr, "snmpsim", log.LstdFlags, LogWarn)
+
+	oldValues, err := loadServedValues(flags.Arg(0), *format, varInits)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	newValues, err := loadServedValues(flags.Arg(1), *format, varInits)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	changes, err := diffProfiles(oldValues, newValues)
+	if err == nil {
+		err = writeProfileChanges(out, changes, *jsonLines)
+	}
+	if err != nil {
+		fmt.Fprintf(out, "diff failed: %s\n", err)
+		return 2
+	}
+	if len(changes) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const diffTestOld = `
+var
+  descr: 2.1.1.1.0 string = "firmware 1.0"
+  contact: 2.1.1.4.0 rw string = "ops"
+  ifDescr.[1..2]: 2.1.2.2.1.2 string = "eth%d"
+  alias 2.1.1.6.0 = 2.1.1.4.0
+endvar
+run
+endrun`
+
+const diffTestNew = `
+var
+  descr: 2.1.1.1.0 string = "firmware 2.0"
+  ifDescr.[1..3]: 2.1.2.2.1.2 string = "eth%d"
+  ifMtu: 2.1.2.2.1.4.1 integer = 1500
+  location: 2.1.1.6.0 string = "lab"
+endvar
+run
+endrun`
+
+func TestDiffProfiles(t *testing.T) {
+	_, oldInterp := parseTestProgram(t, diffTestOld)
+	_, newInterp := parseTestProgram(t, diffTestNew)
+	oldValues, err := servedValues(oldInterp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newValues, err := servedValues(newInterp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := diffProfiles(oldValues, newValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := writeProfileChanges(&out, changes, false); err != nil {
+		t.Fatal(err)
+	}
+	want := `~ .1.3.6.1.2.1.1.1.0 = STRING: "firmware 1.0" -> STRING: "firmware 2.0"
+- .1.3.6.1.2.1.1.4.0 = STRING: "ops"
+~ .1.3.6.1.2.1.1.6.0 = STRING: "ops" -> STRING: "lab"
++ .1.3.6.1.2.1.2.2.1.2.3 = STRING: "eth3"
++ .1.3.6.1.2.1.2.2.1.4.1 = INTEGER: 1500
+`
+	if out.String() != want {
+		t.Errorf("diff =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	dir := t.TempDir()
+	oldFile := filepath.Join(dir, "old.sim")
+	newFile := filepath.Join(dir, "new.sim")
+	os.WriteFile(oldFile, []byte(diffTestOld), 0644)
+	os.WriteFile(newFile, []byte(diffTestNew), 0644)
+
+	var out bytes.Buffer
+	if status := runDiff([]string{oldFile, oldFile}, &out); status != 0 || out.Len() != 0 {
+		t.Errorf("same program: status %d, output %s", status, out.String())
+	}
+	if status := runDiff([]string{"-json", oldFile, newFile}, &out); status != 1 {
+		t.Errorf("status %d, want 1", status)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("%d lines, want 5:\n%s", len(lines), out.String())
+	}
+	var change ProfileChange
+	if err := json.Unmarshal([]byte(lines[1]), &change); err != nil {
+		t.Fatal(err)
+	}
+	if change.Oid != ".1.3.6.1.2.1.1.4.0" || change.Change != "removed" || change.New != nil || change.Old.Value != `"ops"` {
+		t.Errorf("change = %+v", change)
+	}
+	if status := runDiff([]string{oldFile, filepath.Join(dir, "missing.sim")}, &out); status != 2 {
+		t.Errorf("missing program: status %d, want 2", status)
+	}
+}
@@ -0,0 +1,63 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// enableDstAddr has the kernel pass the destination address of each datagram read from the socket,
+// so a request sent to a broadcast or multicast address can be told from one sent to us.
+// A socket listening on all addresses may be IPv6 with IPv4 mapped into it, so both options are tried.
+func enableDstAddr(conn *net.UDPConn) error {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ip4Err, ip6Err error
+	err = rawConn.Control(func(fd uintptr) {
+		ip4Err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_PKTINFO, 1)
+		ip6Err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_RECVPKTINFO, 1)
+	})
+	if err != nil {
+		return err
+	}
+	if ip4Err != nil && ip6Err != nil {
+		return ip4Err
+	}
+	return nil
+}
+
+// readFromWithDst reads a datagram with its source and destination addresses, the destination being nil
+// if the kernel did not pass it
+func readFromWithDst(conn *net.UDPConn, buffer []byte) (n int, source net.Addr, dst net.IP, err error) {
+	oob := make([]byte, 128)
+	n, oobn, _, udpAddr, err := conn.ReadMsgUDP(buffer, oob)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return n, udpAddr, pktinfoDst(oob[:oobn]), nil
+}
+
+// pktinfoDst returns the destination address of the IP_PKTINFO or IPV6_PKTINFO control message, nil if none
+func pktinfoDst(oob []byte) net.IP {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+	for _, msg := range msgs {
+		switch {
+		case msg.Header.Level == syscall.IPPROTO_IP && msg.Header.Type == syscall.IP_PKTINFO &&
+			len(msg.Data) >= syscall.SizeofInet4Pktinfo:
+			// struct in_pktinfo: ifindex, then the local address, then the destination of the header
+			return net.IP(append([]byte(nil), msg.Data[8:12]...))
+		case msg.Header.Level == syscall.IPPROTO_IPV6 && msg.Header.Type == syscall.IPV6_PKTINFO &&
+			len(msg.Data) >= syscall.SizeofInet6Pktinfo:
+			// struct in6_pktinfo: the destination, then ifindex
+			return net.IP(append([]byte(nil), msg.Data[:16]...))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// enableDstAddr is not supported on this platform
+func enableDstAddr(conn *net.UDPConn) error {
+	return errors.New("destination addresses of datagrams not available on this platform")
+}
+
+// readFromWithDst reads a datagram, the destination address being unknown on this platform
+func readFromWithDst(conn *net.UDPConn, buffer []byte) (n int, source net.Addr, dst net.IP, err error) {
+	n, source, err = conn.ReadFrom(buffer)
+	return n, source, nil, err
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+)
+
+// snmpEngineOid is the snmpEngine group of SNMP-FRAMEWORK-MIB (RFC 3411)
+const snmpEngineOid = ".1.3.6.1.6.3.10.2.1"
+
+// engineIdEnterprise is the enterprise of the default snmpEngineID, that of net-snmp which managers recognise
+const engineIdEnterprise = 8072
+
+// EngineConfig is the SNMP engine served in the snmpEngine group, which an SNMPv3 manager discovers first
+type EngineConfig struct {
+	id    []byte // snmpEngineID
+	boots int    // snmpEngineBoots at startup, counted up by each reboot of the program
+}
+
+// defaultEngineId returns an snmpEngineID in the octets format of RFC 3411 from the run id,
+// so it is the same for the same -run-id
+func defaultEngineId() []byte {
+	sum := sha256.Sum256([]byte(runId))
+	id := []byte{0x80 | engineIdEnterprise>>24, engineIdEnterprise >> 16 & 0xff, engineIdEnterprise >> 8 & 0xff,
+		engineIdEnterprise & 0xff, 5}
+	return append(id, sum[:8]...)
+}
+
+// parseEngineId parses an snmpEngineID in hex with an optional 0x, which is 5 to 32 octets
+func parseEngineId(text string) ([]byte, error) {
+	id, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(text, "0x"), "0X"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid -engine-id %s: %v", text, err)
+	}
+	if len(id) < 5 || len(id) > 32 {
+		return nil, fmt.Errorf("Invalid -engine-id %s: %d octets, expecting 5 to 32", text, len(id))
+	}
+	return id, nil
+}
+
+// engineObject is an object of the snmpEngine group
+type engineObject struct {
+	subOid string
+	getter func(engine *EngineConfig, interp *Interpreter, maxMsgSize uint) GetHandler
+}
+
+var engineObjects = []engineObject{
+	{".1.0", func(engine *EngineConfig, interp *Interpreter, maxMsgSize uint) GetHandler {
+		return constantValue(string(engine.id))
+	}},
+	{".2.0", func(engine *EngineConfig, interp *Interpreter, maxMsgSize uint) GetHandler {
+		return func(ctx context.Context, oid asn1.Oid) (interface{}, error) {
+			return engine.boots + interp.Reboots(), nil
+		}
+	}},
+	{".3.0", func(engine *EngineConfig, interp *Interpreter, maxMsgSize uint) GetHandler {
+		return func(ctx context.Context, oid asn1.Oid) (interface{}, error) {
+			// seconds since the last boot, which is when snmpEngineBoots went up
+			return int(interp.Uptime() / time.Second), nil
+		}
+	}},
+	{".4.0", func(engine *EngineConfig, interp *Interpreter, maxMsgSize uint) GetHandler {
+		return constantValue(int(maxMsgSize))
+	}},
+}
+
+// addEngineOids serves snmpEngineID, snmpEngineBoots, snmpEngineTime and snmpEngineMaxMessageSize,
+// apart from those the program declares. A reboot of the program counts up the boots and starts the time again.
+func addEngineOids(agent *Agent, interp *Interpreter, engine *EngineConfig, maxMsgSize uint) {
+	for _, object := range engineObjects {
+		oidStr := snmpEngineOid + object.subOid
+		if _, declared := interp.GetTypeForOid(oidStr); declared {
+			continue
+		}
+		oid, _ := strToOID(oidStr)
+		agent.AddRoManagedObject(oid, object.getter(engine, interp, maxMsgSize))
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/PromonLogicalis/snmp"
+)
+
+func TestEngineOids(t *testing.T) {
+	_, interp := parseTestProgram(t, `
+var
+  descr: 2.1.1.1.0 string = "engine"
+  max-size: 6.3.10.2.1.4.0 integer = 1400
+endvar
+run
+endrun`)
+	agent := NewAgent()
+	if err := addProgramOIDs(agent, interp, false); err != nil {
+		t.Fatal(err)
+	}
+	engine := &EngineConfig{id: []byte{0x80, 0x00, 0x1f, 0x88, 0x04, 't', 'e', 's', 't'}, boots: 3}
+	addEngineOids(agent, interp, engine, maxDatagramSize)
+
+	oids := []string{"1.3.6.1.6.3.10.2.1.1.0", "1.3.6.1.6.3.10.2.1.2.0", "1.3.6.1.6.3.10.2.1.3.0", "1.3.6.1.6.3.10.2.1.4.0"}
+	get := func() []snmp.Variable {
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, oids...)})
+		if resp.ErrorStatus != snmp.NoError {
+			t.Fatalf("status %d", resp.ErrorStatus)
+		}
+		return resp.Variables
+	}
+	vars := get()
+	if vars[0].Value != string(engine.id) || vars[1].Value != 3 || vars[2].Value != 0 {
+		t.Errorf("engine = %v", vars)
+	}
+	// the program's declaration is served rather than the maximum message size
+	if vars[3].Value != 1400 {
+		t.Errorf("snmpEngineMaxMessageSize = %v, want the declared 1400", vars[3].Value)
+	}
+
+	interp.reboot()
+	if vars := get(); vars[1].Value != 4 {
+		t.Errorf("snmpEngineBoots = %v after a reboot, want 4", vars[1].Value)
+	}
+}
+
+func TestEngineId(t *testing.T) {
+	id := defaultEngineId()
+	if len(id) != 13 || !bytes.Equal(id[:5], []byte{0x80, 0x00, 0x1f, 0x88, 0x05}) {
+		t.Errorf("default engine id %X", id)
+	}
+	if !bytes.Equal(id, defaultEngineId()) {
+		t.Errorf("default engine id changes")
+	}
+
+	if id, err := parseEngineId("0x80001F8804746573"); err != nil || len(id) != 8 || id[7] != 0x73 {
+		t.Errorf("engine id %X, error %v", id, err)
+	}
+	for _, text := range []string{"0x8000", "80001f88zz", "0x" + string(bytes.Repeat([]byte("ab"), 33))} {
+		if _, err := parseEngineId(text); err == nil {
+			t.Errorf("%s accepted", text)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The kinds of error, for callers to tell apart with errors.Is
+var (
+	// ErrUnknownOID is an OID which has no variable or value
+	ErrUnknownOID = errors.New("Unknown OID")
+	// ErrTypeMismatch is a value whose type does not match the variable, such as a SET of a string to an integer
+	ErrTypeMismatch = errors.New("Type mismatch")
+	// ErrNotWritable is a SET of a variable whose type can not be set, such as a counter
+	ErrNotWritable = errors.New("Not writable")
+	// ErrWrongLength is a SET of a string longer than the maximum length of the variable
+	ErrWrongLength = errors.New("Wrong length")
+	// ErrWrongValue is a SET of a value outside the range of the variable
+	ErrWrongValue = errors.New("Wrong value")
+	// ErrIllegalValue is a value which can not be served
+	ErrIllegalValue = errors.New("Illegal Value")
+	// ErrSourceFailed is a value which could not be worked out, such as a failed fetch from a backend
+	ErrSourceFailed = errors.New("Source failed")
+	// ErrParse is an error in a program, the details of which are in a ParseError
+	ErrParse = errors.New("Parse error")
+)
+
+// OIDError is an error getting or setting the value of an OID
+// It is one of the kinds of error above, e.g. errors.Is(err, ErrTypeMismatch).
+type OIDError struct {
+	Oid     string
+	Kind    error
+	Message string // details of the error, empty for just the kind
+}
+
+func (e *OIDError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s: %v", e.Oid, e.Kind)
+	}
+	return fmt.Sprintf("%s: %s", e.Oid, e.Message)
+}
+
+func (e *OIDError) Unwrap() error {
+	return e.Kind
+}
+
+// oidErrorf returns an OIDError of a kind with the formatted details
+func oidErrorf(oidStr string, kind error, format string, a ...interface{}) error {
+	return &OIDError{Oid: oidStr, Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+// ParseError is an error at a line of a program
+type ParseError struct {
+	Name    string // of the program
+	Line    int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: Error at line %d: %s", e.Name, e.Line, e.Message)
+}
+
+// Is makes every ParseError an ErrParse
+func (e *ParseError) Is(target error) bool {
+	return target == ErrParse
+}
+
+// RuntimeError is an error interpreting the statement at a line of a program
+type RuntimeError struct {
+	Line int
+	Err  error
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("Error at line %d: %v", e.Line, e.Err)
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
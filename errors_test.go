@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/PromonLogicalis/asn1"
+)
+
+func TestParseErrorType(t *testing.T) {
+	_, err := Parse("bad.sim", "var\n  x: 2.1.1 integer\n  x: 2.1.2 integer\nendvar\nrun\nendrun")
+	if !errors.Is(err, ErrParse) {
+		t.Fatalf("error %v is not ErrParse", err)
+	}
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("error %v is not a ParseError", err)
+	}
+	if parseErr.Name != "bad.sim" || parseErr.Line == 0 {
+		t.Errorf("error at %s line %d, want a line of bad.sim", parseErr.Name, parseErr.Line)
+	}
+	if got, want := err.Error(), fmt.Sprintf("bad.sim: Error at line %d: %s", parseErr.Line, parseErr.Message); got != want {
+		t.Errorf("message %q, want %q", got, want)
+	}
+}
+
+func TestOIDErrorTypes(t *testing.T) {
+	agent, interp := newTestAgent(t, `
+var
+  contact: 2.1.1.4.0 rw string
+endvar
+run
+endrun`)
+	oid := asn1.Oid{1, 3, 6, 1, 2, 1, 1, 4, 0}
+	object, _ := agent.getObject(oid)
+	_, err := object.setter(context.Background(), oid, 42)
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("set: error %v, want ErrTypeMismatch", err)
+	}
+	var oidErr *OIDError
+	if !errors.As(err, &oidErr) || oidErr.Oid != oid.String() {
+		t.Errorf("set: error %v does not have the OID", err)
+	}
+
+	// the value has gone, e.g. a reset part way through a request
+	interp.valLock.Lock()
+	delete(interp.oid2Values, oid.String())
+	interp.valLock.Unlock()
+	_, err = object.getter(context.Background(), oid)
+	if !errors.Is(err, ErrUnknownOID) {
+		t.Errorf("get: error %v, want ErrUnknownOID", err)
+	}
+}
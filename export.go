@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// typeKeywords are the keywords of the types of the variables an export declares
+var typeKeywords = map[ValueType]string{
+	ValueInteger:     "integer",
+	ValueString:      "string",
+	ValueCounter:     "counter",
+	ValueCounter64:   "counter64",
+	ValueGuage:       "guage",
+	ValueTimeticks:   "timeticks",
+	ValueIpv4address: "ipaddress",
+	ValueInetAddress: "inetaddress",
+	ValueBitset:      "bitset",
+	ValueOid:         "oid",
+}
+
+// exportProgram writes the current values of the variables with OIDs as a program of one declaration per line
+// in numeric OID order, e.g.
+//
+//	.1.3.6.1.2.1.1.1.0 string = "router" // descr
+//
+// so the diff of two exports of a large profile is a line per changed OID. The export parses back to a program
+// serving the same values. Tables and bytes variables do not fit on a line so they are left as comments.
+func exportProgram(out io.Writer, interp *Interpreter) error {
+	var oids []string
+	for oid := range interp.variables.typesFromOid {
+		oids = append(oids, oid)
+	}
+	if err := sortOIDStrings(oids); err != nil {
+		return err
+	}
+	var aliasOids []string
+	for oid := range interp.variables.oidAliases {
+		aliasOids = append(aliasOids, oid)
+	}
+	if err := sortOIDStrings(aliasOids); err != nil {
+		return err
+	}
+	var tableIds []string
+	for id := range interp.variables.tables {
+		tableIds = append(tableIds, id)
+	}
+	sort.Strings(tableIds)
+
+	lines := []string{"var"}
+	for _, oid := range oids {
+		typ, _ := interp.GetTypeForOid(oid)
+		val, found := interp.GetValueForOid(oid)
+		if !found {
+			continue
+		}
+		lines = append(lines, "  "+declarationLine(typ, val))
+	}
+	for _, oid := range aliasOids {
+		lines = append(lines, fmt.Sprintf("  alias %s = %s", oid, interp.variables.oidAliases[oid]))
+	}
+	for _, id := range tableIds {
+		lines = append(lines, fmt.Sprintf("  // table %s at %s is not exported", id, interp.variables.tables[id].oid))
+	}
+	lines = append(lines, "endvar", "run", "endrun")
+	_, err := io.WriteString(out, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// declarationLine returns the declaration of a variable by its OID with the value as the initial value
+func declarationLine(typ *Type, val *Value) string {
+	keyword, ok := typeKeywords[typ.valueType]
+	if !ok {
+		return fmt.Sprintf("// %s %s is not exported", typ.oid, typ.id)
+	}
+	var line strings.Builder
+	line.WriteString(typ.oid)
+	switch typ.snmpMode {
+	case SnmpModeReadWrite:
+		if typ.access == AccessDefault {
+			line.WriteString(" rw")
+		}
+	case SnmpModeReadWriteBlocked:
+		line.WriteString(" rwb")
+	}
+	line.WriteString(" " + keyword)
+	if typ.maxLength > 0 {
+		fmt.Fprintf(&line, "(%d)", typ.maxLength)
+	}
+	if typ.valueRange != nil {
+		fmt.Fprintf(&line, "(%s)", typ.valueRange)
+	}
+	if typ.access != AccessDefault {
+		line.WriteString(" access " + typ.access.String())
+	}
+	line.WriteString(" = " + literalText(val))
+	if typ.id != typ.oid {
+		line.WriteString(" // " + typ.id)
+	}
+	return line.String()
+}
+
+// runExport is the export subcommand returning the exit status
+// snmprun export [-V key=value] [-to sim|snmprec] program.sim
+func runExport(args []string, out io.Writer) int {
+	varInits := make(VariableInits)
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.Var(&varInits, "V", "variable initializers")
+	format := flags.String("format", "", "format of the program file: sim, json or snmprec (default is from a .json or .snmprec extension otherwise sim)")
+	to := flags.String("to", "sim", "format to export to: sim for a program or snmprec for a data file of snmpsim")
+	flags.Parse(args)
+
+	var export func(io.Writer, *Interpreter) error
+	switch *to {
+	case "sim":
+		export = exportProgram
+	case "snmprec":
+		export = exportSnmprec
+	default:
+		fmt.Printf("Invalid format to export to %s, expecting sim or snmprec\n", *to)
+		return 1
+	}
+
+	if flags.NArg() != 1 {
+		fmt.Print("Missing filename to export\n")
+		return 1
+	}
+	logger = newLevelLogger(os.Stderr, "snmpsim", log.LstdFlags, LogWarn)
+
+	program, err := loadProgramAs(flags.Arg(0), *format, nil)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	interp := new(Interpreter)
+	err = interp.Init(program, varInits)
+	if err != nil {
+		fmt.Printf("Initialization error: %s\n", err)
+		return 1
+	}
+	err = export(out, interp)
+	if err != nil {
+		fmt.Printf("export failed: %s\n", err)
+		return 1
+	}
+	return 0
+}
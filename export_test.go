@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExportRoundTrip(t *testing.T) {
+	prog := `
+var
+  descr: 2.1.1.1.0 string(16) = 0x7361792022686922
+  admin: 2.1.2.2.1.7.1 rw integer(1..3) = 2
+  in-octets: 2.1.2.2.1.10.1 counter = 1234
+  flags: 4.1.9.1.0 bitset = [1, 3]
+  object: 2.1.1.2.0 oid = .1.3.6.1.4.1.8072
+  addr: 2.1.4.20.1.1.0 ipaddress = 10.0.0.1
+  sysname: 2.1.1.5.0 rw string access read-only = "router"
+  alias 2.1.1.6.0 = 2.1.1.5.0
+endvar
+run
+endrun`
+	_, interp := parseTestProgram(t, prog)
+
+	var exported bytes.Buffer
+	if err := exportProgram(&exported, interp); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(exported.String(), "\n  .1.3.6.1.2.1.2.2.1.7.1 rw integer(1..3) = 2 // admin\n") {
+		t.Errorf("export = %s", exported.String())
+	}
+
+	reparsed, err := Parse("export", exported.String())
+	if err != nil {
+		t.Fatalf("%s\n%s", err, exported.String())
+	}
+	reinterp := new(Interpreter)
+	if err := reinterp.Init(reparsed, make(VariableInits)); err != nil {
+		t.Fatal(err)
+	}
+	var again bytes.Buffer
+	if err := exportProgram(&again, reinterp); err != nil {
+		t.Fatal(err)
+	}
+	// the ids are the OIDs so the comments go but the declarations are the same
+	for i, line := range strings.Split(exported.String(), "\n") {
+		againLine := strings.Split(again.String(), "\n")[i]
+		if end := strings.Index(line, " // "); end > 0 && !strings.HasPrefix(line, "  //") {
+			line = line[:end]
+		}
+		if line != againLine {
+			t.Errorf("line %d = %s, want %s", i+1, againLine, line)
+		}
+	}
+}
+
+func TestExportSnmprec(t *testing.T) {
+	prog := `
+var
+  descr: 2.1.1.1.0 string = "edge router"
+  raw: 2.1.1.9.0 string = 0x0001ff
+  admin: 2.1.2.2.1.7.1 rw integer(1..3) = 2
+  in-octets: 2.1.2.2.1.10.1 counter = 1234
+  speed: 2.1.2.2.1.5.1 guage = 100000000
+  uptime: 2.1.1.3.0 timeticks = 4200
+  object: 2.1.1.2.0 oid = .1.3.6.1.4.1.8072
+  addr: 2.1.4.20.1.1.0 ipaddress = 10.0.0.1
+  hc-octets: 2.1.31.1.1.1.6.1 counter64 = 5000000000
+  alias 2.1.1.6.0 = 2.1.1.1.0
+endvar
+run
+endrun`
+	_, interp := parseTestProgram(t, prog)
+
+	var exported bytes.Buffer
+	if err := exportSnmprec(&exported, interp); err != nil {
+		t.Fatal(err)
+	}
+	expected := `1.3.6.1.2.1.1.1.0|4|edge router
+1.3.6.1.2.1.1.2.0|6|1.3.6.1.4.1.8072
+1.3.6.1.2.1.1.3.0|67|4200
+1.3.6.1.2.1.1.6.0|4|edge router
+1.3.6.1.2.1.1.9.0|4x|0001ff
+1.3.6.1.2.1.2.2.1.5.1|66|100000000
+1.3.6.1.2.1.2.2.1.7.1|2|2
+1.3.6.1.2.1.2.2.1.10.1|65|1234
+1.3.6.1.2.1.4.20.1.1.0|64|10.0.0.1
+1.3.6.1.2.1.31.1.1.1.6.1|70|5000000000
+`
+	if exported.String() != expected {
+		t.Errorf("export = %s, expecting %s", exported.String(), expected)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package main
+
+import "os"
+
+// notifyHangup does nothing as this platform, such as Windows or js/wasm, has no SIGHUP to reset with
+func notifyHangup(hangup chan<- os.Signal) {
+}
@@ -0,0 +1,15 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyHangup relays a SIGHUP to the channel, which runs the program again
+func notifyHangup(hangup chan<- os.Signal) {
+	signal.Notify(hangup, syscall.SIGHUP)
+}
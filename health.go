@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+// healthObject is an OID under the -health-oid, which describes snmprun itself rather than the simulated device
+type healthObject struct {
+	subOid string // under the -health-oid
+	name   string // for -list-oids
+	getter func(agent *Agent, started time.Time) GetHandler
+}
+
+var healthObjects = []healthObject{
+	{".1.0", "uptime", func(agent *Agent, started time.Time) GetHandler {
+		return func(ctx context.Context, oid asn1.Oid) (interface{}, error) {
+			// unlike sysUpTime this is not reset by a reboot of the program
+			return snmp.TimeTicks(time.Since(started) / (10 * time.Millisecond)), nil
+		}
+	}},
+	{".2.0", "requests", func(agent *Agent, started time.Time) GetHandler {
+		return func(ctx context.Context, oid asn1.Oid) (interface{}, error) {
+			return snmp.Counter32(agent.RequestCount()), nil
+		}
+	}},
+	{".3.0", "runId", func(agent *Agent, started time.Time) GetHandler {
+		return func(ctx context.Context, oid asn1.Oid) (interface{}, error) {
+			return runId, nil
+		}
+	}},
+}
+
+// addHealthOids serves the uptime of snmprun, the number of requests it has received and its run id under
+// the OID so the simulator can be watched by SNMP monitoring like any other device.
+func addHealthOids(agent *Agent, interp *Interpreter, healthOid string, started time.Time) error {
+	baseOid, err := canonicalOid(healthOid)
+	if err != nil {
+		return fmt.Errorf("Invalid -health-oid %s: %v", healthOid, err)
+	}
+	// the health OIDs are added last so any OID the program serves is already there
+	err = checkOidOverlap(agent, interp, baseOid, "-health-oid")
+	if err != nil {
+		return err
+	}
+	for _, object := range healthObjects {
+		oid, err := strToOID(baseOid + object.subOid)
+		if err != nil {
+			return fmt.Errorf("Invalid -health-oid %s: %v", healthOid, err)
+		}
+		agent.AddRoManagedObject(oid, object.getter(agent, started))
+	}
+	return nil
+}
+
+// checkOidOverlap returns an error if the OID of an option is under, or over, an OID already served
+func checkOidOverlap(agent *Agent, interp *Interpreter, baseOid string, option string) error {
+	var served []string
+	for _, oid := range agent.ManagedOids() {
+		served = append(served, oid.String())
+	}
+	for _, table := range interp.variables.tables {
+		served = append(served, table.oid)
+	}
+	for _, oidStr := range served {
+		if oidStr == baseOid || strings.HasPrefix(oidStr, baseOid+".") || strings.HasPrefix(baseOid, oidStr+".") {
+			return fmt.Errorf("%s %s overlaps %s of the program", option, baseOid, oidStr)
+		}
+	}
+	return nil
+}
+
+// healthOidName returns the name of an OID under the -health-oid for -list-oids, false if it is not one
+func healthOidName(healthOid string, oidStr string) (name string, ok bool) {
+	if healthOid == "" {
+		return "", false
+	}
+	baseOid, err := canonicalOid(healthOid)
+	if err != nil {
+		return "", false
+	}
+	for _, object := range healthObjects {
+		if oidStr == baseOid+object.subOid {
+			return object.name, true
+		}
+	}
+	return "", false
+}
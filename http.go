@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// ProgramInfo describes the program being served for the /info endpoint
+type ProgramInfo struct {
+	Program  string            `json:"program"`
+	Version  string            `json:"version"`
+	RunId    string            `json:"runId"` // of the snmprun process
+	Metadata map[string]string `json:"metadata"`
+	State    string            `json:"state,omitempty"` // running, finished or failed
+	Error    string            `json:"error,omitempty"` // why the program failed
+}
+
+// The states of a program
+const (
+	ProgramRunning  = "running"
+	ProgramFinished = "finished"
+	ProgramFailed   = "failed"
+)
+
+// ProgramStatus is the state of the program as it runs, shared with the /info endpoint
+type ProgramStatus struct {
+	lock  sync.Mutex
+	state string
+	err   error
+}
+
+func (status *ProgramStatus) Set(state string, err error) {
+	status.lock.Lock()
+	defer status.lock.Unlock()
+
+	status.state = state
+	status.err = err
+}
+
+func (status *ProgramStatus) Get() (state string, err error) {
+	status.lock.Lock()
+	defer status.lock.Unlock()
+
+	return status.state, status.err
+}
+
+// StatusServer is the HTTP server for tooling to find out about the simulation
+type StatusServer struct {
+	listener net.Listener
+	server   *http.Server
+	mux      *http.ServeMux
+	info     ProgramInfo
+	program  *ProgramStatus // nil if not known
+
+	responseSizes *SizeHistogram // nil until set
+	inflight      *InflightLimit // nil if no -max-inflight
+}
+
+// Stats are the statistics of the requests served for the /stats endpoint
+type Stats struct {
+	ResponseSizes SizeSummary      `json:"responseSizes"`
+	Inflight      *InflightSummary `json:"inflight,omitempty"` // only with a -max-inflight
+}
+
+func newStatusServer(addr string, filename string, program *Program, programStatus *ProgramStatus) (status *StatusServer, err error) {
+	status = &StatusServer{mux: http.NewServeMux(), program: programStatus}
+	status.info = ProgramInfo{
+		Program:  filename,
+		Version:  version,
+		RunId:    runId,
+		Metadata: program.metadata,
+	}
+	if status.info.Metadata == nil {
+		status.info.Metadata = make(map[string]string)
+	}
+	status.mux.HandleFunc("/info", status.handleInfo)
+	status.mux.HandleFunc("/stats", status.handleStats)
+
+	// listen now so a bad address is reported at startup
+	status.listener, err = net.Listen("tcp", statusListenAddr(addr))
+	if err != nil {
+		return nil, err
+	}
+	status.server = &http.Server{Handler: status.mux}
+	return status, nil
+}
+
+// statusListenAddr returns the address for the HTTP status server to listen on, which is localhost if the
+// address has no host, e.g. :8161 or just 8161, so the management endpoints are only exposed on other
+// interfaces when asked for. Listening on all of them is logged as a warning.
+func statusListenAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		// a port alone
+		host, port = "", addr
+	}
+	if host == "" {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		logger.Warnf("The HTTP status server listens on all interfaces (%s), use localhost:%s for this host only\n", addr, port)
+	}
+	return addr
+}
+
+// Serve serves HTTP requests until the server is closed
+func (status *StatusServer) Serve() {
+	err := status.server.Serve(status.listener)
+	if err != nil && err != http.ErrServerClosed {
+		logger.Errorf("HTTP server failed: %s\n", err)
+	}
+}
+
+// SetResponseSizes sets the histogram of response sizes for the /stats endpoint
+// Must call before Serve.
+func (status *StatusServer) SetResponseSizes(responseSizes *SizeHistogram) {
+	status.responseSizes = responseSizes
+}
+
+// SetInflight sets the limit of requests in flight for the /stats endpoint, nil for none
+// Must call before Serve.
+func (status *StatusServer) SetInflight(inflight *InflightLimit) {
+	status.inflight = inflight
+}
+
+func (status *StatusServer) Close() error {
+	return status.server.Close()
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(v)
+	if err != nil {
+		logger.Warnf("Failed to write HTTP response: %s\n", err)
+	}
+}
+
+func (status *StatusServer) handleInfo(w http.ResponseWriter, r *http.Request) {
+	info := status.info
+	if status.program != nil {
+		state, err := status.program.Get()
+		info.State = state
+		if err != nil {
+			info.Error = err.Error()
+		}
+	}
+	writeJSON(w, info)
+}
+
+func (status *StatusServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	var stats Stats
+	if status.responseSizes != nil {
+		stats.ResponseSizes = status.responseSizes.Summary()
+	} else {
+		stats.ResponseSizes.Buckets = []SizeBucket{}
+	}
+	if status.inflight != nil {
+		inflight := status.inflight.Summary()
+		stats.Inflight = &inflight
+	}
+	writeJSON(w, stats)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInfoEndpoint(t *testing.T) {
+	prog := `
+//@device: Cisco 2960
+#@vendor : Cisco Systems
+var
+  descr: 2.1.1.1.0 string // the description
+endvar
+run
+endrun`
+	program, _ := parseTestProgram(t, prog)
+
+	status, err := newStatusServer("127.0.0.1:0", "cisco.sim", program, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer status.listener.Close()
+
+	recorder := httptest.NewRecorder()
+	status.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/info", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status code %d", recorder.Code)
+	}
+	var info ProgramInfo
+	err = json.Unmarshal(recorder.Body.Bytes(), &info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Program != "cisco.sim" {
+		t.Errorf("program = %s", info.Program)
+	}
+	if info.RunId == "" || info.RunId != runId {
+		t.Errorf("run id = %q, want %q", info.RunId, runId)
+	}
+	if info.Metadata["device"] != "Cisco 2960" || info.Metadata["vendor"] != "Cisco Systems" {
+		t.Errorf("metadata = %v", info.Metadata)
+	}
+}
+
+func TestInfoProgramStatus(t *testing.T) {
+	program, _ := parseTestProgram(t, "var\n  x: integer\nendvar\nrun\nendrun")
+	programStatus := new(ProgramStatus)
+	status, err := newStatusServer("127.0.0.1:0", "test.sim", program, programStatus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer status.listener.Close()
+
+	programStatus.Set(ProgramFailed, &RuntimeError{Line: 7, Err: errors.New("Division by zero")})
+	recorder := httptest.NewRecorder()
+	status.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/info", nil))
+	var info ProgramInfo
+	err = json.Unmarshal(recorder.Body.Bytes(), &info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State != ProgramFailed || info.Error != "Error at line 7: Division by zero" {
+		t.Errorf("state %q, error %q", info.State, info.Error)
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	program, _ := parseTestProgram(t, "var\n  x: integer\nendvar\nrun\nendrun")
+	status, err := newStatusServer("127.0.0.1:0", "test.sim", program, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer status.listener.Close()
+	responseSizes := newSizeHistogram()
+	responseSizes.Record(60, false)
+	responseSizes.Record(2000, true)
+	status.SetResponseSizes(responseSizes)
+	inflight := newInflightLimit(8)
+	inflight.TryAcquire()
+	status.SetInflight(inflight)
+
+	recorder := httptest.NewRecorder()
+	status.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var stats Stats
+	err = json.Unmarshal(recorder.Body.Bytes(), &stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.ResponseSizes.Count != 2 || stats.ResponseSizes.Max != 2000 || stats.ResponseSizes.TooBig != 1 {
+		t.Errorf("response sizes %+v", stats.ResponseSizes)
+	}
+	if stats.Inflight == nil || *stats.Inflight != (InflightSummary{Current: 1, Max: 8}) {
+		t.Errorf("inflight %+v", stats.Inflight)
+	}
+}
+
+func TestStatusListenAddr(t *testing.T) {
+	if logger == nil {
+		logger = newLevelLogger(ioutil.Discard, "", 0, LogError)
+	}
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{":8161", "127.0.0.1:8161"},
+		{"8161", "127.0.0.1:8161"},
+		{"localhost:8161", "localhost:8161"},
+		{"10.1.1.1:8161", "10.1.1.1:8161"},
+		{"0.0.0.0:8161", "0.0.0.0:8161"},
+		{"[::]:8161", "[::]:8161"},
+	}
+	for _, test := range tests {
+		if got := statusListenAddr(test.addr); got != test.want {
+			t.Errorf("%s: listen on %s, want %s", test.addr, got, test.want)
+		}
+	}
+
+	program, _ := parseTestProgram(t, "var\n  x: integer\nendvar\nrun\nendrun")
+	status, err := newStatusServer(":0", "test.sim", program, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer status.listener.Close()
+	if ip := status.listener.Addr().(*net.TCPAddr).IP; !ip.IsLoopback() {
+		t.Errorf("listening on %s for a port alone, want localhost", ip)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// InetAddressType values of INET-ADDRESS-MIB (RFC 4001) for the addresses an inetaddress variable holds
+const (
+	InetAddressUnknown = 0
+	InetAddressIpv4    = 1
+	InetAddressIpv6    = 2
+)
+
+// InetAddress is the value of an inetaddress variable: an IPv4 or IPv6 address with its InetAddressType.
+// It is served as an OCTET STRING of 4 or 16 octets, unlike an ipaddress which is the 4 octet IpAddress type.
+// The zero value is the unknown type with no octets.
+type InetAddress struct {
+	addrType int
+	addr     net.IP // 4 octets for IPv4, 16 for IPv6
+}
+
+// parseInetAddress parses an IPv4 address in dotted decimal or an IPv6 address in any of the RFC 4291 forms,
+// or an empty string for the unknown type
+func parseInetAddress(text string) (inet InetAddress, err error) {
+	if text == "" {
+		return inet, nil
+	}
+	if strings.ContainsAny(text, "%[]/") {
+		// zones, brackets and prefix lengths are for the InetAddressIPv6z or other types
+		return inet, fmt.Errorf("Invalid inet address %s", text)
+	}
+	ip := net.ParseIP(text)
+	if ip == nil {
+		return inet, fmt.Errorf("Invalid inet address %s", text)
+	}
+	if ip4 := ip.To4(); ip4 != nil && !strings.Contains(text, ":") {
+		return InetAddress{addrType: InetAddressIpv4, addr: ip4}, nil
+	}
+	return InetAddress{addrType: InetAddressIpv6, addr: ip.To16()}, nil
+}
+
+// inetAddressFromOctets returns the address of an OCTET STRING set by SNMP, whose length gives its type
+func inetAddressFromOctets(octets string) (inet InetAddress, err error) {
+	switch len(octets) {
+	case 0:
+		return inet, nil
+	case net.IPv4len:
+		return InetAddress{addrType: InetAddressIpv4, addr: net.IP([]byte(octets))}, nil
+	case net.IPv6len:
+		return InetAddress{addrType: InetAddressIpv6, addr: net.IP([]byte(octets))}, nil
+	}
+	return inet, fmt.Errorf("Inet address of %d octets, expecting 4 or 16", len(octets))
+}
+
+// octets returns the OCTET STRING the address is served as
+func (inet InetAddress) octets() string {
+	return string(inet.addr)
+}
+
+func (inet InetAddress) String() string {
+	if inet.addrType == InetAddressUnknown {
+		return ""
+	}
+	if ip4 := inet.addr.To4(); inet.addrType == InetAddressIpv6 && ip4 != nil {
+		// net.IP writes an IPv4-mapped address as IPv4, which would parse back as the wrong type
+		return "::ffff:" + ip4.String()
+	}
+	return inet.addr.String()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/PromonLogicalis/snmp"
+)
+
+func TestParseInetAddress(t *testing.T) {
+	tests := []struct {
+		text     string
+		addrType int
+		octets   string
+	}{
+		{"10.0.0.1", InetAddressIpv4, "\x0a\x00\x00\x01"},
+		{"2001:db8::1", InetAddressIpv6, string(net.ParseIP("2001:db8::1"))},
+		{"::ffff:10.0.0.1", InetAddressIpv6, string(net.ParseIP("::ffff:10.0.0.1"))},
+		{"", InetAddressUnknown, ""},
+	}
+	for _, test := range tests {
+		inet, err := parseInetAddress(test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+			continue
+		}
+		if inet.addrType != test.addrType || inet.octets() != test.octets || inet.String() != test.text {
+			t.Errorf("%s = type %d, octets %x, %s", test.text, inet.addrType, inet.octets(), inet)
+		}
+	}
+	for _, text := range []string{"10.0.0.256", "10.0.0", "2001:db8::g", "2001:db8:::1", "fe80::1%eth0", "[2001:db8::1]", "10.0.0.0/8"} {
+		if _, err := parseInetAddress(text); err == nil {
+			t.Errorf("%s: expected error", text)
+		}
+	}
+}
+
+func TestInetAddressVariables(t *testing.T) {
+	agent, _ := newTestAgent(t, `
+var
+  v4: 2.1.4.34.1.3.1 inetaddress = 192.0.2.1
+  v6: 2.1.4.34.1.3.2 rw inetaddress = "2001:db8::1"
+  next-hop: 2.1.4.34.1.3.3 inetaddress cycle ["192.0.2.1", "2001:db8::2"]
+endvar
+run
+endrun`)
+
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil,
+		"1.3.6.1.2.1.4.34.1.3.1", "1.3.6.1.2.1.4.34.1.3.2")})
+	if resp.Variables[0].Value != "\xc0\x00\x02\x01" {
+		t.Errorf("v4 = %q, want 4 octets", resp.Variables[0].Value)
+	}
+	if resp.Variables[1].Value != string(net.ParseIP("2001:db8::1")) {
+		t.Errorf("v6 = %q, want 16 octets", resp.Variables[1].Value)
+	}
+
+	v6Oid := "1.3.6.1.2.1.4.34.1.3.2"
+	newAddr := string(net.ParseIP("2001:db8::99"))
+	resp = request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{Variables: oidVars(t,
+		map[string]interface{}{v6Oid: newAddr}, v6Oid)})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("set: status %d", resp.ErrorStatus)
+	}
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, v6Oid)})
+	if resp.Variables[0].Value != newAddr {
+		t.Errorf("after set = %q", resp.Variables[0].Value)
+	}
+	resp = request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{Variables: oidVars(t,
+		map[string]interface{}{v6Oid: "12345"}, v6Oid)})
+	if resp.ErrorStatus != snmp.WrongLength {
+		t.Errorf("set of 5 octets: status %d, want wrongLength", resp.ErrorStatus)
+	}
+}
+
+func TestInetAddressParseErrors(t *testing.T) {
+	if logger == nil {
+		logger = newLevelLogger(ioutil.Discard, "", 0, LogError)
+	}
+	progs := []string{
+		"var\n  a: 2.1.1.1.0 inetaddress = \"2001:db8::g\"\nendvar\nrun\nendrun\n",
+		"var\n  a: 2.1.1.1.0 inetaddress = 10.0.0.300\nendvar\nrun\nendrun\n",
+		"var\n  a: 2.1.1.1.0 inetaddress\nendvar\nrun\n  a = \"fe80::1%eth0\"\nendrun\n",
+	}
+	for _, prog := range progs {
+		_, err := Parse("test", prog)
+		if err == nil || !strings.Contains(err.Error(), "Invalid inet address") {
+			t.Errorf("%q: error %v", prog, err)
+		}
+	}
+}
@@ -4,24 +4,30 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"math"
+	"math/rand"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/PromonLogicalis/asn1"
 )
 
 type Value struct {
 	valueType ValueType
 
-	intVal    int
-	stringVal string
-	boolVal   bool
-	bitsetVal BitsetMap
-	bytesVal  BytesMap
-	oidVal    string
-	addrVal   string
+	intVal       int
+	counter64Val uint64 // unsigned 64 bits on 32 bit platforms too
+	stringVal    string
+	boolVal      bool
+	bitsetVal    BitsetMap
+	bytesVal     BytesMap
+	oidVal       string
+	addrVal      string
+	inetVal      InetAddress
 }
 
 func (v *Value) String() string {
@@ -43,11 +49,98 @@ func (v *Value) String() string {
 	return str
 }
 
+// TrapSender sends the trap for a trap statement
+type TrapSender interface {
+	SendTrap(generic int, specific int, ids []string) error
+}
+
+// OidPresence serves or stops serving the OID of a variable for appear and disappear statements
+type OidPresence interface {
+	SetPresent(typ *Type, present bool)
+}
+
 type Interpreter struct {
-	variables  *Variables
-	values     map[string]*Value // variable id --> Value
-	oid2Values map[string]*Value // oid --> Value
-	valLock    sync.RWMutex
+	variables      *Variables
+	values         map[string]*Value // variable id --> Value
+	oid2Values     map[string]*Value // oid --> Value
+	valLock        sync.RWMutex
+	startTime      time.Time   // used for the uptime
+	reboots        int         // by reboot statements since the start
+	trapSender     TrapSender  // optional, traps are ignored if not set
+	presence       OidPresence // optional, appear and disappear are ignored if not set
+	varInits       VariableInits
+	addedTypes     map[string]*Type      // oid --> Type of variables not declared in the program
+	aliasOids      map[string]string     // alias oid --> declared oid whose value it returns
+	stop           chan struct{}         // closed to stop the program
+	rng            *rand.Rand            // used under valLock
+	seed           int64                 // of rng, and of the random-stable values
+	rateStates     map[string]*rateState // oid --> state of a counter with a rate
+	rateUsers      map[string][]*Type    // variable id --> counters whose rate is its value
+	clocks         map[string]*Clock     // name --> clock rates are applied by
+	cyclePositions map[string]int        // oid --> index of the next value of a cycle
+	state          *StateFile            // optional, values persisted by SETs
+	setRecorder    *SetRecorder          // optional, SETs recorded as statements
+	sourceCache    *SourceCache          // values of backends served again for a time
+}
+
+// errStopped is returned by InterpProgram when the program is stopped
+var errStopped = errors.New("Program stopped")
+
+// Uptime returns the time since the interpreter was initialized (or rebooted)
+func (interp *Interpreter) Uptime() time.Duration {
+	interp.valLock.RLock()
+	defer interp.valLock.RUnlock()
+
+	return time.Since(interp.startTime)
+}
+
+// Reboots returns the number of reboot statements run since the interpreter was initialized
+func (interp *Interpreter) Reboots() int {
+	interp.valLock.RLock()
+	defer interp.valLock.RUnlock()
+
+	return interp.reboots
+}
+
+// UptimeTicks returns the uptime in hundredths of a second, as per sysUpTime
+func (interp *Interpreter) UptimeTicks() uint32 {
+	return uint32(interp.Uptime() / (10 * time.Millisecond))
+}
+
+// sysUpTimeOid is zeroed by a reboot if the program declares it
+const sysUpTimeOid = ".1.3.6.1.2.1.1.3.0"
+
+// reboot simulates a device restart: the uptime starts again and all counters go to zero
+func (interp *Interpreter) reboot() {
+	interp.valLock.Lock()
+	defer interp.valLock.Unlock()
+
+	interp.startTime = time.Now()
+	interp.reboots++
+	for _, typ := range interp.variables.typesFromOid {
+		if typ.valueType == ValueCounter || typ.valueType == ValueCounter64 ||
+			(typ.valueType == ValueTimeticks && typ.oid == sysUpTimeOid) {
+			val := &Value{valueType: typ.valueType}
+			interp.oid2Values[typ.oid] = val
+			interp.values[typ.id] = val
+		}
+	}
+	for id, typ := range interp.variables.types {
+		if (typ.valueType == ValueCounter || typ.valueType == ValueCounter64) && len(typ.oid) == 0 {
+			interp.values[id] = &Value{valueType: typ.valueType}
+		}
+	}
+	interp.rateStates = interp.newRateStates()
+}
+
+// SetTrapSender sets the sender used by trap statements
+func (interp *Interpreter) SetTrapSender(sender TrapSender) {
+	interp.trapSender = sender
+}
+
+// SetOidPresence sets what serves and stops serving OIDs for appear and disappear statements
+func (interp *Interpreter) SetOidPresence(presence OidPresence) {
+	interp.presence = presence
 }
 
 // GetValueForOid is a thread safe version of getting value from oid map
@@ -75,13 +168,74 @@ func (interp *Interpreter) GetValueForId(id string) (val *Value, found bool) {
 
 // SetValueForOidId is a thread safe version of setting value in the oid/id map
 func (interp *Interpreter) SetValueForIdOid(id string, oidStr string, val *Value) {
+	// before the lock as the uptime is read under it
+	ticks := interp.UptimeTicks()
+
 	interp.valLock.Lock()
 	defer interp.valLock.Unlock()
 
 	if len(oidStr) > 0 {
 		interp.oid2Values[oidStr] = val
 	}
+	// the time up to now is at the rate before the change
+	for _, typ := range interp.rateUsers[id] {
+		interp.applyRateLocked(typ)
+	}
+	old, found := interp.values[id]
 	interp.values[id] = val
+
+	// a track-change records when the value last changed, the initial value being a change at the start
+	if typ, ok := interp.variables.types[id]; ok && typ.lastChange != nil &&
+		(!found || old.valueType != val.valueType || formatValue(old) != formatValue(val)) {
+		lastChange := &Value{valueType: ValueTimeticks, intVal: int(ticks)}
+		interp.values[typ.lastChange.id] = lastChange
+		interp.oid2Values[typ.lastChange.oid] = lastChange
+	}
+}
+
+// GetTypeForOid is a thread safe version of getting the type from the oid map
+// as table rows are added and removed while serving
+func (interp *Interpreter) GetTypeForOid(oidStr string) (typ *Type, found bool) {
+	interp.valLock.RLock()
+	defer interp.valLock.RUnlock()
+
+	typ, found = interp.variables.typesFromOid[oidStr]
+	return typ, found
+}
+
+// GetTypeForNumericOid is GetTypeForOid for the OID of a request, looked up without allocating its string
+// as GETs of large programs spent most of the lookup converting it
+func (interp *Interpreter) GetTypeForNumericOid(oid asn1.Oid) (typ *Type, found bool) {
+	var buf [oidKeyLen]byte
+	key := appendOid(buf[:0], oid)
+
+	interp.valLock.RLock()
+	defer interp.valLock.RUnlock()
+
+	typ, found = interp.variables.typesFromOid[string(key)]
+	return typ, found
+}
+
+// AddValueForType adds a variable which is not declared in the program e.g. a table cell
+func (interp *Interpreter) AddValueForType(typ *Type, val *Value) {
+	interp.valLock.Lock()
+	defer interp.valLock.Unlock()
+
+	interp.variables.typesFromOid[typ.oid] = typ
+	interp.addedTypes[typ.oid] = typ
+	interp.oid2Values[typ.oid] = val
+	interp.values[typ.id] = val
+}
+
+// RemoveValueForType removes a variable added by AddValueForType
+func (interp *Interpreter) RemoveValueForType(typ *Type) {
+	interp.valLock.Lock()
+	defer interp.valLock.Unlock()
+
+	delete(interp.variables.typesFromOid, typ.oid)
+	delete(interp.addedTypes, typ.oid)
+	delete(interp.oid2Values, typ.oid)
+	delete(interp.values, typ.id)
 }
 
 func textToValue(text string, val *Value, variables *Variables) error {
@@ -89,8 +243,8 @@ func textToValue(text string, val *Value, variables *Variables) error {
 	switch val.valueType {
 	case ValueString:
 		val.stringVal = text
-	case ValueInteger, ValueCounter, ValueTimeticks, ValueGuage:
-		val.intVal, err = strconv.Atoi(text)
+	case ValueInteger, ValueCounter, ValueCounter64, ValueTimeticks, ValueGuage:
+		err = setIntLiteral(val, strings.TrimPrefix(text, "-"), strings.HasPrefix(text, "-"))
 		if err != nil {
 			return fmt.Errorf("Invalid integer/counter/ticks/guage: %v\n", err)
 		}
@@ -105,6 +259,11 @@ func textToValue(text string, val *Value, variables *Variables) error {
 		if err != nil {
 			return fmt.Errorf("Invalid ipv4address: %v\n", err)
 		}
+	case ValueInetAddress:
+		val.inetVal, err = parseInetAddress(text)
+		if err != nil {
+			return err
+		}
 	case ValueOid:
 		val.oidVal = text
 		err = isValidOID(text)
@@ -132,7 +291,7 @@ func textToValue(text string, val *Value, variables *Variables) error {
 
 // Prompt for input of variables
 // If there is an error then ask again
-func promptForInput(id string, val *Value, variables *Variables) {
+func promptForInput(id string, val *Value, variables *Variables) (text string) {
 	// prompt for input
 	for {
 		fmt.Printf("Input %s: ", id)
@@ -141,15 +300,72 @@ func promptForInput(id string, val *Value, variables *Variables) {
 		text = strings.Trim(text, "\n ")
 		err := textToValue(text, val, variables)
 		if err == nil {
-			return
+			return text
 		}
 	}
 }
 
 type VariableInits map[string]string
 
+// expandEnv replaces ${VAR} in a string with the value of the environment variable VAR
+// ${VAR:-fallback} gives the fallback if VAR is not set or is empty, otherwise it is an error for VAR not to be set.
+// $${ is a literal ${.
+func expandEnv(str string) (string, error) {
+	var b strings.Builder
+	for {
+		start := strings.Index(str, "${")
+		if start < 0 {
+			b.WriteString(str)
+			return b.String(), nil
+		}
+		if start > 0 && str[start-1] == '$' {
+			b.WriteString(str[:start])
+			b.WriteString("{")
+			str = str[start+2:]
+			continue
+		}
+		end := strings.Index(str[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("Missing } after %s", str[start:])
+		}
+		ref := str[start+2 : start+end]
+		name, fallback, hasFallback := ref, "", false
+		if i := strings.Index(ref, ":-"); i >= 0 {
+			name, fallback, hasFallback = ref[:i], ref[i+2:], true
+		}
+		if !isEnvName(name) {
+			return "", fmt.Errorf("Invalid environment variable ${%s}", ref)
+		}
+		value, ok := os.LookupEnv(name)
+		if hasFallback && value == "" {
+			value, ok = fallback, true
+		}
+		if !ok {
+			return "", fmt.Errorf("Environment variable %s is not set", name)
+		}
+		b.WriteString(str[:start])
+		b.WriteString(value)
+		str = str[start+end+1:]
+	}
+}
+
+// isEnvName reports whether the name is a valid environment variable name: letters, digits and _, not starting with a digit
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		isLetter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isLetter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
 // Initialize values from prompt or command line args
-func (interp *Interpreter) initValues(varInits VariableInits) {
+// Initial value expressions are evaluated in the order of declaration, so they can use earlier variables.
+func (interp *Interpreter) initValues(varInits VariableInits) error {
 	// sort types according to line#s for deterministic order input
 	var ids []string
 	for i := range interp.variables.types {
@@ -162,9 +378,34 @@ func (interp *Interpreter) initValues(varInits VariableInits) {
 
 	for _, id := range ids {
 		typ := interp.variables.types[id]
+		if _, set := interp.values[id]; set {
+			// the last change of a track-change, set by the initial value of its variable on the same line
+			continue
+		}
 		//fmt.Printf("id = %s, typ = %v\n", id, typ)
 		val := new(Value)
 		val.valueType = typ.valueType
+		if typ.initValue != nil {
+			*val = *typ.initValue
+		}
+		if typ.initExprn != nil {
+			// as in an assignment the variable's type overrides an integer expression
+			exprnVal, err := interp.interpExpressionAs(typ.initExprn, typ.valueType, true)
+			if err != nil {
+				return fmt.Errorf("Error at line %d: initial value of %s: %v", typ.lineNum, id, err)
+			}
+			val = exprnVal
+		}
+		if typ.initEnvRefs {
+			expanded, err := expandEnv(val.stringVal)
+			if err != nil {
+				return fmt.Errorf("Error at line %d: initial value of %s: %v", typ.lineNum, id, err)
+			}
+			val = &Value{valueType: ValueString, stringVal: expanded}
+		}
+		if typ.randomStable {
+			val = interp.randomStableValue(typ)
+		}
 
 		if typ.initMode == InitModeExternal {
 			// get from -v command line options if have any
@@ -176,25 +417,145 @@ func (interp *Interpreter) initValues(varInits VariableInits) {
 				}
 			} else {
 				// otherwise prompt for the variable values
-				promptForInput(id, val, interp.variables)
+				// and keep them for when the values are reset
+				text := promptForInput(id, val, interp.variables)
+				if varInits != nil {
+					varInits[id] = text
+				}
 			}
 		}
 
 		interp.SetValueForIdOid(id, typ.oid, val)
 	}
-
+	return nil
 }
 
 // Init initializes the interpreter
 // Must call before interpreting program
-func (interp *Interpreter) Init(prog *Program, varInits VariableInits) {
+func (interp *Interpreter) Init(prog *Program, varInits VariableInits) error {
 	interp.variables = prog.variables
+	interp.varInits = varInits
+	interp.startTime = time.Now()
+	interp.addedTypes = make(map[string]*Type)
+	interp.stop = make(chan struct{})
+	if interp.rng == nil {
+		interp.SetSeed(time.Now().UnixNano())
+	}
 
 	/* initialise variables based on the types */
 	interp.values = make(map[string]*Value)
 	interp.oid2Values = make(map[string]*Value)
 
-	interp.initValues(varInits)
+	err := interp.initValues(varInits)
+	if err != nil {
+		return err
+	}
+	err = interp.applyState()
+	if err != nil {
+		return err
+	}
+	err = interp.findRateUsers()
+	if err != nil {
+		return err
+	}
+	interp.clocks = interp.newClocks()
+	interp.rateStates = interp.newRateStates()
+	interp.cyclePositions = make(map[string]int)
+	interp.sourceCache = newSourceCache()
+
+	return interp.resolveOidAliases()
+}
+
+// resolveOidAliases follows each OID alias through any chain of aliases to a declared OID
+func (interp *Interpreter) resolveOidAliases() error {
+	interp.aliasOids = make(map[string]string)
+
+	// sort for predictable errors
+	aliasOids := make([]string, 0, len(interp.variables.oidAliases))
+	for aliasOid := range interp.variables.oidAliases {
+		aliasOids = append(aliasOids, aliasOid)
+	}
+	sort.Strings(aliasOids)
+
+	for _, aliasOid := range aliasOids {
+		if _, ok := interp.variables.typesFromOid[aliasOid]; ok {
+			return fmt.Errorf("Alias OID %s is already declared by a variable", aliasOid)
+		}
+		seen := map[string]bool{aliasOid: true}
+		target := interp.variables.oidAliases[aliasOid]
+		for {
+			if _, ok := interp.variables.typesFromOid[target]; ok {
+				break
+			}
+			next, isAlias := interp.variables.oidAliases[target]
+			if !isAlias {
+				return fmt.Errorf("Alias OID %s refers to %s which is not declared", aliasOid, target)
+			}
+			if seen[target] {
+				return fmt.Errorf("Alias OID %s is in a cycle of aliases", aliasOid)
+			}
+			seen[target] = true
+			target = next
+		}
+		interp.aliasOids[aliasOid] = target
+	}
+	return nil
+}
+
+// Stop makes a running program return errStopped at its next statement, sleep or read
+func (interp *Interpreter) Stop() {
+	select {
+	case <-interp.stop:
+		// already stopped
+	default:
+		close(interp.stop)
+	}
+}
+
+// Reset puts all the values back to their initial state, so the program can be run again from scratch.
+// The program must not be running. Variables not declared in the program (table rows) are removed
+// and their OIDs returned. The values are swapped in one go so readers see either the old or the new values.
+func (interp *Interpreter) Reset() (removedOids []string) {
+	fresh := &Interpreter{
+		variables:  interp.variables,
+		values:     make(map[string]*Value),
+		oid2Values: make(map[string]*Value),
+		state:      interp.state,
+		seed:       interp.seed,
+		startTime:  interp.startTime,
+	}
+	// the initial values and state were applied without error by Init
+	fresh.initValues(interp.varInits)
+	fresh.applyState()
+
+	interp.valLock.Lock()
+	defer interp.valLock.Unlock()
+
+	for oidStr := range interp.addedTypes {
+		delete(interp.variables.typesFromOid, oidStr)
+		removedOids = append(removedOids, oidStr)
+	}
+	interp.addedTypes = make(map[string]*Type)
+	interp.values = fresh.values
+	interp.oid2Values = fresh.oid2Values
+	interp.clocks = interp.newClocks()
+	interp.rateStates = interp.newRateStates()
+	interp.cyclePositions = make(map[string]int)
+	interp.sourceCache.clear()
+	interp.stop = make(chan struct{})
+	return removedOids
+}
+
+// sleep for the duration unless the program is stopped
+func (interp *Interpreter) sleep(duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-interp.stop:
+		return errStopped
+	}
 }
 
 func isValidOID(str string) (err error) {
@@ -248,6 +609,12 @@ func (interp *Interpreter) interpStatementList(stmtList []*Statement) (isExit bo
 }
 
 func (interp *Interpreter) interpStatement(stmt *Statement) (isExit bool, err error) {
+	select {
+	case <-interp.stop:
+		return false, errStopped
+	default:
+	}
+
 	err = nil
 	isExit = false
 	switch stmt.stmtType {
@@ -263,9 +630,20 @@ func (interp *Interpreter) interpStatement(stmt *Statement) (isExit bool, err er
 		err = interp.interpSleepStmt(stmt.sleepStmt)
 	case StmtRead:
 		err = interp.interpReadStmt(stmt.readStmt)
+	case StmtTrap:
+		err = interp.interpTrapStmt(stmt.trapStmt)
+	case StmtReboot:
+		err = interp.interpRebootStmt(stmt.rebootStmt)
+	case StmtAppear:
+		interp.interpAppearStmt(stmt.appearStmt)
 	case StmtBreak:
 		return true, nil
 	}
+	var runtimeErr *RuntimeError
+	if err != nil && err != errStopped && !errors.As(err, &runtimeErr) {
+		// the innermost statement is where it broke
+		err = &RuntimeError{Line: stmt.lineNum, Err: err}
+	}
 	return isExit, err
 }
 
@@ -301,26 +679,68 @@ func (interp *Interpreter) interpPrintStmt(printStmt *PrintStatement) (err error
 
 func (interp *Interpreter) interpReadStmt(readStmt *ReadStatement) (err error) {
 	typ := interp.variables.types[readStmt.identifier]
-	value := <-typ.externalValue
+	var value *Value
+	select {
+	case value = <-typ.externalValue:
+	case <-interp.stop:
+		return errStopped
+	}
 
 	interp.SetValueForIdOid(readStmt.identifier, typ.oid, value)
 	return nil
 }
 
-func (interp *Interpreter) interpSleepStmt(sleepStmt *SleepStatement) (err error) {
-	duration, err := interp.interpIntExpression(sleepStmt.exprn)
+func (interp *Interpreter) interpTrapStmt(trapStmt *TrapStatement) (err error) {
+	generic, err := interp.interpIntExpression(trapStmt.genericExprn)
 	if err != nil {
 		return err
 	}
-	switch sleepStmt.units {
-	case TimeSecs:
-		time.Sleep(time.Duration(duration) * time.Second)
-	case TimeMillis:
-		time.Sleep(time.Duration(duration) * time.Millisecond)
+	if generic < 0 || generic > 6 {
+		return fmt.Errorf("Generic trap number %d is not in range 0 to 6", generic)
+	}
+	var specific int64
+	if trapStmt.specificExprn != nil {
+		specific, err = interp.interpIntExpression(trapStmt.specificExprn)
+		if err != nil {
+			return err
+		}
+	}
+	if interp.trapSender == nil {
+		return nil
+	}
+	return interp.trapSender.SendTrap(int(generic), int(specific), trapStmt.identifiers)
+}
+
+func (interp *Interpreter) interpRebootStmt(rebootStmt *RebootStatement) (err error) {
+	interp.reboot()
+	if rebootStmt.coldStartTrap && interp.trapSender != nil {
+		const coldStart = 0
+		return interp.trapSender.SendTrap(coldStart, 0, nil)
 	}
 	return nil
 }
 
+// interpAppearStmt starts or stops serving the OIDs of the variables
+// Their values are kept, so a variable set while absent has the value when it appears.
+func (interp *Interpreter) interpAppearStmt(appearStmt *AppearStatement) {
+	if interp.presence == nil {
+		return
+	}
+	for _, id := range appearStmt.ids {
+		typ := interp.variables.types[id]
+		interp.presence.SetPresent(typ, appearStmt.appear)
+	}
+	logger.Infof("%s %s\n", appearStmt.keyword(), strings.Join(appearStmt.ids, ", "))
+}
+
+func (interp *Interpreter) interpSleepStmt(sleepStmt *SleepStatement) (err error) {
+	duration, err := interp.interpIntExpression(sleepStmt.exprn)
+	if err != nil {
+		return err
+	}
+	return interp.sleep(sleepStmt.units.Duration(int(duration)))
+}
+
 func (interp *Interpreter) interpLoopStmt(loopStmt *LoopStatement) (err error) {
 	switch loopStmt.loopType {
 	case LoopForever:
@@ -338,7 +758,27 @@ func (interp *Interpreter) interpLoopStmt(loopStmt *LoopStatement) (err error) {
 		if err != nil {
 			return err
 		}
-		for i := 0; i < n; i++ {
+		for i := int64(0); i < n; i++ {
+			exit, err := interp.interpStatementList(loopStmt.stmtList)
+			if err != nil {
+				return err
+			}
+			if exit {
+				break
+			}
+		}
+	case LoopEvery:
+		n, err := interp.interpIntExpression(loopStmt.intExpression)
+		if err != nil {
+			return err
+		}
+		period := loopStmt.units.Duration(int(n))
+		if period <= 0 {
+			return fmt.Errorf("Loop period must be positive but got %d %v", n, loopStmt.units)
+		}
+		// run on a fixed schedule so the period does not drift by the loop's run time
+		next := time.Now()
+		for {
 			exit, err := interp.interpStatementList(loopStmt.stmtList)
 			if err != nil {
 				return err
@@ -346,6 +786,16 @@ func (interp *Interpreter) interpLoopStmt(loopStmt *LoopStatement) (err error) {
 			if exit {
 				break
 			}
+			next = next.Add(period)
+			now := time.Now()
+			if next.Before(now) {
+				// overran the period so skip the missed ones
+				next = now
+			}
+			err = interp.sleep(next.Sub(now))
+			if err != nil {
+				return err
+			}
 		}
 	case LoopWhile:
 		for {
@@ -380,16 +830,11 @@ func updateBytesValueField(uintValue uint, fieldId string, vals BytesMap, sizes
 }
 
 func (interp *Interpreter) interpAssignmentStmt(assign *AssignmentStatement) (err error) {
-	value, err := interp.interpExpression(assign.exprn)
-	if err != nil {
-		return err
-	}
 	varType := interp.variables.types[assign.identifier]
-
 	// ensure counter/timeticks/guage overrides integer type expression
-	if varType.valueType == ValueCounter || varType.valueType == ValueTimeticks ||
-		varType.valueType == ValueGuage {
-		value.valueType = varType.valueType
+	value, err := interp.interpExpressionAs(assign.exprn, varType.valueType, false)
+	if err != nil {
+		return err
 	}
 
 	// field assignment - modify part of the value
@@ -412,6 +857,45 @@ func (interp *Interpreter) interpAssignmentStmt(assign *AssignmentStatement) (er
 	return nil
 }
 
+// interpExpressionAs is interpExpression for a variable of a type, which overrides that of an integer expression
+// so a counter64 is evaluated in uint64 and gets all 64 bits of it. An initial value is checked to be in the range of the type, whereas
+// assignments are served as the type wraps or limits them.
+func (interp *Interpreter) interpExpressionAs(exprn *Expression, valueType ValueType, initial bool) (val *Value, err error) {
+	switch valueType {
+	case ValueCounter64:
+		if exprn.exprnType == ExprnInteger {
+			n, err := interp.interpUintExpression(exprn.intExpression)
+			if err != nil {
+				return nil, err
+			}
+			return &Value{valueType: valueType, counter64Val: n}, nil
+		}
+	case ValueInteger, ValueCounter, ValueTimeticks, ValueGuage:
+		if exprn.exprnType == ExprnInteger {
+			n, err := interp.interpIntExpression(exprn.intExpression)
+			if err != nil {
+				return nil, err
+			}
+			if initial {
+				err = checkIntRange(valueType, n)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return intTypeValue(valueType, n), nil
+		}
+	}
+	return interp.interpExpression(exprn)
+}
+
+// intTypeValue returns an integer as a value of a numeric type
+func intTypeValue(valueType ValueType, n int64) *Value {
+	if valueType == ValueCounter64 {
+		return &Value{valueType: valueType, counter64Val: uint64(n)}
+	}
+	return &Value{valueType: valueType, intVal: int(n)}
+}
+
 func (interp *Interpreter) interpExpression(exprn *Expression) (val *Value, err error) {
 	val = new(Value)
 	switch exprn.exprnType {
@@ -420,7 +904,9 @@ func (interp *Interpreter) interpExpression(exprn *Expression) (val *Value, err
 		val.boolVal, err = interp.interpBoolExpression(exprn.boolExpression)
 	case ExprnInteger:
 		val.valueType = ValueInteger
-		val.intVal, err = interp.interpIntExpression(exprn.intExpression)
+		var n int64
+		n, err = interp.interpIntExpression(exprn.intExpression)
+		val.intVal = int(n)
 	case ExprnString:
 		val.valueType = ValueString
 		val.stringVal, err = interp.interpStringExpression(exprn.stringExpression)
@@ -437,6 +923,9 @@ func (interp *Interpreter) interpExpression(exprn *Expression) (val *Value, err
 	case ExprnAddr:
 		val.valueType = ValueIpv4address
 		val.addrVal, err = interp.interpAddrExpression(exprn.addrExpression)
+	case ExprnInet:
+		val.valueType = ValueInetAddress
+		val.inetVal = interp.interpInetExpression(exprn.inetExpression)
 	}
 	if err != nil {
 		return nil, err
@@ -551,9 +1040,22 @@ func (interp *Interpreter) interpAddrExpression(addrExprn *AddrExpression) (stri
 	return "", nil
 }
 
+func (interp *Interpreter) interpInetExpression(addrExprn *AddrExpression) InetAddress {
+	if addrExprn.addrExprnType == AddrExprnId {
+		val, _ := interp.GetValueForId(addrExprn.identifier)
+		return val.inetVal
+	}
+	return addrExprn.inetVal
+}
+
 func (interp *Interpreter) interpStringTerm(strTerm *StringTerm) (string, error) {
 	switch strTerm.strTermType {
 	case StringTermValue:
+		if strTerm.envRefs {
+			return expandEnv(strTerm.strVal)
+		}
+		return strTerm.strVal, nil
+	case StringTermHexValue:
 		return strTerm.strVal, nil
 	case StringTermBracket:
 		return interp.interpStringExpression(strTerm.bracketedExprn)
@@ -571,7 +1073,7 @@ func (interp *Interpreter) interpStringTerm(strTerm *StringTerm) (string, error)
 		if err != nil {
 			return "", err
 		}
-		return strconv.Itoa(i), nil
+		return strconv.FormatInt(i, 10), nil
 	case StringTermStringedOidExprn:
 		o, err := interp.interpOidExpression(strTerm.stringedOidExprn)
 		if err != nil {
@@ -596,10 +1098,35 @@ func (interp *Interpreter) interpStringTerm(strTerm *StringTerm) (string, error)
 			return "", err
 		}
 		return b.String(), nil
+	case StringTermFormat:
+		return interp.interpFormat(strTerm)
 	}
 	return "", nil
 }
 
+// interpFormat formats the values of the arguments, which are integers for the integer verbs
+// and otherwise strings, with other types in the form print shows them.
+func (interp *Interpreter) interpFormat(strTerm *StringTerm) (string, error) {
+	args := make([]interface{}, len(strTerm.formatArgs))
+	for i, exprn := range strTerm.formatArgs {
+		val, err := interp.interpExpression(exprn)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case isIntegerVerb(strTerm.formatVerbs[i]):
+			args[i] = val.intVal
+		case val.valueType == ValueString:
+			args[i] = val.stringVal
+		case val.valueType == ValueInteger:
+			args[i] = val.intVal
+		default:
+			args[i] = formatValue(val)
+		}
+	}
+	return fmt.Sprintf(strTerm.format, args...), nil
+}
+
 func (interp *Interpreter) interpBoolExpression(boolExprn *BoolExpression) (val bool, err error) {
 	for _, term := range boolExprn.boolOrTerms {
 		val, err = interp.interpBoolTerm(term)
@@ -682,8 +1209,8 @@ func (interp *Interpreter) interpIntComparison(intComparison *IntComparison) (bo
 	return false, nil
 }
 
-func (interp *Interpreter) interpIntExpression(intExpression *IntExpression) (int, error) {
-	val := 0
+func (interp *Interpreter) interpIntExpression(intExpression *IntExpression) (int64, error) {
+	var val int64
 	for _, term := range intExpression.plusTerms {
 		plusVal, err := interp.interpIntTerm(term)
 		if err != nil {
@@ -701,8 +1228,8 @@ func (interp *Interpreter) interpIntExpression(intExpression *IntExpression) (in
 	return val, nil
 }
 
-func (interp *Interpreter) interpIntTerm(intTerm *IntTerm) (int, error) {
-	val := 1
+func (interp *Interpreter) interpIntTerm(intTerm *IntTerm) (int64, error) {
+	val := int64(1)
 	for _, factor := range intTerm.timesFactors {
 		timesVal, err := interp.interpIntFactor(factor)
 		if err != nil {
@@ -715,12 +1242,15 @@ func (interp *Interpreter) interpIntTerm(intTerm *IntTerm) (int, error) {
 		if err != nil {
 			return 1, err
 		}
+		if divideVal == 0 {
+			return 1, errors.New("Division by zero")
+		}
 		val /= divideVal
 	}
 	return val, nil
 }
 
-func (interp *Interpreter) interpIntFactor(intFactor *IntFactor) (int, error) {
+func (interp *Interpreter) interpIntFactor(intFactor *IntFactor) (int64, error) {
 	switch intFactor.intFactorType {
 	case IntFactorConst:
 		return intFactor.intConst, nil
@@ -728,7 +1258,15 @@ func (interp *Interpreter) interpIntFactor(intFactor *IntFactor) (int, error) {
 		return interp.interpIntExpression(intFactor.bracketedExprn)
 	case IntFactorId:
 		value, _ := interp.GetValueForId(intFactor.intIdentifier)
-		return value.intVal, nil
+		if value.valueType == ValueCounter64 {
+			// the top half of the counter64 range does not fit the int64 of other expressions
+			if value.counter64Val > math.MaxInt64 {
+				return 0, fmt.Errorf("Counter64 %s = %d is too large for an integer expression",
+					intFactor.intIdentifier, value.counter64Val)
+			}
+			return int64(value.counter64Val), nil
+		}
+		return int64(value.intVal), nil
 	case IntFactorMinus:
 		value, err := interp.interpIntFactor(intFactor.minusIntFactor)
 		if err != nil {
@@ -738,3 +1276,69 @@ func (interp *Interpreter) interpIntFactor(intFactor *IntFactor) (int, error) {
 	}
 	return 0, nil
 }
+
+// interpUintExpression is interpIntExpression for a counter64, which is evaluated in uint64
+// so that its values of 2^63 and above are not negative and it wraps modulo 2^64
+func (interp *Interpreter) interpUintExpression(intExpression *IntExpression) (uint64, error) {
+	var val uint64
+	for _, term := range intExpression.plusTerms {
+		plusVal, err := interp.interpUintTerm(term)
+		if err != nil {
+			return 0, err
+		}
+		val += plusVal
+	}
+	for _, term := range intExpression.minusTerms {
+		minusVal, err := interp.interpUintTerm(term)
+		if err != nil {
+			return 0, err
+		}
+		val -= minusVal
+	}
+	return val, nil
+}
+
+func (interp *Interpreter) interpUintTerm(intTerm *IntTerm) (uint64, error) {
+	val := uint64(1)
+	for _, factor := range intTerm.timesFactors {
+		timesVal, err := interp.interpUintFactor(factor)
+		if err != nil {
+			return 1, err
+		}
+		val *= timesVal
+	}
+	for _, factor := range intTerm.divideFactors {
+		divideVal, err := interp.interpUintFactor(factor)
+		if err != nil {
+			return 1, err
+		}
+		if divideVal == 0 {
+			return 1, errors.New("Division by zero")
+		}
+		val /= divideVal
+	}
+	return val, nil
+}
+
+func (interp *Interpreter) interpUintFactor(intFactor *IntFactor) (uint64, error) {
+	switch intFactor.intFactorType {
+	case IntFactorConst:
+		// a literal above the int64 range is kept in the bits of its int64
+		return uint64(intFactor.intConst), nil
+	case IntFactorBracket:
+		return interp.interpUintExpression(intFactor.bracketedExprn)
+	case IntFactorId:
+		value, _ := interp.GetValueForId(intFactor.intIdentifier)
+		if value.valueType == ValueCounter64 {
+			return value.counter64Val, nil
+		}
+		return uint64(int64(value.intVal)), nil
+	case IntFactorMinus:
+		value, err := interp.interpUintFactor(intFactor.minusIntFactor)
+		if err != nil {
+			return 0, err
+		}
+		return -value, nil
+	}
+	return 0, nil
+}
@@ -3,6 +3,10 @@ package main
 import (
 	"fmt"
 	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
 )
 
 func runProgram(progStr string) {
@@ -157,3 +161,355 @@ endrun`
 	// large
 	// 15
 }
+
+func ExampleInterp5() {
+	prog := `
+var
+  i: integer
+endvar
+run
+    loop every 10 msecs
+        i = i + 1
+        print "tick " + strInt(i)
+        if i = 3
+            break
+        endif
+    endloop
+endrun`
+	runProgram(prog)
+	// Output:
+	// tick 1
+	// tick 2
+	// tick 3
+}
+
+func TestStopAndReset(t *testing.T) {
+	prog := `
+var
+  count: 2.1.1.1.0 counter
+endvar
+run
+  loop
+    count = count + 1
+    sleep 5 msecs
+  endloop
+endrun`
+	program, interp := parseTestProgram(t, prog)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- interp.InterpProgram(program)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	interp.Stop()
+	select {
+	case err := <-done:
+		if err != errStopped {
+			t.Fatalf("stopped program returned %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("program did not stop")
+	}
+
+	val, _ := interp.GetValueForOid(".1.3.6.1.2.1.1.1.0")
+	if val.intVal == 0 {
+		t.Fatal("program did not count")
+	}
+
+	row := &Type{valueType: ValueInteger, oid: ".1.3.6.1.4.1.99.1.2.1", id: "row"}
+	interp.AddValueForType(row, &Value{valueType: ValueInteger})
+	removed := interp.Reset()
+	if len(removed) != 1 || removed[0] != row.oid {
+		t.Errorf("removed OIDs = %v, want [%s]", removed, row.oid)
+	}
+	if _, found := interp.GetTypeForOid(row.oid); found {
+		t.Error("added type still exists after reset")
+	}
+	val, _ = interp.GetValueForOid(".1.3.6.1.2.1.1.1.0")
+	if val.intVal != 0 {
+		t.Errorf("count = %d after reset, want 0", val.intVal)
+	}
+
+	// runs again after the reset
+	go func() {
+		done <- interp.InterpProgram(program)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	interp.Stop()
+	<-done
+	val, _ = interp.GetValueForOid(".1.3.6.1.2.1.1.1.0")
+	if val.intVal == 0 {
+		t.Error("program did not count after reset")
+	}
+}
+
+type recordingTrapSender struct {
+	traps [][2]int
+}
+
+func (sender *recordingTrapSender) SendTrap(generic int, specific int, ids []string) error {
+	sender.traps = append(sender.traps, [2]int{generic, specific})
+	return nil
+}
+
+func TestReboot(t *testing.T) {
+	prog := `
+var
+  uptime: 2.1.1.3.0 timeticks
+  pages: 2.43.10.2.1.4.1.1 counter
+  descr: 2.1.1.1.0 string
+endvar
+run
+  uptime = 12345
+  pages = 100
+  descr = "printer"
+  sleep 30 msecs
+  reboot trap
+endrun`
+	program, interp := parseTestProgram(t, prog)
+	sender := new(recordingTrapSender)
+	interp.SetTrapSender(sender)
+
+	err := interp.InterpProgram(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"uptime", "pages"} {
+		val, _ := interp.GetValueForId(id)
+		if val.intVal != 0 {
+			t.Errorf("%s = %d after reboot, want 0", id, val.intVal)
+		}
+	}
+	val, _ := interp.GetValueForOid(".1.3.6.1.2.1.1.1.0")
+	if val.stringVal != "printer" {
+		t.Errorf("descr = %v, want unchanged by reboot", val)
+	}
+	if interp.UptimeTicks() > 2 {
+		t.Errorf("uptime = %d ticks, want it restarted", interp.UptimeTicks())
+	}
+	if len(sender.traps) != 1 || sender.traps[0] != [2]int{0, 0} {
+		t.Errorf("traps = %v, want one coldStart", sender.traps)
+	}
+}
+
+func TestInitialValueExpressions(t *testing.T) {
+	_, interp := parseTestProgram(t, `
+var
+  mtu: integer = 1500
+  max-bits: 2.1.99.1.0 integer = mtu * 8
+  speed: 2.1.2.2.1.5.1 guage = 100 * 1000 * 1000
+  descr: 2.1.1.1.0 string = "port " + "1"
+  up: boolean = max-bits > 10000
+endvar
+run
+  max-bits = 0
+endrun`)
+
+	want := map[string]*Value{
+		"mtu":      {valueType: ValueInteger, intVal: 1500},
+		"max-bits": {valueType: ValueInteger, intVal: 12000},
+		"speed":    {valueType: ValueGuage, intVal: 100000000},
+		"descr":    {valueType: ValueString, stringVal: "port 1"},
+		"up":       {valueType: ValueBoolean, boolVal: true},
+	}
+	check := func(when string) {
+		for id, w := range want {
+			val, _ := interp.GetValueForId(id)
+			if !reflect.DeepEqual(val, w) {
+				t.Errorf("%s: %s = %v, want %v", when, id, val, w)
+			}
+		}
+	}
+	check("init")
+	interp.SetValueForIdOid("max-bits", ".1.3.6.1.2.1.99.1.0", &Value{valueType: ValueInteger})
+	interp.Reset()
+	check("reset")
+}
+
+func TestInitialValueEnv(t *testing.T) {
+	t.Setenv("SNMPRUN_TEST_HOST", "switch-7")
+	t.Setenv("SNMPRUN_TEST_EMPTY", "")
+	_, interp := parseTestProgram(t, `
+var
+  name: 2.1.1.5.0 string = "${SNMPRUN_TEST_HOST}"
+  descr: 2.1.1.1.0 string = "${SNMPRUN_TEST_HOST}.lab (" + "${SNMPRUN_TEST_UNSET:-generic} ${SNMPRUN_TEST_EMPTY:-v1})"
+  port.[1..2]: 2.1.2.2.1.2 string = "${SNMPRUN_TEST_HOST}/%d"
+  escaped: 2.1.1.4.0 string = "$${SNMPRUN_TEST_HOST} is ${SNMPRUN_TEST_HOST}"
+  hex: 2.1.1.6.0 string = 0x247B534E4D5052554E5F544553545F484F53547D + " at " + (name + "")
+endvar
+run
+endrun`)
+	want := map[string]string{
+		"name":    "switch-7",
+		"descr":   "switch-7.lab (generic v1)",
+		"port.2":  "switch-7/2",
+		"escaped": "${SNMPRUN_TEST_HOST} is switch-7",
+		"hex":     "${SNMPRUN_TEST_HOST} at switch-7",
+	}
+	for id, w := range want {
+		if val, _ := interp.GetValueForId(id); val.stringVal != w {
+			t.Errorf("%s = %q, want %q", id, val.stringVal, w)
+		}
+	}
+
+	for _, bad := range []string{"${SNMPRUN_TEST_UNSET}", "${SNMPRUN_TEST_HOST", "${1X}", "${}"} {
+		program, err := Parse("test", "var\n  x: string = \""+bad+"\"\nendvar\nrun\nendrun")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = new(Interpreter).Init(program, nil)
+		if err == nil || !strings.HasPrefix(err.Error(), "Error at line 2: initial value of x: ") {
+			t.Errorf("%s: error = %v", bad, err)
+		}
+	}
+
+	// only the quoted strings of a program are expanded, not the values of a profile
+	program, err := parseJSONProgram([]byte(`{"objects": [{"oid": "1.3.6.1.2.1.1.5.0", "name": "name", "type": "string", "value": "${SNMPRUN_TEST_HOST}"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	interp = new(Interpreter)
+	if err := interp.Init(program, nil); err != nil {
+		t.Fatal(err)
+	}
+	if val, _ := interp.GetValueForId("name"); val.stringVal != "${SNMPRUN_TEST_HOST}" {
+		t.Errorf("profile value = %q, want it unexpanded", val.stringVal)
+	}
+}
+
+func TestIntLiterals(t *testing.T) {
+	_, interp := parseTestProgram(t, `
+var
+  octal: integer = 010
+  nine: integer = 09
+  hex: integer = 0x10
+  min: integer = -2147483648
+  max: counter = 4294967295
+  hc: 2.1.31.1.1.1.6.1 counter64 = 18446744073709551615
+  hc-sum: 2.1.31.1.1.1.10.1 counter64 = 0xFFFFFFFF + 1
+  hc-max: 2.1.31.1.1.1.7.1 counter64 = 9223372036854775807
+  hc-copy: 2.1.31.1.1.1.11.1 counter64 = hc-max - 1 + 1
+endvar
+run
+endrun`)
+	want := map[string]*Value{
+		"octal":   {valueType: ValueInteger, intVal: 10},
+		"nine":    {valueType: ValueInteger, intVal: 9},
+		"hex":     {valueType: ValueInteger, intVal: 16},
+		"min":     {valueType: ValueInteger, intVal: -2147483648},
+		"max":     {valueType: ValueCounter, intVal: 4294967295},
+		"hc":      {valueType: ValueCounter64, counter64Val: 18446744073709551615},
+		"hc-sum":  {valueType: ValueCounter64, counter64Val: 4294967296},
+		"hc-max":  {valueType: ValueCounter64, counter64Val: 9223372036854775807},
+		"hc-copy": {valueType: ValueCounter64, counter64Val: 9223372036854775807},
+	}
+	for id, w := range want {
+		if val, _ := interp.GetValueForId(id); !reflect.DeepEqual(val, w) {
+			t.Errorf("%s = %+v, want %+v", id, val, w)
+		}
+	}
+
+	for _, decl := range []string{"x: integer = 0b101", "x: integer = 1_000", "x: integer = 2147483648",
+		"x: integer = -2147483649", "x: counter = 4294967296", "x: guage = 0x100000000",
+		"x: 2.1.31.1.1.1.6.1 counter64 = 18446744073709551616"} {
+		program, err := Parse("test", "var\n  "+decl+"\nendvar\nrun\nendrun")
+		if err == nil {
+			err = new(Interpreter).Init(program, nil)
+		}
+		if err == nil {
+			t.Errorf("%s: no error", decl)
+		}
+	}
+
+	// -V values, JSON profiles and snmprec files
+	for _, test := range []struct {
+		valueType ValueType
+		text      string
+		want      Value
+	}{
+		{ValueInteger, "010", Value{valueType: ValueInteger, intVal: 10}},
+		{ValueInteger, "-5", Value{valueType: ValueInteger, intVal: -5}},
+		{ValueTimeticks, "0x2A", Value{valueType: ValueTimeticks, intVal: 42}},
+		{ValueCounter64, "18446744073709551615", Value{valueType: ValueCounter64, counter64Val: 18446744073709551615}},
+	} {
+		val := &Value{valueType: test.valueType}
+		if err := textToValue(test.text, val, nil); err != nil || !reflect.DeepEqual(*val, test.want) {
+			t.Errorf("%s: %+v, %v", test.text, val, err)
+		}
+	}
+	for _, text := range []string{"0b101", "1_000", "+5", "4294967296", "-1"} {
+		if err := textToValue(text, &Value{valueType: ValueGuage}, nil); err == nil {
+			t.Errorf("guage %s: no error", text)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	program, interp := parseTestProgram(t, `
+var
+  model: string = "WS-C2960"
+  version: integer = 15
+  addr: ipaddress = 10.1.1.7
+  up: boolean
+  descr: 2.1.1.1.0 string
+  name: 2.1.1.5.0 string
+  serial: 2.1.1.6.0 string
+endvar
+run
+  up = true
+  descr = format("Cisco %s Software, Version %d.%d", model, version, version - 13) + " (lab)"
+  name = format("%-6s|%04d|%x|%q|100%%", "sw", 42, 255, model)
+  serial = format("%s at %s is %v", model + "-1", addr, up)
+endrun`)
+	if err := interp.InterpProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"descr":  "Cisco WS-C2960 Software, Version 15.2 (lab)",
+		"name":   `sw    |0042|ff|"WS-C2960"|100%`,
+		"serial": "WS-C2960-1 at 10.1.1.7 is true",
+	}
+	for id, w := range want {
+		if val, _ := interp.GetValueForId(id); val.stringVal != w {
+			t.Errorf("%s = %q, want %q", id, val.stringVal, w)
+		}
+	}
+
+	for _, bad := range []string{
+		`format("%s v%d", model)`,
+		`format("%s", model, model)`,
+		`format("%d", model)`,
+		`format("%f", model)`,
+		`format("100%")`,
+		`format("%s", nosuch)`,
+		`format(model)`,
+	} {
+		_, err := Parse("test", "var\n  model: string\n  x: string\nendvar\nrun\n  x = "+bad+"\nendrun")
+		if err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
+
+func TestInitialValueExpressionErrors(t *testing.T) {
+	tests := []struct {
+		decls string
+		want  string
+	}{
+		{"a: integer = b + 1\n  b: integer", "test: Error at line 2: "},
+		{"a: integer = \"x\"", "test: Error at line 2: "},
+		{"a: integer = 0\n  b: integer = 10 / a", "Error at line 3: initial value of b: Division by zero"},
+		{"a: 2.1.31.1.1.1.6.1 counter64 = 9223372036854775808\n  b: integer = a - 9223372036854775807",
+			"Error at line 3: initial value of b: Counter64 a = 9223372036854775808 is too large"},
+	}
+	for _, test := range tests {
+		prog := "var\n  " + test.decls + "\nendvar\nrun\nendrun"
+		program, err := NewParser(lex("test", prog)).ParseProgram()
+		if err == nil {
+			err = new(Interpreter).Init(program, make(VariableInits))
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%s: error = %v, want %s", test.decls, err, test.want)
+		}
+	}
+}
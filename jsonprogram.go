@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// JSONProfile is a static device profile of OIDs and their values, for tooling generated dumps
+// e.g. {"objects": [{"oid": "1.3.6.1.2.1.1.1.0", "type": "string", "value": "Switch"}]}
+type JSONProfile struct {
+	Metadata map[string]string `json:"metadata"`
+	Objects  []JSONObject      `json:"objects"`
+}
+
+// JSONObject is an OID with its type and value, and optionally a name and access
+type JSONObject struct {
+	Oid    string      `json:"oid"`
+	Name   string      `json:"name"`
+	Type   string      `json:"type"`
+	Value  json.Number `json:"value"`
+	Access string      `json:"access"`
+}
+
+// UnmarshalJSON allows the value to be a JSON number or string
+func (object *JSONObject) UnmarshalJSON(data []byte) error {
+	type plainObject JSONObject
+	var raw struct {
+		plainObject
+		Value interface{} `json:"value"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&raw)
+	if err != nil {
+		return err
+	}
+	*object = JSONObject(raw.plainObject)
+	switch value := raw.Value.(type) {
+	case json.Number:
+		object.Value = value
+	case string:
+		object.Value = json.Number(value)
+	case nil:
+	default:
+		return fmt.Errorf("Value of %s must be a number or a string", object.Oid)
+	}
+	return nil
+}
+
+var jsonValueTypes = map[string]ValueType{
+	"string":      ValueString,
+	"integer":     ValueInteger,
+	"int":         ValueInteger,
+	"counter":     ValueCounter,
+	"counter64":   ValueCounter64,
+	"guage":       ValueGuage,
+	"gauge":       ValueGuage,
+	"timeticks":   ValueTimeticks,
+	"ipaddress":   ValueIpv4address,
+	"inetaddress": ValueInetAddress,
+	"oid":         ValueOid,
+}
+
+// parseJSONProgram makes a program with no statements which serves the values of a JSON profile
+func parseJSONProgram(input []byte) (*Program, error) {
+	var profile JSONProfile
+	decoder := json.NewDecoder(bytes.NewReader(input))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&profile)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := &Variables{
+		types:        make(map[string]*Type),
+		typesFromOid: make(map[string]*Type),
+		intAliases:   make(map[string]int),
+		tables:       make(map[string]*Table),
+		oidAliases:   make(map[string]string),
+	}
+	for i, object := range profile.Objects {
+		typ, err := object.toType(i + 1)
+		if err != nil {
+			return nil, fmt.Errorf("Object %d: %v", i+1, err)
+		}
+		if _, ok := vars.typesFromOid[typ.oid]; ok {
+			return nil, fmt.Errorf("Object %d: OID %s is already declared", i+1, typ.oid)
+		}
+		if _, ok := vars.types[typ.id]; ok {
+			return nil, fmt.Errorf("Object %d: name %s is already declared", i+1, typ.id)
+		}
+		vars.types[typ.id] = typ
+		vars.typesFromOid[typ.oid] = typ
+	}
+	return &Program{variables: vars, metadata: profile.Metadata}, nil
+}
+
+// toType returns the type of the object with its value as the initial value
+// The position of the object is used as the line number so the values are initialized in order.
+func (object JSONObject) toType(position int) (typ *Type, err error) {
+	typ = &Type{lineNum: position}
+	typ.oid, err = canonicalOid(object.Oid)
+	if err != nil || len(object.Oid) == 0 {
+		return nil, fmt.Errorf("Invalid OID %s", object.Oid)
+	}
+	typ.id = object.Name
+	if len(typ.id) == 0 {
+		typ.id = typ.oid
+	}
+	var ok bool
+	typ.valueType, ok = jsonValueTypes[strings.ToLower(object.Type)]
+	if !ok {
+		return nil, fmt.Errorf("Invalid type %s of %s", object.Type, object.Oid)
+	}
+	if len(object.Access) > 0 {
+		typ.access, ok = accessNames[object.Access]
+		if !ok {
+			return nil, fmt.Errorf("Invalid access %s of %s", object.Access, object.Oid)
+		}
+		if typ.access != AccessReadOnly {
+			if typ.valueType == ValueCounter || typ.valueType == ValueCounter64 {
+				return nil, fmt.Errorf("Counter %s can not be %s", object.Oid, object.Access)
+			}
+			typ.snmpMode = SnmpModeReadWrite
+		}
+	}
+
+	// no value is the zero value
+	typ.initValue = &Value{valueType: typ.valueType}
+	text := object.Value.String()
+	if typ.valueType == ValueOid {
+		text = strings.TrimPrefix(text, ".")
+	}
+	if len(text) > 0 {
+		err = textToValue(text, typ.initValue, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value of %s: %v", object.Oid, err)
+		}
+	}
+	return typ, nil
+}
+
+// loadProgramAs loads a program in a format: sim for the program language, json for a static profile or
+// snmprec for a data file of snmpsim.
+// If the format is empty it is from the file extension, .json for json, .snmprec for snmprec otherwise sim.
+// The MIB index is optional and only used by programs in the language.
+func loadProgramAs(filename string, format string, mibIndex *MibIndex) (*Program, error) {
+	if len(format) == 0 {
+		format = "sim"
+		switch ext := filepath.Ext(filename); {
+		case strings.EqualFold(ext, ".json"):
+			format = "json"
+		case strings.EqualFold(ext, ".snmprec"):
+			format = "snmprec"
+		}
+	}
+	switch strings.ToLower(format) {
+	case "sim":
+		return loadProgram(filename, mibIndex)
+	case "json":
+		input, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read file %s: %s", filename, err)
+		}
+		program, err := parseJSONProgram(input)
+		if err != nil {
+			return nil, fmt.Errorf("Error in JSON profile %s: %s", filename, err)
+		}
+		return program, nil
+	case "snmprec":
+		input, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read file %s: %s", filename, err)
+		}
+		program, skipped, err := parseSnmprecProgram(input)
+		if err != nil {
+			return nil, fmt.Errorf("Error in snmprec file %s: %s", filename, err)
+		}
+		if skipped > 0 {
+			logger.Warnf("%d OIDs of %s are not served as their types are not supported\n", skipped, filename)
+		}
+		return program, nil
+	}
+	return nil, fmt.Errorf("Invalid format %s, expecting sim, json or snmprec", format)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+const jsonTestProfile = `{
+  "metadata": {"device": "Cisco 2960"},
+  "objects": [
+    {"oid": "1.3.6.1.2.1.1.1.0", "type": "string", "value": "Cisco IOS Software"},
+    {"oid": ".1.3.6.1.2.1.1.2.0", "type": "oid", "value": ".1.3.6.1.4.1.9.1.516"},
+    {"oid": "1.3.6.1.2.1.1.5.0", "name": "sys-name", "type": "string", "value": "switch1", "access": "read-write"},
+    {"oid": "1.3.6.1.2.1.2.1.0", "type": "integer", "value": 24},
+    {"oid": "1.3.6.1.2.1.2.2.1.10.1", "type": "counter", "value": "4294967295"},
+    {"oid": "1.3.6.1.2.1.31.1.1.1.6.1", "type": "counter64", "value": 18446744073709551615},
+    {"oid": "1.3.6.1.2.1.4.20.1.1.10.0.0.1", "type": "ipaddress", "value": "10.0.0.1"},
+    {"oid": "1.3.6.1.2.1.1.4.0", "type": "string"}
+  ]
+}`
+
+func TestJSONProgram(t *testing.T) {
+	program, err := parseJSONProgram([]byte(jsonTestProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program.metadata["device"] != "Cisco 2960" {
+		t.Errorf("metadata = %v", program.metadata)
+	}
+	if logger == nil {
+		logger = newLevelLogger(ioutil.Discard, "", 0, LogError)
+	}
+	interp := new(Interpreter)
+	if err := interp.Init(program, make(VariableInits)); err != nil {
+		t.Fatal(err)
+	}
+	agent := NewAgent()
+	if err := addProgramOIDs(agent, interp, false); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil,
+		"1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.2.1.0", "1.3.6.1.2.1.2.2.1.10.1", "1.3.6.1.2.1.31.1.1.1.6.1", "1.3.6.1.2.1.1.4.0")})
+	want := []interface{}{"Cisco IOS Software", 24, snmp.Counter32(4294967295), snmp.Counter64(18446744073709551615), ""}
+	for i, w := range want {
+		if got := resp.Variables[i].Value; got != w {
+			t.Errorf("%s = %v (%T), want %v", resp.Variables[i].Name, got, got, w)
+		}
+	}
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil,
+		"1.3.6.1.2.1.1.2.0", "1.3.6.1.2.1.4.20.1.1.10.0.0.1")})
+	if oid, ok := resp.Variables[0].Value.(asn1.Oid); !ok || oid.String() != ".1.3.6.1.4.1.9.1.516" {
+		t.Errorf("sysObjectID = %v", resp.Variables[0].Value)
+	}
+	if addr, ok := resp.Variables[1].Value.(snmp.IPAddress); !ok || addr.String() != "10.0.0.1" {
+		t.Errorf("address = %v", resp.Variables[1].Value)
+	}
+
+	// read-write access
+	resp = request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{"1.3.6.1.2.1.1.5.0": "switch2"}, "1.3.6.1.2.1.1.5.0")})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Errorf("SET status %d", resp.ErrorStatus)
+	}
+	if val, _ := interp.GetValueForId("sys-name"); val.stringVal != "switch2" {
+		t.Errorf("sys-name = %q, want switch2", val.stringVal)
+	}
+}
+
+func TestJSONProgramErrors(t *testing.T) {
+	tests := []struct {
+		objects string
+		want    string
+	}{
+		{`{"oid": "1.3.6.1.2.1.1.1.0", "type": "float", "value": 1}`, "Invalid type float"},
+		{`{"oid": "", "type": "string", "value": "x"}`, "Invalid OID"},
+		{`{"oid": "1.3.6.1.2.1.1.1.0", "type": "integer", "value": "many"}`, "Invalid value"},
+		{`{"oid": "1.3.6.1.2.1.1.1.0", "type": "integer", "value": true}`, "must be a number or a string"},
+		{`{"oid": "1.3.6.1.2.1.1.1.0", "type": "integer", "valeu": 1}`, "unknown field"},
+		{`{"oid": "1.3.6.1.2.1.1.1.0", "type": "counter", "access": "read-write"}`, "can not be read-write"},
+		{`{"oid": "1.3.6.1.2.1.1.1.0", "type": "string"}, {"oid": ".1.3.6.1.2.1.1.1.0", "type": "string"}`, "Object 2: OID .1.3.6.1.2.1.1.1.0 is already declared"},
+	}
+	for _, test := range tests {
+		_, err := parseJSONProgram([]byte(`{"objects": [` + test.objects + `]}`))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error = %v, want %s", test.objects, err, test.want)
+		}
+	}
+}
+
+func TestSnmprecProgram(t *testing.T) {
+	input := `# recorded from a switch
+1.3.6.1.2.1.1.1.0|4|Cisco IOS Software
+1.3.6.1.2.1.1.2.0|6|1.3.6.1.4.1.9.1.516
+1.3.6.1.2.1.1.3.0|67|4200
+1.3.6.1.2.1.2.2.1.6.1|4x|001a2b3c4d5e
+1.3.6.1.2.1.2.2.1.5.1|66|100000000
+1.3.6.1.2.1.2.2.1.10.1|65:numeric|min=0,max=100,value=1042
+1.3.6.1.2.1.2.2.1.16.1|65:numeric|min=0,max=100
+1.3.6.1.2.1.4.20.1.1.10.0.0.1|64|10.0.0.1
+1.3.6.1.2.1.4.20.1.1.10.0.0.2|64x|0a000002
+1.3.6.1.2.1.31.1.1.1.6.1|70|5000000000
+1.3.6.1.2.1.7.1.0|2|-5
+1.3.6.1.2.1.99.1.0|5|
+1.3.6.1.2.1.99.2.0|68x|0102
+`
+	program, skipped, err := parseSnmprecProgram([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 2 {
+		t.Errorf("skipped %d, expecting 2", skipped)
+	}
+	if logger == nil {
+		logger = newLevelLogger(ioutil.Discard, "", 0, LogError)
+	}
+	interp := new(Interpreter)
+	if err := interp.Init(program, make(VariableInits)); err != nil {
+		t.Fatal(err)
+	}
+	agent := NewAgent()
+	if err := addProgramOIDs(agent, interp, false); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil,
+		"1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.3.0", "1.3.6.1.2.1.2.2.1.6.1", "1.3.6.1.2.1.2.2.1.5.1",
+		"1.3.6.1.2.1.2.2.1.10.1", "1.3.6.1.2.1.2.2.1.16.1", "1.3.6.1.2.1.31.1.1.1.6.1", "1.3.6.1.2.1.7.1.0",
+		"1.3.6.1.2.1.99.1.0")})
+	want := []interface{}{"Cisco IOS Software", snmp.TimeTicks(4200), "\x00\x1a\x2b\x3c\x4d\x5e",
+		snmp.Unsigned32(100000000), snmp.Counter32(1042), snmp.Counter32(0), snmp.Counter64(5000000000), -5,
+		snmp.NoSuchObject{}}
+	for i, w := range want {
+		if got := resp.Variables[i].Value; got != w {
+			t.Errorf("%s = %v (%T), want %v", resp.Variables[i].Name, got, got, w)
+		}
+	}
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil,
+		"1.3.6.1.2.1.1.2.0", "1.3.6.1.2.1.4.20.1.1.10.0.0.1", "1.3.6.1.2.1.4.20.1.1.10.0.0.2")})
+	if oid, ok := resp.Variables[0].Value.(asn1.Oid); !ok || oid.String() != ".1.3.6.1.4.1.9.1.516" {
+		t.Errorf("sysObjectID = %v", resp.Variables[0].Value)
+	}
+	if addr, ok := resp.Variables[1].Value.(snmp.IPAddress); !ok || addr.String() != "10.0.0.1" {
+		t.Errorf("address = %v", resp.Variables[1].Value)
+	}
+	if addr, ok := resp.Variables[2].Value.(snmp.IPAddress); !ok || addr.String() != "10.0.0.2" {
+		t.Errorf("hex address = %v", resp.Variables[2].Value)
+	}
+}
+
+func TestSnmprecProgramErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"1.3.6.1.2.1.1.1.0|4", "Line 1: Invalid line"},
+		{"1.3.6.1.2.1.1.1.0|four|x", "Line 1: Invalid type tag four"},
+		{"1.3.x.1|2|1", "Line 1: Invalid OID 1.3.x.1"},
+		{"1.3.6.1.2.1.1.1.0|2|many", "Line 1: Invalid value"},
+		{"1.3.6.1.2.1.1.1.0|4x|0g", "Line 1: Invalid hex value"},
+		{"1.3.6.1.2.1.4.20.1.1.0|64x|0a00", "expecting 4 octets"},
+		{"1.3.6.1.2.1.1.1.0|4|a\n.1.3.6.1.2.1.1.1.0|4|b", "Line 2: OID .1.3.6.1.2.1.1.1.0 is already declared"},
+	}
+	for _, test := range tests {
+		_, _, err := parseSnmprecProgram([]byte(test.input))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: error = %v, want %s", test.input, err, test.want)
+		}
+	}
+}
@@ -47,6 +47,16 @@ func (t itemType) String() string {
 			return w
 		}
 	}
+	words = words[:0]
+	for w := range contextKeywords {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+	for _, w := range words {
+		if contextKeywords[w] == t {
+			return w
+		}
+	}
 	// lookup symbols
 	var syms []string
 	for s := range symbols {
@@ -102,9 +112,11 @@ const (
 	itemRightCurlyBracket                  // '}'
 	itemColon                              // ':'
 	itemComma                              // ','
+	itemPercent                            // '%'
 	itemNewLine                            // '\n'
 	itemEOF
 	itemIdentifier // alphanumeric identifier
+	itemMetadata   // //@key: value comment
 	// Keywords appear after all the rest.
 	itemKeyword   // used only to delimit the keywords
 	itemIf        // if keyword
@@ -124,14 +136,18 @@ const (
 	itemStrBitset
 	itemStrBytes
 	itemStrGuage
+	itemFormat      // format keyword, printf-style string function
 	itemBoolean     // boolean keyword
 	itemString      // string keyword
 	itemInteger     // integer keyword
 	itemBitset      // bitset keyword
+	itemBits        // bits keyword (SMI name of bitset)
 	itemOid         // oid keyword
 	itemCounter     // counter keyword
+	itemCounter64   // counter64 keyword
 	itemTimeticks   // timeticks keyword
 	itemIpv4address // ipaddress keyword
+	itemInetAddress // inetaddress keyword (IPv4 or IPv6 InetAddress)
 	itemGauge       // guage keyword (guage type = uint32)
 	itemTrue        // true
 	itemFalse       // false
@@ -149,6 +165,35 @@ const (
 	itemContains    // contains
 	itemBytes       // bytes (like a struct of fields of bytes - converts to string)
 	itemDot         // field name specifier
+	itemTrap        // trap
+	itemSpecific    // specific (trap number)
+	itemWith        // with (trap variables)
+	itemEvery       // every keyword in periodic loop
+	itemTable       // table (of writable rows)
+	itemRowStatus   // rowstatus (table column)
+	itemUnits       // units (variable metadata)
+	itemHint        // hint (display-hint variable metadata)
+	itemReboot      // reboot
+	itemOidAlias    // alias (of an OID)
+	itemRate        // rate (of counter increase)
+	itemJitter      // jitter (of a rate)
+	itemCycle       // cycle (of values served)
+	itemOnce        // once (through values served)
+	itemAccess      // access (MAX-ACCESS of a variable)
+	itemLatency     // latency (of reads of a variable)
+	itemCountOf     // count-of (the rows of a table)
+	itemAbsent      // absent (until an appear statement)
+	itemAppear      // appear (of an absent variable)
+	itemDisappear   // disappear (of a variable)
+	itemWritable    // writable (for a time)
+	itemTrackChange // track-change (to a timeticks OID)
+	itemUntil       // until (a time after the start)
+	itemClock       // clock (of a rate)
+	itemHttp        // http (backend of a value)
+	itemStable      // random-stable (initial value)
+	itemCache       // cache (of a backend)
+	itemWave        // wave (of a value over time)
+	itemOnError     // on-error (policy of a backend)
 	itemNone
 )
 
@@ -161,6 +206,7 @@ var others = map[itemType]string{
 	itemNewLine:        "new line",
 	itemEOF:            "EOF",
 	itemIdentifier:     "identifier",
+	itemMetadata:       "metadata",
 	itemNone:           "none",
 }
 
@@ -210,6 +256,45 @@ var keywords = map[string]itemType{
 	"contains":     itemContains,
 }
 
+// contextKeywords are the words which are keywords only where the parser expects one of them, e.g. after the
+// type of a variable or at the start of a statement. The lexer gives them as identifiers so programs can still
+// name variables with them.
+var contextKeywords = map[string]itemType{
+	"format":        itemFormat,
+	"counter64":     itemCounter64,
+	"inetaddress":   itemInetAddress,
+	"bits":          itemBits,
+	"trap":          itemTrap,
+	"specific":      itemSpecific,
+	"with":          itemWith,
+	"every":         itemEvery,
+	"table":         itemTable,
+	"rowstatus":     itemRowStatus,
+	"units":         itemUnits,
+	"hint":          itemHint,
+	"reboot":        itemReboot,
+	"alias":         itemOidAlias,
+	"rate":          itemRate,
+	"jitter":        itemJitter,
+	"cycle":         itemCycle,
+	"once":          itemOnce,
+	"access":        itemAccess,
+	"latency":       itemLatency,
+	"count-of":      itemCountOf,
+	"absent":        itemAbsent,
+	"appear":        itemAppear,
+	"disappear":     itemDisappear,
+	"writable":      itemWritable,
+	"track-change":  itemTrackChange,
+	"until":         itemUntil,
+	"clock":         itemClock,
+	"http":          itemHttp,
+	"random-stable": itemStable,
+	"cache":         itemCache,
+	"wave":          itemWave,
+	"on-error":      itemOnError,
+}
+
 var symbols = map[string]itemType{
 	"<":  itemLessThan,
 	">":  itemGreaterThan,
@@ -235,6 +320,7 @@ var symbols = map[string]itemType{
 	"}":  itemRightCurlyBracket,
 	",":  itemComma,
 	".":  itemDot,
+	"%":  itemPercent,
 }
 
 type processFn func(*lexer) processResult
@@ -470,9 +556,13 @@ func processComment(l *lexer) processResult {
 	if rune == '/' {
 		rune := l.next()
 		if rune == '/' {
-			// eat up until \n
-			for l.next() != '\n' {
+			if l.peek() == '@' {
+				return processMetadata(l)
+			}
+			// eat up until \n leaving it to end the line
+			for r := l.next(); r != '\n' && r != eof; r = l.next() {
 			}
+			l.backup()
 			l.ignore()
 			return resultMatch
 		} else {
@@ -480,12 +570,29 @@ func processComment(l *lexer) processResult {
 			l.backup()
 			return resultNoMatch
 		}
+	} else if rune == '#' && l.peek() == '@' {
+		// #@ is also allowed as # on its own is not equals
+		return processMetadata(l)
 	} else {
 		l.backup()
 		return resultNoMatch
 	}
 }
 
+// processMetadata emits the key: value text of a //@key: value comment
+// The comment does not count as a previous item, so it does not affect new lines.
+func processMetadata(l *lexer) processResult {
+	l.next() // @
+	l.ignore()
+	for r := l.next(); r != '\n' && r != eof; r = l.next() {
+	}
+	l.backup()
+	prevItemType := l.prevItemType
+	l.emit(itemMetadata)
+	l.prevItemType = prevItemType
+	return resultMatch
+}
+
 /*
  * Process a symbol/operator of 1 or 2 runes
  * Return true if got a match and emitted symbol
@@ -595,8 +702,8 @@ func processOidLiteral(l *lexer) processResult {
 
 func processNumericLiteral(l *lexer) processResult {
 	r := l.next()
+	l.backup()
 	if r != '+' && r != '-' && !('0' <= r && r <= '9') {
-		l.backup()
 		return resultNoMatch
 	}
 
@@ -644,7 +751,8 @@ func processKeyword(l *lexer) processResult {
 				return resultNoMatch
 			}
 		}
-		if !isAlpha(rune) {
+		// digits and hyphens are allowed after the first letter, e.g. counter64 and count-of
+		if !isAlpha(rune) && !unicode.IsDigit(rune) && rune != '-' {
 			l.reset()
 			return resultNoMatch
 		}
@@ -689,7 +797,7 @@ func isAlpha(r rune) bool {
 }
 
 func isEndOfWord(r rune) bool {
-	return isSpace(r) || isEndOfLine(r) || r == eof || r == '('
+	return isSpace(r) || isEndOfLine(r) || r == eof || r == '(' || r == ')' || r == ',' || r == '}'
 }
 
 // Is item allow arguments to span on next line or not?
@@ -279,3 +279,12 @@ func ExampleLexing4() {
 	// item: <endvar>
 	// item: EOF
 }
+
+func ExampleLexing5() {
+	printTokens(lex("test", "mac = 0x000A0B0C0D0E"))
+	// Output:
+	// item: "mac" (type identifier)
+	// item: "=" (type =)
+	// item: "0x000A0B0C0D0E" (type int literal)
+	// item: EOF
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// AuthLockout locks out a source which sends too many requests with a bad community within a window,
+// like the brute-force protection of some devices. The requests of a locked out source are not processed
+// whatever their community until the lockout ends.
+type AuthLockout struct {
+	lock        sync.Mutex
+	maxFailures int
+	window      time.Duration
+	duration    time.Duration
+	sources     map[string]*sourceFailures // by source address without the port
+	lastSweep   time.Time                  // of the sources with no recent failures
+}
+
+type sourceFailures struct {
+	times       []time.Time // of the requests with a bad community within the window
+	lockedUntil time.Time   // zero if not locked out
+}
+
+func newAuthLockout(maxFailures int, window time.Duration, duration time.Duration) *AuthLockout {
+	return &AuthLockout{
+		maxFailures: maxFailures,
+		window:      window,
+		duration:    duration,
+		sources:     make(map[string]*sourceFailures),
+	}
+}
+
+// Failure records a request with a bad community from the source, true if it locks the source out
+func (lockout *AuthLockout) Failure(source string, now time.Time) bool {
+	lockout.lock.Lock()
+	defer lockout.lock.Unlock()
+
+	if now.Sub(lockout.lastSweep) >= lockout.window {
+		lockout.sweep(now)
+	}
+	failures, ok := lockout.sources[source]
+	if !ok {
+		failures = new(sourceFailures)
+		lockout.sources[source] = failures
+	}
+	// forget the failures which have gone out of the window
+	recent := failures.times[:0]
+	for _, t := range failures.times {
+		if now.Sub(t) < lockout.window {
+			recent = append(recent, t)
+		}
+	}
+	failures.times = append(recent, now)
+
+	if len(failures.times) < lockout.maxFailures {
+		return false
+	}
+	failures.times = nil
+	failures.lockedUntil = now.Add(lockout.duration)
+	return true
+}
+
+// sweep forgets the sources which are not locked out and have no failures within the window,
+// so a flood from many addresses does not keep growing the map
+// Must be called with the lock held
+func (lockout *AuthLockout) sweep(now time.Time) {
+	for source, failures := range lockout.sources {
+		if now.Before(failures.lockedUntil) {
+			continue
+		}
+		if n := len(failures.times); n == 0 || now.Sub(failures.times[n-1]) >= lockout.window {
+			delete(lockout.sources, source)
+		}
+	}
+	lockout.lastSweep = now
+}
+
+// Locked returns true if the source is locked out
+func (lockout *AuthLockout) Locked(source string, now time.Time) bool {
+	lockout.lock.Lock()
+	defer lockout.lock.Unlock()
+
+	failures, ok := lockout.sources[source]
+	if !ok || failures.lockedUntil.IsZero() {
+		return false
+	}
+	if now.Before(failures.lockedUntil) {
+		return true
+	}
+	// the lockout is over so the source starts again with no failures
+	delete(lockout.sources, source)
+	return false
+}
+
+// sourceHost returns the address of the source of a request without the port, which changes between requests
+func sourceHost(source net.Addr) string {
+	if udpAddr, ok := source.(*net.UDPAddr); ok {
+		return udpAddr.IP.String()
+	}
+	host, _, err := net.SplitHostPort(source.String())
+	if err != nil {
+		return source.String()
+	}
+	return host
+}
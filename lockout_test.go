@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+func TestAuthLockout(t *testing.T) {
+	lockout := newAuthLockout(3, time.Minute, 5*time.Minute)
+	start := time.Now()
+
+	// failures out of the window do not count
+	for _, offset := range []time.Duration{0, 30 * time.Second, 90 * time.Second, 95 * time.Second} {
+		if lockout.Failure("192.0.2.1", start.Add(offset)) {
+			t.Fatalf("locked out after the failure at %v", offset)
+		}
+	}
+	if lockout.Locked("192.0.2.1", start.Add(96*time.Second)) {
+		t.Fatal("locked out with 2 failures in the window")
+	}
+	if !lockout.Failure("192.0.2.1", start.Add(100*time.Second)) {
+		t.Fatal("not locked out after 3 failures in the window")
+	}
+	if !lockout.Locked("192.0.2.1", start.Add(101*time.Second)) {
+		t.Error("not locked out")
+	}
+	if lockout.Locked("192.0.2.2", start.Add(101*time.Second)) {
+		t.Error("another source locked out")
+	}
+	if lockout.Locked("192.0.2.1", start.Add(100*time.Second+5*time.Minute)) {
+		t.Error("still locked out after the lockout time")
+	}
+
+	// sources with no recent failures are forgotten
+	lockout.Failure("192.0.2.3", start.Add(10*time.Minute))
+	if len(lockout.sources) != 1 {
+		t.Errorf("%d sources, want only the one with a recent failure", len(lockout.sources))
+	}
+}
+
+func TestAuthLockoutServer(t *testing.T) {
+	addr := serveTestProgramWith(t, queryTestProg, &ServerConfig{
+		authLockout: 2, authLockoutWindow: time.Minute, authLockoutTime: time.Minute, authLockoutResp: "authorizationError"})
+	descr := asn1.Oid{1, 3, 6, 1, 2, 1, 1, 1, 0}
+
+	bad, err := newClient(addr, "guess", snmp.V2C, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bad.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := bad.Get(descr); err == nil {
+			t.Fatal("response to a bad community")
+		}
+	}
+
+	// even the right community is refused once locked out
+	for _, version := range []int{snmp.V2C, snmp.V1} {
+		client, err := newClient(addr, "public", version, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		want := snmp.AuthorizationError
+		if version == snmp.V1 {
+			want = snmp.NoSuchName
+		}
+		_, err = client.Get(descr)
+		var statusErr StatusError
+		if !errors.As(err, &statusErr) || statusErr.Status != want {
+			t.Errorf("version %d locked out: error %v, want status %d", version, err, want)
+		}
+	}
+}
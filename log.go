@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LogLevel is the least severe level of message which is logged
+type LogLevel int
+
+const (
+	LogError LogLevel = iota
+	LogWarn
+	LogInfo
+	LogDebug
+)
+
+var logLevelNames = map[LogLevel]string{
+	LogError: "error",
+	LogWarn:  "warn",
+	LogInfo:  "info",
+	LogDebug: "debug",
+}
+
+func (level *LogLevel) String() string {
+	return logLevelNames[*level]
+}
+
+// Set the log level from its name for the -log-level flag
+func (level *LogLevel) Set(value string) error {
+	for l, name := range logLevelNames {
+		if strings.EqualFold(value, name) {
+			*level = l
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid log level %s, expecting error, warn, info or debug", value)
+}
+
+// LevelLogger is a logger which drops messages less severe than its level
+type LevelLogger struct {
+	*log.Logger
+	level LogLevel
+}
+
+func newLevelLogger(out io.Writer, prefix string, flag int, level LogLevel) *LevelLogger {
+	return &LevelLogger{Logger: log.New(out, prefix, flag), level: level}
+}
+
+func (logger *LevelLogger) logf(level LogLevel, format string, a ...interface{}) {
+	if level > logger.level {
+		return
+	}
+	logger.Logger.Output(3, strings.ToUpper(logLevelNames[level])+": "+fmt.Sprintf(format, a...))
+}
+
+func (logger *LevelLogger) Errorf(format string, a ...interface{}) {
+	logger.logf(LogError, format, a...)
+}
+
+func (logger *LevelLogger) Warnf(format string, a ...interface{}) {
+	logger.logf(LogWarn, format, a...)
+}
+
+func (logger *LevelLogger) Infof(format string, a ...interface{}) {
+	logger.logf(LogInfo, format, a...)
+}
+
+func (logger *LevelLogger) Debugf(format string, a ...interface{}) {
+	logger.logf(LogDebug, format, a...)
+}
+
+// Printf logs at info level
+func (logger *LevelLogger) Printf(format string, a ...interface{}) {
+	logger.logf(LogInfo, format, a...)
+}
+
+// Println logs at info level
+func (logger *LevelLogger) Println(a ...interface{}) {
+	logger.logf(LogInfo, "%s", fmt.Sprintln(a...))
+}
+
+// ByteSize is a size in bytes with an optional K, M or G suffix (multiples of 1024) for flags, e.g. 50MB
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"", 1},
+}
+
+func (size *ByteSize) String() string {
+	for _, unit := range byteSizeUnits {
+		if *size != 0 && int64(*size)%unit.size == 0 {
+			return fmt.Sprintf("%d%s", int64(*size)/unit.size, unit.suffix)
+		}
+	}
+	return "0"
+}
+
+// Set the size from e.g. 50MB, 64K or 1000
+func (size *ByteSize) Set(value string) error {
+	str := strings.TrimSuffix(strings.ToUpper(value), "B")
+	str = strings.TrimSuffix(str, "I") // KiB etc.
+	for _, unit := range byteSizeUnits {
+		if unit.suffix != "" && !strings.HasSuffix(str, unit.suffix) {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSuffix(str, unit.suffix), 10, 64)
+		if err != nil || n < 0 {
+			break
+		}
+		*size = ByteSize(n * unit.size)
+		return nil
+	}
+	return fmt.Errorf("Invalid size %s, expecting e.g. 50MB, 64K or 1000", value)
+}
+
+// RotatingFile is a log file which is rotated when it reaches a maximum size
+// The old files are name.1 (most recent) to name.keep. Writes are serialized so it can be shared by goroutines.
+type RotatingFile struct {
+	lock    sync.Mutex
+	name    string
+	maxSize int64 // 0 for no rotation
+	keep    int   // number of old files to keep
+	file    *os.File
+	size    int64
+}
+
+// openRotatingFile opens the file for appending, rotating it once it has maxSize bytes, 0 for never
+func openRotatingFile(name string, maxSize int64, keep int) (*RotatingFile, error) {
+	rf := &RotatingFile{name: name, maxSize: maxSize, keep: keep}
+	err := rf.open()
+	if err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file = file
+	rf.size = info.Size()
+	return nil
+}
+
+// Write writes to the file, first rotating it if the write would take it past the maximum size
+func (rf *RotatingFile) Write(p []byte) (n int, err error) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		err = rf.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err = rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate renames name to name.1, name.1 to name.2 and so on, dropping the oldest, and starts a new file
+func (rf *RotatingFile) rotate() error {
+	err := rf.file.Close()
+	if err != nil {
+		return err
+	}
+	if rf.keep <= 0 {
+		os.Remove(rf.name)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", rf.name, rf.keep))
+		for i := rf.keep - 1; i >= 1; i-- {
+			// older files may not exist yet
+			os.Rename(fmt.Sprintf("%s.%d", rf.name, i), fmt.Sprintf("%s.%d", rf.name, i+1))
+		}
+		err = os.Rename(rf.name, rf.name+".1")
+		if err != nil {
+			return err
+		}
+	}
+	return rf.open()
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	return rf.file.Close()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLevelLogger(t *testing.T) {
+	var buf bytes.Buffer
+	var level LogLevel
+	if err := level.Set("WARN"); err != nil {
+		t.Fatal(err)
+	}
+	l := newLevelLogger(&buf, "", 0, level)
+	l.Errorf("bad %d\n", 1)
+	l.Warnf("odd %d\n", 2)
+	l.Infof("fine %d\n", 3)
+	l.Debugf("detail %d\n", 4)
+	l.Printf("printf %d\n", 5)
+
+	want := "ERROR: bad 1\nWARN: odd 2\n"
+	if buf.String() != want {
+		t.Errorf("logged %q, want %q", buf.String(), want)
+	}
+	if err := level.Set("loud"); err == nil || !strings.Contains(err.Error(), "loud") {
+		t.Errorf("expected error for invalid level, got %v", err)
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  ByteSize
+	}{
+		{"1000", 1000},
+		{"64K", 64 << 10},
+		{"50MB", 50 << 20},
+		{"1GiB", 1 << 30},
+		{"2m", 2 << 20},
+	}
+	for _, test := range tests {
+		var size ByteSize
+		if err := size.Set(test.value); err != nil || size != test.want {
+			t.Errorf("%s = %d (%v), want %d", test.value, size, err, test.want)
+		}
+	}
+	for _, bad := range []string{"", "MB", "-1K", "10T"} {
+		var size ByteSize
+		if err := size.Set(bad); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+	size := ByteSize(50 << 20)
+	if size.String() != "50M" {
+		t.Errorf("String() = %s, want 50M", size.String())
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.sim.log")
+	rf, err := openRotatingFile(name, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	l := newLevelLogger(rf, "", 0, LogInfo)
+
+	// 22 byte lines from several goroutines
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				l.Infof("goroutine %d %03d\n", g, i)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	lines := 0
+	for _, suffix := range []string{"", ".1", ".2"} {
+		data, err := os.ReadFile(name + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > 100 {
+			t.Errorf("%s has %d bytes, want at most 100", name+suffix, len(data))
+		}
+		for _, line := range strings.SplitAfter(string(data), "\n") {
+			if line == "" {
+				continue
+			}
+			if !strings.HasPrefix(line, "INFO: goroutine ") || len(line) != 22 {
+				t.Errorf("%s has interleaved line %q", name+suffix, line)
+			}
+			lines++
+		}
+	}
+	// 40 lines of 22 bytes fill 10 files of 4 so only the last 12 are kept
+	if lines != 12 {
+		t.Errorf("%d lines kept, want 12", lines)
+	}
+	if _, err := os.Stat(name + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists beyond -log-keep 2", name)
+	}
+}
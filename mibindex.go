@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// MibIndex is a flattened table of the names of MIB objects with their OIDs, and optionally their syntax,
+// such as written by smidump -f identifiers, so a program can use the names of OIDs without a MIB compiler.
+type MibIndex struct {
+	objects map[string]MibObject // by name
+}
+
+// MibObject is a named OID of a MIB index
+type MibObject struct {
+	module string
+	name   string
+	kind   string   // e.g. scalar, column or node
+	oid    string   // canonical with a leading dot
+	syntax itemType // the type of variable it declares, itemNone if not known
+}
+
+// mibSyntaxes are the variable types for the SMI syntaxes and common textual conventions of a MIB index
+var mibSyntaxes = map[string]itemType{
+	"INTEGER":           itemInteger,
+	"Integer32":         itemInteger,
+	"OCTET STRING":      itemString,
+	"DisplayString":     itemString,
+	"SnmpAdminString":   itemString,
+	"OBJECT IDENTIFIER": itemOid,
+	"Counter":           itemCounter,
+	"Counter32":         itemCounter,
+	"Counter64":         itemCounter64,
+	"Gauge":             itemGauge,
+	"Gauge32":           itemGauge,
+	"Unsigned32":        itemGauge,
+	"TimeTicks":         itemTimeticks,
+	"IpAddress":         itemIpv4address,
+	"InetAddress":       itemInetAddress,
+	"BITS":              itemBitset,
+}
+
+// loadMibIndex reads a MIB index file
+func loadMibIndex(filename string) (*MibIndex, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	index, err := readMibIndex(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return index, nil
+}
+
+// readMibIndex reads the lines of a MIB index: module name kind oid and an optional syntax
+// e.g. IF-MIB ifDescr column 1.3.6.1.2.1.2.2.1.2 DisplayString
+// Blank lines, # and -- comments and the lines of types and other objects with no OID are skipped.
+// An unknown syntax is ignored so the variable must give its type. The first of two objects
+// with the same name is kept.
+func readMibIndex(r io.Reader) (*MibIndex, error) {
+	index := &MibIndex{objects: make(map[string]MibObject)}
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "--") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[2] == "type" {
+			continue
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("Line %d: expecting module, name, kind and OID but got %s", lineNum, line)
+		}
+		oid, err := canonicalOid(fields[3])
+		if err != nil {
+			continue
+		}
+		object := MibObject{module: fields[0], name: fields[1], kind: fields[2], oid: oid, syntax: itemNone}
+		if syntax, ok := mibSyntaxes[strings.Join(fields[4:], " ")]; ok {
+			object.syntax = syntax
+		}
+		if _, ok := index.objects[object.name]; !ok {
+			index.objects[object.name] = object
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// Len returns the number of named OIDs
+func (index *MibIndex) Len() int {
+	return len(index.objects)
+}
+
+// Lookup returns the object with the name
+func (index *MibIndex) Lookup(name string) (object MibObject, ok bool) {
+	object, ok = index.objects[name]
+	return object, ok
+}
+
+// maxSuggestions is the most names suggested for an unknown one
+const maxSuggestions = 3
+
+// Suggest returns the names closest to an unknown one: those differing only in case
+// or by a couple of edits, nearest first
+func (index *MibIndex) Suggest(name string) []string {
+	type suggestion struct {
+		name     string
+		distance int
+	}
+	var suggestions []suggestion
+	for other := range index.objects {
+		distance := editDistance(strings.ToLower(name), strings.ToLower(other))
+		if distance <= 2 {
+			suggestions = append(suggestions, suggestion{other, distance})
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].distance != suggestions[j].distance {
+			return suggestions[i].distance < suggestions[j].distance
+		}
+		return suggestions[i].name < suggestions[j].name
+	})
+	var names []string
+	for i := 0; i < len(suggestions) && i < maxSuggestions; i++ {
+		names = append(names, suggestions[i].name)
+	}
+	return names
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
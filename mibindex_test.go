@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const testMibIndex = `
+-- generated by smidump -f identifiers
+SNMPv2-MIB sysDescr      scalar 1.3.6.1.2.1.1.1 DisplayString
+SNMPv2-MIB sysUpTime     scalar 1.3.6.1.2.1.1.3 TimeTicks
+IF-MIB     InterfaceIndex type
+IF-MIB     ifNumber      scalar 1.3.6.1.2.1.2.1 Integer32
+IF-MIB     ifDescr       column 1.3.6.1.2.1.2.2.1.2 DisplayString
+IF-MIB     ifInOctets    column 1.3.6.1.2.1.2.2.1.10 Counter32
+IF-MIB     ifSpeed       column 1.3.6.1.2.1.2.2.1.5 Gauge32
+IF-MIB     ifMIB         node   1.3.6.1.2.1.31
+ACME-MIB   acmeSerial    scalar 1.3.6.1.4.1.99.1 AcmeSerialNumber
+`
+
+func TestReadMibIndex(t *testing.T) {
+	index, err := readMibIndex(strings.NewReader(testMibIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.Len() != 8 {
+		t.Errorf("%d names, want 8", index.Len())
+	}
+	object, ok := index.Lookup("ifInOctets")
+	if !ok || object.oid != ".1.3.6.1.2.1.2.2.1.10" || object.syntax != itemCounter || object.module != "IF-MIB" {
+		t.Errorf("ifInOctets = %+v", object)
+	}
+	if object, _ := index.Lookup("acmeSerial"); object.syntax != itemNone {
+		t.Errorf("unknown syntax = %v, want none", object.syntax)
+	}
+
+	_, err = readMibIndex(strings.NewReader("IF-MIB ifDescr 1.3.6.1.2.1.2.2.1.2\n"))
+	if err == nil || !strings.Contains(err.Error(), "Line 1") {
+		t.Errorf("short line error %v", err)
+	}
+}
+
+func TestParseMibNames(t *testing.T) {
+	if logger == nil {
+		logger = newLevelLogger(ioutil.Discard, "", 0, LogError)
+	}
+	index, err := readMibIndex(strings.NewReader(testMibIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parse := func(decls string) (*Program, error) {
+		parser := NewParser(lex("mib", "var\n"+decls+"\nendvar\nrun\nendrun"))
+		parser.SetMibIndex(index)
+		return parser.ParseProgram()
+	}
+
+	program, err := parse(`
+  descr: sysDescr.0 = "router"
+  ifs: ifNumber.0 rw
+  ifDescr.[1..2]: ifDescr string(16) = "eth%d"
+  serial: acmeSerial.0 string
+  octets: 2.1.2.2.1.10.1 counter`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := program.variables.types
+	tests := []struct {
+		id        string
+		oid       string
+		valueType ValueType
+	}{
+		{"descr", ".1.3.6.1.2.1.1.1.0", ValueString},
+		{"ifs", ".1.3.6.1.2.1.2.1.0", ValueInteger},
+		{"ifDescr.2", ".1.3.6.1.2.1.2.2.1.2.2", ValueString},
+		{"serial", ".1.3.6.1.4.1.99.1.0", ValueString},
+		{"octets", ".1.3.6.1.2.1.2.2.1.10.1", ValueCounter},
+	}
+	for _, test := range tests {
+		typ, ok := types[test.id]
+		if !ok || typ.oid != test.oid || typ.valueType != test.valueType {
+			t.Errorf("%s = %v, want %s of type %v", test.id, typ, test.oid, test.valueType)
+		}
+	}
+	if types["ifs"].snmpMode != SnmpModeReadWrite || types["ifDescr.1"].maxLength != 16 {
+		t.Errorf("rw mode or string length lost")
+	}
+
+	for decl, want := range map[string]string{
+		"descr: sysDesc.0":     "Unknown MIB name sysDesc, did you mean sysDescr?",
+		"descr: nothingLike.0": "Unknown MIB name nothingLike",
+		"serial: acmeSerial.0": "Expecting a variable type",
+		"n: ifInOctets.1 rw":   "Counter type can not be in rw mode",
+	} {
+		_, err := parse("  " + decl)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %v, want %s", decl, err, want)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type ValueType int
@@ -36,6 +40,9 @@ const (
 	ValueIpv4address
 	ValueGuage
 	ValueBytes
+	ValueCounter64
+	ValueTable
+	ValueInetAddress
 	ValueNone
 )
 
@@ -47,12 +54,16 @@ const (
 	StmtSleep
 	StmtBreak
 	StmtRead
+	StmtTrap
+	StmtReboot
+	StmtAppear
 )
 
 const (
 	LoopForever LoopType = iota
 	LoopWhile
 	LoopTimes
+	LoopEvery
 )
 
 const (
@@ -63,6 +74,7 @@ const (
 	ExprnBitset
 	ExprnOid
 	ExprnAddr
+	ExprnInet
 )
 
 const (
@@ -100,20 +112,30 @@ const (
 	StringBinaryOpMinus
 )
 
+// Program is the root of the syntax tree of a program.
+// The variables section declares the Types (keyed by identifier and by OID), the Tables and the OID aliases,
+// the statements of the run section are a tree of Statement nodes whose expressions are Expression nodes.
 type Program struct {
 	variables *Variables
 	stmtList  []*Statement
+	metadata  map[string]string // from //@key: value comments, e.g. the device being simulated
+	config    []configSetting   // options of the config section, which the command line overrides
 }
 
+// Variables are the declarations of the var section
 type Variables struct {
 	types        map[string]*Type
 	typesFromOid map[string]*Type
-	intAliases   map[string]int // global
+	intAliases   map[string]int    // global
+	tables       map[string]*Table // tables whose rows are created by SET
+	oidAliases   map[string]string // alias OID -> OID it returns the value of
 }
 
 type Parser struct {
-	prefixOid string // OID prefix used if oid not prefixed by dot
+	prefixOid string    // OID prefix used if oid not prefixed by dot
+	mibIndex  *MibIndex // optional names of OIDs
 	variables *Variables
+	metadata  map[string]string
 
 	lex   *lexer
 	token item
@@ -127,24 +149,76 @@ func (parser *Parser) nextItem() item {
 	if parser.hold {
 		parser.hold = false
 	} else {
-		parser.token = parser.lex.nextItem()
+		parser.token = parser.lexItem()
 	}
 	//fmt.Println("-> token: ", parser.token)
 	return parser.token
 }
 
+// lexItem returns the next token from the lexer keeping any metadata comments
+// as they can appear anywhere
+func (parser *Parser) lexItem() item {
+	for {
+		token := parser.lex.nextItem()
+		if token.typ != itemMetadata {
+			return token
+		}
+		key, value := token.val, ""
+		if i := strings.Index(token.val, ":"); i >= 0 {
+			key, value = token.val[:i], token.val[i+1:]
+		}
+		if parser.metadata == nil {
+			parser.metadata = make(map[string]string)
+		}
+		parser.metadata[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+}
+
 // peek returns but does not consume the nextItem token.
 func (parser *Parser) peek() item {
 	if parser.hold {
 		return parser.token
 	}
 	parser.hold = true
-	parser.token = parser.lex.nextItem()
+	parser.token = parser.lexItem()
 	return parser.token
 }
 
+// asKeyword returns an identifier which is a contextual keyword as that keyword
+func asKeyword(i item) item {
+	if i.typ == itemIdentifier {
+		if typ, ok := contextKeywords[i.val]; ok {
+			i.typ = typ
+		}
+	}
+	return i
+}
+
+// peekKeyword is peek where a contextual keyword can be, e.g. the rate after the type of a variable
+func (parser *Parser) peekKeyword() item {
+	return asKeyword(parser.peek())
+}
+
+// nextKeyword is nextItem where a contextual keyword can be
+func (parser *Parser) nextKeyword() item {
+	return asKeyword(parser.nextItem())
+}
+
+// peekStatementKeyword is peek where a contextual keyword or an expression can be, e.g. the start of a statement,
+// where the word of a declared variable is the variable
+func (parser *Parser) peekStatementKeyword() item {
+	item := parser.peek()
+	if item.typ == itemIdentifier && parser.lookupType(item.val) != ValueNone {
+		return item
+	}
+	return asKeyword(item)
+}
+
 func (parser *Parser) matchItem(itemTyp itemType, context string) (item item, err error) {
 	item = parser.nextItem()
+	if item.typ == itemIdentifier && contextKeywords[item.val] == itemTyp {
+		item.typ = itemTyp
+	}
 	//fmt.Printf("-> matching on item: %v, got token: %v\n", itemTyp, item)
 	if item.typ != itemTyp {
 		return item, parser.errorf("Expecting %v in %s but got \"%v\"", itemTyp, context, item.typ)
@@ -173,10 +247,27 @@ func printfIndent(indent int, format string, a ...interface{}) {
 
 func PrintProgram(prog *Program, indent int) {
 	printfIndent(indent, "Program\n")
+	PrintMetadata(prog.metadata, indent+1)
 	PrintVariables(prog.variables, indent+1)
 	PrintStatementList(prog.stmtList, indent+1)
 }
 
+func PrintMetadata(metadata map[string]string, indent int) {
+	if len(metadata) == 0 {
+		return
+	}
+	printfIndent(indent, "Metadata\n")
+	// sort for testing predictability
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		printfIndent(indent+1, "%s: %s\n", key, metadata[key])
+	}
+}
+
 func PrintVariables(vars *Variables, indent int) {
 	printfIndent(indent, "Variables\n")
 
@@ -192,6 +283,34 @@ func PrintVariables(vars *Variables, indent int) {
 		printfIndent(indent+2, "%s: %v\n", id, vars.types[id])
 	}
 
+	// tables
+	// sort for testing predictability
+	if len(vars.tables) > 0 {
+		printfIndent(indent+1, "Tables\n")
+		ids = make([]string, 0)
+		for id := range vars.tables {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			printfIndent(indent+2, "%s: %v\n", id, vars.tables[id])
+		}
+	}
+
+	// OID aliases
+	// sort for testing predictability
+	if len(vars.oidAliases) > 0 {
+		printfIndent(indent+1, "OID aliases\n")
+		oids := make([]string, 0)
+		for oid := range vars.oidAliases {
+			oids = append(oids, oid)
+		}
+		sort.Strings(oids)
+		for _, oid := range oids {
+			printfIndent(indent+2, "%s = %s\n", oid, vars.oidAliases[oid])
+		}
+	}
+
 	// aliases
 	// sort for testing predictability
 	if len(vars.intAliases) > 0 {
@@ -229,6 +348,12 @@ func PrintOneStatement(stmt *Statement, indent int) {
 		PrintPrintStmt(stmt.printStmt, indent+1)
 	case StmtRead:
 		PrintReadStmt(stmt.readStmt, indent+1)
+	case StmtTrap:
+		PrintTrapStmt(stmt.trapStmt, indent+1)
+	case StmtReboot:
+		printfIndent(indent+1, "Reboot Statement (coldStart trap: %t)\n", stmt.rebootStmt.coldStartTrap)
+	case StmtAppear:
+		printfIndent(indent+1, "%s Statement: %s\n", stmt.appearStmt.keyword(), strings.Join(stmt.appearStmt.ids, ", "))
 	case StmtBreak:
 		printfIndent(indent, "Break\n")
 	}
@@ -287,6 +412,19 @@ func PrintReadStmt(readStmt *ReadStatement, indent int) {
 	printfIndent(indent, "id: %s", readStmt.identifier)
 }
 
+func PrintTrapStmt(trapStmt *TrapStatement, indent int) {
+	printfIndent(indent, "Trap Statement\n")
+	printfIndent(indent, "generic\n")
+	PrintIntExpression(trapStmt.genericExprn, indent+1)
+	if trapStmt.specificExprn != nil {
+		printfIndent(indent, "specific\n")
+		PrintIntExpression(trapStmt.specificExprn, indent+1)
+	}
+	for i, id := range trapStmt.identifiers {
+		printfIndent(indent, "[%d]: with id: %s\n", i, id)
+	}
+}
+
 func PrintLoopStmt(loopStmt *LoopStatement, indent int) {
 	printfIndent(indent, "Loop Statement (%v)\n", loopStmt.loopType)
 	switch loopStmt.loopType {
@@ -294,6 +432,9 @@ func PrintLoopStmt(loopStmt *LoopStatement, indent int) {
 		PrintBooleanExpression(loopStmt.boolExpression, indent+1)
 	case LoopTimes:
 		PrintIntExpression(loopStmt.intExpression, indent+1)
+	case LoopEvery:
+		PrintIntExpression(loopStmt.intExpression, indent+1)
+		printfIndent(indent+1, "%v\n", loopStmt.units)
 	}
 	PrintStatementList(loopStmt.stmtList, indent+1)
 }
@@ -403,6 +544,8 @@ func PrintStrAddTerm(i int, term *StringTerm, indent int) {
 	switch term.strTermType {
 	case StringTermValue:
 		printfIndent(indent, "Literal: \"%s\"\n", term.strVal)
+	case StringTermHexValue:
+		printfIndent(indent, "Hex literal: 0x%X\n", term.strVal)
 	case StringTermId:
 		printfIndent(indent, "Identifier: %s\n", term.identifier)
 	case StringTermBracket:
@@ -414,6 +557,8 @@ func PrintStrAddTerm(i int, term *StringTerm, indent int) {
 	case StringTermStringedIntExprn:
 		printfIndent(indent, "Stringify Int Expression\n")
 		PrintIntExpression(term.stringedIntExprn, indent+1)
+	case StringTermFormat:
+		printfIndent(indent, "Format: %q with %d arguments\n", term.format, len(term.formatArgs))
 	}
 }
 
@@ -536,6 +681,11 @@ func PrintIntFactor(i int, factor *IntFactor, indent int) {
 	}
 }
 
+// Parse parses the source of a program, the name is used in error messages
+func Parse(name string, src string) (*Program, error) {
+	return NewParser(lex(name, src)).ParseProgram()
+}
+
 func NewParser(l *lexer) *Parser {
 	return &Parser{
 		lex:       l,
@@ -543,8 +693,17 @@ func NewParser(l *lexer) *Parser {
 	}
 }
 
+// SetMibIndex sets the names of OIDs a variable can be declared with rather than its numeric OID
+func (parser *Parser) SetMibIndex(index *MibIndex) {
+	parser.mibIndex = index
+}
+
 func (parser *Parser) ParseProgram() (prog *Program, err error) {
 	prog = new(Program)
+	prog.config, err = parser.parseConfigSection()
+	if err != nil {
+		return nil, err
+	}
 	prog.variables, err = parser.parseVariables()
 	if err != nil {
 		return nil, err
@@ -570,14 +729,76 @@ func (parser *Parser) ParseProgram() (prog *Program, err error) {
 	if err != nil {
 		return nil, err
 	}
+	prog.metadata = parser.metadata
 	return prog, nil
 }
 
+// parseConfigSection parses the options a program is served with by default, as in a -config file
+// e.g.
+//	config
+//	  c = "monitor"
+//	  p = 1161
+//	endconfig
+// config and endconfig are not keywords, so that variables can still be called config.
+// Grammar
+//	<config-section> ::= config <newline> {<option> = <value> <newline>} endconfig <newline>
+func (parser *Parser) parseConfigSection() (settings []configSetting, err error) {
+	item := parser.peek()
+	if item.typ != itemIdentifier || item.val != "config" {
+		return nil, nil
+	}
+	parser.nextItem()
+	err = parser.match(itemNewLine, "config")
+	if err != nil {
+		return nil, err
+	}
+	for {
+		item = parser.nextItem()
+		switch {
+		case item.typ == itemNewLine:
+			continue
+		case item.typ == itemIdentifier && item.val == "endconfig":
+			err = parser.match(itemNewLine, "endconfig")
+			if err != nil {
+				return nil, err
+			}
+			return settings, nil
+		case item.typ == itemEOF:
+			return nil, parser.errorf("Cannot find endconfig")
+		case item.typ != itemIdentifier && keywords[item.val] != item.typ:
+			// an option can be a keyword here
+			return nil, parser.errorf("Expecting an option in the config section but got %s", item)
+		}
+		setting := configSetting{name: item.val, line: item.line}
+		err = parser.match(itemEquals, "config option")
+		if err != nil {
+			return nil, err
+		}
+		valueItem := parser.nextItem()
+		switch valueItem.typ {
+		case itemStringLiteral, itemIntegerLiteral, itemIdentifier, itemTrue, itemFalse:
+			setting.value = valueItem.val
+		default:
+			return nil, parser.errorf("Expecting a string, a number or a word as the value of %s but got %s",
+				setting.name, valueItem)
+		}
+		settings = append(settings, setting)
+		err = parser.match(itemNewLine, "config option")
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
 func (parser *Parser) parseVariables() (vars *Variables, err error) {
 	vars = new(Variables)
 	vars.types = make(map[string]*Type)
 	vars.typesFromOid = make(map[string]*Type)
 	vars.intAliases = make(map[string]int)
+	vars.tables = make(map[string]*Table)
+	vars.oidAliases = make(map[string]string)
+	// initial value expressions can use the variables declared before them
+	parser.variables = vars
 
 	item := parser.peek()
 	if item.typ != itemVar {
@@ -594,6 +815,12 @@ func (parser *Parser) parseVariables() (vars *Variables, err error) {
 	// we have potentially some variables (could be empty)
 	for {
 		item = parser.nextItem()
+		if item.typ == itemIdentifier && item.val == "alias" {
+			// an alias is followed by its OID, a variable called alias by : or >
+			if next := parser.peek().typ; next == itemOidLiteral || next == itemIntegerLiteral {
+				item = asKeyword(item)
+			}
+		}
 		switch item.typ {
 		case itemEndVar:
 			// end of variable declaration
@@ -601,15 +828,32 @@ func (parser *Parser) parseVariables() (vars *Variables, err error) {
 			if err != nil {
 				return nil, err
 			}
+			err = parser.resolveCountOfs(vars)
+			if err != nil {
+				return nil, err
+			}
 			return vars, nil
 		case itemEOF:
 			// end of any input which is an error
 			err := parser.errorf("Cannot find EndVar")
 			return nil, err
+		case itemOidAlias:
+			err = parser.parseOidAlias(vars)
+			if err != nil {
+				return nil, err
+			}
 		case itemIdentifier:
 			idStr := item.val
 			var initMode InitMode
 
+			if parser.peek().typ == itemDot {
+				err = parser.parseRange(vars, idStr)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+
 			switch parser.nextItem().typ {
 			case itemColon:
 				initMode = InitModeZero
@@ -623,20 +867,22 @@ func (parser *Parser) parseVariables() (vars *Variables, err error) {
 			if err != nil {
 				return nil, err
 			}
-
-			if _, ok := vars.types[idStr]; ok {
-				return nil, parser.errorf("Redeclaration of variable identifier: %s", idStr)
+			err = parser.declareVariable(vars, idStr, typ)
+			if err != nil {
+				return nil, err
 			}
-			vars.types[idStr] = typ
-
-			if len(typ.oid) > 0 {
-				if _, ok := vars.typesFromOid[typ.oid]; ok {
-					return nil, parser.errorf("Reuse of OID in variable identifier: %s with OID: %s", idStr, typ.oid)
-				}
-				vars.typesFromOid[typ.oid] = typ
+		case itemOidLiteral:
+			// a variable with no identifier, one OID per line: .1.3.6.1.2.1.1.1.0 string = "router"
+			parser.hold = true
+			typ, err := parser.parseType(vars, InitModeZero, "")
+			if err != nil {
+				return nil, err
 			}
-
-			err = parser.match(itemNewLine, "Variable declaration")
+			if typ.valueType == ValueTable {
+				return nil, parser.errorf("Table needs an identifier")
+			}
+			typ.id = typ.oid
+			err = parser.declareVariable(vars, typ.id, typ)
 			if err != nil {
 				return nil, err
 			}
@@ -646,6 +892,205 @@ func (parser *Parser) parseVariables() (vars *Variables, err error) {
 	}
 }
 
+// maxRangeSize is the most instances a range can declare
+const maxRangeSize = 65536
+
+// parseRange parses the declaration of a range of instances of a variable
+// e.g. ifDescr.[1..48]: 2.1.2.2.1.2 string = "GigabitEthernet0/%d"
+// declares ifDescr.1 to ifDescr.48 with the OIDs 2.1.2.2.1.2.1 to 2.1.2.2.1.2.48.
+// The %d of an initial string value is replaced by the index of the instance.
+// The initial value of a numeric range is an expression of the index and constants, e.g.
+// ifInOctets.[1..48]: 2.1.2.2.1.10 counter = index * 1000
+// Grammar
+//	<range> ::= <id> . [ <int-literal> .. <int-literal> ] (: | >) <type> [= <literal> | = <index-expression>]
+func (parser *Parser) parseRange(vars *Variables, id string) (err error) {
+	parser.nextItem() // .
+	err = parser.match(itemLeftSquareBracket, "range")
+	if err != nil {
+		return err
+	}
+	firstItem, err := parser.matchItem(itemIntegerLiteral, "range")
+	if err != nil {
+		return err
+	}
+	err = parser.match(itemDot, "range, expecting ..")
+	if err != nil {
+		return err
+	}
+	// the second dot lexes as the start of an OID, e.g. ".48"
+	lastItem := parser.nextItem()
+	if lastItem.typ != itemOidLiteral || strings.Count(lastItem.val, ".") != 1 {
+		return parser.errorf("Expecting ..<int-literal> in range")
+	}
+	lastItem.val = lastItem.val[1:]
+	err = parser.match(itemRightSquareBracket, "range")
+	if err != nil {
+		return err
+	}
+	first, err := strconv.Atoi(firstItem.val)
+	if err != nil || first < 0 {
+		return parser.errorf("Invalid range start: %s", firstItem.val)
+	}
+	last, err := strconv.Atoi(lastItem.val)
+	if err != nil || last < first || last-first >= maxRangeSize {
+		return parser.errorf("Invalid range %s..%s, expecting at most %d instances", firstItem.val, lastItem.val, maxRangeSize)
+	}
+
+	var initMode InitMode
+	switch parser.nextItem().typ {
+	case itemColon:
+		initMode = InitModeZero
+	case itemGreaterThan:
+		initMode = InitModeExternal
+	default:
+		return parser.errorf("Non valid char after range")
+	}
+	typ, err := parser.parseType(vars, initMode, id)
+	if err != nil {
+		return err
+	}
+	if typ.oid == "" || typ.valueType == ValueTable {
+		return parser.errorf("A range needs an OID and can not be a table")
+	}
+	var initValue *Value
+	var indexExprn *IntExpression
+	if parser.peek().typ == itemEquals {
+		if typ.randomStable {
+			return parser.errorf("A random-stable variable can not have an initial value")
+		}
+		parser.nextItem()
+		switch typ.valueType {
+		case ValueInteger, ValueCounter, ValueCounter64, ValueGuage, ValueTimeticks:
+			indexExprn, err = parser.parseIndexExpression(vars)
+		default:
+			initValue, err = parser.parseLiteralValue(vars, typ.valueType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for index := first; index <= last; index++ {
+		instance := *typ
+		instance.id = fmt.Sprintf("%s.%d", id, index)
+		instance.oid = fmt.Sprintf("%s.%d", typ.oid, index)
+		if typ.externalValue != nil {
+			instance.externalValue = make(chan *Value)
+		}
+		if typ.backend != nil {
+			// each instance has its own backend, and URL e.g. "http://localhost:9100/if/%d/speed"
+			backend := *typ.backend
+			if source, ok := backend.source.(httpBackend); ok {
+				backend.source = httpBackend{url: strings.Replace(source.url, "%d", strconv.Itoa(index), -1)}
+			}
+			instance.backend = &backend
+		}
+		if initValue != nil {
+			val := *initValue
+			if val.valueType == ValueString {
+				val.stringVal = strings.Replace(val.stringVal, "%d", strconv.Itoa(index), -1)
+				instance.initEnvRefs = true
+			}
+			instance.initValue = &val
+		}
+		if indexExprn != nil {
+			instance.initValue, err = parser.indexExpressionValue(indexExprn, typ.valueType, index)
+			if err != nil {
+				return err
+			}
+		}
+		if _, ok := vars.types[instance.id]; ok {
+			return parser.errorf("Redeclaration of variable identifier: %s", instance.id)
+		}
+		if other, ok := vars.typesFromOid[instance.oid]; ok {
+			return parser.errorf("Reuse of OID in range %s.[%d..%d]: %s is the OID of %s", id, first, last, instance.oid, other.id)
+		}
+		vars.types[instance.id] = &instance
+		vars.typesFromOid[instance.oid] = &instance
+		if typ.lastChange != nil {
+			// the last change of each instance is at the track-change OID with the same index
+			lastChange := *typ.lastChange
+			lastChange.oid = fmt.Sprintf("%s.%d", typ.lastChange.oid, index)
+			instance.lastChange = &lastChange
+			err = parser.declareLastChange(vars, instance.id, &instance)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return parser.match(itemNewLine, "Range declaration")
+}
+
+// parseIndexExpression parses the integer expression of the initial values of a range's instances,
+// which can only use the index of the instance and constants
+func (parser *Parser) parseIndexExpression(vars *Variables) (exprn *IntExpression, err error) {
+	switch parser.peek().typ {
+	case itemIntegerLiteral, itemAlias, itemMinus, itemLeftParen, itemIdentifier:
+	default:
+		return nil, parser.errorf("Expecting an integer value")
+	}
+	// index is a variable of the expression only, hiding any declared
+	declared, isDeclared := vars.types[rangeIndexId]
+	vars.types[rangeIndexId] = &Type{valueType: ValueInteger, id: rangeIndexId}
+	exprn, err = parser.parseIntExpression()
+	delete(vars.types, rangeIndexId)
+	if isDeclared {
+		vars.types[rangeIndexId] = declared
+	}
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := intExpressionVariable(exprn, rangeIndexId); ok {
+		return nil, parser.errorf("The value of a range can only use %s and constants, not the variable %s", rangeIndexId, id)
+	}
+	return exprn, nil
+}
+
+// rangeIndexId is the variable of the index in the expression of a range's value
+const rangeIndexId = "index"
+
+// intExpressionVariable returns a variable other than the allowed one that an integer expression uses
+func intExpressionVariable(exprn *IntExpression, allowed string) (id string, found bool) {
+	for _, terms := range [][]*IntTerm{exprn.plusTerms, exprn.minusTerms} {
+		for _, term := range terms {
+			for _, factors := range [][]*IntFactor{term.timesFactors, term.divideFactors} {
+				for _, factor := range factors {
+					if id, found := intFactorVariable(factor, allowed); found {
+						return id, true
+					}
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+func intFactorVariable(factor *IntFactor, allowed string) (id string, found bool) {
+	switch factor.intFactorType {
+	case IntFactorId:
+		return factor.intIdentifier, factor.intIdentifier != allowed
+	case IntFactorMinus:
+		return intFactorVariable(factor.minusIntFactor, allowed)
+	case IntFactorBracket:
+		return intExpressionVariable(factor.bracketedExprn, allowed)
+	}
+	return "", false
+}
+
+// indexExpressionValue works out the initial value of the instance of a range with the index
+func (parser *Parser) indexExpressionValue(exprn *IntExpression, valueType ValueType, index int) (*Value, error) {
+	interp := &Interpreter{values: map[string]*Value{rangeIndexId: {valueType: ValueInteger, intVal: index}}}
+	n, err := interp.interpIntExpression(exprn)
+	if err != nil {
+		return nil, parser.errorf("Value of the range with %s %d: %v", rangeIndexId, index, err)
+	}
+	err = checkIntRange(valueType, n)
+	if err != nil {
+		return nil, parser.errorf("Invalid value of the range with %s %d: %v", rangeIndexId, index, err)
+	}
+	return intTypeValue(valueType, n), nil
+}
+
 func (parser *Parser) parseFields(typ *Type) (err error) {
 	offset := uint(0)
 	typ.fieldInfo.fieldOffsets = make(map[uint]string)
@@ -696,6 +1141,141 @@ func (parser *Parser) parseFields(typ *Type) (err error) {
 
 }
 
+// parseOid parses an OID, adding the prefix if it is not prefixed by a dot
+func (parser *Parser) parseOid(context string) (oidStr string, err error) {
+	item := parser.nextItem()
+	if item.typ != itemOidLiteral && item.typ != itemIntegerLiteral {
+		return "", parser.errorf("Expecting %v in %s but got \"%v\"", itemOidLiteral, context, item.typ)
+	}
+	oidStr = item.val
+	if !strings.HasPrefix(oidStr, ".") {
+		oidStr = parser.prefixOid + "." + oidStr
+	}
+	oidStr, err = canonicalOid(oidStr)
+	if err != nil {
+		return "", parser.errorf("Invalid OID %s: %v", item.val, err)
+	}
+	return oidStr, nil
+}
+
+// parseOidAlias parses an alias directive for an OID that returns the current value of another
+// alias <oid> = <oid> \n
+// The target may itself be an alias, the chain is resolved when the interpreter is initialized.
+func (parser *Parser) parseOidAlias(vars *Variables) (err error) {
+	aliasOid, err := parser.parseOid("alias")
+	if err != nil {
+		return err
+	}
+	err = parser.match(itemEquals, "alias")
+	if err != nil {
+		return err
+	}
+	targetOid, err := parser.parseOid("alias")
+	if err != nil {
+		return err
+	}
+	if _, ok := vars.oidAliases[aliasOid]; ok {
+		return parser.errorf("Redefinition of alias OID: %s", aliasOid)
+	}
+	vars.oidAliases[aliasOid] = targetOid
+	return parser.match(itemNewLine, "alias")
+}
+
+// parseTableColumns parses the columns of a table up to the closing bracket
+// Format:
+// id: entry-oid table {column-id: sub-id type, column-id: sub-id type, ...}
+// where one column is of type rowstatus
+func (parser *Parser) parseTableColumns(id string, oid string) (table *Table, err error) {
+	table = &Table{id: id, oid: oid}
+	table.lineNum = parser.token.line
+	subIds := make(map[uint]bool)
+
+	for {
+		// columns can be spread over lines
+		for parser.peek().typ == itemNewLine {
+			parser.nextItem()
+		}
+
+		if parser.peek().typ == itemRightCurlyBracket {
+			parser.nextItem()
+			break
+		}
+
+		idItem, err := parser.matchItem(itemIdentifier, "table columns")
+		if err != nil {
+			return nil, err
+		}
+
+		err = parser.match(itemColon, "table columns")
+		if err != nil {
+			return nil, err
+		}
+
+		subIdItem, err := parser.matchItem(itemIntegerLiteral, "table columns")
+		if err != nil {
+			return nil, err
+		}
+		subId, err := strconv.ParseUint(subIdItem.val, 10, 32)
+		if err != nil {
+			return nil, parser.errorf("Invalid table column number: %s", subIdItem.val)
+		}
+
+		column := &TableColumn{id: idItem.val, subId: uint(subId)}
+		switch parser.nextKeyword().typ {
+		case itemString:
+			column.valueType = ValueString
+		case itemInteger:
+			column.valueType = ValueInteger
+		case itemCounter:
+			column.valueType = ValueCounter
+		case itemCounter64:
+			column.valueType = ValueCounter64
+		case itemGauge:
+			column.valueType = ValueGuage
+		case itemTimeticks:
+			column.valueType = ValueTimeticks
+		case itemIpv4address:
+			column.valueType = ValueIpv4address
+		case itemInetAddress:
+			column.valueType = ValueInetAddress
+		case itemOid:
+			column.valueType = ValueOid
+		case itemRowStatus:
+			if table.statusColumn != nil {
+				return nil, parser.errorf("Table %s can only have one rowstatus column", id)
+			}
+			column.valueType = ValueInteger
+			table.statusColumn = column
+		default:
+			return nil, parser.errorf("Expecting a table column type")
+		}
+
+		for _, c := range table.columns {
+			if c.id == column.id {
+				return nil, parser.errorf("Cannot have multiple columns \"%s\" with the same name", column.id)
+			}
+		}
+		if subIds[column.subId] {
+			return nil, parser.errorf("Cannot have multiple columns numbered %d", column.subId)
+		}
+		subIds[column.subId] = true
+		table.columns = append(table.columns, column)
+
+		// optional comma
+		if parser.peek().typ == itemComma {
+			parser.nextItem()
+		}
+	}
+
+	if table.statusColumn == nil {
+		return nil, parser.errorf("Table %s needs a rowstatus column", id)
+	}
+	sort.Slice(table.columns, func(i, j int) bool {
+		return table.columns[i].subId < table.columns[j].subId
+	})
+	return table, nil
+}
+
 func (parser *Parser) parseAliases(vars *Variables) (err error) {
 
 	// loop through each alias - can be empty
@@ -735,45 +1315,151 @@ func (parser *Parser) parseAliases(vars *Variables) (err error) {
 	}
 }
 
-func (parser *Parser) parseType(vars *Variables, initMode InitMode, id string) (typ *Type, err error) {
-	typ = new(Type)
-	typ.initMode = initMode
-	typ.id = id
-
-	item := parser.nextItem()
-	typ.lineNum = item.line
-
-	// optional oid
-	if item.typ == itemOidLiteral || item.typ == itemIntegerLiteral {
-		if strings.HasPrefix(item.val, ".") {
-			typ.oid = item.val
-		} else {
-			typ.oid = parser.prefixOid + "." + item.val
-		}
-		item = parser.nextItem()
-
-		// optional rw or rwb snmp mode
-		switch item.typ {
-		case itemRW:
-			typ.snmpMode = SnmpModeReadWrite
-			typ.externalValue = make(chan *Value)
-			item = parser.nextItem()
-		case itemRWB:
-			typ.snmpMode = SnmpModeReadWriteBlocked
-			item = parser.nextItem()
-		}
+// parseIntRange parses the range of an integer after the (, e.g. 1..10) or -1..-1)
+func (parser *Parser) parseIntRange() (valueRange *IntRange, err error) {
+	min, err := parser.parseRangeBound()
+	if err != nil {
+		return nil, err
 	}
-
-	switch item.typ {
-	case itemString:
-		typ.valueType = ValueString
-	case itemInteger:
-		typ.valueType = ValueInteger
+	err = parser.match(itemDot, "integer range, expecting ..")
+	if err != nil {
+		return nil, err
+	}
+	var max int
+	if item := parser.peek(); item.typ == itemOidLiteral {
+		// the second dot lexes as the start of an OID, e.g. ".10"
+		parser.nextItem()
+		max, err = strconv.Atoi(item.val[1:])
+		if err != nil {
+			return nil, parser.errorf("Expecting ..<int-literal> in integer range")
+		}
+	} else {
+		err = parser.match(itemDot, "integer range, expecting ..")
+		if err != nil {
+			return nil, err
+		}
+		max, err = parser.parseRangeBound()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = parser.match(itemRightParen, "integer range")
+	if err != nil {
+		return nil, err
+	}
+	if max < min {
+		return nil, parser.errorf("Invalid integer range %d..%d", min, max)
+	}
+	return &IntRange{min: min, max: max}, nil
+}
+
+// parseRangeBound parses an integer with an optional minus sign
+func (parser *Parser) parseRangeBound() (bound int, err error) {
+	sign := 1
+	if parser.peek().typ == itemMinus {
+		parser.nextItem()
+		sign = -1
+	}
+	item, err := parser.matchItem(itemIntegerLiteral, "integer range")
+	if err != nil {
+		return 0, err
+	}
+	bound, err = strconv.Atoi(item.val)
+	if err != nil {
+		return 0, parser.errorf("Invalid integer range bound: %s", item.val)
+	}
+	return sign * bound, nil
+}
+
+func (parser *Parser) parseType(vars *Variables, initMode InitMode, id string) (typ *Type, err error) {
+	typ = new(Type)
+	typ.initMode = initMode
+	typ.id = id
+
+	item := parser.nextItem()
+	typ.lineNum = item.line
+	if isTypeItem(asKeyword(item).typ) {
+		item = asKeyword(item)
+	}
+
+	// optional oid, numeric or the name of a MIB object
+	mibSyntax := itemNone
+	if item.typ == itemIdentifier && parser.mibIndex != nil {
+		typ.oid, mibSyntax, err = parser.parseMibName(item.val)
+		if err != nil {
+			return nil, err
+		}
+	} else if item.typ == itemOidLiteral || item.typ == itemIntegerLiteral {
+		oidStr := item.val
+		if !strings.HasPrefix(oidStr, ".") {
+			oidStr = parser.prefixOid + "." + oidStr
+		}
+		typ.oid, err = canonicalOid(oidStr)
+		if err != nil {
+			return nil, parser.errorf("Invalid OID %s: %v", item.val, err)
+		}
+	}
+	if typ.oid != "" {
+		item = parser.nextItem()
+
+		// optional rw or rwb snmp mode
+		switch item.typ {
+		case itemRW:
+			typ.snmpMode = SnmpModeReadWrite
+			typ.externalValue = make(chan *Value)
+			item = parser.nextItem()
+		case itemRWB:
+			typ.snmpMode = SnmpModeReadWriteBlocked
+			item = parser.nextItem()
+		}
+		item = asKeyword(item)
+	}
+	if mibSyntax != itemNone && !isTypeItem(item.typ) {
+		// no type so it is that of the MIB object, and the item is what follows it
+		parser.hold = true
+		item.typ = mibSyntax
+	}
+
+	switch item.typ {
+	case itemString:
+		typ.valueType = ValueString
+		// optional maximum length: string(64)
+		if parser.peek().typ == itemLeftParen {
+			parser.nextItem()
+			lenItem, err := parser.matchItem(itemIntegerLiteral, "string length")
+			if err != nil {
+				return nil, err
+			}
+			maxLength, err := strconv.ParseUint(lenItem.val, 10, 32)
+			if err != nil || maxLength == 0 {
+				return nil, parser.errorf("Invalid string length: %s", lenItem.val)
+			}
+			typ.maxLength = uint(maxLength)
+			err = parser.match(itemRightParen, "string length")
+			if err != nil {
+				return nil, err
+			}
+		}
+	case itemInteger:
+		typ.valueType = ValueInteger
+		// optional range of values for SETs: integer(1..10)
+		if parser.peek().typ == itemLeftParen {
+			parser.nextItem()
+			typ.valueRange, err = parser.parseIntRange()
+			if err != nil {
+				return nil, err
+			}
+		}
 	case itemCounter:
 		if typ.snmpMode == SnmpModeReadWrite {
 			return nil, parser.errorf("Counter type can not be in rw mode as cannot be set")
 		}
 		typ.valueType = ValueCounter
+	case itemCounter64:
+		if typ.snmpMode == SnmpModeReadWrite {
+			return nil, parser.errorf("Counter type can not be in rw mode as cannot be set")
+		}
+		typ.valueType = ValueCounter64
 	case itemGauge:
 		typ.valueType = ValueGuage
 	case itemTimeticks:
@@ -785,12 +1471,35 @@ func (parser *Parser) parseType(vars *Variables, initMode InitMode, id string) (
 		}
 	case itemIpv4address:
 		typ.valueType = ValueIpv4address
-	case itemBitset:
+	case itemInetAddress:
+		typ.valueType = ValueInetAddress
+	case itemBitset, itemBits:
 		typ.valueType = ValueBitset
 	case itemOid:
 		typ.valueType = ValueOid
 	case itemBytes:
 		typ.valueType = ValueBytes
+	case itemTable:
+		if typ.oid == "" || typ.snmpMode != SnmpModeRead {
+			return nil, parser.errorf("Table needs an entry OID and no rw or rwb mode (its columns are writable)")
+		}
+		typ.valueType = ValueTable
+		err = parser.match(itemLeftCurlyBracket, "table definition")
+		if err != nil {
+			return nil, err
+		}
+		typ.table, err = parser.parseTableColumns(id, typ.oid)
+		if err != nil {
+			return nil, err
+		}
+		if parser.peekKeyword().typ == itemLatency {
+			parser.nextItem()
+			typ.table.latency, err = parser.parseLatency()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return typ, nil
 	default:
 		return nil, parser.errorf("Expecting a variable type")
 	}
@@ -822,9 +1531,729 @@ func (parser *Parser) parseType(vars *Variables, initMode InitMode, id string) (
 
 	}
 
+	switch parser.peekKeyword().typ {
+	case itemRate:
+		typ.rate, err = parser.parseRate(typ)
+		if err != nil {
+			return nil, err
+		}
+	case itemCycle, itemOnce:
+		typ.cycle, err = parser.parseCycle(vars, typ)
+		if err != nil {
+			return nil, err
+		}
+	case itemCountOf:
+		typ.countOf, err = parser.parseCountOf(typ)
+		if err != nil {
+			return nil, err
+		}
+	case itemHttp:
+		typ.backend, err = parser.parseBackend(vars, typ)
+		if err != nil {
+			return nil, err
+		}
+	case itemWave:
+		typ.wave, err = parser.parseWave(typ)
+		if err != nil {
+			return nil, err
+		}
+	case itemStable:
+		parser.nextItem()
+		switch typ.valueType {
+		case ValueInteger, ValueCounter, ValueCounter64, ValueGuage, ValueTimeticks, ValueString, ValueIpv4address:
+		default:
+			return nil, parser.errorf("Only a numeric, string or ipaddress variable can be random-stable")
+		}
+		if typ.oid == "" {
+			return nil, parser.errorf("Random-stable needs an OID as the value is made from it")
+		}
+		typ.randomStable = true
+	}
+
+	err = parser.parseMetadata(typ)
+	if err != nil {
+		return nil, err
+	}
+
 	return typ, nil
 }
 
+// declareVariable adds a variable, or a table, with its optional initial value to the variables
+func (parser *Parser) declareVariable(vars *Variables, idStr string, typ *Type) (err error) {
+	_, isType := vars.types[idStr]
+	_, isTable := vars.tables[idStr]
+	if isType || isTable {
+		return parser.errorf("Redeclaration of variable identifier: %s", idStr)
+	}
+
+	if typ.valueType == ValueTable {
+		// rows only exist once created so nothing to serve yet
+		vars.tables[idStr] = typ.table
+		return parser.match(itemNewLine, "Table declaration")
+	}
+	if parser.peek().typ == itemEquals {
+		if typ.randomStable {
+			return parser.errorf("A random-stable variable can not have an initial value")
+		}
+		parser.nextItem()
+		typ.initExprn, err = parser.parseExpression(typ.valueType)
+		if err != nil {
+			return err
+		}
+		if typ.initExprn.exprnType == ExprnString {
+			markEnvRefs(typ.initExprn.stringExpression)
+		}
+	}
+	vars.types[idStr] = typ
+
+	if len(typ.oid) > 0 {
+		if _, ok := vars.typesFromOid[typ.oid]; ok {
+			return parser.errorf("Reuse of OID in variable identifier: %s with OID: %s", idStr, typ.oid)
+		}
+		vars.typesFromOid[typ.oid] = typ
+	}
+	err = parser.declareLastChange(vars, idStr, typ)
+	if err != nil {
+		return err
+	}
+
+	return parser.match(itemNewLine, "Variable declaration")
+}
+
+// declareLastChange adds the timeticks variable of a track-change, which is served at its own OID
+// with the sysUpTime of the last change of the tracked variable, like ifLastChange for ifOperStatus
+func (parser *Parser) declareLastChange(vars *Variables, idStr string, typ *Type) error {
+	if typ.lastChange == nil {
+		return nil
+	}
+	typ.lastChange.id = idStr + "-last-change"
+	if _, ok := vars.types[typ.lastChange.id]; ok {
+		return parser.errorf("Redeclaration of variable identifier: %s", typ.lastChange.id)
+	}
+	if other, ok := vars.typesFromOid[typ.lastChange.oid]; ok {
+		return parser.errorf("Reuse of OID in track-change of %s: %s is the OID of %s", idStr, typ.lastChange.oid, other.id)
+	}
+	vars.types[typ.lastChange.id] = typ.lastChange
+	vars.typesFromOid[typ.lastChange.oid] = typ.lastChange
+	return nil
+}
+
+// parseMibName parses the name of an OID of the MIB index with an optional instance, e.g. sysDescr.0
+// and returns the OID and the type of variable of the MIB object, itemNone if the index does not have it
+func (parser *Parser) parseMibName(name string) (oid string, syntax itemType, err error) {
+	object, ok := parser.mibIndex.Lookup(name)
+	if !ok {
+		if suggestions := parser.mibIndex.Suggest(name); len(suggestions) > 0 {
+			return "", itemNone, parser.errorf("Unknown MIB name %s, did you mean %s?", name, strings.Join(suggestions, ", "))
+		}
+		return "", itemNone, parser.errorf("Unknown MIB name %s", name)
+	}
+	oid = object.oid
+	if next := parser.peek(); next.typ == itemOidLiteral && strings.HasPrefix(next.val, ".") {
+		parser.nextItem()
+		oid, err = canonicalOid(oid + next.val)
+		if err != nil {
+			return "", itemNone, parser.errorf("Invalid OID %s%s: %v", name, next.val, err)
+		}
+	}
+	return oid, object.syntax, nil
+}
+
+// isTypeItem returns true for the keywords of the types of variables
+func isTypeItem(typ itemType) bool {
+	switch typ {
+	case itemString, itemInteger, itemCounter, itemCounter64, itemGauge, itemTimeticks, itemBoolean,
+		itemIpv4address, itemInetAddress, itemBitset, itemBits, itemOid, itemBytes, itemTable:
+		return true
+	}
+	return false
+}
+
+// parseCountOf parses the table or range a variable counts the rows of
+// e.g. ifNumber: 2.1.2.1.0 integer count-of ifDescr
+// The table or range can be declared after the variable, so it is looked up at the end of the variables.
+func (parser *Parser) parseCountOf(typ *Type) (countOf *CountOf, err error) {
+	parser.nextItem() // count-of
+	if typ.valueType != ValueInteger && typ.valueType != ValueGuage {
+		return nil, parser.errorf("Only an integer or guage can be a count-of")
+	}
+	if typ.oid == "" || typ.snmpMode != SnmpModeRead {
+		return nil, parser.errorf("A count-of needs an OID and no rw or rwb mode as it is worked out when it is read")
+	}
+	item, err := parser.matchItem(itemIdentifier, "count-of")
+	if err != nil {
+		return nil, err
+	}
+	return &CountOf{id: item.val}, nil
+}
+
+// parseBackend parses the URL a variable's value is fetched from when it is read, the optional time
+// the value is served again for instead of fetching it and what is served if the fetch fails
+// e.g. cpu-load: 4.1.99.2.0 guage http "http://localhost:9100/cpu" cache 5 secs on-error default 0
+// The body of the response is the text of the value, as in a -v option.
+func (parser *Parser) parseBackend(vars *Variables, typ *Type) (backend *Backend, err error) {
+	parser.nextItem() // http
+	if typ.oid == "" || typ.valueType == ValueBytes {
+		return nil, parser.errorf("An http backend needs an OID and can not be bytes")
+	}
+	urlItem, err := parser.matchItem(itemStringLiteral, "http backend")
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(urlItem.val, "http://") && !strings.HasPrefix(urlItem.val, "https://") {
+		return nil, parser.errorf("Invalid http backend URL %s", urlItem.val)
+	}
+	backend = &Backend{source: httpBackend{url: urlItem.val}, timeout: defaultBackendTimeout, cache: defaultBackendCache,
+		onError: OnErrorLast}
+	if parser.peekKeyword().typ == itemCache {
+		parser.nextItem()
+		amountItem, err := parser.matchItem(itemIntegerLiteral, "cache")
+		if err != nil {
+			return nil, err
+		}
+		amount, err := strconv.Atoi(amountItem.val)
+		if err != nil {
+			return nil, parser.errorf("Invalid cache time: %s", amountItem.val)
+		}
+		units, err := parser.parseTimeUnits("cache")
+		if err != nil {
+			return nil, err
+		}
+		backend.cache = units.Duration(amount)
+		backend.fixedCache = true
+	}
+	if parser.peekKeyword().typ == itemOnError {
+		parser.nextItem()
+		policyItem, err := parser.matchItem(itemIdentifier, "on-error")
+		if err != nil {
+			return nil, err
+		}
+		backend.onError = policyItem.val
+		switch backend.onError {
+		case OnErrorLast, OnErrorGenErr:
+		case OnErrorDefault:
+			backend.defaultVal, err = parser.parseLiteralValue(vars, typ.valueType)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, parser.errorf("Invalid on-error %s, expecting last, default or genErr", backend.onError)
+		}
+	}
+	return backend, nil
+}
+
+// resolveCountOfs finds the tables and ranges counted by count-of variables
+func (parser *Parser) resolveCountOfs(vars *Variables) error {
+	for _, typ := range vars.types {
+		if typ.countOf == nil {
+			continue
+		}
+		if table, ok := vars.tables[typ.countOf.id]; ok {
+			typ.countOf.table = table
+			continue
+		}
+		prefix := typ.countOf.id + "."
+		for id := range vars.types {
+			if strings.HasPrefix(id, prefix) {
+				typ.countOf.instances++
+			}
+		}
+		if typ.countOf.instances == 0 {
+			return &ParseError{Name: parser.lex.name, Line: typ.lineNum,
+				Message: fmt.Sprintf("count-of %s is not a table or range", typ.countOf.id)}
+		}
+	}
+	return nil
+}
+
+// parseCycle parses the values served on successive reads of a variable
+// e.g. status: 2.1.25.3.2.1.5.1 integer [2 = 'running', 3 = 'warning'] cycle ['running', 'warning']
+// Grammar
+//	<cycle> ::= cycle [<value> {, <value>}] | once [<value> {, <value>}]
+func (parser *Parser) parseCycle(vars *Variables, typ *Type) (cycle *Cycle, err error) {
+	item := parser.nextKeyword() // cycle or once
+	if typ.oid == "" {
+		return nil, parser.errorf("A %s needs an OID as it is applied when the variable is read", item.val)
+	}
+	cycle = &Cycle{once: item.typ == itemOnce}
+
+	err = parser.match(itemLeftSquareBracket, item.val)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		val, err := parser.parseLiteralValue(vars, typ.valueType)
+		if err != nil {
+			return nil, err
+		}
+		cycle.values = append(cycle.values, val)
+
+		item = parser.nextItem()
+		if item.typ == itemRightSquareBracket {
+			return cycle, nil
+		}
+		if item.typ != itemComma {
+			return nil, parser.errorf("Expecting , or ] in the values of a %s", cycle.keyword())
+		}
+	}
+}
+
+// parseLiteralValue parses a constant value of a type
+func (parser *Parser) parseLiteralValue(vars *Variables, valueType ValueType) (val *Value, err error) {
+	val = &Value{valueType: valueType}
+	item := parser.nextItem()
+	switch valueType {
+	case ValueInteger, ValueCounter, ValueCounter64, ValueGuage, ValueTimeticks:
+		negative := false
+		if item.typ == itemMinus && valueType == ValueInteger {
+			negative = true
+			item = parser.nextItem()
+		}
+		switch item.typ {
+		case itemIntegerLiteral:
+			err = setIntLiteral(val, item.val, negative)
+			if err != nil {
+				return nil, parser.errorf("Invalid integer literal %s: %v", item.val, err)
+			}
+		case itemAlias:
+			x, ok := vars.intAliases[item.val]
+			if !ok || valueType != ValueInteger {
+				return nil, parser.errorf("Invalid integer alias '%s'", item.val)
+			}
+			val.intVal = x
+			if negative {
+				val.intVal = -x
+			}
+		default:
+			return nil, parser.errorf("Expecting an integer value")
+		}
+	case ValueString:
+		if item.typ != itemStringLiteral {
+			return nil, parser.errorf("Expecting a string literal")
+		}
+		val.stringVal = item.val
+	case ValueOid:
+		if item.typ != itemOidLiteral {
+			return nil, parser.errorf("Expecting an OID literal")
+		}
+		val.oidVal, err = canonicalOid(item.val)
+		if err != nil {
+			return nil, parser.errorf("Invalid OID %s: %v", item.val, err)
+		}
+	case ValueIpv4address:
+		if item.typ != itemOidLiteral {
+			return nil, parser.errorf("Expecting an IP address")
+		}
+		err = parser.validateAddrStr(item.val)
+		if err != nil {
+			return nil, err
+		}
+		val.addrVal = item.val
+	case ValueInetAddress:
+		if item.typ != itemOidLiteral && item.typ != itemStringLiteral {
+			return nil, parser.errorf("Expecting an IPv4 or IPv6 address")
+		}
+		val.inetVal, err = parseInetAddress(item.val)
+		if err != nil {
+			return nil, parser.errorf("%v", err)
+		}
+	default:
+		return nil, parser.errorf("Only integer, counter, counter64, guage, timeticks, string, oid, ipaddress and inetaddress values can be listed")
+	}
+	return val, nil
+}
+
+// rateIntervals are the time units of a rate
+var rateIntervals = map[string]time.Duration{
+	"s":    time.Second,
+	"secs": time.Second,
+	"m":    time.Minute,
+	"min":  time.Minute,
+	"h":    time.Hour,
+	"hour": time.Hour,
+}
+
+// parseRate parses the rate a counter increases by while it is served
+// e.g. in-octets: 2.1.2.2.1.10.1 counter rate 1000/s jitter 10%
+// The amount can be an integer variable so the rate can be changed by a SET or the program,
+// which is checked by Init as the variable may be declared later.
+// Grammar
+//	<rate> ::= rate <rate-amount> / <rate-units> [jitter <int-literal> %]
+//	<rate-amount> ::= <int-literal> | <identifier>
+//	<rate-units> ::= s | secs | m | min | h | hour
+func (parser *Parser) parseRate(typ *Type) (rate *Rate, err error) {
+	parser.nextItem() // rate
+	if typ.valueType != ValueCounter && typ.valueType != ValueCounter64 {
+		return nil, parser.errorf("Only a counter can have a rate")
+	}
+	if typ.oid == "" {
+		return nil, parser.errorf("A rate needs an OID as it is applied when the counter is read")
+	}
+
+	rate = new(Rate)
+	amountItem := parser.nextItem()
+	switch amountItem.typ {
+	case itemIntegerLiteral:
+		rate.amount, err = strconv.Atoi(amountItem.val)
+		if err != nil || rate.amount < 0 {
+			return nil, parser.errorf("Invalid rate: %s", amountItem.val)
+		}
+	case itemIdentifier:
+		rate.amountId = amountItem.val
+	default:
+		return nil, parser.errorf("Expecting an integer or variable for the rate but got %s", amountItem.val)
+	}
+	err = parser.match(itemDivide, "rate")
+	if err != nil {
+		return nil, err
+	}
+	unitsItem := parser.nextItem()
+	interval, ok := rateIntervals[unitsItem.val]
+	if !ok {
+		return nil, parser.errorf("Expecting rate units s, m or h but got %s", unitsItem.val)
+	}
+	rate.interval = interval
+
+	if parser.peekKeyword().typ == itemJitter {
+		parser.nextItem()
+		jitterItem, err := parser.matchItem(itemIntegerLiteral, "jitter")
+		if err != nil {
+			return nil, err
+		}
+		rate.jitter, err = strconv.Atoi(jitterItem.val)
+		if err != nil || rate.jitter < 0 || rate.jitter > 100 {
+			return nil, parser.errorf("Invalid jitter: %s, expecting a percentage from 0 to 100", jitterItem.val)
+		}
+		err = parser.match(itemPercent, "jitter")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if parser.peekKeyword().typ == itemClock {
+		parser.nextItem()
+		clockItem, err := parser.matchItem(itemIdentifier, "clock")
+		if err != nil {
+			return nil, err
+		}
+		rate.clock = clockItem.val
+	}
+	return rate, nil
+}
+
+// parseWave parses the waveform a variable's value follows over time
+// e.g. temperature: 4.1.99.5.0 integer wave sine base 25 amplitude 5 period 60 secs
+// Grammar
+//	<wave> ::= wave (sine | sawtooth | square) base [-]<int-literal> amplitude <int-literal>
+//	           period <int-literal> <time-units> [clock <identifier>]
+func (parser *Parser) parseWave(typ *Type) (wave *Wave, err error) {
+	parser.nextItem() // wave
+	if typ.valueType != ValueInteger && typ.valueType != ValueGuage {
+		return nil, parser.errorf("Only an integer or guage can follow a wave")
+	}
+	if typ.oid == "" || typ.snmpMode != SnmpModeRead {
+		return nil, parser.errorf("A wave needs an OID and no rw or rwb mode as it is worked out when it is read")
+	}
+	shapeItem, err := parser.matchItem(itemIdentifier, "wave")
+	if err != nil {
+		return nil, err
+	}
+	wave = &Wave{shape: shapeItem.val}
+	switch wave.shape {
+	case WaveSine, WaveSawtooth, WaveSquare:
+	default:
+		return nil, parser.errorf("Invalid wave %s, expecting sine, sawtooth or square", wave.shape)
+	}
+
+	parameter := func(name string) (n int, err error) {
+		nameItem, err := parser.matchItem(itemIdentifier, "wave")
+		if err != nil {
+			return 0, err
+		}
+		if nameItem.val != name {
+			return 0, parser.errorf("Expecting %s in the wave but got %s", name, nameItem.val)
+		}
+		negative := false
+		if parser.peek().typ == itemMinus && name == "base" {
+			parser.nextItem()
+			negative = true
+		}
+		item, err := parser.matchItem(itemIntegerLiteral, "wave "+name)
+		if err != nil {
+			return 0, err
+		}
+		val := &Value{valueType: ValueInteger}
+		err = setIntLiteral(val, item.val, negative)
+		if err != nil {
+			return 0, parser.errorf("Invalid wave %s: %s", name, item.val)
+		}
+		return val.intVal, nil
+	}
+	wave.base, err = parameter("base")
+	if err != nil {
+		return nil, err
+	}
+	wave.amplitude, err = parameter("amplitude")
+	if err != nil {
+		return nil, err
+	}
+	periodAmount, err := parameter("period")
+	if err != nil {
+		return nil, err
+	}
+	units, err := parser.parseTimeUnits("wave period")
+	if err != nil {
+		return nil, err
+	}
+	wave.period = units.Duration(periodAmount)
+	if wave.period <= 0 {
+		return nil, parser.errorf("Invalid wave period of %s", wave.period)
+	}
+	if typ.valueType == ValueGuage && wave.base-wave.amplitude < 0 {
+		return nil, parser.errorf("A guage wave can not go below 0, base %d amplitude %d", wave.base, wave.amplitude)
+	}
+	if typ.valueRange != nil && (!typ.valueRange.contains(wave.base-wave.amplitude) || !typ.valueRange.contains(wave.base+wave.amplitude)) {
+		return nil, parser.errorf("The wave goes outside the range %s", typ.valueRange)
+	}
+
+	if parser.peekKeyword().typ == itemClock {
+		parser.nextItem()
+		clockItem, err := parser.matchItem(itemIdentifier, "clock")
+		if err != nil {
+			return nil, err
+		}
+		wave.clock = clockItem.val
+	}
+	return wave, nil
+}
+
+// parseMetadata parses the optional units, display hint and access of a variable
+// e.g. in-octets: 2.1.2.2.1.10.1 counter units "octets" hint "d" access read-only
+// The units and display hint are not served but are for tooling and the dumps of the program.
+func (parser *Parser) parseMetadata(typ *Type) (err error) {
+	for {
+		switch parser.peekKeyword().typ {
+		case itemAccess:
+			parser.nextItem()
+			err = parser.parseAccess(typ)
+			if err != nil {
+				return err
+			}
+		case itemUnits:
+			parser.nextItem()
+			unitsItem, err := parser.matchItem(itemStringLiteral, "units")
+			if err != nil {
+				return err
+			}
+			typ.units = unitsItem.val
+		case itemHint:
+			parser.nextItem()
+			hintItem, err := parser.matchItem(itemStringLiteral, "display hint")
+			if err != nil {
+				return err
+			}
+			typ.displayHint = hintItem.val
+		case itemAbsent:
+			parser.nextItem()
+			if typ.oid == "" {
+				return parser.errorf("Absent needs an OID")
+			}
+			typ.absent = true
+		case itemLatency:
+			parser.nextItem()
+			if typ.oid == "" {
+				return parser.errorf("Latency needs an OID")
+			}
+			typ.latency, err = parser.parseLatency()
+			if err != nil {
+				return err
+			}
+		case itemWritable:
+			parser.nextItem()
+			err = parser.parseWritableUntil(typ)
+			if err != nil {
+				return err
+			}
+		case itemTrackChange:
+			parser.nextItem()
+			if typ.oid == "" || typ.valueType == ValueTable {
+				return parser.errorf("Track-change needs an OID and can not be a table")
+			}
+			changeOid, err := parser.parseOid("track-change")
+			if err != nil {
+				return err
+			}
+			typ.lastChange = &Type{valueType: ValueTimeticks, oid: changeOid, snmpMode: SnmpModeRead, lineNum: typ.lineNum}
+		default:
+			return nil
+		}
+	}
+}
+
+// parseLatency parses how long reads of a variable or table take to answer, like an expensive object of a device
+// e.g. cpu-load: 4.1.99.2.0 integer latency 500 msecs
+// Grammar
+//	<latency> ::= latency <int-literal> <time-units>
+func (parser *Parser) parseLatency() (latency time.Duration, err error) {
+	amountItem, err := parser.matchItem(itemIntegerLiteral, "latency")
+	if err != nil {
+		return 0, err
+	}
+	amount, err := strconv.Atoi(amountItem.val)
+	if err != nil {
+		return 0, parser.errorf("Invalid latency: %s", amountItem.val)
+	}
+	units, err := parser.parseTimeUnits("latency")
+	if err != nil {
+		return 0, err
+	}
+	return units.Duration(amount), nil
+}
+
+// parseWritableUntil parses how long after the start SETs of a variable are allowed, like a provisioning
+// window of a device after which its configuration is read-only. The variable is writable as if it were rw.
+// e.g. admin-password: 4.1.99.6.0 string writable until 30 secs
+// Grammar
+//	<writable> ::= writable until <int-literal> <time-units>
+func (parser *Parser) parseWritableUntil(typ *Type) (err error) {
+	if typ.oid == "" {
+		return parser.errorf("Writable needs an OID")
+	}
+	if typ.valueType == ValueCounter || typ.valueType == ValueCounter64 {
+		return parser.errorf("Counter type can not be writable as cannot be set")
+	}
+	err = parser.match(itemUntil, "writable")
+	if err != nil {
+		return err
+	}
+	amountItem, err := parser.matchItem(itemIntegerLiteral, "writable until")
+	if err != nil {
+		return err
+	}
+	amount, err := strconv.Atoi(amountItem.val)
+	if err != nil || amount <= 0 {
+		return parser.errorf("Invalid writable time: %s", amountItem.val)
+	}
+	units, err := parser.parseTimeUnits("writable until")
+	if err != nil {
+		return err
+	}
+	typ.writableFor = units.Duration(amount)
+	if typ.snmpMode == SnmpModeRead {
+		typ.snmpMode = SnmpModeReadWrite
+		typ.externalValue = make(chan *Value)
+	}
+	return nil
+}
+
+// accessNames are the MAX-ACCESS values of a variable
+var accessNames = map[string]Access{
+	"read-only":   AccessReadOnly,
+	"read-write":  AccessReadWrite,
+	"read-create": AccessReadCreate,
+}
+
+// parseAccess parses the MAX-ACCESS of a variable which overrides its rw or rwb mode for SETs
+// read-write and read-create make a variable writable as if it were rw.
+func (parser *Parser) parseAccess(typ *Type) (err error) {
+	item := parser.nextItem()
+	access, ok := accessNames[item.val]
+	if !ok {
+		return parser.errorf("Expecting access read-only, read-write or read-create but got %s", item.val)
+	}
+	if typ.oid == "" {
+		return parser.errorf("Access needs an OID")
+	}
+	if access != AccessReadOnly {
+		if typ.valueType == ValueCounter || typ.valueType == ValueCounter64 {
+			return parser.errorf("Counter type can not be %s as cannot be set", item.val)
+		}
+		if typ.snmpMode == SnmpModeRead {
+			typ.snmpMode = SnmpModeReadWrite
+			typ.externalValue = make(chan *Value)
+		}
+	}
+	typ.access = access
+	return nil
+}
+
+// parseUintLiteral parses a decimal or 0x hex integer literal up to 2^64-1
+// A leading 0 is still decimal, and there are no other prefixes or _ separators.
+func parseUintLiteral(str string) (uint64, error) {
+	if strings.HasPrefix(str, "0x") || strings.HasPrefix(str, "0X") {
+		return strconv.ParseUint(str[2:], 16, 64)
+	}
+	return strconv.ParseUint(str, 10, 64)
+}
+
+// parseIntLiteral parses a decimal or 0x hex integer literal of an expression
+// Literals up to 2^64-1 are allowed for counter64 values. Integers are 64 bits and wrap,
+// so 2^64-1 is held as -1 and adding 1 to it gives 0, which is the modular arithmetic of a Counter64.
+func parseIntLiteral(str string) (int64, error) {
+	u, err := parseUintLiteral(str)
+	return int64(u), err
+}
+
+// setIntLiteral sets a numeric value from a literal, negated after a minus sign, checking it is in the range
+// of the type
+func setIntLiteral(val *Value, str string, negative bool) error {
+	u, err := parseUintLiteral(str)
+	if err != nil {
+		return err
+	}
+	if val.valueType == ValueCounter64 {
+		if negative && u != 0 {
+			return fmt.Errorf("-%s is out of the range of Counter64", str)
+		}
+		val.counter64Val = u
+		return nil
+	}
+	if u > math.MaxUint32 {
+		return fmt.Errorf("%s is out of the range of %s", str, Type{valueType: val.valueType})
+	}
+	n := int64(u)
+	if negative {
+		n = -n
+	}
+	err = checkIntRange(val.valueType, n)
+	if err != nil {
+		return err
+	}
+	val.intVal = int(n)
+	return nil
+}
+
+// checkIntRange checks a value is in the range of its SMI type (RFC 2578): that of Integer32 for an integer
+// and unsigned 32 bits for a counter, guage or timeticks
+func checkIntRange(valueType ValueType, n int64) error {
+	switch valueType {
+	case ValueInteger:
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return fmt.Errorf("%d is out of the range of %s", n, Type{valueType: valueType})
+		}
+	case ValueCounter, ValueGuage, ValueTimeticks:
+		if n < 0 || n > math.MaxUint32 {
+			return fmt.Errorf("%d is out of the range of %s", n, Type{valueType: valueType})
+		}
+	}
+	return nil
+}
+
+// canonicalOid returns the OID with a leading dot and no leading zeros in its components
+// so that equal OIDs have equal strings, e.g. 1.3.06.1 => .1.3.6.1
+func canonicalOid(oidStr string) (string, error) {
+	components := strings.Split(strings.TrimPrefix(oidStr, "."), ".")
+	for i, comp := range components {
+		x, err := strconv.ParseUint(comp, 10, 32)
+		if err != nil {
+			return "", err
+		}
+		components[i] = strconv.FormatUint(x, 10)
+	}
+	return "." + strings.Join(components, "."), nil
+}
+
 func (parser *Parser) lookupType(id string) ValueType {
 	typ, ok := parser.variables.types[id]
 	if ok {
@@ -854,14 +2283,14 @@ func (parser *Parser) parseStatementList() ([]*Statement, error) {
 }
 
 func (parser *Parser) errorf(format string, a ...interface{}) error {
-	preamble := fmt.Sprintf("%s: Error at line %d: ", parser.lex.name, parser.token.line)
-	return fmt.Errorf(preamble+format, a...)
+	return &ParseError{Name: parser.lex.name, Line: parser.token.line, Message: fmt.Sprintf(format, a...)}
 }
 
 func (parser *Parser) parseStatement() (stmt *Statement, err error) {
 	stmt = new(Statement)
 
-	item := parser.peek()
+	item := parser.peekStatementKeyword()
+	stmt.lineNum = item.line
 	switch item.typ {
 	case itemIdentifier:
 		stmt.stmtType = StmtAssignment
@@ -909,6 +2338,27 @@ func (parser *Parser) parseStatement() (stmt *Statement, err error) {
 		if err != nil {
 			return nil, err
 		}
+	case itemTrap:
+		parser.nextItem()
+		stmt.stmtType = StmtTrap
+		stmt.trapStmt, err = parser.parseTrapStatement()
+		if err != nil {
+			return nil, err
+		}
+	case itemReboot:
+		parser.nextItem()
+		stmt.stmtType = StmtReboot
+		stmt.rebootStmt, err = parser.parseRebootStatement()
+		if err != nil {
+			return nil, err
+		}
+	case itemAppear, itemDisappear:
+		parser.nextItem()
+		stmt.stmtType = StmtAppear
+		stmt.appearStmt, err = parser.parseAppearStatement(item.typ == itemAppear)
+		if err != nil {
+			return nil, err
+		}
 
 	default:
 		return nil, parser.errorf("Missing leading statement token. Got %v", item)
@@ -946,18 +2396,123 @@ func (parser *Parser) parseReadStatement() (readStmt *ReadStatement, err error)
 	if typ.oid == "" {
 		return nil, parser.errorf("Unable to read on non OID variable")
 	}
-	if typ.snmpMode != SnmpModeReadWrite {
-		return nil, parser.errorf("Unable to read on non rw OID variable")
+	if typ.snmpMode != SnmpModeReadWrite {
+		return nil, parser.errorf("Unable to read on non rw OID variable")
+	}
+
+	readStmt.identifier = id
+
+	err = parser.match(itemNewLine, "read")
+	if err != nil {
+		return nil, err
+	}
+
+	return readStmt, nil
+}
+
+// Grammar
+//	<reboot> ::= reboot [trap] \n
+//
+func (parser *Parser) parseRebootStatement() (rebootStmt *RebootStatement, err error) {
+	rebootStmt = new(RebootStatement)
+
+	if parser.peekKeyword().typ == itemTrap {
+		parser.nextItem()
+		rebootStmt.coldStartTrap = true
+	}
+
+	err = parser.match(itemNewLine, "reboot")
+	if err != nil {
+		return nil, err
+	}
+	return rebootStmt, nil
+}
+
+// parseAppearStatement parses the variable, or range of them, whose OIDs an appear statement serves
+// or a disappear statement stops serving, like hardware which is plugged in or removed
+// Grammar
+//	<appear> ::= appear <identifier> \n | disappear <identifier> \n
+func (parser *Parser) parseAppearStatement(appear bool) (appearStmt *AppearStatement, err error) {
+	appearStmt = &AppearStatement{appear: appear}
+	idItem, err := parser.matchItem(itemIdentifier, appearStmt.keyword())
+	if err != nil {
+		return nil, err
+	}
+	if typ, ok := parser.variables.types[idItem.val]; ok {
+		appearStmt.ids = []string{idItem.val}
+		if typ.oid == "" {
+			return nil, parser.errorf("Can not %s %s as it has no OID", appearStmt.keyword(), idItem.val)
+		}
+	} else {
+		// the instances of a range
+		prefix := idItem.val + "."
+		for id := range parser.variables.types {
+			if strings.HasPrefix(id, prefix) {
+				appearStmt.ids = append(appearStmt.ids, id)
+			}
+		}
+		if len(appearStmt.ids) == 0 {
+			return nil, parser.errorf("Can not %s undeclared variable: %s", appearStmt.keyword(), idItem.val)
+		}
+		sort.Strings(appearStmt.ids)
+	}
+
+	err = parser.match(itemNewLine, appearStmt.keyword())
+	if err != nil {
+		return nil, err
+	}
+	return appearStmt, nil
+}
+
+// Grammar
+//	<trap> ::= trap <int-expression> [specific <int-expression>] [with <identifier> {, <identifier>}] \n
+//
+func (parser *Parser) parseTrapStatement() (trapStmt *TrapStatement, err error) {
+	trapStmt = new(TrapStatement)
+
+	trapStmt.genericExprn, err = parser.parseIntExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	// optional specific trap number
+	if parser.peekKeyword().typ == itemSpecific {
+		parser.nextItem()
+		trapStmt.specificExprn, err = parser.parseIntExpression()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	readStmt.identifier = id
+	// optional OID variables to send as the trap's variable bindings
+	if parser.peekKeyword().typ == itemWith {
+		parser.nextItem()
+		for {
+			idItem, err := parser.matchItem(itemIdentifier, "trap variables")
+			if err != nil {
+				return nil, err
+			}
+			typ, ok := parser.variables.types[idItem.val]
+			if !ok {
+				return nil, parser.errorf("Trap with undefined variable: %s", idItem.val)
+			}
+			if typ.oid == "" {
+				return nil, parser.errorf("Trap with non OID variable: %s", idItem.val)
+			}
+			trapStmt.identifiers = append(trapStmt.identifiers, idItem.val)
 
-	err = parser.match(itemNewLine, "read")
+			if parser.peek().typ != itemComma {
+				break
+			}
+			parser.nextItem()
+		}
+	}
+
+	err = parser.match(itemNewLine, "trap statement")
 	if err != nil {
 		return nil, err
 	}
-
-	return readStmt, nil
+	return trapStmt, nil
 }
 
 func (parser *Parser) parseSleepStatement() (sleepStmt *SleepStatement, err error) {
@@ -968,14 +2523,9 @@ func (parser *Parser) parseSleepStatement() (sleepStmt *SleepStatement, err erro
 		return nil, err
 	}
 
-	item := parser.nextItem()
-	switch item.typ {
-	case itemSecs:
-		sleepStmt.units = TimeSecs
-	case itemMillis:
-		sleepStmt.units = TimeMillis
-	default:
-		return nil, parser.errorf("Expecting time units in sleep statement but got \"%v\"", item.typ)
+	sleepStmt.units, err = parser.parseTimeUnits("sleep statement")
+	if err != nil {
+		return nil, err
 	}
 
 	err = parser.match(itemNewLine, "sleep statement")
@@ -985,17 +2535,29 @@ func (parser *Parser) parseSleepStatement() (sleepStmt *SleepStatement, err erro
 	return sleepStmt, nil
 }
 
+func (parser *Parser) parseTimeUnits(context string) (units TimeUnit, err error) {
+	item := parser.nextItem()
+	switch item.typ {
+	case itemSecs:
+		return TimeSecs, nil
+	case itemMillis:
+		return TimeMillis, nil
+	}
+	return units, parser.errorf("Expecting time units in %s but got \"%v\"", context, item.typ)
+}
+
 // Note: other parsers use panic/recover instead of returning an error
 
 // Grammar
 //	<loop> ::= loop \n {<statement>} endloop \n |
 //             loop times <int-expression> \n {<statement>} endloop \n |
+//             loop every <int-expression> <time-units> \n {<statement>} endloop \n |
 //             loop <bool-expression> \n {<statement>} endloop \n
 //
 func (parser *Parser) parseLoopStatement() (loopStmt *LoopStatement, err error) {
 	loopStmt = new(LoopStatement)
 
-	switch parser.peek().typ {
+	switch parser.peekStatementKeyword().typ {
 	case itemNewLine:
 		// forever loop
 		// just statements and no conditional part of loop construct
@@ -1007,6 +2569,17 @@ func (parser *Parser) parseLoopStatement() (loopStmt *LoopStatement, err error)
 		if err != nil {
 			return nil, err
 		}
+	case itemEvery:
+		parser.nextItem() // move over the "every" keyword
+		loopStmt.loopType = LoopEvery
+		loopStmt.intExpression, err = parser.parseIntExpression()
+		if err != nil {
+			return nil, err
+		}
+		loopStmt.units, err = parser.parseTimeUnits("loop every")
+		if err != nil {
+			return nil, err
+		}
 
 	default:
 		// while loop
@@ -1134,36 +2707,8 @@ func (parser *Parser) parseAssignment() (assign *AssignmentStatement, err error)
 		return nil, err
 	}
 
-	switch idType {
-	case ValueBytes:
-		if len(assign.fieldId) > 0 {
-			// id.field = intvalue
-			intExprn, err := parser.parseIntExpression()
-			if err != nil {
-				return nil, err
-			}
-			assign.exprn = new(Expression)
-			assign.exprn.exprnType = ExprnInteger
-			assign.exprn.intExpression = intExprn
-		} else {
-			// id = id | { intexprn, intexprn, ... }
-			bytesExprn, err := parser.parseBytesExpression()
-			if err != nil {
-				return nil, err
-			}
-			assign.exprn = new(Expression)
-			assign.exprn.exprnType = ExprnBytes
-			assign.exprn.bytesExpression = bytesExprn
-		}
-	case ValueBoolean:
-		boolExprn, err := parser.parseBoolExpression()
-		if err != nil {
-			return nil, err
-		}
-		assign.exprn = new(Expression)
-		assign.exprn.exprnType = ExprnBoolean
-		assign.exprn.boolExpression = boolExprn
-	case ValueInteger, ValueCounter, ValueTimeticks, ValueGuage:
+	if idType == ValueBytes && len(assign.fieldId) > 0 {
+		// id.field = intvalue
 		intExprn, err := parser.parseIntExpression()
 		if err != nil {
 			return nil, err
@@ -1171,40 +2716,11 @@ func (parser *Parser) parseAssignment() (assign *AssignmentStatement, err error)
 		assign.exprn = new(Expression)
 		assign.exprn.exprnType = ExprnInteger
 		assign.exprn.intExpression = intExprn
-	case ValueString:
-		strExprn, err := parser.parseStrExpression()
-		if err != nil {
-			return nil, err
-		}
-		assign.exprn = new(Expression)
-		assign.exprn.exprnType = ExprnString
-		assign.exprn.stringExpression = strExprn
-	case ValueBitset:
-		bitsetExprn, err := parser.parseBitsetExpression()
-		if err != nil {
-			return nil, err
-		}
-		assign.exprn = new(Expression)
-		assign.exprn.exprnType = ExprnBitset
-		assign.exprn.bitsetExpression = bitsetExprn
-	case ValueOid:
-		oidExprn, err := parser.parseOidExpression()
-		if err != nil {
-			return nil, err
-		}
-		assign.exprn = new(Expression)
-		assign.exprn.exprnType = ExprnOid
-		assign.exprn.oidExpression = oidExprn
-	case ValueIpv4address:
-		addrExprn, err := parser.parseAddrExpression()
+	} else {
+		assign.exprn, err = parser.parseExpression(idType)
 		if err != nil {
 			return nil, err
 		}
-		assign.exprn = new(Expression)
-		assign.exprn.exprnType = ExprnAddr
-		assign.exprn.addrExpression = addrExprn
-	default:
-		return nil, parser.errorf("Assignment to undeclared variable: %s", idItem.val)
 	}
 
 	err = parser.match(itemNewLine, "assignment")
@@ -1215,6 +2731,44 @@ func (parser *Parser) parseAssignment() (assign *AssignmentStatement, err error)
 	return assign, nil
 }
 
+// parseExpression parses an expression for a variable of the value type
+func (parser *Parser) parseExpression(valueType ValueType) (exprn *Expression, err error) {
+	exprn = new(Expression)
+	switch valueType {
+	case ValueBytes:
+		// id = id | { intexprn, intexprn, ... }
+		exprn.exprnType = ExprnBytes
+		exprn.bytesExpression, err = parser.parseBytesExpression()
+	case ValueBoolean:
+		exprn.exprnType = ExprnBoolean
+		exprn.boolExpression, err = parser.parseBoolExpression()
+	case ValueInteger, ValueCounter, ValueCounter64, ValueTimeticks, ValueGuage:
+		exprn.exprnType = ExprnInteger
+		exprn.intExpression, err = parser.parseIntExpression()
+	case ValueString:
+		exprn.exprnType = ExprnString
+		exprn.stringExpression, err = parser.parseStrExpression()
+	case ValueBitset:
+		exprn.exprnType = ExprnBitset
+		exprn.bitsetExpression, err = parser.parseBitsetExpression()
+	case ValueOid:
+		exprn.exprnType = ExprnOid
+		exprn.oidExpression, err = parser.parseOidExpression()
+	case ValueIpv4address:
+		exprn.exprnType = ExprnAddr
+		exprn.addrExpression, err = parser.parseAddrExpression()
+	case ValueInetAddress:
+		exprn.exprnType = ExprnInet
+		exprn.inetExpression, err = parser.parseInetExpression()
+	default:
+		return nil, parser.errorf("Expecting a variable with a value for the expression")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return exprn, nil
+}
+
 func (parser *Parser) parseBytesExpression() (bytesExprn *BytesExpression, err error) {
 	idItem := parser.nextItem()
 	if idItem.typ != itemIdentifier {
@@ -1420,6 +2974,26 @@ loop:
 //	<string-expression> ::= <str-term> {<binary-str-operator> <str-term>}
 //	<string-term> ::= <string-literal> | <identifier> | str(<expression>)
 //	                     | <lparen><string-expression><rparen>
+// markEnvRefs marks the quoted literals of the string expression of an initial value, including those in brackets
+// and the string arguments of a format, as using ${VAR}
+// A hex literal and the value of another variable are used as they are.
+func markEnvRefs(strExprn *StringExpression) {
+	for _, term := range strExprn.addTerms {
+		switch term.strTermType {
+		case StringTermValue:
+			term.envRefs = true
+		case StringTermBracket:
+			markEnvRefs(term.bracketedExprn)
+		case StringTermFormat:
+			for _, arg := range term.formatArgs {
+				if arg.exprnType == ExprnString {
+					markEnvRefs(arg.stringExpression)
+				}
+			}
+		}
+	}
+}
+
 func (parser *Parser) parseStrExpression() (strExprn *StringExpression, err error) {
 	strExprn = new(StringExpression)
 
@@ -1567,6 +3141,9 @@ func (parser *Parser) parseStrTerm() (strTerm *StringTerm, err error) {
 	strTerm = new(StringTerm)
 
 	item := parser.nextItem()
+	if item.val == "format" && parser.peek().typ == itemLeftParen {
+		item = asKeyword(item)
+	}
 	switch item.typ {
 	case itemIdentifier:
 		if parser.lookupType(item.val) != ValueString {
@@ -1577,6 +3154,17 @@ func (parser *Parser) parseStrTerm() (strTerm *StringTerm, err error) {
 	case itemStringLiteral:
 		strTerm.strTermType = StringTermValue
 		strTerm.strVal = item.val
+	case itemIntegerLiteral:
+		// a hex literal gives the bytes of the string in the order written, e.g. 0x000A0B0C0D0E for a MAC address
+		if !strings.HasPrefix(item.val, "0x") && !strings.HasPrefix(item.val, "0X") {
+			return nil, parser.errorf("Invalid string term, only hex literals (0x...) can be strings")
+		}
+		bytes, err := hex.DecodeString(item.val[2:])
+		if err != nil || len(bytes) == 0 {
+			return nil, parser.errorf("Invalid hex string literal %s, expecting an even number of hex digits", item.val)
+		}
+		strTerm.strTermType = StringTermHexValue
+		strTerm.strVal = string(bytes)
 	case itemLeftParen:
 		strTerm.strTermType = StringTermBracket
 		strTerm.bracketedExprn, err = parser.parseStrExpression()
@@ -1671,12 +3259,112 @@ func (parser *Parser) parseStrTerm() (strTerm *StringTerm, err error) {
 		if err != nil {
 			return nil, err
 		}
+	case itemFormat:
+		strTerm.strTermType = StringTermFormat
+		err = parser.parseFormat(strTerm)
+		if err != nil {
+			return nil, err
+		}
 	default:
 		return nil, parser.errorf("Invalid string term")
 	}
 	return strTerm, nil
 }
 
+// parseFormat parses format(<string-literal> {, <expression>}) after the keyword
+// The format is a literal so the number of arguments and those the verbs need to be integers are checked here.
+func (parser *Parser) parseFormat(strTerm *StringTerm) (err error) {
+	err = parser.match(itemLeftParen, "format")
+	if err != nil {
+		return err
+	}
+	formatItem, err := parser.matchItem(itemStringLiteral, "format string")
+	if err != nil {
+		return err
+	}
+	strTerm.format = formatItem.val
+	strTerm.formatVerbs, err = formatVerbs(formatItem.val)
+	if err != nil {
+		return parser.errorf("Invalid format %q: %v", formatItem.val, err)
+	}
+	for parser.peek().typ == itemComma {
+		parser.nextItem()
+		arg, err := parser.parseFormatArg()
+		if err != nil {
+			return err
+		}
+		strTerm.formatArgs = append(strTerm.formatArgs, arg)
+	}
+	err = parser.match(itemRightParen, "format")
+	if err != nil {
+		return err
+	}
+
+	if len(strTerm.formatArgs) != len(strTerm.formatVerbs) {
+		return parser.errorf("Format %q needs %d arguments but has %d",
+			strTerm.format, len(strTerm.formatVerbs), len(strTerm.formatArgs))
+	}
+	for i, verb := range strTerm.formatVerbs {
+		if isIntegerVerb(verb) && strTerm.formatArgs[i].exprnType != ExprnInteger {
+			return parser.errorf("Argument %d of format %q is not an integer for %%%c", i+1, strTerm.format, verb)
+		}
+	}
+	return nil
+}
+
+// parseFormatArg parses an argument of format, whose type is that of the variable or literal it starts with
+func (parser *Parser) parseFormatArg() (*Expression, error) {
+	item := parser.peek()
+	var valueType ValueType
+	switch item.typ {
+	case itemIdentifier:
+		valueType = parser.lookupType(item.val)
+		if valueType == ValueNone {
+			return nil, parser.errorf("Unknown variable %s in format", item.val)
+		}
+	case itemStringLiteral:
+		valueType = ValueString
+	case itemIntegerLiteral, itemMinus:
+		valueType = ValueInteger
+	default:
+		return nil, parser.errorf("Expecting a variable or literal as an argument of format")
+	}
+	return parser.parseExpression(valueType)
+}
+
+// formatVerbs returns the verb of each argument of a printf-style format, which can be s, q, v, d, x, X or o
+// with flags, width and precision, e.g. %-8s or %04d. %% is a percent sign.
+func formatVerbs(format string) (verbs []rune, err error) {
+	runes := []rune(format)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '%' {
+			continue
+		}
+		i++
+		for i < len(runes) && strings.ContainsRune("+-# 0123456789.", runes[i]) {
+			i++
+		}
+		if i == len(runes) {
+			return nil, errors.New("missing verb at the end")
+		}
+		switch verb := runes[i]; {
+		case verb == '%':
+			if runes[i-1] != '%' {
+				return nil, errors.New("%% with flags")
+			}
+		case strings.ContainsRune("sqvdxXo", verb):
+			verbs = append(verbs, verb)
+		default:
+			return nil, fmt.Errorf("unsupported verb %%%c", verb)
+		}
+	}
+	return verbs, nil
+}
+
+func isIntegerVerb(verb rune) bool {
+	return strings.ContainsRune("dxXo", verb)
+}
+
 func (parser *Parser) validateAddrStr(addrStr string) (err error) {
 	components := strings.Split(addrStr, ".")
 	if len(components) != 4 {
@@ -1715,6 +3403,32 @@ func (parser *Parser) parseAddrExpression() (addrExprn *AddrExpression, err erro
 	return addrExprn, nil
 }
 
+// parseInetExpression parses an inetaddress variable or an address, which is an IPv4 address or
+// a string literal of an IPv4 or IPv6 address as IPv6 addresses have colons
+// e.g. "2001:db8::1"
+func (parser *Parser) parseInetExpression() (addrExprn *AddrExpression, err error) {
+	addrExprn = new(AddrExpression)
+
+	item := parser.nextItem()
+	switch item.typ {
+	case itemIdentifier:
+		if parser.lookupType(item.val) != ValueInetAddress {
+			return nil, parser.errorf("Not inetaddress variable in address expression")
+		}
+		addrExprn.addrExprnType = AddrExprnId
+		addrExprn.identifier = item.val
+	case itemOidLiteral, itemStringLiteral:
+		addrExprn.inetVal, err = parseInetAddress(item.val)
+		if err != nil {
+			return nil, parser.errorf("%v", err)
+		}
+		addrExprn.addrExprnType = AddrExprnValue
+	default:
+		return nil, parser.errorf("Invalid inet address expression")
+	}
+	return addrExprn, nil
+}
+
 func (parser *Parser) parseOidTerm() (oidTerm *OidTerm, err error) {
 	oidTerm = new(OidTerm)
 
@@ -1857,14 +3571,15 @@ func (parser *Parser) parseIntFactor() (intFactor *IntFactor, err error) {
 	switch item.typ {
 	case itemIdentifier:
 		valType := parser.lookupType(item.val)
-		if valType != ValueInteger && valType != ValueCounter && valType != ValueTimeticks && valType != ValueGuage {
+		if valType != ValueInteger && valType != ValueCounter && valType != ValueCounter64 &&
+			valType != ValueTimeticks && valType != ValueGuage {
 			return nil, parser.errorf("Not numeric variable in integer expression")
 		}
 		intFactor.intFactorType = IntFactorId
 		intFactor.intIdentifier = item.val
 	case itemIntegerLiteral:
 		intFactor.intFactorType = IntFactorConst
-		intFactor.intConst, err = strconv.Atoi(item.val)
+		intFactor.intConst, err = parseIntLiteral(item.val)
 		if err != nil {
 			return nil, parser.errorf("Invalid integer literal")
 		}
@@ -1874,7 +3589,7 @@ func (parser *Parser) parseIntFactor() (intFactor *IntFactor, err error) {
 		if !ok {
 			return nil, parser.errorf("Invalid integer alias")
 		}
-		intFactor.intConst = x
+		intFactor.intConst = int64(x)
 	case itemMinus:
 		intFactor.intFactorType = IntFactorMinus
 		intFactor.minusIntFactor, err = parser.parseIntFactor()
@@ -1913,6 +3628,25 @@ const (
 	SnmpModeReadWriteBlocked
 )
 
+// Access is the MAX-ACCESS of a variable
+type Access int
+
+const (
+	AccessDefault  Access = iota // from the rw or rwb mode
+	AccessReadOnly               // SETs get notWritable whatever the mode
+	AccessReadWrite
+	AccessReadCreate
+)
+
+func (access Access) String() string {
+	for name, a := range accessNames {
+		if a == access {
+			return name
+		}
+	}
+	return "default"
+}
+
 type FieldInfo struct {
 	totalSize    uint
 	fieldSizes   map[string]uint // field-id -> size
@@ -1928,6 +3662,135 @@ type Type struct {
 	lineNum       int
 	id            string
 	fieldInfo     FieldInfo
+	maxLength     uint          // maximum length of served string, 0 for no limit
+	valueRange    *IntRange     // values an integer can be set to, nil for any
+	table         *Table        // for a table declaration
+	units         string        // UNITS, informational only
+	displayHint   string        // DISPLAY-HINT, informational only
+	rate          *Rate         // optional increase of a counter over time
+	cycle         *Cycle        // optional values served on successive reads
+	access        Access        // MAX-ACCESS, overrides the snmpMode for SETs
+	initValue     *Value        // initial value of a variable from a profile, nil for the zero value
+	initExprn     *Expression   // initial value computed when the interpreter is initialized
+	latency       time.Duration // delay before a read of the variable is answered
+	countOf       *CountOf      // optional table or range whose rows are served as the value
+	absent        bool          // not served until an appear statement
+	writableFor   time.Duration // SETs get notWritable after this time since the start, 0 for always writable
+	lastChange    *Type         // timeticks variable of a track-change, nil if changes are not tracked
+	backend       *Backend      // where the value is fetched from when read, nil for the program's value
+	randomStable  bool          // initial value is random for the seed and OID
+	initEnvRefs   bool          // the initial value is a quoted literal of the program, which can use ${VAR}
+	wave          *Wave         // optional waveform served as the value over time
+}
+
+// CountOf is the table or range whose number of rows is the value of a variable, such as ifNumber for ifTable
+type CountOf struct {
+	id        string
+	table     *Table // nil for a range
+	instances int    // of a range
+}
+
+// IntRange is the range of values a SET of an integer can have, like the range of a MIB's SYNTAX
+type IntRange struct {
+	min int
+	max int
+}
+
+func (valueRange IntRange) String() string {
+	return fmt.Sprintf("%d..%d", valueRange.min, valueRange.max)
+}
+
+func (valueRange IntRange) contains(n int) bool {
+	return n >= valueRange.min && n <= valueRange.max
+}
+
+// Cycle is the list of values a variable takes on successive reads, going round again unless once
+// in which case the last value stays.
+type Cycle struct {
+	values []*Value
+	once   bool
+}
+
+func (cycle Cycle) keyword() string {
+	if cycle.once {
+		return "once"
+	}
+	return "cycle"
+}
+
+func (cycle Cycle) String() string {
+	strs := make([]string, len(cycle.values))
+	for i, val := range cycle.values {
+		switch val.valueType {
+		case ValueString:
+			strs[i] = fmt.Sprintf("%q", val.stringVal)
+		case ValueOid:
+			strs[i] = val.oidVal
+		case ValueIpv4address:
+			strs[i] = val.addrVal
+		case ValueInetAddress:
+			strs[i] = fmt.Sprintf("%q", val.inetVal)
+		default:
+			strs[i] = formatValue(val)
+		}
+	}
+	return fmt.Sprintf("%s: [%s]", cycle.keyword(), strings.Join(strs, ", "))
+}
+
+// Rate is the amount a counter increases by in each interval of time, which is applied when the counter is read.
+// The increase is varied randomly by up to the jitter percentage either way.
+type Rate struct {
+	amount   int
+	amountId string // variable holding the amount if not a literal
+	interval time.Duration
+	jitter   int    // percent
+	clock    string // name of the clock the rate is applied by, empty for the wall clock
+}
+
+func (rate Rate) String() string {
+	str := fmt.Sprintf("%d/%s", rate.amount, rate.interval)
+	if rate.amountId != "" {
+		str = fmt.Sprintf("%s/%s", rate.amountId, rate.interval)
+	}
+	if rate.jitter > 0 {
+		str += fmt.Sprintf(" jitter: %d%%", rate.jitter)
+	}
+	if rate.clock != "" {
+		str += fmt.Sprintf(" clock: %s", rate.clock)
+	}
+	return str
+}
+
+// Table is a conceptual table whose rows are created and destroyed by SETs of its RowStatus column
+// The OID of a cell is <entry-oid>.<column sub-id>.<index>
+type Table struct {
+	id           string
+	oid          string         // entry OID
+	columns      []*TableColumn // in column order
+	statusColumn *TableColumn
+	lineNum      int
+	latency      time.Duration // delay before a read of a cell is answered
+}
+
+type TableColumn struct {
+	id        string
+	subId     uint
+	valueType ValueType
+}
+
+func (table Table) String() string {
+	str := fmt.Sprintf("Table oid: %s Columns: ", table.oid)
+	for _, column := range table.columns {
+		typStr := Type{valueType: column.valueType}.String()
+		if column == table.statusColumn {
+			typStr = "RowStatus"
+		}
+		str += fmt.Sprintf("%s: %d %s,", column.id, column.subId, typStr)
+	}
+	if table.latency > 0 {
+		str += fmt.Sprintf(" latency: %s", table.latency)
+	}
+	return str
 }
 
 func (typ Type) String() string {
@@ -1938,6 +3801,8 @@ func (typ Type) String() string {
 		str = "Integer"
 	case ValueCounter:
 		str = "Counter"
+	case ValueCounter64:
+		str = "Counter64"
 	case ValueGuage:
 		str = "Guage"
 	case ValueTimeticks:
@@ -1950,6 +3815,10 @@ func (typ Type) String() string {
 		str = "Bitset"
 	case ValueOid:
 		str = "Oid"
+	case ValueIpv4address:
+		str = "Ipv4address"
+	case ValueInetAddress:
+		str = "InetAddress"
 	case ValueNone:
 		str = "None"
 	}
@@ -1958,6 +3827,58 @@ func (typ Type) String() string {
 		str += fmt.Sprintf(" oid: %s", typ.oid)
 	}
 
+	if typ.maxLength > 0 {
+		str += fmt.Sprintf(" max length: %d", typ.maxLength)
+	}
+
+	if typ.valueRange != nil {
+		str += fmt.Sprintf(" range: %s", typ.valueRange)
+	}
+
+	if typ.rate != nil {
+		str += fmt.Sprintf(" rate: %s", typ.rate)
+	}
+
+	if typ.cycle != nil {
+		str += fmt.Sprintf(" %s", typ.cycle)
+	}
+
+	if typ.access != AccessDefault {
+		str += fmt.Sprintf(" access: %s", typ.access)
+	}
+
+	if len(typ.units) > 0 {
+		str += fmt.Sprintf(" units: %s", typ.units)
+	}
+
+	if len(typ.displayHint) > 0 {
+		str += fmt.Sprintf(" hint: %s", typ.displayHint)
+	}
+
+	if typ.latency > 0 {
+		str += fmt.Sprintf(" latency: %s", typ.latency)
+	}
+
+	if typ.writableFor > 0 {
+		str += fmt.Sprintf(" writable until: %s", typ.writableFor)
+	}
+
+	if typ.lastChange != nil {
+		str += fmt.Sprintf(" track-change: %s", typ.lastChange.oid)
+	}
+
+	if typ.backend != nil {
+		str += fmt.Sprintf(" backend: %s cache: %s on-error: %s", typ.backend.source, typ.backend.cache, typ.backend.onError)
+	}
+
+	if typ.randomStable {
+		str += " random-stable"
+	}
+
+	if typ.wave != nil {
+		str += fmt.Sprintf(" wave: %s base %d amplitude %d period %s", typ.wave.shape, typ.wave.base, typ.wave.amplitude, typ.wave.period)
+	}
+
 	// field sizes
 	// sort for testing predictability
 	if len(typ.fieldInfo.fieldSizes) > 0 {
@@ -1985,10 +3906,31 @@ func (loopTyp LoopType) String() string {
 		return "times"
 	case LoopWhile:
 		return "while"
+	case LoopEvery:
+		return "every"
 	}
 	return "unknown loop"
 }
 
+func (units TimeUnit) String() string {
+	switch units {
+	case TimeSecs:
+		return "secs"
+	case TimeMillis:
+		return "msecs"
+	}
+	return "unknown units"
+}
+
+// Duration converts an amount of the time units to a time.Duration
+func (units TimeUnit) Duration(amount int) time.Duration {
+	switch units {
+	case TimeMillis:
+		return time.Duration(amount) * time.Millisecond
+	}
+	return time.Duration(amount) * time.Second
+}
+
 func (intComp IntComparatorType) String() string {
 	switch intComp {
 	case IntCompEquals:
@@ -2005,8 +3947,10 @@ func (intComp IntComparatorType) String() string {
 	return "unknown operator"
 }
 
+// Statement is a statement of the run section, the field for its stmtType is set
 type Statement struct {
 	stmtType StatementType
+	lineNum  int
 
 	assignmentStmt *AssignmentStatement
 	ifStmt         *IfStatement
@@ -2014,13 +3958,17 @@ type Statement struct {
 	printStmt      *PrintStatement
 	sleepStmt      *SleepStatement
 	readStmt       *ReadStatement
+	trapStmt       *TrapStatement
+	rebootStmt     *RebootStatement
+	appearStmt     *AppearStatement
 }
 
 type LoopStatement struct {
 	loopType LoopType
 
-	intExpression  *IntExpression
+	intExpression  *IntExpression // number of times or period
 	boolExpression *BoolExpression
+	units          TimeUnit // period units
 	stmtList       []*Statement
 }
 
@@ -2050,11 +3998,34 @@ type ReadStatement struct {
 	identifier string
 }
 
+type RebootStatement struct {
+	coldStartTrap bool // send a coldStart trap after the reboot
+}
+
+type AppearStatement struct {
+	ids    []string // of the variables, all the instances of a range
+	appear bool     // false to disappear
+}
+
+func (appearStmt AppearStatement) keyword() string {
+	if appearStmt.appear {
+		return "appear"
+	}
+	return "disappear"
+}
+
+type TrapStatement struct {
+	genericExprn  *IntExpression
+	specificExprn *IntExpression // optional
+	identifiers   []string       // OID variables sent in the trap
+}
+
 type SleepStatement struct {
 	exprn *IntExpression
 	units TimeUnit
 }
 
+// Expression is the right hand side of an assignment, the field for its exprnType is set
 type Expression struct {
 	exprnType ExpressionType
 
@@ -2064,6 +4035,7 @@ type Expression struct {
 	bitsetExpression *BitsetExpression
 	oidExpression    *OidExpression
 	addrExpression   *AddrExpression
+	inetExpression   *AddrExpression
 	bytesExpression  *BytesExpression
 }
 
@@ -2141,7 +4113,7 @@ const (
 type IntFactor struct {
 	intFactorType IntFactorType
 
-	intConst       int
+	intConst       int64
 	intIdentifier  string
 	minusIntFactor *IntFactor
 	bracketedExprn *IntExpression
@@ -2173,6 +4145,7 @@ const (
 type AddrExpression struct {
 	addrExprnType AddrExprnType
 	addrVal       string
+	inetVal       InetAddress // of an inetaddress expression
 	identifier    string
 }
 
@@ -2204,12 +4177,14 @@ const (
 	StringTermStringedAddrExprn
 	StringTermStringedBitsetExprn
 	StringTermStringedBytesExprn
+	StringTermHexValue
+	StringTermFormat
 )
 
 type StringTerm struct {
 	strTermType StringTermType
 
-	strVal              string
+	strVal              string // a literal, or the bytes of a hex literal
 	identifier          string
 	bracketedExprn      *StringExpression
 	stringedIntExprn    *IntExpression
@@ -2218,6 +4193,10 @@ type StringTerm struct {
 	stringedAddrExprn   *AddrExpression
 	stringedBitsetExprn *BitsetExpression
 	stringedBytesExprn  *BytesExpression
+	format              string        // of format(...), with a verb for each of the formatArgs
+	formatVerbs         []rune        // e.g. 's' and 'd' for "Model %s v%d"
+	formatArgs          []*Expression // of format(...)
+	envRefs             bool          // a quoted literal of an initial value, which can use ${VAR}
 }
 
 type BitsetTermType int
@@ -1,6 +1,11 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
 
 func ExampleParse1() {
 	inputStr := `var
@@ -385,3 +390,238 @@ func ExampleParse2() {
 	//                       [0]: factor
 	//                       Const factor: 1
 }
+
+func ExampleParse3() {
+	inputStr := `
+	var
+		descr: 2.1.1.1.0 string(16)
+	endvar
+	run
+	    descr = "a description longer than 16"
+	endrun
+	`
+	l := lex("test", inputStr)
+	parser := NewParser(l)
+	program, err := parser.ParseProgram()
+	if err != nil {
+		fmt.Print(err)
+	} else {
+		PrintVariables(program.variables, 0)
+	}
+	// Output:
+	// Variables
+	//   Types
+	//     descr: String oid: .1.3.6.1.2.1.1.1.0 max length: 16
+}
+
+func ExampleParse4() {
+	inputStr := `
+	var
+		first: 2.1.1.5.0 string
+		second: 2.1.01.5.0 string
+	endvar
+	run
+	endrun
+	`
+	l := lex("test", inputStr)
+	parser := NewParser(l)
+	_, err := parser.ParseProgram()
+	fmt.Print(err)
+	// Output:
+	// test: Error at line 5: Reuse of OID in variable identifier: second with OID: .1.3.6.1.2.1.1.5.0
+}
+
+func ExampleParse5() {
+	inputStr := `
+	var
+		hosts: 4.1.99.1.1 table {
+			addr: 3 ipaddress,
+			name: 2 string,
+			status: 4 rowstatus
+		}
+	endvar
+	run
+	endrun
+	`
+	l := lex("test", inputStr)
+	parser := NewParser(l)
+	program, err := parser.ParseProgram()
+	if err != nil {
+		fmt.Print(err)
+	} else {
+		PrintVariables(program.variables, 0)
+	}
+	// Output:
+	// Variables
+	//   Types
+	//   Tables
+	//     hosts: Table oid: .1.3.6.1.4.1.99.1.1 Columns: name: 2 String,addr: 3 Ipv4address,status: 4 RowStatus,
+}
+
+func ExampleParse6() {
+	inputStr := `
+	var
+		in-octets: 2.1.2.2.1.10.1 counter units "octets" hint "d"
+		speed: 2.1.2.2.1.5.1 guage units "bits per second"
+	endvar
+	run
+	endrun
+	`
+	l := lex("test", inputStr)
+	parser := NewParser(l)
+	program, err := parser.ParseProgram()
+	if err != nil {
+		fmt.Print(err)
+	} else {
+		PrintVariables(program.variables, 0)
+	}
+	// Output:
+	// Variables
+	//   Types
+	//     in-octets: Counter oid: .1.3.6.1.2.1.2.2.1.10.1 units: octets hint: d
+	//     speed: Guage oid: .1.3.6.1.2.1.2.2.1.5.1 units: bits per second
+}
+
+func ExampleParse7() {
+	inputStr := `//@device: Cisco 2960
+	var
+		descr: 2.1.1.1.0 string
+	endvar
+	//@location: lab rack 4
+	run
+		descr = "switch" // not metadata
+	endrun
+	`
+	l := lex("test", inputStr)
+	parser := NewParser(l)
+	program, err := parser.ParseProgram()
+	if err != nil {
+		fmt.Print(err)
+	} else {
+		PrintMetadata(program.metadata, 0)
+	}
+	// Output:
+	// Metadata
+	//   device: Cisco 2960
+	//   location: lab rack 4
+}
+
+func ExampleParse8() {
+	inputStr := `
+	var
+		in-octets: 2.1.2.2.1.10.1 counter rate 1000/s jitter 10% units "octets"
+		in-errors: 2.1.2.2.1.14.1 counter rate 5/m
+	endvar
+	run
+	endrun
+	`
+	l := lex("test", inputStr)
+	parser := NewParser(l)
+	program, err := parser.ParseProgram()
+	if err != nil {
+		fmt.Print(err)
+	} else {
+		PrintVariables(program.variables, 0)
+	}
+	// Output:
+	// Variables
+	//   Types
+	//     in-errors: Counter oid: .1.3.6.1.2.1.2.2.1.14.1 rate: 5/1m0s
+	//     in-octets: Counter oid: .1.3.6.1.2.1.2.2.1.10.1 rate: 1000/1s jitter: 10% units: octets
+}
+
+func ExampleParse9() {
+	inputStr := `
+	var
+		status: 2.1.25.3.2.1.5.1 integer [2 = 'running', 3 = 'warning'] cycle ['running', 'warning']
+		descr: 2.1.1.1.0 string once ["booting", "ready"]
+	endvar
+	run
+	endrun
+	`
+	l := lex("test", inputStr)
+	parser := NewParser(l)
+	program, err := parser.ParseProgram()
+	if err != nil {
+		fmt.Print(err)
+	} else {
+		PrintVariables(program.variables, 0)
+	}
+	// Output:
+	// Variables
+	//   Types
+	//     descr: String oid: .1.3.6.1.2.1.1.1.0 once: ["booting", "ready"]
+	//     status: Integer oid: .1.3.6.1.2.1.25.3.2.1.5.1 cycle: [2, 3]
+	//   Aliases
+	//     running: 2
+	//     warning: 3
+}
+
+func TestParseExamples(t *testing.T) {
+	files, err := filepath.Glob("examples/*.sim")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no examples: %v", err)
+	}
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Parse(file, string(src))
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestContextKeywords(t *testing.T) {
+	// the words are keywords where one is expected and variables anywhere else,
+	// except at the start of a statement where a variable hides the statement
+	program, err := Parse("test", `var
+  bits: 4.1.99.1.0 bits
+  rate: 4.1.99.2.0 counter rate 10/s units "packets"
+  table: 4.1.99.3.0 integer cycle [1, 2]
+  reboot: integer
+  specific: integer
+  with: 4.1.99.6.0 integer
+  every: boolean
+  format: string
+  cache: 4.1.99.7.0 integer http "http://localhost:9100/cache" cache 5 secs
+  alias: 4.1.99.4.0 integer
+  alias 4.1.99.5.0 = 4.1.99.4.0
+endvar
+run
+  reboot = 6
+  specific = reboot + 1
+  trap reboot specific specific with with, alias
+  every = true
+  loop every
+    every = false
+    format = format("%d", with)
+  endloop
+endrun`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := program.variables
+	if vars.types["bits"].valueType != ValueBitset || vars.types["rate"].rate == nil || vars.types["table"].cycle == nil {
+		t.Errorf("bits %v, rate %v, table %v", vars.types["bits"], vars.types["rate"], vars.types["table"])
+	}
+	if vars.oidAliases[".1.3.6.1.4.1.99.5.0"] != ".1.3.6.1.4.1.99.4.0" {
+		t.Errorf("aliases %v", vars.oidAliases)
+	}
+	var types []StatementType
+	for _, stmt := range program.stmtList {
+		types = append(types, stmt.stmtType)
+	}
+	want := []StatementType{StmtAssignment, StmtAssignment, StmtTrap, StmtAssignment, StmtLoop}
+	if fmt.Sprint(types) != fmt.Sprint(want) {
+		t.Errorf("statements %v, want %v", types, want)
+	}
+	if loop := program.stmtList[4].loopStmt; loop.loopType != LoopWhile {
+		t.Errorf("loop every is %v", loop.loopType)
+	}
+	if len(program.stmtList[2].trapStmt.identifiers) != 2 {
+		t.Errorf("trap with %v", program.stmtList[2].trapStmt.identifiers)
+	}
+}
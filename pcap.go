@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// udpDatagram is the payload of a UDP packet read from a capture
+type udpDatagram struct {
+	src     string // ip:port
+	dst     string
+	srcPort int
+	dstPort int
+	payload []byte
+}
+
+// The link types of the captures read, from https://www.tcpdump.org/linktypes.html
+const (
+	linkTypeNull      = 0 // BSD loopback
+	linkTypeEthernet  = 1
+	linkTypeRaw       = 101
+	linkTypeLinuxSLL  = 113 // tcpdump -i any
+	linkTypeIPv4      = 228
+	linkTypeIPv6      = 229
+	linkTypeLinuxSLL2 = 276
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	ipProtocolUDP = 17
+)
+
+// maxPcapPacket is the largest packet read from a capture, larger than any snapshot length
+const maxPcapPacket = 1 << 20
+
+var errPcapng = errors.New("pcapng captures are not supported, convert with editcap -F pcap")
+
+// readPcapUDP reads the UDP datagrams of a libpcap capture, as written by tcpdump -w
+// Fragmented and truncated packets and other protocols are skipped.
+func readPcapUDP(r io.Reader) ([]udpDatagram, error) {
+	header := make([]byte, 24)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, fmt.Errorf("Reading pcap header: %v", err)
+	}
+	var order binary.ByteOrder
+	switch binary.LittleEndian.Uint32(header) {
+	case 0xa1b2c3d4, 0xa1b23c4d: // microsecond and nanosecond timestamps
+		order = binary.LittleEndian
+	case 0xd4c3b2a1, 0x4d3cb2a1:
+		order = binary.BigEndian
+	case 0x0a0d0d0a:
+		return nil, errPcapng
+	default:
+		return nil, errors.New("Not a pcap capture")
+	}
+	linkType := order.Uint32(header[20:]) & 0xffff
+
+	var datagrams []udpDatagram
+	record := make([]byte, 16)
+	for {
+		_, err = io.ReadFull(r, record)
+		if err == io.EOF {
+			return datagrams, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Reading pcap record: %v", err)
+		}
+		length := order.Uint32(record[8:])
+		if length > maxPcapPacket {
+			return nil, fmt.Errorf("Pcap packet of %d bytes is too large", length)
+		}
+		packet := make([]byte, length)
+		_, err = io.ReadFull(r, packet)
+		if err != nil {
+			return nil, fmt.Errorf("Reading pcap packet: %v", err)
+		}
+		if datagram, ok := linkUDP(linkType, packet, order); ok {
+			datagrams = append(datagrams, datagram)
+		}
+	}
+}
+
+// linkUDP returns the UDP datagram in a packet of the link type, false if it is not one
+func linkUDP(linkType uint32, packet []byte, order binary.ByteOrder) (datagram udpDatagram, ok bool) {
+	switch linkType {
+	case linkTypeNull:
+		if len(packet) < 4 {
+			return datagram, false
+		}
+		// the address family in the byte order of the capturing host, IPv6 varies by OS
+		switch order.Uint32(packet) {
+		case 2:
+			return ipv4UDP(packet[4:])
+		case 24, 28, 30:
+			return ipv6UDP(packet[4:])
+		}
+	case linkTypeEthernet:
+		if len(packet) < 14 {
+			return datagram, false
+		}
+		etherType := binary.BigEndian.Uint16(packet[12:])
+		packet = packet[14:]
+		for etherType == etherTypeVLAN && len(packet) >= 4 {
+			etherType = binary.BigEndian.Uint16(packet[2:])
+			packet = packet[4:]
+		}
+		return etherUDP(etherType, packet)
+	case linkTypeLinuxSLL:
+		if len(packet) < 16 {
+			return datagram, false
+		}
+		return etherUDP(binary.BigEndian.Uint16(packet[14:]), packet[16:])
+	case linkTypeLinuxSLL2:
+		if len(packet) < 20 {
+			return datagram, false
+		}
+		return etherUDP(binary.BigEndian.Uint16(packet), packet[20:])
+	case linkTypeRaw:
+		if len(packet) > 0 && packet[0]>>4 == 6 {
+			return ipv6UDP(packet)
+		}
+		return ipv4UDP(packet)
+	case linkTypeIPv4:
+		return ipv4UDP(packet)
+	case linkTypeIPv6:
+		return ipv6UDP(packet)
+	}
+	return datagram, false
+}
+
+func etherUDP(etherType uint16, packet []byte) (datagram udpDatagram, ok bool) {
+	switch etherType {
+	case etherTypeIPv4:
+		return ipv4UDP(packet)
+	case etherTypeIPv6:
+		return ipv6UDP(packet)
+	}
+	return datagram, false
+}
+
+func ipv4UDP(packet []byte) (datagram udpDatagram, ok bool) {
+	if len(packet) < 20 || packet[0]>>4 != 4 || packet[9] != ipProtocolUDP {
+		return datagram, false
+	}
+	if binary.BigEndian.Uint16(packet[6:])&0x3fff != 0 {
+		// a fragment, the more fragments flag or an offset
+		return datagram, false
+	}
+	headerLen := int(packet[0]&0x0f) * 4
+	totalLen := int(binary.BigEndian.Uint16(packet[2:]))
+	if headerLen < 20 || totalLen < headerLen || totalLen > len(packet) {
+		return datagram, false
+	}
+	return udp(net.IP(packet[12:16]), net.IP(packet[16:20]), packet[headerLen:totalLen])
+}
+
+func ipv6UDP(packet []byte) (datagram udpDatagram, ok bool) {
+	// extension headers are not followed
+	if len(packet) < 40 || packet[0]>>4 != 6 || packet[6] != ipProtocolUDP {
+		return datagram, false
+	}
+	payloadLen := int(binary.BigEndian.Uint16(packet[4:]))
+	if 40+payloadLen > len(packet) {
+		return datagram, false
+	}
+	return udp(net.IP(packet[8:24]), net.IP(packet[24:40]), packet[40:40+payloadLen])
+}
+
+func udp(srcIP net.IP, dstIP net.IP, segment []byte) (datagram udpDatagram, ok bool) {
+	if len(segment) < 8 {
+		return datagram, false
+	}
+	length := int(binary.BigEndian.Uint16(segment[4:]))
+	if length < 8 || length > len(segment) {
+		return datagram, false
+	}
+	datagram.srcPort = int(binary.BigEndian.Uint16(segment))
+	datagram.dstPort = int(binary.BigEndian.Uint16(segment[2:]))
+	datagram.src = net.JoinHostPort(srcIP.String(), strconv.Itoa(datagram.srcPort))
+	datagram.dst = net.JoinHostPort(dstIP.String(), strconv.Itoa(datagram.dstPort))
+	datagram.payload = segment[8:length]
+	return datagram, true
+}
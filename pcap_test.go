@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// testPacket is a UDP packet to write to a test capture
+type testPacket struct {
+	src     string // ip:port
+	dst     string
+	payload []byte
+}
+
+// ipv4Frame returns an Ethernet frame of the UDP packet
+func ipv4Frame(t *testing.T, packet testPacket) []byte {
+	addr := func(s string) (net.IP, int) {
+		udpAddr, err := net.ResolveUDPAddr("udp", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return udpAddr.IP.To4(), udpAddr.Port
+	}
+	srcIP, srcPort := addr(packet.src)
+	dstIP, dstPort := addr(packet.dst)
+
+	udp := make([]byte, 8, 8+len(packet.payload))
+	binary.BigEndian.PutUint16(udp, uint16(srcPort))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dstPort))
+	binary.BigEndian.PutUint16(udp[4:], uint16(8+len(packet.payload)))
+	udp = append(udp, packet.payload...)
+
+	ip := make([]byte, 20, 20+len(udp))
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(udp)))
+	ip[8] = 64
+	ip[9] = ipProtocolUDP
+	copy(ip[12:], srcIP)
+	copy(ip[16:], dstIP)
+	ip = append(ip, udp...)
+
+	frame := make([]byte, 14, 14+len(ip))
+	binary.BigEndian.PutUint16(frame[12:], etherTypeIPv4)
+	return append(frame, ip...)
+}
+
+// writeTestPcap returns a little-endian capture of the frames
+func writeTestPcap(linkType uint32, frames ...[]byte) []byte {
+	var buf bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header, 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], linkType)
+	buf.Write(header)
+	for i, frame := range frames {
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record, uint32(1700000000+i))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(frame)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(frame)))
+		buf.Write(record)
+		buf.Write(frame)
+	}
+	return buf.Bytes()
+}
+
+func TestReadPcapUDP(t *testing.T) {
+	request := ipv4Frame(t, testPacket{"192.0.2.10:40000", "192.0.2.1:161", []byte("request")})
+	response := ipv4Frame(t, testPacket{"192.0.2.1:161", "192.0.2.10:40000", []byte("response")})
+	fragment := ipv4Frame(t, testPacket{"192.0.2.10:40000", "192.0.2.1:161", []byte("fragment")})
+	fragment[14+6] = 0x20 // more fragments
+	arp := make([]byte, 42)
+	binary.BigEndian.PutUint16(arp[12:], 0x0806)
+
+	datagrams, err := readPcapUDP(bytes.NewReader(writeTestPcap(linkTypeEthernet, request, arp, fragment, response)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(datagrams) != 2 {
+		t.Fatalf("%d datagrams, want 2", len(datagrams))
+	}
+	got := datagrams[0]
+	if got.src != "192.0.2.10:40000" || got.dst != "192.0.2.1:161" || got.dstPort != 161 || string(got.payload) != "request" {
+		t.Errorf("request %+v", got)
+	}
+	got = datagrams[1]
+	if got.srcPort != 161 || got.dst != "192.0.2.10:40000" || string(got.payload) != "response" {
+		t.Errorf("response %+v", got)
+	}
+
+	// the same packet captured on any interface and raw
+	sll := append(make([]byte, 16), request[14:]...)
+	binary.BigEndian.PutUint16(sll[14:], etherTypeIPv4)
+	for _, capture := range [][]byte{writeTestPcap(linkTypeLinuxSLL, sll), writeTestPcap(linkTypeRaw, request[14:])} {
+		datagrams, err = readPcapUDP(bytes.NewReader(capture))
+		if err != nil || len(datagrams) != 1 || string(datagrams[0].payload) != "request" {
+			t.Errorf("datagrams %+v, error %v", datagrams, err)
+		}
+	}
+
+	pcapng := []byte{0x0a, 0x0d, 0x0d, 0x0a, 0x1c, 0, 0, 0, 0x4d, 0x3c, 0x2b, 0x1a, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if _, err := readPcapUDP(bytes.NewReader(pcapng)); err != errPcapng {
+		t.Errorf("pcapng: error %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// pcapSnapLen is the snapshot length of the captures written, larger than any datagram
+const pcapSnapLen = 65535
+
+// TrafficRecorder writes each request received and response sent to a libpcap capture, as tcpdump -w would,
+// so a session can be opened in Wireshark or replayed with -pcap.
+// The packets are raw IPv4 or IPv6 with the UDP header, since the sockets give no link layer.
+type TrafficRecorder struct {
+	lock     sync.Mutex
+	filename string
+	file     *os.File
+}
+
+// openTrafficRecorder creates the capture file, replacing any already there, and writes its header
+func openTrafficRecorder(filename string) (*TrafficRecorder, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header, 0xa1b2c3d4) // microsecond timestamps
+	binary.LittleEndian.PutUint16(header[4:], 2)      // version 2.4
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(header[20:], linkTypeRaw)
+	_, err = file.Write(header)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &TrafficRecorder{filename: filename, file: file}, nil
+}
+
+// Record writes a datagram from one address to another with the time it was received or sent.
+// The packet is written at once so none is lost if snmprun is killed.
+func (recorder *TrafficRecorder) Record(src net.Addr, dst net.Addr, payload []byte, now time.Time) error {
+	packet := udpPacket(udpAddr(src), udpAddr(dst), payload)
+	record := make([]byte, 16, 16+len(packet))
+	binary.LittleEndian.PutUint32(record, uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(now.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(record[12:], uint32(len(packet)))
+	record = append(record, packet...)
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	_, err := recorder.file.Write(record)
+	return err
+}
+
+// Close closes the file
+func (recorder *TrafficRecorder) Close() error {
+	return recorder.file.Close()
+}
+
+// udpAddr returns the UDP address of a socket or a source, the zero address if it is not one
+func udpAddr(addr net.Addr) *net.UDPAddr {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		return udp
+	}
+	return &net.UDPAddr{}
+}
+
+// udpPacket frames a datagram as an IPv4 packet, or IPv6 if either address is IPv6.
+// The address of a socket listening on all addresses is unspecified, as which one a request was sent to is not known.
+func udpPacket(src *net.UDPAddr, dst *net.UDPAddr, payload []byte) []byte {
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	ipv6 := (srcIP == nil && len(src.IP) > 0 && !src.IP.IsUnspecified()) ||
+		(dstIP == nil && len(dst.IP) > 0 && !dst.IP.IsUnspecified())
+	if ipv6 {
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+		if srcIP == nil || src.IP.IsUnspecified() {
+			srcIP = net.IPv6unspecified
+		}
+		if dstIP == nil || dst.IP.IsUnspecified() {
+			dstIP = net.IPv6unspecified
+		}
+	} else {
+		if srcIP == nil {
+			srcIP = net.IPv4zero.To4()
+		}
+		if dstIP == nil {
+			dstIP = net.IPv4zero.To4()
+		}
+	}
+
+	segment := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint16(segment, uint16(src.Port))
+	binary.BigEndian.PutUint16(segment[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(segment[4:], uint16(len(segment)))
+	copy(segment[8:], payload)
+	checksum := udpChecksum(srcIP, dstIP, segment)
+	binary.BigEndian.PutUint16(segment[6:], checksum)
+
+	var header []byte
+	if ipv6 {
+		header = make([]byte, 40)
+		header[0] = 6 << 4
+		binary.BigEndian.PutUint16(header[4:], uint16(len(segment)))
+		header[6] = ipProtocolUDP
+		header[7] = 64 // hop limit
+		copy(header[8:], srcIP)
+		copy(header[24:], dstIP)
+	} else {
+		header = make([]byte, 20)
+		header[0] = 4<<4 | 5
+		binary.BigEndian.PutUint16(header[2:], uint16(len(header)+len(segment)))
+		header[8] = 64 // time to live
+		header[9] = ipProtocolUDP
+		copy(header[12:], srcIP)
+		copy(header[16:], dstIP)
+		binary.BigEndian.PutUint16(header[10:], internetChecksum(0, header))
+	}
+	return append(header, segment...)
+}
+
+// udpChecksum returns the checksum of a UDP segment with the pseudo header of its addresses (RFC 768 and
+// RFC 8200 section 8.1), with 0 sent as all ones as 0 is no checksum
+func udpChecksum(srcIP net.IP, dstIP net.IP, segment []byte) uint16 {
+	var sum uint32
+	for _, ip := range []net.IP{srcIP, dstIP} {
+		for i := 0; i < len(ip); i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(ip[i:]))
+		}
+	}
+	sum += ipProtocolUDP + uint32(len(segment))
+	checksum := internetChecksum(sum, segment)
+	if checksum == 0 {
+		return 0xffff
+	}
+	return checksum
+}
+
+// internetChecksum returns the ones' complement of the ones' complement sum of the 16 bit words of data,
+// started from a partial sum (RFC 1071)
+func internetChecksum(sum uint32, data []byte) uint16 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
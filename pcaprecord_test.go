@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+func TestTrafficRecorder(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "traffic.pcap")
+	recorder, err := openTrafficRecorder(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent4 := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 161}
+	manager4 := &net.UDPAddr{IP: net.ParseIP("192.0.2.9"), Port: 40000}
+	agent6 := &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 161}
+	manager6 := &net.UDPAddr{IP: net.ParseIP("2001:db8::9"), Port: 40001}
+	anyAddr := &net.UDPAddr{IP: net.IPv4zero, Port: 161}
+	now := time.Now()
+	for _, packet := range []struct {
+		src, dst *net.UDPAddr
+		payload  string
+	}{
+		{manager4, agent4, "request"},
+		{agent4, manager4, "odd response"},
+		{manager6, agent6, "request"},
+		{anyAddr, manager6, "response"},
+	} {
+		if err := recorder.Record(packet.src, packet.dst, []byte(packet.payload), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorder.Close()
+
+	capture, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	datagrams, err := readPcapUDP(bytes.NewReader(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ src, dst, payload string }{
+		{"192.0.2.9:40000", "192.0.2.1:161", "request"},
+		{"192.0.2.1:161", "192.0.2.9:40000", "odd response"},
+		{"[2001:db8::9]:40001", "[2001:db8::1]:161", "request"},
+		{"[::]:161", "[2001:db8::9]:40001", "response"},
+	}
+	if len(datagrams) != len(want) {
+		t.Fatalf("%d datagrams, want %d", len(datagrams), len(want))
+	}
+	for i, w := range want {
+		d := datagrams[i]
+		if d.src != w.src || d.dst != w.dst || string(d.payload) != w.payload {
+			t.Errorf("datagram %d from %s to %s %q, want from %s to %s %q", i, d.src, d.dst, d.payload, w.src, w.dst, w.payload)
+		}
+	}
+
+	// a checksum over the packet with its checksum is zero
+	ipv4 := udpPacket(manager4, agent4, []byte("odd"))
+	if sum := internetChecksum(0, ipv4[:20]); sum != 0 {
+		t.Errorf("IPv4 header checksum does not verify: %04x", sum)
+	}
+	if sum := udpChecksum(ipv4[12:16], ipv4[16:20], ipv4[20:]); sum != 0xffff {
+		t.Errorf("UDP checksum does not verify: %04x", sum)
+	}
+	ipv6 := udpPacket(manager6, agent6, []byte("odd"))
+	if sum := udpChecksum(ipv6[8:24], ipv6[24:40], ipv6[40:]); sum != 0xffff {
+		t.Errorf("UDP checksum over IPv6 does not verify: %04x", sum)
+	}
+}
+
+func TestRecordServer(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "traffic.pcap")
+	addr := serveTestProgramWith(t, queryTestProg, &ServerConfig{recordFile: filename})
+	client, err := newClient(addr, "public", snmp.V2C, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Get(asn1.Oid{1, 3, 6, 1, 2, 1, 1, 1, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	capture, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	datagrams, err := readPcapUDP(bytes.NewReader(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(datagrams) != 2 {
+		t.Fatalf("%d datagrams, want the request and the response", len(datagrams))
+	}
+	ctx := snmp.Asn1Context()
+	var response snmp.Message
+	if _, err := ctx.Decode(datagrams[1].payload, &response); err != nil {
+		t.Fatal(err)
+	}
+	pdu, ok := response.Pdu.(snmp.GetResponsePdu)
+	if !ok || len(pdu.Variables) != 1 || pdu.Variables[0].Value != "query test" {
+		t.Errorf("recorded response %+v", response.Pdu)
+	}
+	if datagrams[0].srcPort != datagrams[1].dstPort {
+		t.Errorf("response to port %d, request from %d", datagrams[1].dstPort, datagrams[0].srcPort)
+	}
+}
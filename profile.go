@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiling starts writing a CPU profile if cpuFilename is given
+// The returned stop function stops it and writes a heap profile if memFilename is given,
+// so it is called at a clean shutdown.
+func startProfiling(cpuFilename string, memFilename string) (stop func(), err error) {
+	var cpuFile *os.File
+	if len(cpuFilename) > 0 {
+		cpuFile, err = os.Create(cpuFilename)
+		if err != nil {
+			return nil, err
+		}
+		err = pprof.StartCPUProfile(cpuFile)
+		if err != nil {
+			cpuFile.Close()
+			return nil, err
+		}
+	}
+
+	stop = func() {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			cpuFile.Close()
+		}
+		if len(memFilename) > 0 {
+			memFile, err := os.Create(memFilename)
+			if err != nil {
+				logger.Errorf("Failed to create memory profile: %s\n", err)
+				return
+			}
+			defer memFile.Close()
+			// get up to date statistics
+			runtime.GC()
+			err = pprof.WriteHeapProfile(memFile)
+			if err != nil {
+				logger.Errorf("Failed to write memory profile: %s\n", err)
+			}
+		}
+	}
+	return stop, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStartProfiling(t *testing.T) {
+	dir := t.TempDir()
+	cpuFilename := filepath.Join(dir, "cpu.prof")
+	memFilename := filepath.Join(dir, "mem.prof")
+
+	stop, err := startProfiling(cpuFilename, memFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+
+	for _, filename := range []string{cpuFilename, memFilename} {
+		info, err := os.Stat(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 {
+			t.Errorf("%s is empty", filename)
+		}
+	}
+}
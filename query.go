@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+// formatVariable formats a variable binding as OID = TYPE: value like the net-snmp tools
+func formatVariable(v snmp.Variable) string {
+	typ, text := formatSnmpValue(v.Value)
+	if typ == "" {
+		return fmt.Sprintf("%s = %s", v.Name, text)
+	}
+	return fmt.Sprintf("%s = %s: %s", v.Name, typ, text)
+}
+
+// formatSnmpValue returns the type and the text of a value, no type for NULL and the exceptions
+func formatSnmpValue(snmpValue interface{}) (typ string, text string) {
+	var value interface{} = snmpValue
+	switch x := snmpValue.(type) {
+	case int:
+		typ = "INTEGER"
+	case string:
+		typ = "STRING"
+		value = fmt.Sprintf("%q", x)
+	case asn1.Oid:
+		typ = "OID"
+	case snmp.IPAddress:
+		typ = "IpAddress"
+		value = net.IP(x[:]).String()
+	case snmp.Counter32:
+		typ = "Counter32"
+	case snmp.Unsigned32:
+		typ = "Gauge32"
+	case snmp.TimeTicks:
+		typ = "Timeticks"
+	case snmp.Counter64:
+		typ = "Counter64"
+	case snmp.Opaque:
+		typ = "Opaque"
+		value = fmt.Sprintf("% X", []byte(x))
+	case asn1.Null, nil:
+		return "", "NULL"
+	case snmp.NoSuchObject:
+		return "", "noSuchObject"
+	case snmp.NoSuchInstance:
+		return "", "noSuchInstance"
+	case snmp.EndOfMibView:
+		return "", "endOfMibView"
+	default:
+		typ = fmt.Sprintf("%T", x)
+	}
+	return typ, fmt.Sprint(value)
+}
+
+// queryClient parses the options and host of the get and walk subcommands and returns a client
+// and the remaining arguments after the host and community
+func queryClient(name string, args []string) (client *Client, rest []string, err error) {
+	var versionStr string
+	var timeout time.Duration
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(&versionStr, "v", "2c", "SNMP version: 1 or 2c")
+	flags.DurationVar(&timeout, "t", 2*time.Second, "time to wait for each response")
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		return nil, nil, fmt.Errorf("Usage: snmprun %s [-v 1|2c] [-t timeout] host[:port] community oid ...", name)
+	}
+	var version int
+	switch versionStr {
+	case "1":
+		version = snmp.V1
+	case "2c":
+		version = snmp.V2C
+	default:
+		return nil, nil, fmt.Errorf("Invalid SNMP version %s, expecting 1 or 2c", versionStr)
+	}
+	addr := flags.Arg(0)
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), "161")
+	}
+	client, err = newClient(addr, flags.Arg(1), version, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, flags.Args()[2:], nil
+}
+
+// parseOids parses the OIDs of the command line, which need not have a leading dot
+func parseOids(oidStrs []string) (oids []asn1.Oid, err error) {
+	for _, oidStr := range oidStrs {
+		oid, err := strToOID(oidStr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid OID %s: %v", oidStr, err)
+		}
+		oids = append(oids, oid)
+	}
+	return oids, nil
+}
+
+// runGet is the get subcommand returning the exit status
+// snmprun get [-v 1|2c] [-t timeout] host[:port] community oid ...
+func runGet(args []string, out io.Writer) int {
+	client, oidStrs, err := queryClient("get", args)
+	if err == nil && len(oidStrs) == 0 {
+		err = fmt.Errorf("Missing OID to get")
+	}
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	defer client.Close()
+
+	oids, err := parseOids(oidStrs)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	vars, err := client.Get(oids...)
+	if err != nil {
+		fmt.Fprintf(out, "get failed: %s\n", err)
+		return 1
+	}
+	for _, v := range vars {
+		fmt.Fprintln(out, formatVariable(v))
+	}
+	return 0
+}
+
+// runWalk is the walk subcommand returning the exit status
+// snmprun walk [-v 1|2c] [-t timeout] host[:port] community [oid]
+func runWalk(args []string, out io.Writer) int {
+	client, oidStrs, err := queryClient("walk", args)
+	if err == nil && len(oidStrs) > 1 {
+		err = fmt.Errorf("Only one OID can be walked")
+	}
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	defer client.Close()
+
+	root := asn1.Oid{1, 3, 6, 1}
+	if len(oidStrs) == 1 {
+		oids, err := parseOids(oidStrs)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return 1
+		}
+		root = oids[0]
+	}
+	err = client.Walk(root, func(v snmp.Variable) error {
+		_, err := fmt.Fprintln(out, formatVariable(v))
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(out, "walk failed: %s\n", err)
+		return 1
+	}
+	return 0
+}
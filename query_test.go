@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+// serveTestProgram runs the program then serves it on an ephemeral port until the test ends
+func serveTestProgram(t *testing.T, prog string) (addr string) {
+	return serveTestProgramWith(t, prog, &ServerConfig{})
+}
+
+// serveTestProgramWith serves the program with the options of the config, with the default communities
+func serveTestProgramWith(t *testing.T, prog string, config *ServerConfig) (addr string) {
+	program, interp := parseTestProgram(t, prog)
+	config.readCommunity, config.writeCommunity, config.maxMsgSize = "public", "private", maxDatagramSize
+	server, err := initSNMPServer(interp, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := interp.InterpProgram(program); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	quit := make(chan bool, 1)
+	go runSNMPServer(server, quit, &wg)
+	t.Cleanup(func() {
+		quit <- true
+		server.conn.SetReadDeadline(time.Now())
+		wg.Wait()
+		server.conn.Close()
+	})
+	port := server.conn.LocalAddr().(*net.UDPAddr).Port
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+}
+
+const queryTestProg = `
+var
+  descr: 2.1.1.1.0 string
+  uptime: 2.1.1.3.0 timeticks
+  ifNumber: 2.1.2.1.0 integer
+  hc-in-octets: 2.1.31.1.1.1.6.1 counter64
+endvar
+run
+  descr = "query test"
+  uptime = 4200
+  ifNumber = 2
+  hc-in-octets = 18446744073709551615
+endrun`
+
+func TestServeAfterInform(t *testing.T) {
+	addr := serveTestProgram(t, queryTestProg)
+
+	client, err := newClient(addr, "public", snmp.V2C, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	msg := snmp.Message{Version: snmp.V2C, Community: []byte("public"),
+		Pdu: snmp.InformRequestPdu{Identifier: 99, Variables: nullVars([]asn1.Oid{{1, 3, 6, 1, 2, 1, 1, 3, 0}})}}
+	buffer, err := client.ctx.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.conn.Write(buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	// the inform is dropped and the server keeps answering
+	vars, err := client.Get(asn1.Oid{1, 3, 6, 1, 2, 1, 1, 1, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars[0].Value != "query test" {
+		t.Errorf("got %v after the inform", vars[0].Value)
+	}
+}
+
+func TestGetCommand(t *testing.T) {
+	addr := serveTestProgram(t, queryTestProg)
+
+	var out bytes.Buffer
+	status := runGet([]string{addr, "public", "1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.3.0", "1.3.6.1.2.1.1.2.0"}, &out)
+	want := `.1.3.6.1.2.1.1.1.0 = STRING: "query test"
+.1.3.6.1.2.1.1.3.0 = Timeticks: 4200
+.1.3.6.1.2.1.1.2.0 = noSuchObject
+`
+	if status != 0 || out.String() != want {
+		t.Errorf("status %d, output:\n%s\nwant:\n%s", status, out.String(), want)
+	}
+
+	out.Reset()
+	status = runGet([]string{"-v", "1", addr, "public", "1.3.6.1.2.1.1.2.0"}, &out)
+	if status != 1 || out.String() != "get failed: Error status 2 at index 1\n" {
+		t.Errorf("v1 missing OID: status %d, output %q", status, out.String())
+	}
+}
+
+func TestWalkCommand(t *testing.T) {
+	addr := serveTestProgram(t, queryTestProg)
+
+	var out bytes.Buffer
+	status := runWalk([]string{addr, "public", "1.3.6.1.2.1"}, &out)
+	want := `.1.3.6.1.2.1.1.1.0 = STRING: "query test"
+.1.3.6.1.2.1.1.3.0 = Timeticks: 4200
+.1.3.6.1.2.1.2.1.0 = INTEGER: 2
+.1.3.6.1.2.1.31.1.1.1.6.1 = Counter64: 18446744073709551615
+`
+	if status != 0 || out.String() != want {
+		t.Errorf("status %d, output:\n%s\nwant:\n%s", status, out.String(), want)
+	}
+
+	// v1 ends with noSuchName and does not see the counter64
+	out.Reset()
+	status = runWalk([]string{"-v", "1", addr, "public", "1.3.6.1.2.1.2"}, &out)
+	if status != 0 || out.String() != ".1.3.6.1.2.1.2.1.0 = INTEGER: 2\n" {
+		t.Errorf("v1 walk: status %d, output %q", status, out.String())
+	}
+}
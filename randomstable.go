@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+// randomStableChars are the characters of a random-stable string, as in serial numbers
+const randomStableChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// randomStableLength is the length of a random-stable string without a maximum length
+const randomStableLength = 12
+
+// randomStableHash returns the hash of the seed and the OID of a variable the random-stable value is made
+// from, so each OID has its own value that is the same whenever the values are initialized with the seed
+func (interp *Interpreter) randomStableHash(oidStr string) uint64 {
+	hash := fnv.New64a()
+	var seed [8]byte
+	binary.BigEndian.PutUint64(seed[:], uint64(interp.seed))
+	hash.Write(seed[:])
+	hash.Write([]byte(oidStr))
+	return hash.Sum64()
+}
+
+// randomStableValue returns the random-stable value of a variable for the seed, within its range or length.
+// The next hash is the hash of the previous one for as many random numbers as are needed.
+func (interp *Interpreter) randomStableValue(typ *Type) *Value {
+	h := interp.randomStableHash(typ.oid)
+	val := &Value{valueType: typ.valueType}
+	switch typ.valueType {
+	case ValueInteger:
+		if typ.valueRange != nil {
+			size := uint64(typ.valueRange.max-typ.valueRange.min) + 1
+			val.intVal = typ.valueRange.min + int(h%size)
+		} else {
+			val.intVal = int(h % (math.MaxInt32 + 1))
+		}
+	case ValueCounter, ValueGuage, ValueTimeticks:
+		val.intVal = int(h % (math.MaxUint32 + 1))
+	case ValueCounter64:
+		val.counter64Val = h >> 1
+	case ValueString:
+		length := randomStableLength
+		if typ.maxLength > 0 && typ.maxLength < randomStableLength {
+			length = int(typ.maxLength)
+		}
+		chars := make([]byte, length)
+		for i := range chars {
+			chars[i] = randomStableChars[h%uint64(len(randomStableChars))]
+			h /= uint64(len(randomStableChars))
+			if h == 0 {
+				h = interp.randomStableHash(fmt.Sprintf("%s.%d", typ.oid, i))
+			}
+		}
+		val.stringVal = string(chars)
+	case ValueIpv4address:
+		// in 10.0.0.0/8 so the address is private
+		val.addrVal = fmt.Sprintf("10.%d.%d.%d", byte(h>>16), byte(h>>8), byte(h))
+	}
+	return val
+}
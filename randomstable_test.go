@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRandomStable(t *testing.T) {
+	if logger == nil {
+		logger = newLevelLogger(ioutil.Discard, "", 0, LogError)
+	}
+	prog := `
+var
+  serial: 2.1.47.1.1.1.11.1 string(10) random-stable
+  id: 4.1.99.1.0 string random-stable
+  slot: 4.1.99.2.0 integer(1..8) random-stable
+  mgmt-addr: 4.1.99.3.0 ipaddress random-stable
+  ifSpeed.[1..4]: 2.1.2.2.1.5 guage random-stable
+endvar
+run
+endrun`
+	values := func(seed int64, reset bool) map[string]string {
+		program, err := Parse("test", prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		interp := new(Interpreter)
+		interp.SetSeed(seed)
+		if err := interp.Init(program, make(VariableInits)); err != nil {
+			t.Fatal(err)
+		}
+		if reset {
+			interp.Reset()
+		}
+		formatted := make(map[string]string)
+		for id := range program.variables.types {
+			val, _ := interp.GetValueForId(id)
+			formatted[id] = formatValue(val)
+		}
+		return formatted
+	}
+	first := values(42, false)
+	for id, val := range values(42, true) {
+		if first[id] != val {
+			t.Errorf("%s = %s then %s after a reset with the same seed", id, first[id], val)
+		}
+	}
+	if serial := first["serial"]; len(serial) != 12 || strings.Trim(serial, `"`+randomStableChars) != "" {
+		t.Errorf("serial = %s, want 10 characters", serial)
+	}
+	if id := first["id"]; len(id) != randomStableLength+2 {
+		t.Errorf("id = %s, want %d characters", id, randomStableLength)
+	}
+	if slot := first["slot"]; slot < "1" || slot > "8" || len(slot) != 1 {
+		t.Errorf("slot = %s, want 1 to 8", slot)
+	}
+	if addr := first["mgmt-addr"]; !strings.HasPrefix(addr, "10.") || isValidIpv4Address(addr) != nil {
+		t.Errorf("mgmt-addr = %s, want a 10. address", addr)
+	}
+	if first["ifSpeed.1"] == first["ifSpeed.2"] {
+		t.Errorf("ifSpeed.1 and ifSpeed.2 are both %s, want a value per OID", first["ifSpeed.1"])
+	}
+
+	other := values(43, false)
+	same := 0
+	for id, val := range other {
+		if first[id] == val {
+			same++
+		}
+	}
+	if same == len(other) {
+		t.Errorf("same values with another seed: %v", other)
+	}
+
+	for _, decl := range []string{"x: 4.1.99.1.0 string random-stable = \"x\"", "x: 4.1.99.1.0 bitset random-stable",
+		"x: integer random-stable"} {
+		if _, err := Parse("test", "var\n  "+decl+"\nendvar\nrun\nendrun"); err == nil {
+			t.Errorf("%s: no error", decl)
+		}
+	}
+}
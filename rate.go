@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// rateState is how far a counter with a rate has been increased
+type rateState struct {
+	last  time.Time // when the rate was last applied
+	carry float64   // fraction of an increment not yet added
+}
+
+// SetSeed seeds the random numbers, such as for the jitter of rates, so runs can be reproduced
+func (interp *Interpreter) SetSeed(seed int64) {
+	interp.rng = rand.New(rand.NewSource(seed))
+	interp.seed = seed
+}
+
+// newRateStates starts the rates of all the counters with one from now, by the clock of each
+func (interp *Interpreter) newRateStates() map[string]*rateState {
+	states := make(map[string]*rateState)
+	for oidStr, typ := range interp.variables.typesFromOid {
+		if typ.rate != nil {
+			states[oidStr] = &rateState{last: interp.clockNow(typ.rate)}
+		}
+	}
+	return states
+}
+
+// findRateUsers checks the variables holding the amounts of rates and finds the counters using each
+func (interp *Interpreter) findRateUsers() error {
+	interp.rateUsers = make(map[string][]*Type)
+
+	// sort for predictable errors
+	oidStrs := make([]string, 0, len(interp.variables.typesFromOid))
+	for oidStr := range interp.variables.typesFromOid {
+		oidStrs = append(oidStrs, oidStr)
+	}
+	err := sortOIDStrings(oidStrs)
+	if err != nil {
+		return err
+	}
+	for _, oidStr := range oidStrs {
+		typ := interp.variables.typesFromOid[oidStr]
+		if typ.rate == nil || typ.rate.amountId == "" {
+			continue
+		}
+		amountType, ok := interp.variables.types[typ.rate.amountId]
+		if !ok {
+			return fmt.Errorf("Error at line %d: rate of %s uses %s which is not declared", typ.lineNum, typ.id, typ.rate.amountId)
+		}
+		if amountType.valueType != ValueInteger && amountType.valueType != ValueGuage {
+			return fmt.Errorf("Error at line %d: rate of %s uses %s which is not an integer or guage", typ.lineNum, typ.id, typ.rate.amountId)
+		}
+		interp.rateUsers[typ.rate.amountId] = append(interp.rateUsers[typ.rate.amountId], typ)
+	}
+	return nil
+}
+
+// applyRate increases the counter by its rate for the time since the rate was last applied
+func (interp *Interpreter) applyRate(typ *Type) {
+	interp.valLock.Lock()
+	defer interp.valLock.Unlock()
+
+	interp.applyRateLocked(typ)
+}
+
+// applyRateLocked is applyRate with the values already locked
+func (interp *Interpreter) applyRateLocked(typ *Type) {
+	state, ok := interp.rateStates[typ.oid]
+	if !ok {
+		return
+	}
+	amount := typ.rate.amount
+	if typ.rate.amountId != "" {
+		amount = 0
+		if val, found := interp.values[typ.rate.amountId]; found && val.intVal > 0 {
+			amount = val.intVal
+		}
+	}
+	now := interp.clockNow(typ.rate)
+	increase := float64(amount) * float64(now.Sub(state.last)) / float64(typ.rate.interval)
+	if typ.rate.jitter > 0 {
+		increase *= 1 + float64(typ.rate.jitter)/100*(2*interp.rng.Float64()-1)
+	}
+	increase += state.carry
+	whole := math.Floor(increase)
+	state.carry = increase - whole
+	state.last = now
+
+	// values are replaced rather than updated as they may be shared
+	val := &Value{valueType: typ.valueType}
+	if old, found := interp.oid2Values[typ.oid]; found {
+		val.intVal = old.intVal
+		val.counter64Val = old.counter64Val
+	}
+	if typ.valueType == ValueCounter64 {
+		val.counter64Val += uint64(whole)
+	} else {
+		val.intVal = int(uint32(val.intVal + int(whole)))
+	}
+	interp.oid2Values[typ.oid] = val
+	interp.values[typ.id] = val
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PromonLogicalis/snmp"
+)
+
+const rateTestOid = ".1.3.6.1.2.1.2.2.1.10.1"
+
+// readAfter reads the counter as if its rate was last applied the duration ago
+func readAfter(t *testing.T, agent *Agent, interp *Interpreter, ago time.Duration) int {
+	interp.valLock.Lock()
+	interp.rateStates[rateTestOid].last = time.Now().Add(-ago)
+	interp.valLock.Unlock()
+
+	oid, _ := strToOID(rateTestOid)
+	object, _ := agent.getObject(oid)
+	value, err := object.getter(context.Background(), oid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(value.(snmp.Counter32))
+}
+
+func TestRate(t *testing.T) {
+	agent, interp := newTestAgent(t, `
+var
+  in-octets: 2.1.2.2.1.10.1 counter rate 100/s
+endvar
+run
+endrun`)
+
+	if got := readAfter(t, agent, interp, 2*time.Second); got < 200 || got > 201 {
+		t.Errorf("after 2s = %d, want 200", got)
+	}
+	if got := readAfter(t, agent, interp, time.Minute); got < 6200 || got > 6202 {
+		t.Errorf("after another minute = %d, want 6200", got)
+	}
+}
+
+func TestRateAliasAndTrap(t *testing.T) {
+	agent, interp := newTestAgent(t, `
+var
+  in-octets: 2.1.2.2.1.10.1 counter rate 100/s
+  alias 4.1.99.1.0 = 2.1.2.2.1.10.1
+endvar
+run
+endrun`)
+	setLast := func(ago time.Duration) {
+		interp.valLock.Lock()
+		interp.rateStates[rateTestOid].last = time.Now().Add(-ago)
+		interp.valLock.Unlock()
+	}
+
+	// the alias is brought up to date like its target
+	setLast(2 * time.Second)
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, "1.3.6.1.4.1.99.1.0")})
+	if got, ok := resp.Variables[0].Value.(snmp.Counter32); !ok || got < 200 || got > 201 {
+		t.Errorf("alias after 2s = %v, want 200", resp.Variables[0].Value)
+	}
+
+	// and so are the variables of a trap
+	sender, err := newV1TrapSender(interp, &TrapConfig{enterprise: ".1.3.6.1.4.1.99"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setLast(2 * time.Second)
+	msg, err := sender.buildTrap(6, 1, []string{"in-octets"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := msg.Pdu.(snmp.V1TrapPdu).Variables
+	if got, ok := vars[0].Value.(snmp.Counter32); !ok || got < 400 || got > 402 {
+		t.Errorf("trap variable after another 2s = %v, want 400", vars[0].Value)
+	}
+}
+
+func TestRateJitter(t *testing.T) {
+	const prog = `
+var
+  in-octets: 2.1.2.2.1.10.1 counter rate 1000/s jitter 10%
+endvar
+run
+endrun`
+	readings := func() (increases []int) {
+		_, interp := parseTestProgram(t, prog)
+		agent := NewAgent()
+		if err := addProgramOIDs(agent, interp, false); err != nil {
+			t.Fatal(err)
+		}
+		interp.SetSeed(42)
+		total := 0
+		for i := 0; i < 20; i++ {
+			got := readAfter(t, agent, interp, time.Second)
+			increases = append(increases, got-total)
+			total = got
+		}
+		return increases
+	}
+
+	first := readings()
+	varied := false
+	for _, increase := range first {
+		if increase < 900 || increase > 1101 {
+			t.Errorf("increase %d is outside the 10%% jitter band", increase)
+		}
+		if increase < 990 || increase > 1010 {
+			varied = true
+		}
+	}
+	if !varied {
+		t.Errorf("increases %v do not vary", first)
+	}
+
+	// the same seed gives about the same readings, allowing for the time taken between reads
+	second := readings()
+	for i := range first {
+		if diff := first[i] - second[i]; diff < -2 || diff > 2 {
+			t.Errorf("increase %d = %d with the same seed, was %d", i, second[i], first[i])
+		}
+	}
+}
+
+func TestRateVariable(t *testing.T) {
+	program, interp := parseTestProgram(t, `
+var
+  in-octets: 2.1.2.2.1.10.1 counter rate in-rate/s
+  in-rate: 4.1.99.1.0 rw integer = 100
+endvar
+run
+endrun`)
+	agent := NewAgent()
+	if err := addProgramOIDs(agent, interp, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := interp.InterpProgram(program); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readAfter(t, agent, interp, 2*time.Second); got < 200 || got > 201 {
+		t.Errorf("after 2s = %d, want 200", got)
+	}
+
+	// the time before a change is at the old rate
+	interp.valLock.Lock()
+	interp.rateStates[rateTestOid].last = time.Now().Add(-time.Second)
+	interp.valLock.Unlock()
+	rateOid := "1.3.6.1.4.1.99.1.0"
+	resp := request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{rateOid: 1000}, rateOid)})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("set status %d", resp.ErrorStatus)
+	}
+	if got := readAfter(t, agent, interp, time.Second); got < 1300 || got > 1302 {
+		t.Errorf("after 1s at 100/s and 1s at 1000/s = %d, want 1300", got)
+	}
+
+	// a negative rate stops the counter
+	interp.SetValueForIdOid("in-rate", ".1.3.6.1.4.1.99.1.0", &Value{valueType: ValueInteger, intVal: -5})
+	before := readAfter(t, agent, interp, 0)
+	if got := readAfter(t, agent, interp, time.Minute); got != before {
+		t.Errorf("negative rate changed %d to %d", before, got)
+	}
+}
+
+func TestRateVariableErrors(t *testing.T) {
+	tests := []struct {
+		decl string
+		want string
+	}{
+		{"x: 2.1.1 counter rate y/s", "rate of x uses y which is not declared"},
+		{"x: 2.1.1 counter rate y/s\n  y: string", "rate of x uses y which is not an integer or guage"},
+	}
+	for _, test := range tests {
+		program, err := NewParser(lex("test", "var\n  "+test.decl+"\nendvar\nrun\nendrun")).ParseProgram()
+		if err != nil {
+			t.Fatalf("%s: %v", test.decl, err)
+		}
+		err = new(Interpreter).Init(program, nil)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error = %v, want %s", test.decl, err, test.want)
+		}
+	}
+}
+
+func TestRateErrors(t *testing.T) {
+	tests := []struct {
+		decl string
+		want string
+	}{
+		{"x: 2.1.1 integer rate 1/s", "Only a counter can have a rate"},
+		{"x: counter rate 1/s", "A rate needs an OID"},
+		{"x: 2.1.1 counter rate 1/d", "Expecting rate units s, m or h but got d"},
+		{"x: 2.1.1 counter rate 1/s jitter 200%", "Invalid jitter: 200"},
+		{"x: 2.1.1 counter rate \"fast\"/s", "Expecting an integer or variable for the rate"},
+	}
+	for _, test := range tests {
+		_, err := NewParser(lex("test", "var\n  "+test.decl+"\nendvar\nrun\nendrun")).ParseProgram()
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error = %v, want %s", test.decl, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parseStatementLine parses a single line statement using the variables of the program
+func parseStatementLine(program *Program, line string) (stmt *Statement, err error) {
+	l := lex("repl", line+"\n")
+	defer l.drain()
+
+	parser := NewParser(l)
+	parser.variables = program.variables
+	stmt, err = parser.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	if item := parser.nextItem(); item.typ != itemEOF {
+		return nil, parser.errorf("Unexpected %v after the statement", item)
+	}
+	return stmt, nil
+}
+
+// formatValue formats a value for the show command
+func formatValue(val *Value) string {
+	switch val.valueType {
+	case ValueInteger, ValueCounter, ValueGuage, ValueTimeticks:
+		return fmt.Sprintf("%d", val.intVal)
+	case ValueCounter64:
+		return fmt.Sprintf("%d", val.counter64Val)
+	case ValueString:
+		return fmt.Sprintf("%q", val.stringVal)
+	case ValueBoolean:
+		return fmt.Sprintf("%t", val.boolVal)
+	case ValueBitset:
+		return val.bitsetVal.String()
+	case ValueBytes:
+		return val.bytesVal.String()
+	case ValueOid:
+		return val.oidVal
+	case ValueIpv4address:
+		return val.addrVal
+	case ValueInetAddress:
+		return val.inetVal.String()
+	}
+	return val.String()
+}
+
+// show writes the values of the variables, or all of them if none are given
+func show(out io.Writer, interp *Interpreter, ids []string) {
+	if len(ids) == 0 {
+		for id := range interp.variables.types {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+	for _, id := range ids {
+		val, found := interp.GetValueForId(id)
+		if !found {
+			fmt.Fprintf(out, "%s is not a variable\n", id)
+			continue
+		}
+		fmt.Fprintf(out, "%s = %s\n", id, formatValue(val))
+	}
+}
+
+// repl reads statements from in and interprets them one at a time
+// Besides statements there are the commands: show [id ...] and quit.
+func repl(in io.Reader, out io.Writer, interp *Interpreter, program *Program) {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case fields[0] == "quit" || fields[0] == "exit":
+			return
+		case fields[0] == "show":
+			show(out, interp, fields[1:])
+			continue
+		}
+
+		stmt, err := parseStatementLine(program, line)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		_, err = interp.interpStatement(stmt)
+		if err != nil {
+			fmt.Fprintln(out, err)
+		}
+	}
+}
+
+// runRepl is the repl subcommand returning the exit status
+// snmprun repl [-p port] [-c community] [-C community] [-V key=value] program.sim
+// It serves the program, runs it in the background and then interprets statements typed in.
+func runRepl(args []string) int {
+	var config ServerConfig
+	varInits := make(VariableInits)
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	flags.UintVar(&config.portNum, "p", 161, "port number for SNMP server")
+	flags.StringVar(&config.readCommunity, "c", "public", "community name")
+	flags.StringVar(&config.writeCommunity, "C", "private", "community name")
+	flags.Var(&varInits, "V", "variable initializers")
+	flags.Parse(args)
+	config.maxMsgSize = maxDatagramSize
+
+	if flags.NArg() != 1 {
+		fmt.Print("Missing filename to run\n")
+		return 1
+	}
+	logger = newLevelLogger(os.Stderr, "snmpsim", log.LstdFlags, LogWarn)
+
+	program, err := loadProgramAs(flags.Arg(0), "", nil)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	interp := new(Interpreter)
+	err = interp.Init(program, varInits)
+	if err != nil {
+		fmt.Printf("Initialization error: %s\n", err)
+		return 1
+	}
+	server, err := initSNMPServer(interp, &config)
+	if err != nil {
+		fmt.Printf("Failed to init snmp server: %s\n", err)
+		return 1
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	quitServer := make(chan bool, 1)
+	go runSNMPServer(server, quitServer, &wg)
+
+	go func() {
+		err := interp.InterpProgram(program)
+		if err != nil && err != errStopped {
+			logger.Errorf("Interpreting error: %s\n", err)
+		}
+	}()
+
+	fmt.Printf("Serving %s on port %d, type statements, show [id ...] or quit\n", flags.Arg(0), config.portNum)
+	repl(os.Stdin, os.Stdout, interp, program)
+
+	interp.Stop()
+	quitServer <- true
+	server.conn.SetReadDeadline(time.Now())
+	wg.Wait()
+	return 0
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRepl(t *testing.T) {
+	program, interp := parseTestProgram(t, `
+var
+  descr: 2.1.1.1.0 string
+  count: 2.1.2.1.0 counter
+endvar
+run
+endrun`)
+
+	input := strings.Join([]string{
+		`descr = "from the repl"`,
+		"count = count + 5",
+		"",
+		"show count missing",
+		"count = ",
+		"show",
+		"quit",
+		"descr = \"after quit\"",
+	}, "\n")
+	var out bytes.Buffer
+	repl(strings.NewReader(input), &out, interp, program)
+
+	if val, _ := interp.GetValueForOid(".1.3.6.1.2.1.1.1.0"); val.stringVal != "from the repl" {
+		t.Errorf("descr = %q, want from the repl", val.stringVal)
+	}
+	lines := strings.Split(out.String(), "\n")
+	want := []string{
+		"> > > > count = 5",
+		"missing is not a variable",
+		"> repl: Error at line 2: Invalid item/operator in integer factor", // the line of the end of the input
+		"> count = 5",
+		`descr = "from the repl"`,
+		"> ",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+// Replay serves the responses of a capture of a real device byte for byte, to the requests which ask for
+// the same OIDs in the same way, to reproduce quirks of the device the program can not express.
+// Only the request-id of a response is changed to that of the live request.
+type Replay struct {
+	lock      sync.Mutex
+	responses map[string]*replayResponses // by replayKey of the request
+}
+
+// replayResponses are the responses captured for a request, served in turn
+type replayResponses struct {
+	responses [][]byte
+	next      int
+}
+
+// loadReplay reads the requests to an agent on the port and their responses from a pcap file
+func loadReplay(filename string, port int, ctx *asn1.Context) (*Replay, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	datagrams, err := readPcapUDP(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return newReplay(datagrams, port, ctx), nil
+}
+
+// newReplay pairs the requests to the port with the responses with the same request-id back to the manager
+func newReplay(datagrams []udpDatagram, port int, ctx *asn1.Context) *Replay {
+	replay := &Replay{responses: make(map[string]*replayResponses)}
+	pending := make(map[string]string) // manager address and request-id --> key of the request
+	for _, datagram := range datagrams {
+		var msg snmp.Message
+		if _, err := ctx.Decode(datagram.payload, &msg); err != nil {
+			continue
+		}
+		if datagram.dstPort == port {
+			if key, ok := replayKey(msg); ok {
+				id, _, _ := getRequestInfo(msg.Pdu)
+				pending[fmt.Sprintf("%s/%d", datagram.src, id)] = key
+			}
+			continue
+		}
+		resp, ok := msg.Pdu.(snmp.GetResponsePdu)
+		if datagram.srcPort != port || !ok {
+			continue
+		}
+		pendingKey := fmt.Sprintf("%s/%d", datagram.dst, resp.Identifier)
+		key, ok := pending[pendingKey]
+		if !ok {
+			continue
+		}
+		delete(pending, pendingKey)
+		responses, ok := replay.responses[key]
+		if !ok {
+			responses = new(replayResponses)
+			replay.responses[key] = responses
+		}
+		responses.responses = append(responses.responses, datagram.payload)
+	}
+	return replay
+}
+
+// Len returns the number of requests with responses to replay
+func (replay *Replay) Len() int {
+	return len(replay.responses)
+}
+
+// replayKey identifies the requests which get the same response: the version, the PDU type, the OIDs and
+// for a GetBulk the non-repeaters and max-repetitions. SETs are not replayed as they change the device.
+func replayKey(msg snmp.Message) (key string, ok bool) {
+	var kind string
+	var vars []snmp.Variable
+	switch pdu := msg.Pdu.(type) {
+	case snmp.GetRequestPdu:
+		kind, vars = "get", pdu.Variables
+	case snmp.GetNextRequestPdu:
+		kind, vars = "getnext", pdu.Variables
+	case snmp.GetBulkRequestPdu:
+		kind, vars = fmt.Sprintf("getbulk %d %d", pdu.NonRepeaters, pdu.MaxRepetitions), pdu.Variables
+	default:
+		return "", false
+	}
+	oids := make([]string, len(vars))
+	for i, v := range vars {
+		oids[i] = v.Name.String()
+	}
+	return fmt.Sprintf("%d %s %s", msg.Version, kind, strings.Join(oids, ",")), true
+}
+
+// Response returns the next captured response to a request with the request-id of this one, false if none
+func (replay *Replay) Response(msg snmp.Message) (response []byte, ok bool) {
+	key, ok := replayKey(msg)
+	if !ok {
+		return nil, false
+	}
+	replay.lock.Lock()
+	responses, ok := replay.responses[key]
+	if !ok {
+		replay.lock.Unlock()
+		return nil, false
+	}
+	response = responses.responses[responses.next]
+	responses.next = (responses.next + 1) % len(responses.responses)
+	replay.lock.Unlock()
+
+	id, _, _ := getRequestInfo(msg.Pdu)
+	response, err := setRequestId(response, id)
+	if err != nil {
+		logger.Warnf("Captured response for %s not replayed: %v\n", key, err)
+		return nil, false
+	}
+	return response, true
+}
+
+var errBadBER = errors.New("Bad BER encoding")
+
+// berHeader returns the tag of the TLV at the start of data and the lengths of its header and its value
+func berHeader(data []byte) (tag byte, headerLen int, valueLen int, err error) {
+	if len(data) < 2 {
+		return 0, 0, 0, errBadBER
+	}
+	tag = data[0]
+	if data[1] < 0x80 {
+		headerLen, valueLen = 2, int(data[1])
+	} else {
+		n := int(data[1] & 0x7f)
+		if n == 0 || n > 4 || len(data) < 2+n {
+			return 0, 0, 0, errBadBER
+		}
+		for _, b := range data[2 : 2+n] {
+			valueLen = valueLen<<8 | int(b)
+		}
+		headerLen = 2 + n
+	}
+	if headerLen+valueLen > len(data) {
+		return 0, 0, 0, errBadBER
+	}
+	return tag, headerLen, valueLen, nil
+}
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var bytes []byte
+	for ; n > 0; n >>= 8 {
+		bytes = append([]byte{byte(n)}, bytes...)
+	}
+	return append([]byte{0x80 | byte(len(bytes))}, bytes...)
+}
+
+// berInteger returns the TLV of an INTEGER in the fewest bytes of two's complement
+func berInteger(n int) []byte {
+	value := []byte{byte(n)}
+	for (n >= 0x80 || n < -0x80) && len(value) < 8 {
+		n >>= 8
+		value = append([]byte{byte(n)}, value...)
+	}
+	return append([]byte{0x02, byte(len(value))}, value...)
+}
+
+// setRequestId returns a copy of an encoded message with the request-id of its PDU replaced,
+// leaving the other bytes as they were apart from the lengths which contain it
+func setRequestId(message []byte, id int) ([]byte, error) {
+	tag, headerLen, valueLen, err := berHeader(message)
+	if err != nil || tag != 0x30 {
+		return nil, errBadBER
+	}
+	content := message[headerLen : headerLen+valueLen]
+
+	// version and community
+	offset := 0
+	for i := 0; i < 2; i++ {
+		_, h, v, err := berHeader(content[offset:])
+		if err != nil {
+			return nil, err
+		}
+		offset += h + v
+	}
+	pduTag, pduHeaderLen, pduLen, err := berHeader(content[offset:])
+	if err != nil {
+		return nil, err
+	}
+	pdu := content[offset+pduHeaderLen : offset+pduHeaderLen+pduLen]
+	idTag, idHeaderLen, idLen, err := berHeader(pdu)
+	if err != nil || idTag != 0x02 {
+		return nil, errBadBER
+	}
+
+	pduContent := append(berInteger(id), pdu[idHeaderLen+idLen:]...)
+	newPdu := append(append([]byte{pduTag}, berLength(len(pduContent))...), pduContent...)
+	newContent := append(append(append([]byte{}, content[:offset]...), newPdu...), content[offset+pduHeaderLen+pduLen:]...)
+	return append(append([]byte{0x30}, berLength(len(newContent))...), newContent...), nil
+}
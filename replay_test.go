@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+func TestSetRequestId(t *testing.T) {
+	ctx := snmp.Asn1Context()
+	descr := asn1.Oid{1, 3, 6, 1, 2, 1, 1, 1, 0}
+	for _, ids := range [][2]int{{1, 2}, {5, 1804289383}, {1804289383, 7}, {200, -129}, {127, 128}} {
+		message, err := ctx.Encode(snmp.Message{Version: snmp.V2C, Community: []byte("public"),
+			Pdu: snmp.GetResponsePdu{Identifier: ids[0], Variables: []snmp.Variable{{Name: descr, Value: "router"}}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := setRequestId(message, ids[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg snmp.Message
+		if _, err := ctx.Decode(got, &msg); err != nil {
+			t.Fatalf("request-id %d: %v", ids[1], err)
+		}
+		resp := msg.Pdu.(snmp.GetResponsePdu)
+		if resp.Identifier != ids[1] || len(resp.Variables) != 1 || resp.Variables[0].Value != "router" ||
+			string(msg.Community) != "public" {
+			t.Errorf("request-id %d to %d: %+v", ids[0], ids[1], msg)
+		}
+	}
+	if _, err := setRequestId([]byte{0x30, 0x05, 0x02}, 1); err == nil {
+		t.Error("truncated message: no error")
+	}
+}
+
+// replayTestCapture returns a capture of two GETs of sysDescr and a GETNEXT with their responses
+func replayTestCapture(t *testing.T) []byte {
+	ctx := snmp.Asn1Context()
+	descr := asn1.Oid{1, 3, 6, 1, 2, 1, 1, 1, 0}
+	encode := func(pdu interface{}) []byte {
+		buf, err := ctx.Encode(snmp.Message{Version: snmp.V2C, Community: []byte("public"), Pdu: pdu})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf
+	}
+	get := func(id int) []byte {
+		return encode(snmp.GetRequestPdu{Identifier: id, Variables: nullVars([]asn1.Oid{descr})})
+	}
+	response := func(id int, value string) []byte {
+		return encode(snmp.GetResponsePdu{Identifier: id, Variables: []snmp.Variable{{Name: descr, Value: value}}})
+	}
+	manager, device := "192.0.2.10:40000", "192.0.2.1:161"
+	return writeTestPcap(linkTypeEthernet,
+		ipv4Frame(t, testPacket{manager, device, get(11)}),
+		ipv4Frame(t, testPacket{"192.0.2.11:40000", device, get(11)}), // unanswered
+		ipv4Frame(t, testPacket{device, manager, response(11, "quirky device")}),
+		ipv4Frame(t, testPacket{manager, device, get(12)}),
+		ipv4Frame(t, testPacket{device, manager, response(12, "quirky device again")}),
+		ipv4Frame(t, testPacket{manager, device, encode(snmp.GetNextRequestPdu{Identifier: 13, Variables: nullVars([]asn1.Oid{descr})})}),
+	)
+}
+
+func TestReplay(t *testing.T) {
+	ctx := snmp.Asn1Context()
+	datagrams, err := readPcapUDP(bytes.NewReader(replayTestCapture(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay := newReplay(datagrams, 161, ctx)
+	if replay.Len() != 1 {
+		t.Fatalf("%d requests, want only the answered get", replay.Len())
+	}
+
+	descr := asn1.Oid{1, 3, 6, 1, 2, 1, 1, 1, 0}
+	get := snmp.Message{Version: snmp.V2C, Community: []byte("public"),
+		Pdu: snmp.GetRequestPdu{Identifier: 4242, Variables: nullVars([]asn1.Oid{descr})}}
+	for _, want := range []string{"quirky device", "quirky device again", "quirky device"} {
+		response, ok := replay.Response(get)
+		if !ok {
+			t.Fatal("no response to the captured get")
+		}
+		var msg snmp.Message
+		if _, err := ctx.Decode(response, &msg); err != nil {
+			t.Fatal(err)
+		}
+		resp := msg.Pdu.(snmp.GetResponsePdu)
+		if resp.Identifier != 4242 || resp.Variables[0].Value != want {
+			t.Errorf("response %+v, want %q with request-id 4242", resp, want)
+		}
+	}
+
+	for _, miss := range []snmp.Message{
+		{Version: snmp.V1, Community: []byte("public"), Pdu: get.Pdu},
+		{Version: snmp.V2C, Community: []byte("public"), Pdu: snmp.GetNextRequestPdu{Identifier: 1, Variables: nullVars([]asn1.Oid{descr})}},
+	} {
+		if _, ok := replay.Response(miss); ok {
+			t.Errorf("response to %+v", miss)
+		}
+	}
+}
+
+func TestReplayServer(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "device.pcap")
+	if err := os.WriteFile(filename, replayTestCapture(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTestProgramWith(t, queryTestProg, &ServerConfig{pcapFile: filename, pcapPort: 161})
+	client, err := newClient(addr, "public", snmp.V2C, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// the captured response then the program for an OID not in the capture
+	vars, err := client.Get(asn1.Oid{1, 3, 6, 1, 2, 1, 1, 1, 0})
+	if err != nil || vars[0].Value != "quirky device" {
+		t.Errorf("captured get: %v, error %v", vars, err)
+	}
+	vars, err = client.Get(asn1.Oid{1, 3, 6, 1, 2, 1, 1, 3, 0})
+	if err != nil || vars[0].Value != snmp.TimeTicks(4200) {
+		t.Errorf("fallback get: %v, error %v", vars, err)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build linux && !(mips || mipsle || mips64 || mips64le)
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package main
+
+// soReusePort is SO_REUSEPORT from asm-generic/socket.h, the syscall package does not define it for Linux
+const soReusePort = 0xf
@@ -0,0 +1,8 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+// +build linux
+// +build mips mipsle mips64 mips64le
+
+package main
+
+// soReusePort is SO_REUSEPORT from arch/mips/include/uapi/asm/socket.h
+const soReusePort = 0x200
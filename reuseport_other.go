@@ -0,0 +1,14 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePortControl is not supported on this platform
+func reusePortControl(network string, address string, rawConn syscall.RawConn) error {
+	return errors.New("-reuseport is not supported on this platform")
+}
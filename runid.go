@@ -0,0 +1,26 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	mathrand "math/rand"
+	"os"
+	"time"
+)
+
+// runId identifies this process of snmprun, to tell which of many instances in a test a response or a log came from.
+// It is logged at startup and served by /info, the access log and the -health-oid. -run-id overrides it.
+var runId = newRunId()
+
+// newRunId returns a random (version 4) UUID
+func newRunId() string {
+	uuid := make([]byte, 16)
+	if _, err := rand.Read(uuid); err != nil {
+		// not cryptographic but still unique enough to tell instances apart
+		rng := mathrand.New(mathrand.NewSource(time.Now().UnixNano() ^ int64(os.Getpid())))
+		rng.Read(uuid)
+	}
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewRunId(t *testing.T) {
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := newRunId()
+		if !uuidPattern.MatchString(id) {
+			t.Fatalf("run id %s is not a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("run id %s repeated", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PromonLogicalis/snmp"
+)
+
+// isException reports whether a v2 variable binding value is noSuchObject, noSuchInstance or endOfMibView
+func isException(value interface{}) bool {
+	switch value.(type) {
+	case snmp.NoSuchObject, snmp.NoSuchInstance, snmp.EndOfMibView:
+		return true
+	}
+	return false
+}
+
+// firstDeclaredOid returns the OID of the first variable in the program with one
+func firstDeclaredOid(program *Program) (oidStr string, err error) {
+	var types []*Type
+	for _, typ := range program.variables.types {
+		if len(typ.oid) > 0 {
+			types = append(types, typ)
+		}
+	}
+	if len(types) == 0 {
+		return "", errors.New("Program does not declare any OIDs")
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].lineNum < types[j].lineNum
+	})
+	return types[0].oid, nil
+}
+
+// serveLocally serves the OIDs of an initialized program on an ephemeral port of the loopback address
+// and returns a client of it with the read community, and the function to stop serving
+func serveLocally(interp *Interpreter) (client *Client, stop func(), err error) {
+	const timeout = 2 * time.Second
+
+	config := &ServerConfig{
+		readCommunity:  "public",
+		writeCommunity: "private",
+		maxMsgSize:     maxDatagramSize,
+	}
+	server, err := initSNMPServer(interp, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	quitServer := make(chan bool, 1)
+	go runSNMPServer(server, quitServer, &wg)
+	stopServer := func() {
+		quitServer <- true
+		server.conn.SetReadDeadline(time.Now())
+		wg.Wait()
+		server.conn.Close()
+	}
+
+	port := server.conn.LocalAddr().(*net.UDPAddr).Port
+	client, err = newClient(net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), config.readCommunity, snmp.V2C, timeout)
+	if err != nil {
+		stopServer()
+		return nil, nil, err
+	}
+	stop = func() {
+		client.Close()
+		stopServer()
+	}
+	return client, stop, nil
+}
+
+// selftest serves the program on an ephemeral port and checks a GET of its first OID gets a value
+func selftest(program *Program, varInits VariableInits) (result string, err error) {
+	oidStr, err := firstDeclaredOid(program)
+	if err != nil {
+		return "", err
+	}
+	oid, err := strToOID(oidStr)
+	if err != nil {
+		return "", err
+	}
+
+	interp := new(Interpreter)
+	err = interp.Init(program, varInits)
+	if err != nil {
+		return "", err
+	}
+
+	client, stop, err := serveLocally(interp)
+	if err != nil {
+		return "", err
+	}
+	defer stop()
+
+	// the program sets the values, it may never finish
+	go func() {
+		err := interp.InterpProgram(program)
+		if err != nil {
+			logger.Errorf("Interpreting error: %s\n", err)
+		}
+	}()
+
+	vars, err := client.Get(oid)
+	if err != nil {
+		return "", fmt.Errorf("GET of %s failed: %v", oidStr, err)
+	}
+	if len(vars) != 1 || vars[0].Name.String() != oidStr {
+		return "", fmt.Errorf("GET of %s got the wrong variables: %v", oidStr, vars)
+	}
+	if isException(vars[0].Value) {
+		return "", fmt.Errorf("GET of %s got %T", oidStr, vars[0].Value)
+	}
+	return fmt.Sprintf("%s = %v", oidStr, vars[0].Value), nil
+}
+
+// runSelftest is the selftest subcommand returning the exit status
+// snmprun selftest [-V key=value] program.sim
+func runSelftest(args []string) int {
+	varInits := make(VariableInits)
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	flags.Var(&varInits, "V", "variable initializers")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Print("Missing filename to test\n")
+		return 1
+	}
+	logger = newLevelLogger(os.Stderr, "snmpsim", log.LstdFlags, LogWarn)
+
+	program, err := loadProgramAs(flags.Arg(0), "", nil)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	result, err := selftest(program, varInits)
+	if err != nil {
+		fmt.Printf("selftest failed: %s\n", err)
+		return 1
+	}
+	fmt.Printf("selftest passed: %s\n", result)
+	return 0
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelftest(t *testing.T) {
+	prog := `
+var
+  descr: 2.1.1.1.0 string
+  uptime: 2.1.1.3.0 timeticks
+endvar
+run
+  descr = "selftest"
+  loop
+    sleep 10 msecs
+  endloop
+endrun`
+	program, _ := parseTestProgram(t, prog)
+	result, err := selftest(program, make(VariableInits))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(result, ".1.3.6.1.2.1.1.1.0 = ") {
+		t.Errorf("result = %s", result)
+	}
+}
+
+func TestSelftestNoOids(t *testing.T) {
+	prog := `
+var
+  count: integer
+endvar
+run
+endrun`
+	program, _ := parseTestProgram(t, prog)
+	if _, err := selftest(program, make(VariableInits)); err == nil {
+		t.Error("expected error for a program with no OIDs")
+	}
+}
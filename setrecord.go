@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// SetRecorder appends an assignment statement to a file for each variable set by an SNMP SET, so a session of
+// configuring the device from a manager can be pasted into the run section of a program to reproduce it.
+type SetRecorder struct {
+	lock     sync.Mutex
+	filename string
+	file     *os.File
+}
+
+// openSetRecorder opens the file to append the SETs to, creating it if need be
+func openSetRecorder(filename string) (*SetRecorder, error) {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &SetRecorder{filename: filename, file: file}, nil
+}
+
+// Record appends the assignment of a value set to a variable with the time as a comment.
+// The instances of a range can not be assigned by a statement so they are commented out.
+// The file is written at once so no SET is lost if snmprun is killed.
+func (recorder *SetRecorder) Record(id string, val *Value, now time.Time) error {
+	statement := fmt.Sprintf("%s = %s // %s\n", id, literalText(val), now.UTC().Format(time.RFC3339))
+	if strings.Contains(id, ".") {
+		statement = "// " + statement
+	}
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	_, err := recorder.file.WriteString(statement)
+	return err
+}
+
+// Close closes the file
+func (recorder *SetRecorder) Close() error {
+	return recorder.file.Close()
+}
+
+// literalText formats a value as a literal of the language, which parses back to the same value
+func literalText(val *Value) string {
+	switch val.valueType {
+	case ValueInteger, ValueCounter, ValueGuage, ValueTimeticks:
+		return fmt.Sprintf("%d", val.intVal)
+	case ValueCounter64:
+		return fmt.Sprintf("%d", val.counter64Val)
+	case ValueString:
+		if isPlainString(val.stringVal) {
+			return `"` + val.stringVal + `"`
+		}
+		// a string literal has no escapes so binary values and quotes need hex
+		return fmt.Sprintf("0x%X", val.stringVal)
+	case ValueBitset:
+		return strings.Replace(strings.Replace(val.bitsetVal.String(), "{", "[", 1), "}", "]", 1)
+	case ValueInetAddress:
+		return `"` + val.inetVal.String() + `"`
+	}
+	return formatValue(val)
+}
+
+// isPlainString returns true if the string can be written between quotes as a string literal
+func isPlainString(str string) bool {
+	if !utf8.ValidString(str) {
+		return false
+	}
+	for _, r := range str {
+		if r == '"' || r < ' ' || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// SetSetRecorder sets where the variables set by SNMP SETs are recorded as statements
+func (interp *Interpreter) SetSetRecorder(recorder *SetRecorder) {
+	interp.setRecorder = recorder
+}
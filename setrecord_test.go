@@ -0,0 +1,145 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+const setRecordTestVars = `
+var
+  contact: 2.1.1.4.0 rw string = "nobody"
+  phys-addr: 2.1.2.2.1.6.1 rw string
+  level: 4.1.99.2.0 rw integer
+  speed: 4.1.99.4.0 rw guage
+  since: 4.1.99.5.0 rw timeticks
+  peer: 4.1.99.6.0 rw ipaddress
+  object: 4.1.99.7.0 rw oid
+  flags: 4.1.99.1.0 rw bitset
+  ifAlias.[1..2]: 2.1.31.1.1.1.18 rw string
+  hosts: 4.1.99.1.1 table {
+    name: 2 string,
+    status: 3 rowstatus
+  }
+endvar
+`
+
+func TestRecordSets(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "sets.sim")
+	recorder, err := openSetRecorder(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := Parse("record", setRecordTestVars+"run\nendrun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logger == nil {
+		logger = newLevelLogger(ioutil.Discard, "", 0, LogError)
+	}
+	interp := new(Interpreter)
+	interp.SetSetRecorder(recorder)
+	if err := interp.Init(program, nil); err != nil {
+		t.Fatal(err)
+	}
+	agent := NewAgent()
+	if err := addProgramOIDs(agent, interp, false); err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]interface{}{
+		"1.3.6.1.2.1.1.4.0":         "ops team",
+		"1.3.6.1.2.1.2.2.1.6.1":     "\x00\x0a\"\x0c\r\n",
+		"1.3.6.1.4.1.99.2.0":        -7,
+		"1.3.6.1.4.1.99.4.0":        snmp.Unsigned32(1000),
+		"1.3.6.1.4.1.99.5.0":        snmp.TimeTicks(360000),
+		"1.3.6.1.4.1.99.6.0":        snmp.IPAddress{10, 1, 2, 3},
+		"1.3.6.1.4.1.99.7.0":        asn1.Oid{1, 3, 6, 1, 4, 1, 9},
+		"1.3.6.1.4.1.99.1.0":        "\x50",
+		"1.3.6.1.2.1.31.1.1.1.18.2": "uplink",
+		"1.3.6.1.4.1.99.1.1.3.7":    RowStatusCreateAndGo,
+	}
+	var oids []string
+	for oid := range values {
+		oids = append(oids, oid)
+	}
+	resp := request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{Variables: oidVars(t, values, oids...)})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("set status %d index %d", resp.ErrorStatus, resp.ErrorIndex)
+	}
+	// a failed SET is not recorded
+	resp = request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{"1.3.6.1.4.1.99.2.0": "wrong"}, "1.3.6.1.4.1.99.2.0")})
+	if resp.ErrorStatus == snmp.NoError {
+		t.Fatal("set of the wrong type succeeded")
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != len(values)-1 {
+		t.Errorf("recorded %d statements, want %d without the table row:\n%s", len(lines), len(values)-1, data)
+	}
+	text := "\n" + string(data)
+	if !strings.Contains(text, "\ncontact = \"ops team\" // ") || !strings.Contains(text, "\nphys-addr = 0x000A220C0D0A // ") ||
+		!strings.Contains(text, "\n// ifAlias.2 = \"uplink\" // ") {
+		t.Errorf("recorded:\n%s", data)
+	}
+
+	// the statements give the same values when run by the program
+	replayed, err := Parse("replay", setRecordTestVars+"run\n"+string(data)+"endrun")
+	if err != nil {
+		t.Fatalf("%v in:\n%s", err, data)
+	}
+	replayInterp := new(Interpreter)
+	if err := replayInterp.Init(replayed, nil); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- replayInterp.InterpProgram(replayed) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("replayed program did not finish")
+	}
+	for _, id := range []string{"contact", "phys-addr", "level", "speed", "since", "peer", "object", "flags"} {
+		want, _ := interp.GetValueForId(id)
+		got, _ := replayInterp.GetValueForId(id)
+		if formatValue(got) != formatValue(want) {
+			t.Errorf("%s = %s, want %s", id, formatValue(got), formatValue(want))
+		}
+	}
+}
+
+func TestLiteralText(t *testing.T) {
+	tests := []struct {
+		val  Value
+		want string
+	}{
+		{Value{valueType: ValueString, stringVal: "Zürich"}, `"Zürich"`},
+		{Value{valueType: ValueString, stringVal: "say \"hi\""}, "0x7361792022686922"},
+		{Value{valueType: ValueString, stringVal: "\xff"}, "0xFF"},
+		{Value{valueType: ValueString}, `""`},
+		{Value{valueType: ValueCounter64, counter64Val: 18446744073709551615}, "18446744073709551615"},
+		{Value{valueType: ValueBitset, bitsetVal: BitsetMap{1: true, 3: true}}, "[1, 3]"},
+		{Value{valueType: ValueOid, oidVal: ".1.3.6.1"}, ".1.3.6.1"},
+	}
+	for _, test := range tests {
+		if got := literalText(&test.val); got != test.want {
+			t.Errorf("%+v = %s, want %s", test.val, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+// The type tags of snmprec files, which are the BER tags of the types
+const (
+	snmprecInteger   = 2
+	snmprecString    = 4
+	snmprecNull      = 5
+	snmprecOid       = 6
+	snmprecIPAddress = 64
+	snmprecCounter32 = 65
+	snmprecGauge32   = 66
+	snmprecTimeTicks = 67
+	snmprecOpaque    = 68
+	snmprecCounter64 = 70
+)
+
+// snmprecValueTypes are the value types of the snmprec type tags which a program can serve
+var snmprecValueTypes = map[int]ValueType{
+	snmprecInteger:   ValueInteger,
+	snmprecString:    ValueString,
+	snmprecOid:       ValueOid,
+	snmprecIPAddress: ValueIpv4address,
+	snmprecCounter32: ValueCounter,
+	snmprecGauge32:   ValueGuage,
+	snmprecTimeTicks: ValueTimeticks,
+	snmprecCounter64: ValueCounter64,
+}
+
+// parseSnmprecProgram makes a program with no statements which serves the values of an snmprec data file of
+// snmpsim, returning the number of OIDs skipped as their types can not be served, such as NULL and Opaque
+// A variation module such as 2:numeric is served as a static value, the value= or initial= of its
+// parameters or the zero value.
+func parseSnmprecProgram(input []byte) (program *Program, skipped int, err error) {
+	vars := &Variables{
+		types:        make(map[string]*Type),
+		typesFromOid: make(map[string]*Type),
+		intAliases:   make(map[string]int),
+		tables:       make(map[string]*Table),
+		oidAliases:   make(map[string]string),
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(input))
+	scanner.Buffer(nil, 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		typ, err := parseSnmprecLine(line, lineNum)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Line %d: %v", lineNum, err)
+		}
+		if typ == nil {
+			skipped++
+			continue
+		}
+		if _, ok := vars.typesFromOid[typ.oid]; ok {
+			return nil, 0, fmt.Errorf("Line %d: OID %s is already declared", lineNum, typ.oid)
+		}
+		vars.types[typ.id] = typ
+		vars.typesFromOid[typ.oid] = typ
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	return &Program{variables: vars}, skipped, nil
+}
+
+// parseSnmprecLine returns the type of an oid|tag|value line with its value as the initial value,
+// nil for a type which can not be served
+// The tag is suffixed by x for a value in hex, and followed by :module for a variation module.
+func parseSnmprecLine(line string, lineNum int) (*Type, error) {
+	fields := strings.SplitN(line, "|", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("Invalid line %q, expecting oid|tag|value", line)
+	}
+	oidStr, tagStr, text := fields[0], fields[1], fields[2]
+	variation := false
+	if i := strings.Index(tagStr, ":"); i >= 0 {
+		tagStr = tagStr[:i]
+		variation = true
+	}
+	hexValue := strings.HasSuffix(tagStr, "x")
+	tag, err := strconv.Atoi(strings.TrimSuffix(tagStr, "x"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid type tag %s of %s", fields[1], oidStr)
+	}
+	valueType, ok := snmprecValueTypes[tag]
+	if !ok {
+		return nil, nil
+	}
+
+	typ := &Type{lineNum: lineNum, valueType: valueType}
+	typ.oid, err = canonicalOid(oidStr)
+	if err != nil || len(oidStr) == 0 {
+		return nil, fmt.Errorf("Invalid OID %s", oidStr)
+	}
+	typ.id = typ.oid
+	typ.initValue = &Value{valueType: valueType}
+	if variation {
+		text = snmprecVariationValue(text)
+	}
+	if len(text) == 0 {
+		return typ, nil
+	}
+	if hexValue {
+		octets, err := hex.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid hex value of %s: %v", oidStr, err)
+		}
+		switch valueType {
+		case ValueString:
+			typ.initValue.stringVal = string(octets)
+			return typ, nil
+		case ValueIpv4address:
+			if len(octets) != net.IPv4len {
+				return nil, fmt.Errorf("Invalid IpAddress of %s, expecting 4 octets", oidStr)
+			}
+			text = net.IP(octets).String()
+		default:
+			return nil, fmt.Errorf("Invalid hex value of %s of type tag %d", oidStr, tag)
+		}
+	}
+	err = textToValue(strings.TrimPrefix(text, "."), typ.initValue, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid value of %s: %v", oidStr, err)
+	}
+	return typ, nil
+}
+
+// snmprecVariationValue returns the value in the parameters of a variation module, e.g. value=5 of
+// min=1,max=10,value=5, or an empty string for none
+func snmprecVariationValue(params string) string {
+	for _, param := range strings.Split(params, ",") {
+		if strings.HasPrefix(param, "value=") || strings.HasPrefix(param, "initial=") {
+			return param[strings.Index(param, "=")+1:]
+		}
+	}
+	return ""
+}
+
+// snmprecLine returns the line of an snmprec file for an OID and the value it is served with,
+// false for a value with no snmprec type
+// A string that is not printable ASCII is hex with the type tag suffixed by x, as snmpsim writes it.
+func snmprecLine(oidStr string, value interface{}) (line string, ok bool) {
+	oidStr = strings.TrimPrefix(oidStr, ".")
+	switch x := value.(type) {
+	case int:
+		return fmt.Sprintf("%s|%d|%d", oidStr, snmprecInteger, x), true
+	case string:
+		if isPrintableASCII(x) {
+			return fmt.Sprintf("%s|%d|%s", oidStr, snmprecString, x), true
+		}
+		return fmt.Sprintf("%s|%dx|%s", oidStr, snmprecString, hex.EncodeToString([]byte(x))), true
+	case asn1.Oid:
+		return fmt.Sprintf("%s|%d|%s", oidStr, snmprecOid, strings.TrimPrefix(x.String(), ".")), true
+	case snmp.IPAddress:
+		return fmt.Sprintf("%s|%d|%s", oidStr, snmprecIPAddress, net.IP(x[:])), true
+	case snmp.Counter32:
+		return fmt.Sprintf("%s|%d|%d", oidStr, snmprecCounter32, x), true
+	case snmp.Unsigned32:
+		return fmt.Sprintf("%s|%d|%d", oidStr, snmprecGauge32, x), true
+	case snmp.TimeTicks:
+		return fmt.Sprintf("%s|%d|%d", oidStr, snmprecTimeTicks, x), true
+	case snmp.Counter64:
+		return fmt.Sprintf("%s|%d|%d", oidStr, snmprecCounter64, x), true
+	case snmp.Opaque:
+		return fmt.Sprintf("%s|%dx|%s", oidStr, snmprecOpaque, hex.EncodeToString([]byte(x))), true
+	case asn1.Null:
+		return fmt.Sprintf("%s|%d|", oidStr, snmprecNull), true
+	}
+	return "", false
+}
+
+// isPrintableASCII reports whether a string is printable ASCII, which an snmprec value can be written as
+func isPrintableASCII(str string) bool {
+	for i := 0; i < len(str); i++ {
+		if str[i] < ' ' || str[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// exportSnmprec writes the values the program serves as an snmprec file of snmpsim, an oid|type-tag|value line
+// for each OID in numeric order. The file has no tables, as they have no rows until created, and no behaviour
+// such as rates, just the values served at the start.
+func exportSnmprec(out io.Writer, interp *Interpreter) error {
+	oids, values, err := servedSnmpValues(interp)
+	if err != nil {
+		return err
+	}
+	for _, oidStr := range oids {
+		line, ok := snmprecLine(oidStr, values[oidStr])
+		if !ok {
+			logger.Warnf("%s is not exported as its value %T has no snmprec type\n", oidStr, values[oidStr])
+			continue
+		}
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,31 +1,42 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"net"
 	"os"
+	"os/signal"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/PromonLogicalis/asn1"
 	"github.com/PromonLogicalis/snmp"
 )
 
-var logger *log.Logger
+var logger *LevelLogger
 
 // Convert OID in string format to OID in uint slice format
 func strToOID(str string) (oid asn1.Oid, err error) {
-	str = strings.TrimPrefix(str, ".") // remove leading dot
-	subStrings := strings.Split(str, ".")
+	if len(str) == 0 {
+		return nil, errors.New("OID is empty")
+	}
+	trimmed := strings.TrimPrefix(str, ".") // remove leading dot
+	subStrings := strings.Split(trimmed, ".")
 	oid = make(asn1.Oid, len(subStrings))
 	for i, componentStr := range subStrings {
+		if len(componentStr) == 0 {
+			return nil, fmt.Errorf("OID component %d is empty in '%s'", i+1, str)
+		}
 		x, err := strconv.ParseUint(componentStr, 10, 32)
 		if err != nil {
 			return nil, err
@@ -35,6 +46,64 @@ func strToOID(str string) (oid asn1.Oid, err error) {
 	return oid, nil
 }
 
+// oidKeyLen is the length of the buffer on the stack an OID is written to to look it up, enough for most OIDs
+const oidKeyLen = 128
+
+// appendOid appends the OID in string format as asn1.Oid.String gives it, e.g. .1.3.6.1.2.1.1.3.0
+func appendOid(dst []byte, oid asn1.Oid) []byte {
+	for _, component := range oid {
+		dst = append(dst, '.')
+		dst = strconv.AppendUint(dst, uint64(component), 10)
+	}
+	return dst
+}
+
+// compareOIDs compares two OIDs numerically component by component
+// returning -1 if a is before b, 0 if they are equal and 1 if a is after b.
+// A prefix of an OID is before it.
+func compareOIDs(a, b asn1.Oid) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+// sortOIDStrings sorts OIDs in string format into numeric OID order
+// (a string sort would put 1.3.6.1.2.1.10 before 1.3.6.1.2.1.2)
+func sortOIDStrings(oidStrs []string) error {
+	// OIDs are parsed once rather than looked up by string for each comparison
+	type parsedOid struct {
+		str string
+		oid asn1.Oid
+	}
+	parsed := make([]parsedOid, len(oidStrs))
+	for i, str := range oidStrs {
+		oid, err := strToOID(str)
+		if err != nil {
+			return err
+		}
+		parsed[i] = parsedOid{str, oid}
+	}
+	sort.Slice(parsed, func(i, j int) bool {
+		return compareOIDs(parsed[i].oid, parsed[j].oid) < 0
+	})
+	for i := range parsed {
+		oidStrs[i] = parsed[i].str
+	}
+	return nil
+}
+
 func strToAddr(str string) (addr snmp.IPAddress, err error) {
 	for i, component := range strings.Split(str, ".") {
 		x, err := strconv.Atoi(component)
@@ -46,6 +115,8 @@ func strToAddr(str string) (addr snmp.IPAddress, err error) {
 	return addr, nil
 }
 
+// convertBitsetToOctetStr packs a bitset into an OCTET STRING like the BITS construct of SMIv2 (RFC 2578 section 7.1.4):
+// bit 0 is the most significant bit of the first octet, bit 8 of the second and so on
 func convertBitsetToOctetStr(bitset BitsetMap) string {
 	var maxK uint
 	// get highest key in the set
@@ -65,13 +136,14 @@ func convertBitsetToOctetStr(bitset BitsetMap) string {
 	return string(byteArr)
 }
 
+// convertOctetStrToBitset unpacks a BITS OCTET STRING, the reverse of convertBitsetToOctetStr
 func convertOctetStrToBitset(str string) (bitset BitsetMap) {
 	bitset = make(BitsetMap)
 	bytes := []byte(str)
 	var j uint
 	for i, b := range bytes {
 		for j = 0; j < 8; j++ {
-			if (b & (1 << j)) > 0 {
+			if (b & (1 << (7 - j))) > 0 {
 				bitset[uint(i)*8+j] = true
 			}
 		}
@@ -106,221 +178,1220 @@ func convertBytesToOctetStr(values map[string]uint, fieldInfo FieldInfo) (str st
 	return str, nil
 }
 
-func addOIDFunc(agent *snmp.Agent, interp *Interpreter, strOid string, snmpMode SnmpMode) {
+// convertValueToSnmp converts an interpreter value into the type encoded by the snmp library
+func convertValueToSnmp(val *Value, typ *Type) (interface{}, error) {
+	switch val.valueType {
+	case ValueInteger:
+		return val.intVal, nil
+	case ValueCounter:
+		return snmp.Counter32(val.intVal), nil
+	case ValueCounter64:
+		return snmp.Counter64(val.counter64Val), nil
+	case ValueTimeticks:
+		return snmp.TimeTicks(val.intVal), nil
+	case ValueGuage:
+		// a Gauge32 latches at its maximum rather than wrapping (RFC 2578)
+		switch {
+		case val.intVal < 0:
+			return snmp.Unsigned32(0), nil
+		case uint64(val.intVal) > math.MaxUint32:
+			return snmp.Unsigned32(math.MaxUint32), nil
+		}
+		return snmp.Unsigned32(val.intVal), nil
+	case ValueString:
+		// devices can cap the length of strings such as descriptions
+		if typ != nil && typ.maxLength > 0 && uint(len(val.stringVal)) > typ.maxLength {
+			return val.stringVal[:typ.maxLength], nil
+		}
+		return val.stringVal, nil
+	case ValueBitset:
+		return convertBitsetToOctetStr(val.bitsetVal), nil
+	case ValueBytes:
+		return convertBytesToOctetStr(val.bytesVal, typ.fieldInfo)
+	case ValueOid:
+		oid, err := strToOID(val.oidVal)
+		if err != nil {
+			return nil, err
+		}
+		return oid, nil
+	case ValueIpv4address:
+		addr, err := strToAddr(val.addrVal)
+		if err != nil {
+			return nil, err
+		}
+		return addr, nil
+	case ValueInetAddress:
+		return val.inetVal.octets(), nil
+	}
+	return nil, ErrIllegalValue
+}
+
+func addOIDFunc(agent *Agent, interp *Interpreter, strOid string, snmpMode SnmpMode) {
 	if len(strOid) == 0 {
-		logger.Println("Empty oid")
+		logger.Errorf("Empty oid\n")
 		return
 	}
 	oid, err := strToOID(strOid)
 	if err != nil {
-		logger.Printf("Bad oid %v (%s) - should not happen\n", oid, strOid)
+		logger.Errorf("Bad oid %v (%s) - should not happen\n", oid, strOid)
 		return
 	}
+	readFunc, writeFunc := oidFuncs(interp, snmpMode)
+	agent.addManagedObject(newOIDObject(oid, snmpMode, readFunc, writeFunc))
+}
+
+// newOIDObject returns the object serving a variable's OID in its mode
+func newOIDObject(oid asn1.Oid, snmpMode SnmpMode, readFunc GetHandler, writeFunc SetHandler) *ManagedObject {
+	if snmpMode == SnmpModeRead {
+		return &ManagedObject{oid: oid, getter: readFunc}
+	}
+	return &ManagedObject{oid: oid, getter: readFunc, setter: writeFunc}
+}
+
+// checkSetValue returns the value a SET of the SNMP value gives the variable, or why it can not be set
+func (interp *Interpreter) checkSetValue(typ *Type, oidStr string, value interface{}) (*Value, error) {
+	val := new(Value)
+	if typ.writableFor > 0 && interp.Uptime() >= typ.writableFor {
+		return nil, oidErrorf(oidStr, ErrNotWritable, "Only writable for %s after the start", typ.writableFor)
+	}
+	val.valueType = typ.valueType
+	switch typ.valueType {
+	case ValueString:
+		switch value.(type) {
+		case string:
+			val.stringVal = value.(string)
+			if typ.maxLength > 0 && uint(len(val.stringVal)) > typ.maxLength {
+				return nil, oidErrorf(oidStr, ErrWrongLength, "String of length %d is longer than %d", len(val.stringVal), typ.maxLength)
+			}
+		default:
+			return nil, oidErrorf(oidStr, ErrTypeMismatch, "Bad string type %T", value)
+		}
+	case ValueInteger:
+		switch value.(type) {
+		case int:
+			val.intVal = value.(int)
+			if typ.valueRange != nil && !typ.valueRange.contains(val.intVal) {
+				return nil, oidErrorf(oidStr, ErrWrongValue, "Integer %d is outside the range %s", val.intVal, typ.valueRange)
+			}
+		default:
+			return nil, oidErrorf(oidStr, ErrTypeMismatch, "Bad int type %T", value)
+		}
+	case ValueCounter, ValueCounter64:
+		// Apparently one is not allowed to set a counter
+		return nil, oidErrorf(oidStr, ErrNotWritable, "Cannot set counter type")
+	case ValueBytes:
+		return nil, oidErrorf(oidStr, ErrNotWritable, "Not supporting set bytes yet")
+	case ValueTimeticks:
+		switch value.(type) {
+		case snmp.TimeTicks:
+			val.intVal = int(value.(snmp.TimeTicks))
+		default:
+			return nil, oidErrorf(oidStr, ErrTypeMismatch, "Bad time ticks type %T", value)
+		}
+	case ValueGuage:
+		switch value.(type) {
+		case snmp.Unsigned32:
+			val.intVal = int(value.(snmp.Unsigned32))
+		default:
+			return nil, oidErrorf(oidStr, ErrTypeMismatch, "Bad guage type %T", value)
+		}
+	case ValueOid:
+		switch value.(type) {
+		case asn1.Oid:
+			oid := value.(asn1.Oid)
+			val.oidVal = oid.String()
+		default:
+			return nil, oidErrorf(oidStr, ErrTypeMismatch, "Bad OID type %T", value)
+		}
+	case ValueIpv4address:
+		switch value.(type) {
+		case snmp.IPAddress:
+			addr := value.(snmp.IPAddress)
+			val.addrVal = addr.String()
+		default:
+			return nil, oidErrorf(oidStr, ErrTypeMismatch, "Bad ip address type %T", value)
+		}
+	case ValueInetAddress:
+		octets, ok := value.(string)
+		if !ok {
+			return nil, oidErrorf(oidStr, ErrTypeMismatch, "Bad inet address type %T", value)
+		}
+		inet, err := inetAddressFromOctets(octets)
+		if err != nil {
+			return nil, oidErrorf(oidStr, ErrWrongLength, "%v", err)
+		}
+		val.inetVal = inet
+	case ValueBitset:
+		switch value.(type) {
+		case string:
+			str := value.(string)
+			val.bitsetVal = convertOctetStrToBitset(str)
+		default:
+			return nil, oidErrorf(oidStr, ErrTypeMismatch, "Bad bitset type %T", value)
+		}
+	}
+	return val, nil
+}
+
+// commitSetValue sets the variable to the value of a SET, which checkSetValue has checked
+func (interp *Interpreter) commitSetValue(ctx context.Context, typ *Type, oidStr string, val *Value, snmpMode SnmpMode) {
+	if info, ok := RequestInfoFrom(ctx); ok {
+		logger.Debugf("Set of %s (%s) with community %s\n", oidStr, typ.id, info.Community)
+	}
+	switch snmpMode {
+	case SnmpModeReadWrite:
+		// update variable data under locking
+		interp.SetValueForIdOid(typ.id, oidStr, val)
+	case SnmpModeReadWriteBlocked:
+		// use a blocking channel to send data
+		typ.externalValue <- val
+	}
+	interp.recordSet(typ, val)
+}
 
+// oidFuncs returns the handlers reading and writing the values of the variables served in the mode, which look up
+// the variable by the OID of the request so the same ones serve every OID
+func oidFuncs(interp *Interpreter, snmpMode SnmpMode) (readFunc GetHandler, writeFunc SetHandler) {
 	// given OID store away the provided value
-	writeFunc := func(oid asn1.Oid, value interface{}) error {
-		val := new(Value)
+	writeFunc = func(ctx context.Context, oid asn1.Oid, value interface{}) (func() error, error) {
 		oidStr := oid.String()
+		typ, found := interp.GetTypeForOid(oidStr)
+		if !found {
+			return nil, &OIDError{Oid: oidStr, Kind: ErrUnknownOID}
+		}
+		val, err := interp.checkSetValue(typ, oidStr, value)
+		if err != nil {
+			return nil, err
+		}
+		//fmt.Printf("received value of %v for oid %s\n", val, oidStr)
+		return func() error {
+			interp.commitSetValue(ctx, typ, oidStr, val, snmpMode)
+			return nil
+		}, nil
+	}
+
+	// given OID return its value
+	readFunc = func(ctx context.Context, oid asn1.Oid) (interface{}, error) {
+		// the OID of the variable is its type's, so a GET of one allocates no string for it
+		typ, found := interp.GetTypeForNumericOid(oid)
+		var oidStr string
+		if found {
+			oidStr = typ.oid
+		} else {
+			oidStr = oid.String()
+		}
+		//fmt.Printf("callback: oid: %s\n", oidStr)
+		//fmt.Printf("oid values: %v\n", interp.oid2Values)
+		if typ != nil && typ.latency > 0 {
+			// like an expensive object of a real device
+			time.Sleep(typ.latency)
+		}
+		val, err := interp.valueSource(typ, oidStr).Resolve(ctx)
+		if err != nil {
+			return nil, err
+		}
+		value, err := convertValueToSnmp(val, typ)
+		if err != nil {
+			return nil, oidErrorf(oidStr, ErrIllegalValue, "%v", err)
+		}
+		return value, nil
+	}
+	return readFunc, writeFunc
+}
+
+// addOIDAliasFunc serves the current value of the target OID for the alias OID, from the same source as the target
+func addOIDAliasFunc(agent *Agent, interp *Interpreter, aliasOidStr string, targetOidStr string) {
+	aliasOid, err := strToOID(aliasOidStr)
+	if err != nil {
+		logger.Errorf("Bad alias oid %s - should not happen\n", aliasOidStr)
+		return
+	}
+	readFunc := func(ctx context.Context, oid asn1.Oid) (interface{}, error) {
+		typ, _ := interp.GetTypeForOid(targetOidStr)
+		val, err := interp.valueSource(typ, targetOidStr).Resolve(ctx)
+		if err != nil {
+			return nil, err
+		}
+		value, err := convertValueToSnmp(val, typ)
+		if err != nil {
+			return nil, oidErrorf(targetOidStr, ErrIllegalValue, "%v", err)
+		}
+		return value, nil
+	}
+	agent.AddRoManagedObject(aliasOid, readFunc)
+}
+
+// agentSnmpMode is the mode the agent serves a variable in
+func agentSnmpMode(typ *Type) SnmpMode {
+	if typ.access == AccessReadOnly {
+		// the program may still set it, or read it in rw mode
+		return SnmpModeRead
+	}
+	return typ.snmpMode
+}
+
+// agentPresence serves and stops serving the OIDs of variables for appear and disappear statements
+type agentPresence struct {
+	agent  *Agent
+	interp *Interpreter
+}
+
+func (presence agentPresence) SetPresent(typ *Type, present bool) {
+	if present {
+		addOIDFunc(presence.agent, presence.interp, typ.oid, agentSnmpMode(typ))
+		return
+	}
+	oid, err := strToOID(typ.oid)
+	if err == nil {
+		presence.agent.RemoveManagedObject(oid)
+	}
+}
+
+// addProgramOIDs sets up the agent to serve the OIDs of the program
+func addProgramOIDs(agent *Agent, interp *Interpreter, stdMib bool) error {
+	// the objects are added in one go, which sorts them once, as large programs have 100,000s of OIDs
+	readFunc, writeFunc := oidFuncs(interp, SnmpModeReadWrite)
+	_, blockedWriteFunc := oidFuncs(interp, SnmpModeReadWriteBlocked)
+	writeFuncs := map[SnmpMode]SetHandler{SnmpModeReadWrite: writeFunc, SnmpModeReadWriteBlocked: blockedWriteFunc}
+	objects := make([]*ManagedObject, 0, len(interp.oid2Values))
+	for oidStr := range interp.oid2Values {
 		typ := interp.variables.typesFromOid[oidStr]
-		switch typ.valueType {
-		case ValueString:
-			switch value.(type) {
-			case string:
-				val.stringVal = value.(string)
-			default:
-				return errors.New("Bad string type")
-			}
-		case ValueInteger:
-			switch value.(type) {
-			case int:
-				val.intVal = value.(int)
-			default:
-				return errors.New("Bad int type")
-			}
-		case ValueCounter:
-			// Apparently one is not allowed to set a counter
-			return errors.New("Cannot set counter type")
-		case ValueBytes:
-			return errors.New("Not supporting set bytes yet")
-		case ValueTimeticks:
-			switch value.(type) {
-			case snmp.TimeTicks:
-				val.intVal = int(value.(snmp.TimeTicks))
-			default:
-				return errors.New("Bad time ticks type")
-			}
-		case ValueGuage:
-			switch value.(type) {
-			case snmp.Unsigned32:
-				val.intVal = int(value.(snmp.Unsigned32))
-			default:
-				return errors.New("Bad guage type")
-			}
-		case ValueOid:
-			switch value.(type) {
-			case asn1.Oid:
-				oid := value.(asn1.Oid)
-				val.oidVal = oid.String()
-			default:
-				return errors.New("Bad OID type")
-			}
-		case ValueIpv4address:
-			switch value.(type) {
-			case snmp.IPAddress:
-				addr := value.(snmp.IPAddress)
-				val.addrVal = addr.String()
-			default:
-				return errors.New("Bad ip address type")
-			}
-		case ValueBitset:
-			switch value.(type) {
-			case string:
-				str := value.(string)
-				val.bitsetVal = convertOctetStrToBitset(str)
-			default:
-				return errors.New("Bad bitset type")
+		if typ.absent {
+			continue
+		}
+		oid, err := strToOID(oidStr)
+		if err != nil {
+			return err
+		}
+		snmpMode := agentSnmpMode(typ)
+		objects = append(objects, newOIDObject(oid, snmpMode, readFunc, writeFuncs[snmpMode]))
+	}
+	agent.addManagedObjects(objects)
+	interp.SetOidPresence(agentPresence{agent: agent, interp: interp})
+	agent.SetDeclaredFunc(func(oid asn1.Oid) bool {
+		_, declared := interp.variables.typesFromOid[oid.String()]
+		return declared
+	})
+	for _, table := range interp.variables.tables {
+		err := addTableFunc(agent, interp, table)
+		if err != nil {
+			return err
+		}
+	}
+	for aliasOid, targetOid := range interp.aliasOids {
+		addOIDAliasFunc(agent, interp, aliasOid, targetOid)
+	}
+	if stdMib {
+		addStandardMib(agent, interp)
+	}
+	return nil
+}
+
+// ServerConfig holds the command line options for the SNMP server
+type ServerConfig struct {
+	portNum         uint          // port to listen for requests on
+	readCommunity   string        // read-only community name
+	writeCommunity  string        // read-write community name
+	replyAddr       string        // local address to send responses from, empty means the listening socket
+	replyBroadcast  bool          // respond to requests sent to a broadcast or multicast address
+	maxMsgSize      uint          // largest response message to send, larger ones get a tooBig response
+	rcvBufSize      uint          // socket receive buffer size, 0 for the system default
+	sndBufSize      uint          // socket send buffer size, 0 for the system default
+	stdMib          bool          // serve placeholders for undeclared MIB-II system group objects
+	vendor          string        // serve the sysObjectID of the vendor if undeclared, empty for none
+	maxVarbinds     uint          // requests with more variable bindings get maxVarbindsResp, 0 for no limit
+	maxVarbindsResp string        // tooBig, genErr or drop
+	readOnly        bool          // refuse all SET requests
+	startupDelay    time.Duration // time after binding before requests are answered
+	startupResp     string        // genErr or drop during the startup delay
+	unsupportedPdu  string        // response to an inform: genErr or drop
+	scalarLeniency  string        // GET of a scalar without .0: strict for noSuchInstance or lenient for the scalar
+	listenAddrs     ListenAddrs   // addresses to listen on, all of them if empty
+	accessLogFile   string        // file to log each request to, - for stdout, empty for none
+	accessLogFormat string        // text or json
+	maxInflight     uint          // requests processed at once, more are dropped, 0 for one at a time per socket
+	healthOid       string        // OID to serve the uptime and request count of snmprun under, empty for none
+	reusePort       bool          // set SO_REUSEPORT on the listening sockets to share the port with other processes
+	maxWalk         uint          // OIDs a walk returns before endOfMibView, 0 for no limit
+	engine          *EngineConfig // served in the snmpEngine group, nil for none
+	clockOid        string        // OID to serve the manual clocks under for SETs to advance them, empty for none
+
+	authLockout       uint          // requests with a bad community within the window that lock out a source, 0 for none
+	authLockoutWindow time.Duration // window the bad community requests are counted in
+	authLockoutTime   time.Duration // how long a source is locked out for
+	authLockoutResp   string        // response to a locked out source: drop or authorizationError
+
+	pcapFile   string // capture of a device whose responses are replayed, empty for none
+	pcapPort   uint   // port of the device in the capture
+	recordFile string // capture to write the requests and responses to, empty for none
+
+	corruptRate float64 // fraction of the responses whose encoding is broken, 0 for none
+	seed        int64   // of the random numbers of the server, such as which responses are corrupted
+
+	responseCommunity string // community of every response instead of the request's, empty to echo it
+
+	backends       bool          // serve the variables fetched from http backends
+	backendTimeout time.Duration // how long a read waits for a backend before the last value is served
+	backendCache   time.Duration // how long a value fetched is served again, unless the program says
+}
+
+// SNMPServer holds the agent and the sockets it serves on
+type SNMPServer struct {
+	agent     *Agent
+	conn      *net.UDPConn   // socket requests are read from
+	moreConns []*net.UDPConn // sockets of the other -listen addresses
+	replyConn *net.UDPConn   // socket responses are written to
+	config    *ServerConfig
+	ctx       *asn1.Context // for decoding requests and encoding our own responses
+	resetLock sync.RWMutex  // held by requests so a reset is not seen part way through
+	readyAt   time.Time     // end of the startup delay
+
+	localBroadcasts []net.IP // directed broadcast addresses of the local networks when the sockets were opened
+
+	responseSizes *SizeHistogram   // of the responses before any tooBig
+	accessLog     *AccessLog       // nil if none
+	inflight      *InflightLimit   // nil for no -max-inflight
+	lockout       *AuthLockout     // nil for no -auth-lockout
+	replay        *Replay          // responses of the -pcap capture, nil for none
+	traffic       *TrafficRecorder // -record capture of the requests and responses, nil for none
+	corrupter     *Corrupter       // nil for no -corrupt-rate
+}
+
+// listenError explains the permission error when listening on a privileged port such as 161
+func listenError(err error, portNum uint) error {
+	if !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+	return fmt.Errorf("No permission to listen on UDP port %d (%v). Ports below 1024 need root or the "+
+		"CAP_NET_BIND_SERVICE capability, e.g. sudo setcap cap_net_bind_service=+ep snmprun, "+
+		"or use a higher port with e.g. -p 1161", portNum, err)
+}
+
+// listenUDP binds a UDP socket to the address, with SO_REUSEPORT set first if reusePort
+func listenUDP(addr *net.UDPAddr, reusePort bool) (*net.UDPConn, error) {
+	if !reusePort {
+		return net.ListenUDP("udp", addr)
+	}
+	listenConfig := net.ListenConfig{Control: reusePortControl}
+	conn, err := listenConfig.ListenPacket(context.Background(), "udp", addr.String())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
+
+func initSNMPServer(interp *Interpreter, config *ServerConfig) (server *SNMPServer, err error) {
+	server = &SNMPServer{config: config, ctx: snmp.Asn1Context(), responseSizes: newSizeHistogram()}
+	server.agent = NewAgent()
+
+	// Set the read-only and read-write communities
+	server.agent.SetCommunities(config.readCommunity, config.writeCommunity)
+	if config.readOnly {
+		logger.Infof("Read-only mode, SET requests are refused\n")
+		server.agent.SetReadOnly(true)
+	}
+	server.agent.SetMaxWalk(int(config.maxWalk))
+	if len(config.responseCommunity) > 0 {
+		logger.Warnf("Responding with community %s whatever the request's, which no compliant agent does (-response-community)\n", config.responseCommunity)
+		server.agent.SetResponseCommunity(config.responseCommunity)
+	}
+
+	if len(config.pcapFile) > 0 {
+		server.replay, err = loadReplay(config.pcapFile, int(config.pcapPort), server.ctx)
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("Replaying the responses to %d requests from %s\n", server.replay.Len(), config.pcapFile)
+	}
+
+	if len(config.recordFile) > 0 {
+		server.traffic, err = openTrafficRecorder(config.recordFile)
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("Recording the requests and responses to %s\n", config.recordFile)
+	}
+
+	if config.authLockout > 0 {
+		switch strings.ToLower(config.authLockoutResp) {
+		case "drop", "authorizationerror":
+		default:
+			return nil, fmt.Errorf("Invalid -auth-lockout-response %s, expecting drop or authorizationError", config.authLockoutResp)
+		}
+		server.lockout = newAuthLockout(int(config.authLockout), config.authLockoutWindow, config.authLockoutTime)
+	}
+
+	if config.corruptRate != 0 {
+		server.corrupter, err = newCorrupter(config.corruptRate, config.seed)
+		if err != nil {
+			return nil, err
+		}
+		logger.Warnf("Corrupting %g of the responses (-corrupt-rate)\n", config.corruptRate)
+	}
+
+	if config.maxInflight > 0 {
+		server.inflight = newInflightLimit(int(config.maxInflight))
+	}
+
+	if len(config.accessLogFile) > 0 {
+		server.accessLog, err = openAccessLog(config.accessLogFile, config.accessLogFormat)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Bind to an UDP port on all addresses or on each -listen address
+	listenAddrs := []string(config.listenAddrs)
+	if len(listenAddrs) == 0 {
+		listenAddrs = []string{""}
+	}
+	portStr := strconv.FormatUint(uint64(config.portNum), 10)
+	for _, listenAddr := range listenAddrs {
+		if _, _, err := net.SplitHostPort(listenAddr); err != nil {
+			listenAddr = net.JoinHostPort(strings.Trim(listenAddr, "[]"), portStr)
+		}
+		addr, err := net.ResolveUDPAddr("udp", listenAddr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := listenUDP(addr, config.reusePort)
+		if err != nil {
+			server.Close()
+			return nil, listenError(err, uint(addr.Port))
+		}
+		if server.conn == nil {
+			server.conn = conn
+		} else {
+			server.moreConns = append(server.moreConns, conn)
+		}
+		if len(config.listenAddrs) > 0 {
+			logger.Infof("Listening on %s\n", conn.LocalAddr())
+		}
+	}
+	switch strings.ToLower(config.startupResp) {
+	case "", "drop", "generr":
+	default:
+		return nil, fmt.Errorf("Invalid startup response %s, expecting genErr or drop", config.startupResp)
+	}
+	if !config.replyBroadcast {
+		// once rather than for each request, as listing the interfaces is a system call or more
+		server.localBroadcasts = localBroadcastAddrs()
+		for _, conn := range append([]*net.UDPConn{server.conn}, server.moreConns...) {
+			if err := enableDstAddr(conn); err != nil {
+				logger.Warnf("Unable to get the destination of requests to %s, so requests to broadcast or multicast addresses are answered: %v\n", conn.LocalAddr(), err)
 			}
 		}
+	}
+	server.readyAt = time.Now().Add(config.startupDelay)
+	if config.startupDelay > 0 {
+		logger.Infof("Not answering requests until the startup delay of %s ends\n", config.startupDelay)
+	}
 
-		//fmt.Printf("received value of %v for oid %s\n", val, oidStr)
-		switch snmpMode {
-		case SnmpModeReadWrite:
-			// update variable data under locking
-			interp.SetValueForIdOid(typ.id, oidStr, val)
-		case SnmpModeReadWriteBlocked:
-			// use a blocking channel to send data
-			typ.externalValue <- val
+	// By default reply from the listening socket (i.e. from port 161)
+	// otherwise bind a separate socket for the responses
+	// e.g. ":0" for an ephemeral port or "10.1.1.1:0" for a specific egress
+	server.replyConn = server.conn
+	if len(config.replyAddr) > 0 {
+		replyAddr, err := net.ResolveUDPAddr("udp", config.replyAddr)
+		if err != nil {
+			return nil, err
 		}
+		server.replyConn, err = net.ListenUDP("udp", replyAddr)
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("Sending responses from %s\n", server.replyConn.LocalAddr())
+	}
 
-		return nil
+	err = server.setBufferSizes()
+	if err != nil {
+		return nil, err
 	}
 
-	// given OID return its value
-	readFunc := func(oid asn1.Oid) (interface{}, error) {
+	switch strings.ToLower(config.unsupportedPdu) {
+	case "", "drop":
+	case "generr":
+		server.agent.SetUnsupportedPduStatus(snmp.GenErr)
+	default:
+		return nil, fmt.Errorf("Invalid response %s to unsupported PDUs, expecting genErr or drop", config.unsupportedPdu)
+	}
+
+	switch strings.ToLower(config.scalarLeniency) {
+	case "", "strict":
+	case "lenient":
+		server.agent.SetScalarLeniency(true)
+	default:
+		return nil, fmt.Errorf("Invalid -scalar-leniency %s, expecting strict or lenient", config.scalarLeniency)
+	}
+
+	if config.maxVarbinds > 0 {
+		filter, err := maxVarbindsFilter(config.maxVarbinds, config.maxVarbindsResp)
+		if err != nil {
+			return nil, err
+		}
+		server.agent.SetRequestFilter(filter)
+	}
+
+	err = addServedOIDs(server.agent, interp, config)
+	if err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// addServedOIDs sets up the agent to serve the OIDs of the program and those the options add
+func addServedOIDs(agent *Agent, interp *Interpreter, config *ServerConfig) error {
+	err := enableBackends(interp, config.backends, config.backendTimeout, config.backendCache)
+	if err != nil {
+		return err
+	}
+	err = addProgramOIDs(agent, interp, config.stdMib)
+	if err != nil {
+		return err
+	}
+	if len(config.vendor) > 0 {
+		err = addVendorObjectId(agent, interp, config.vendor)
+		if err != nil {
+			return err
+		}
+	}
+	if config.engine != nil {
+		addEngineOids(agent, interp, config.engine, config.maxMsgSize)
+	}
+	if len(config.clockOid) > 0 {
+		err = addClockOids(agent, interp, config.clockOid)
+		if err != nil {
+			return err
+		}
+	}
+	if len(config.healthOid) > 0 {
+		return addHealthOids(agent, interp, config.healthOid, time.Now())
+	}
+	return nil
+}
+
+// listOids writes the OIDs which would be served in numeric order, with the variable or alias target of each
+// Rows of tables are not listed as they are created by SETs.
+func listOids(out io.Writer, interp *Interpreter, config *ServerConfig) error {
+	agent := NewAgent()
+	err := addServedOIDs(agent, interp, config)
+	if err != nil {
+		return err
+	}
+	for _, oid := range agent.ManagedOids() {
 		oidStr := oid.String()
-		//fmt.Printf("callback: oid: %s\n", oidStr)
-		//fmt.Printf("oid values: %v\n", interp.oid2Values)
-		val, found := interp.GetValueForOid(oidStr)
-		if !found {
-			return nil, errors.New("Illegal Value")
-		}
-		switch val.valueType {
-		case ValueInteger:
-			return val.intVal, nil
-		case ValueCounter:
-			return snmp.Counter32(val.intVal), nil
-		case ValueTimeticks:
-			return snmp.TimeTicks(val.intVal), nil
-		case ValueGuage:
-			return snmp.Unsigned32(val.intVal), nil
-		case ValueString:
-			return val.stringVal, nil
-		case ValueBitset:
-			return convertBitsetToOctetStr(val.bitsetVal), nil
-		case ValueBytes:
-			typ := interp.variables.typesFromOid[oidStr]
-			return convertBytesToOctetStr(val.bytesVal, typ.fieldInfo)
-		case ValueOid:
-			oid, err := strToOID(val.oidVal)
+		if name, ok := healthOidName(config.healthOid, oidStr); ok {
+			fmt.Fprintf(out, "%s %s (-health-oid)\n", oidStr, name)
+		} else if typ, ok := interp.GetTypeForOid(oidStr); ok && typ.id != "" {
+			fmt.Fprintf(out, "%s %s\n", oidStr, typ.id)
+		} else if targetOid, ok := interp.aliasOids[oidStr]; ok {
+			fmt.Fprintf(out, "%s alias of %s\n", oidStr, targetOid)
+		} else {
+			fmt.Fprintln(out, oidStr)
+		}
+	}
+	return nil
+}
+
+// setBufferSizes sets the socket buffers so bursts of requests are not dropped by the kernel
+func (server *SNMPServer) setBufferSizes() error {
+	listenConns := append([]*net.UDPConn{server.conn}, server.moreConns...)
+	if server.config.rcvBufSize > 0 {
+		for _, conn := range listenConns {
+			err := conn.SetReadBuffer(int(server.config.rcvBufSize))
 			if err != nil {
-				return nil, err
+				return fmt.Errorf("Failed to set receive buffer size: %v", err)
 			}
-			return oid, nil
-		case ValueIpv4address:
-			addr, err := strToAddr(val.addrVal)
+		}
+	}
+	if server.config.sndBufSize > 0 {
+		// each listening socket sends its own responses unless there is a -reply-addr
+		replyConns := listenConns
+		if len(server.config.replyAddr) > 0 {
+			replyConns = []*net.UDPConn{server.replyConn}
+		}
+		for _, conn := range replyConns {
+			err := conn.SetWriteBuffer(int(server.config.sndBufSize))
 			if err != nil {
-				return nil, err
+				return fmt.Errorf("Failed to set send buffer size: %v", err)
 			}
-			return addr, nil
-		case ValueNone:
-			return nil, errors.New("Illegal Value")
 		}
-		return nil, errors.New("Illegal Value")
 	}
 
-	switch snmpMode {
-	case SnmpModeRead:
-		agent.AddRoManagedObject(oid, readFunc)
-	case SnmpModeReadWrite, SnmpModeReadWriteBlocked:
-		agent.AddRwManagedObject(oid, readFunc, writeFunc)
+	if server.config.rcvBufSize > 0 || server.config.sndBufSize > 0 {
+		// the kernel may clamp (or on linux double) what was asked for
+		rcvBuf, _, err := socketBufferSizes(server.conn)
+		if err != nil {
+			logger.Warnf("Unable to get socket buffer sizes: %v\n", err)
+			return nil
+		}
+		_, sndBuf, err := socketBufferSizes(server.replyConn)
+		if err != nil {
+			logger.Warnf("Unable to get socket buffer sizes: %v\n", err)
+			return nil
+		}
+		logger.Infof("Socket buffer sizes: receive %d, send %d\n", rcvBuf, sndBuf)
 	}
+	return nil
 }
 
-func initSNMPServer(interp *Interpreter, portNum uint, readCommunity string, writeCommunity string) (agent *snmp.Agent, conn *net.UDPConn, err error) {
-	agent = snmp.NewAgent()
+// isBroadcastOrMulticast reports whether the destination of a request is a broadcast or multicast address,
+// so more than one host may answer it, the local broadcasts being the directed broadcast addresses of our
+// local networks. It is false for a destination which is not known.
+func isBroadcastOrMulticast(ip net.IP, localBroadcasts []net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if ip.IsMulticast() || ip.Equal(net.IPv4bcast) || ip.IsUnspecified() {
+		return true
+	}
+	for _, bcast := range localBroadcasts {
+		if ip.Equal(bcast) {
+			return true
+		}
+	}
+	return false
+}
 
-	// Set the read-only and read-write communities
-	agent.SetCommunities(readCommunity, writeCommunity)
+// localBroadcastAddrs returns the directed broadcast addresses of the IPv4 networks of the local interfaces
+func localBroadcastAddrs() []net.IP {
+	ifAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		logger.Warnf("Unable to list the interface addresses, only replies to 255.255.255.255 and multicast are suppressed: %v\n", err)
+		return nil
+	}
+	var bcasts []net.IP
+	for _, ifAddr := range ifAddrs {
+		ipNet, ok := ifAddr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() == nil || len(ipNet.Mask) != net.IPv4len {
+			continue
+		}
+		bcast := make(net.IP, net.IPv4len)
+		for i := range bcast {
+			bcast[i] = ipNet.IP.To4()[i] | ^ipNet.Mask[i]
+		}
+		if !ipNet.IP.Equal(bcast) {
+			bcasts = append(bcasts, bcast)
+		}
+	}
+	return bcasts
+}
+
+// getRequestInfo returns the request-id and variable bindings of a request PDU
+func getRequestInfo(pdu interface{}) (id int, vars []snmp.Variable, ok bool) {
+	switch req := pdu.(type) {
+	case snmp.GetRequestPdu:
+		return req.Identifier, req.Variables, true
+	case snmp.GetNextRequestPdu:
+		return req.Identifier, req.Variables, true
+	case snmp.SetRequestPdu:
+		return req.Identifier, req.Variables, true
+	case snmp.GetBulkRequestPdu:
+		return req.Identifier, req.Variables, true
+	}
+	return 0, nil, false
+}
 
-	// Bind to an UDP port
-	portStr := ":" + strconv.FormatUint(uint64(portNum), 10)
-	addr, err := net.ResolveUDPAddr("udp", portStr)
+// maxVarbindsFilter fails requests with more than max variable bindings like some devices do
+// with a tooBig or genErr response, or by dropping them
+func maxVarbindsFilter(max uint, response string) (RequestFilter, error) {
+	var err error
+	switch strings.ToLower(response) {
+	case "toobig":
+		err = varErrorf(snmp.TooBig, "Too many variable bindings")
+	case "generr":
+		err = varErrorf(snmp.GenErr, "Too many variable bindings")
+	case "drop":
+		err = errors.New("Too many variable bindings")
+	default:
+		return nil, fmt.Errorf("Invalid response %s to too many variable bindings, expecting tooBig, genErr or drop", response)
+	}
+	return func(version int, pdu interface{}, vars []snmp.Variable) error {
+		if uint(len(vars)) > max {
+			return err
+		}
+		return nil
+	}, nil
+}
+
+// tooBigResponse creates a tooBig response for a request whose response is over the maximum message size.
+// As per RFC 1157 and RFC 3416 the error-index is zero and the request's variable bindings are returned.
+func (server *SNMPServer) tooBigResponse(request []byte) ([]byte, error) {
+	return server.errorResponse(request, snmp.TooBig)
+}
+
+// truncatedBulkResponse removes variable bindings from the end of the response to a GetBulk request until it
+// fits in the maximum message size, as RFC 3416 section 4.2.3 has rather than tooBig. false if the request is not
+// a GetBulk, the response is an error or not even the response with no variable bindings fits.
+func (server *SNMPServer) truncatedBulkResponse(request []byte, response []byte) ([]byte, bool) {
+	var reqMsg snmp.Message
+	if _, err := server.ctx.Decode(request, &reqMsg); err != nil {
+		return nil, false
+	}
+	if _, ok := reqMsg.Pdu.(snmp.GetBulkRequestPdu); !ok {
+		return nil, false
+	}
+	var respMsg snmp.Message
+	if _, err := server.ctx.Decode(response, &respMsg); err != nil {
+		return nil, false
+	}
+	pdu, ok := respMsg.Pdu.(snmp.GetResponsePdu)
+	if !ok || pdu.ErrorStatus != snmp.NoError {
+		return nil, false
+	}
+	vars := pdu.Variables
+	encode := func(n int) []byte {
+		pdu.Variables = vars[:n]
+		respMsg.Pdu = pdu
+		buffer, err := server.ctx.Encode(respMsg)
+		if err != nil || uint(len(buffer)) > server.config.maxMsgSize {
+			return nil
+		}
+		return buffer
+	}
+	// the most variable bindings which fit, the size only grows with them
+	low, high := 0, len(vars)-1
+	if encode(low) == nil {
+		return nil, false
+	}
+	for low < high {
+		mid := (low + high + 1) / 2
+		if encode(mid) != nil {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	return encode(low), true
+}
+
+// startupResponse is the response to a request during the startup delay, nil to drop it
+func (server *SNMPServer) startupResponse(request []byte) ([]byte, error) {
+	if strings.ToLower(server.config.startupResp) != "generr" {
+		return nil, nil
+	}
+	return server.errorResponse(request, snmp.GenErr)
+}
+
+// replayResponse is the response from the -pcap capture to a request, nil if there is none
+func (server *SNMPServer) replayResponse(request []byte) []byte {
+	if server.replay == nil {
+		return nil
+	}
+	var reqMsg snmp.Message
+	_, err := server.ctx.Decode(request, &reqMsg)
 	if err != nil {
-		return nil, nil, err
+		return nil
+	}
+	community := string(reqMsg.Community)
+	if community != server.config.readCommunity && community != server.config.writeCommunity {
+		// left to the agent to drop
+		return nil
+	}
+	response, _ := server.replay.Response(reqMsg)
+	return response
+}
+
+// lockoutResponse is the response to a request from a locked out source, nil to drop it
+func (server *SNMPServer) lockoutResponse(request []byte) ([]byte, error) {
+	if strings.ToLower(server.config.authLockoutResp) != "authorizationerror" {
+		return nil, nil
 	}
-	conn, err = net.ListenUDP("udp", addr)
+	return server.errorResponse(request, snmp.AuthorizationError)
+}
+
+// errorResponse creates a response with the error-status for a request without processing it
+func (server *SNMPServer) errorResponse(request []byte, status int) ([]byte, error) {
+	var reqMsg snmp.Message
+	_, err := server.ctx.Decode(request, &reqMsg)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	id, reqVars, ok := getRequestInfo(reqMsg.Pdu)
+	if !ok {
+		return nil, fmt.Errorf("Unexpected PDU type %T for error response", reqMsg.Pdu)
 	}
+	vars := make([]snmp.Variable, len(reqVars))
+	for i, v := range reqVars {
+		vars[i] = snmp.Variable{Name: v.Name, Value: asn1.Null{}}
+	}
+	if reqMsg.Version == snmp.V1 {
+		status = v1ErrorStatus(status)
+	}
+	respMsg := snmp.Message{
+		Version:   reqMsg.Version,
+		Community: server.agent.responseCommunityFor(reqMsg.Community),
+		Pdu: snmp.GetResponsePdu{
+			Identifier:  id,
+			ErrorStatus: status,
+			ErrorIndex:  0,
+			Variables:   vars,
+		},
+	}
+	return server.ctx.Encode(respMsg)
+}
 
-	//fmt.Printf("oid2Values: %v\n", interp.oid2Values)
-	for oidStr := range interp.oid2Values {
-		addOIDFunc(agent, interp, oidStr, interp.variables.typesFromOid[oidStr].snmpMode)
+// maxDatagramSize is the largest UDP payload over IPv4
+const maxDatagramSize = 65507
+
+// runSNMPServer serves the requests on each of the sockets until told to quit
+func runSNMPServer(server *SNMPServer, quit chan bool, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	conns := append([]*net.UDPConn{server.conn}, server.moreConns...)
+	stop := make(chan struct{})
+	var connWg sync.WaitGroup
+	for _, conn := range conns {
+		connWg.Add(1)
+		go func(conn *net.UDPConn) {
+			defer connWg.Done()
+			server.serveConn(conn, stop)
+		}(conn)
 	}
 
-	return agent, conn, err
+	<-quit
+	close(stop)
+	for _, conn := range conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	connWg.Wait()
 }
 
-// Read from a channel about OID requests
-func runSNMPServer(agent *snmp.Agent, conn *net.UDPConn, quit chan bool, wg *sync.WaitGroup) {
+// serveConn serves the requests read from a socket until stopped
+// Responses go out of the socket the request came in on unless there is a -reply-addr.
+func (server *SNMPServer) serveConn(conn *net.UDPConn, stop chan struct{}) {
 	const readTimeoutSecs = 5
 
-	defer wg.Done()
+	replyConn := conn
+	if len(server.config.replyAddr) > 0 {
+		replyConn = server.replyConn
+	}
+
+	// with a -max-inflight requests are processed concurrently, wait for them when stopped
+	var requestWg sync.WaitGroup
+	defer requestWg.Wait()
 
 	// Serve requests
 	for {
 
 		// stop if told to finish up
 		select {
-		case <-quit:
+		case <-stop:
 			return
 		default:
 			// Do other stuff
 		}
 
 		// read incoming PDU
-		buffer := make([]byte, 1024)
+		buffer := make([]byte, maxDatagramSize)
 		conn.SetReadDeadline(time.Now().Add(readTimeoutSecs * time.Second))
-		n, source, err := conn.ReadFrom(buffer)
+		n, source, dst, err := readFromWithDst(conn, buffer)
 		if err != nil {
 			if e, ok := err.(net.Error); !ok || !e.Timeout() {
 				// error but not a network error or a network error other than timeout
 				// handle non-timeout error
-				logger.Printf("Failed to read buffer: %s", err)
+				logger.Errorf("Failed to read buffer: %s\n", err)
 				os.Exit(1)
 			}
 			// timeout => test for quit or try read again
 			continue
 		}
 
-		// process PDU
-		buffer, err = agent.ProcessDatagram(buffer[:n])
-		if err != nil {
-			logger.Println(err)
+		if !server.config.replyBroadcast && isBroadcastOrMulticast(dst, server.localBroadcasts) {
+			logger.Debugf("Ignoring request from %s to broadcast/multicast address %s\n", source, dst)
+			continue
+		}
+
+		request := buffer[:n]
+		server.recordTraffic(source, conn.LocalAddr(), request)
+		if server.inflight == nil {
+			server.handleRequest(replyConn, request, source)
+			continue
+		}
+		// like a device with a busy SNMP engine, drop rather than queue so the manager times out
+		if !server.inflight.TryAcquire() {
+			logger.Debugf("Request from %s dropped as %d requests are in flight (-max-inflight)\n", source, server.config.maxInflight)
+			server.logAccess(time.Now(), source, server.agent.summarizeRequest(request), nil, errInflightDrop)
 			continue
 		}
+		requestWg.Add(1)
+		go func() {
+			defer requestWg.Done()
+			defer server.inflight.Release()
+			server.handleRequest(replyConn, request, source)
+		}()
+	}
+}
+
+// errors of the access log for requests the server drops without the agent processing them
+var (
+	errStartupDrop  = errors.New("Dropped during the startup delay")
+	errLockoutDrop  = errors.New("Dropped as the source is locked out")
+	errInflightDrop = errors.New("Dropped as too many requests are in flight")
+)
 
-		// respond with a new PDU
-		_, err = conn.WriteTo(buffer, source)
+// handleRequest processes a request and writes the response, if any, to the source
+// The request is logged to the access log once, with the response sent or the error it was dropped with.
+func (server *SNMPServer) handleRequest(replyConn *net.UDPConn, request []byte, source net.Addr) {
+	var buffer []byte
+	var summary RequestSummary
+	var err error
+	start := time.Now()
+	var sent []byte // nil if dropped
+	defer func() {
+		server.logAccess(start, source, summary, sent, err)
+	}()
+	if time.Now().Before(server.readyAt) {
+		// like a device booting up, keep reading so requests do not queue
+		summary = server.agent.summarizeRequest(request)
+		buffer, err = server.startupResponse(request)
+		if err != nil || buffer == nil {
+			logger.Debugf("Request from %s dropped during the startup delay\n", source)
+			if err == nil {
+				err = errStartupDrop
+			}
+			return
+		}
+		summary.ErrorStatus = server.responseStatus(buffer)
+	} else if server.lockout != nil && server.lockout.Locked(sourceHost(source), start) {
+		// not processed even with the right community, like a device blocking a brute-force attack
+		summary = server.agent.summarizeRequest(request)
+		buffer, err = server.lockoutResponse(request)
+		if err != nil || buffer == nil {
+			logger.Debugf("Request from %s dropped as it is locked out (-auth-lockout)\n", source)
+			if err == nil {
+				err = errLockoutDrop
+			}
+			return
+		}
+		summary.ErrorStatus = server.responseStatus(buffer)
+	} else if buffer = server.replayResponse(request); buffer != nil {
+		logger.Debugf("Replayed the captured response to the request from %s (-pcap)\n", source)
+		summary = server.agent.summarizeRequest(request)
+		summary.ErrorStatus = server.responseStatus(buffer)
+	} else {
+		server.resetLock.RLock()
+		buffer, summary, err = server.agent.ProcessRequestFrom(request, source.String())
+		server.resetLock.RUnlock()
+		if server.lockout != nil && errors.Is(err, errBadCommunity) && server.lockout.Failure(sourceHost(source), start) {
+			logger.Warnf("Locking out %s for %v after %d requests with a bad community within %v (-auth-lockout)\n",
+				sourceHost(source), server.config.authLockoutTime, server.config.authLockout, server.config.authLockoutWindow)
+		}
+		if errors.Is(err, errUnsupportedPdu) {
+			logger.Debugf("Request from %s dropped: %s\n", source, err)
+			return
+		}
 		if err != nil {
-			logger.Printf("Failed to write buffer: %s", err)
-			os.Exit(1)
+			logger.Warnf("Request from %s dropped: %s\n", source, err)
+			return
+		}
+	}
+
+	// tooBig rather than sending a response the manager can not take
+	tooBig := uint(len(buffer)) > server.config.maxMsgSize
+	server.responseSizes.Record(len(buffer), tooBig)
+	if tooBig {
+		if truncated, ok := server.truncatedBulkResponse(request, buffer); ok {
+			logger.Debugf("GetBulk response of %d bytes truncated to the maximum message size of %d\n", len(buffer), server.config.maxMsgSize)
+			buffer = truncated
+		} else {
+			logger.Warnf("Response of %d bytes is over the maximum message size of %d\n", len(buffer), server.config.maxMsgSize)
+			buffer, err = server.tooBigResponse(request)
+			if err != nil {
+				logger.Errorf("Failed to create tooBig response: %s\n", err)
+				return
+			}
+			summary.ErrorStatus = snmp.TooBig
 		}
 	}
+	if server.corrupter != nil {
+		if corrupted, how, ok := server.corrupter.Corrupt(buffer); ok {
+			logger.Infof("Corrupted the response to %s: %s (-corrupt-rate)\n", source, how)
+			buffer = corrupted
+		}
+	}
+
+	// respond with a new PDU
+	_, err = replyConn.WriteTo(buffer, source)
+	if err != nil {
+		logger.Errorf("Failed to write buffer: %s\n", err)
+		os.Exit(1)
+	}
+	sent = buffer
+	server.recordTraffic(replyConn.LocalAddr(), source, buffer)
+}
+
+// logAccess writes the line of a request to the access log, if any, with the response sent, nil if dropped
+func (server *SNMPServer) logAccess(start time.Time, source net.Addr, summary RequestSummary, response []byte, err error) {
+	if server.accessLog == nil {
+		return
+	}
+	server.accessLog.Log(accessEntry(start, source.String(), summary, response, err))
+}
+
+// responseStatus is the error-status of a response the server sends without the agent, such as a replayed one
+func (server *SNMPServer) responseStatus(response []byte) int {
+	var respMsg snmp.Message
+	if _, err := server.ctx.Decode(response, &respMsg); err != nil {
+		return snmp.NoError
+	}
+	pdu, _ := respMsg.Pdu.(snmp.GetResponsePdu)
+	return pdu.ErrorStatus
+}
+
+// recordTraffic writes a datagram received or sent to the -record capture, if any
+func (server *SNMPServer) recordTraffic(src net.Addr, dst net.Addr, datagram []byte) {
+	if server.traffic == nil {
+		return
+	}
+	err := server.traffic.Record(src, dst, datagram, time.Now())
+	if err != nil {
+		logger.Errorf("Failed to record to %s: %s\n", server.config.recordFile, err)
+	}
+}
+
+// Close closes the sockets and the files of the server
+func (server *SNMPServer) Close() {
+	for _, conn := range append([]*net.UDPConn{server.conn, server.replyConn}, server.moreConns...) {
+		if conn != nil {
+			conn.Close()
+		}
+	}
+	if server.traffic != nil {
+		server.traffic.Close()
+	}
+	if server.accessLog != nil {
+		server.accessLog.Close()
+	}
+}
+
+// reset puts the values back to their initial state between requests
+func (server *SNMPServer) reset(interp *Interpreter) {
+	server.resetLock.Lock()
+	defer server.resetLock.Unlock()
+
+	for _, oidStr := range interp.Reset() {
+		oid, err := strToOID(oidStr)
+		if err == nil {
+			server.agent.RemoveManagedObject(oid)
+		}
+	}
+	// undo the appear and disappear statements
+	presence := agentPresence{agent: server.agent, interp: interp}
+	for oidStr, typ := range interp.variables.typesFromOid {
+		if _, served := interp.GetValueForOid(oidStr); !served {
+			continue
+		}
+		if typ.absent {
+			presence.SetPresent(typ, false)
+		} else if oid, err := strToOID(oidStr); err == nil {
+			if _, found := server.agent.getObject(oid); !found {
+				presence.SetPresent(typ, true)
+			}
+		}
+	}
+}
+
+// serveProgram runs the program to set the OID values until interrupted
+// A SIGHUP runs the program again from the initial values.
+// Unless exitAfterProgram the final values are served after the program finishes,
+// as a static program finishes at once but still needs to be queried.
+// With keepServingOnError a program which fails is not exited after, its last values are served.
+func serveProgram(server *SNMPServer, interp *Interpreter, program *Program, exitAfterProgram bool,
+	keepServingOnError bool, programStatus *ProgramStatus) {
+	hangup := make(chan os.Signal, 1)
+	notifyHangup(hangup)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	for {
+		programStatus.Set(ProgramRunning, nil)
+		done := make(chan error, 1)
+		go func() {
+			done <- interp.InterpProgram(program)
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				logger.Errorf("Interpreting error: %s\n", err)
+				programStatus.Set(ProgramFailed, err)
+			} else {
+				programStatus.Set(ProgramFinished, nil)
+			}
+			if exitAfterProgram && (err == nil || !keepServingOnError) {
+				return
+			}
+			if err != nil {
+				logger.Infof("Program failed, serving the last values until stopped\n")
+			} else {
+				logger.Infof("Program finished, serving the final values until stopped\n")
+			}
+			select {
+			case <-hangup:
+			case <-stop:
+				return
+			}
+		case <-hangup:
+			interp.Stop()
+			<-done
+		case <-stop:
+			return
+		}
+
+		logger.Infof("Resetting the values and running the program again\n")
+		server.reset(interp)
+	}
+}
+
+// isStaticProgram returns true if the program has no loop which can go on, sleep or read, so it finishes
+// as soon as it is started and its values do not change after
+func isStaticProgram(program *Program) bool {
+	return !statementsWait(program.stmtList)
+}
+
+func statementsWait(stmtList []*Statement) bool {
+	for _, stmt := range stmtList {
+		switch stmt.stmtType {
+		case StmtSleep, StmtRead:
+			return true
+		case StmtLoop:
+			if stmt.loopStmt.loopType != LoopTimes || statementsWait(stmt.loopStmt.stmtList) {
+				return true
+			}
+		case StmtIf:
+			if statementsWait(stmt.ifStmt.stmtList) || statementsWait(stmt.ifStmt.elseStmtList) {
+				return true
+			}
+			for _, elseIf := range stmt.ifStmt.elsifList {
+				if statementsWait(elseIf.stmtList) {
+					return true
+				}
+			}
+		}
+	}
+	return false
 }
 
 // -V key1=val1 -V key2=val2 -V key3=val3
 
+// ListenAddrs are the addresses of the -listen flags, which may be given more than once
+type ListenAddrs []string
+
+func (addrs *ListenAddrs) String() string {
+	return strings.Join(*addrs, ",")
+}
+
+func (addrs *ListenAddrs) Set(value string) error {
+	*addrs = append(*addrs, value)
+	return nil
+}
+
+// Reset removes the addresses, for an SNMPRUN_LISTEN to override them
+func (addrs *ListenAddrs) Reset() {
+	*addrs = nil
+}
+
 func (varInits *VariableInits) String() string {
 	return fmt.Sprintf("varinits: %v\n", *varInits)
 }
@@ -336,82 +1407,338 @@ func (varInits *VariableInits) Set(value string) error {
 	return nil
 }
 
+// Reset removes the variable initializations, for an SNMPRUN_V to override them
+func (varInits *VariableInits) Reset() {
+	for id := range *varInits {
+		delete(*varInits, id)
+	}
+}
+
 var version string // to be overridden with ldflags
 
-// snmprun -p 161 -c public -C private -V key='value'
+// loadProgram reads and parses a program file, whose variables can be declared with the names of the
+// optional MIB index
+func loadProgram(filename string, mibIndex *MibIndex) (*Program, error) {
+	inputBuf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read file %s: %s", filename, err)
+	}
+
+	parser := NewParser(lex(filename, string(inputBuf)))
+	parser.SetMibIndex(mibIndex)
+	program, err := parser.ParseProgram()
+	if err != nil {
+		return nil, fmt.Errorf("Parsing error: %s", err)
+	}
+	return program, nil
+}
+
+// snmprun -p 161 -c public -C private -reply-addr :0 -V key='value'
+// snmprun selftest program.sim
+// snmprun repl program.sim
+// snmprun export program.sim
+// snmprun diff old.sim new.sim
+// snmprun assert program.sim expected.sim
+// snmprun get localhost:1161 public 1.3.6.1.2.1.1.1.0
+// snmprun walk localhost:1161 public 1.3.6.1.2.1.1
 func main() {
-	var portNum uint           // -p 161
-	var readCommunity string   // -c public
-	var writeCommunity string  // -C private
-	var versionFlag bool       // -v
-	var varInits VariableInits // -V key1=val1 -V key2=val2
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		os.Exit(runSelftest(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "repl" {
+		os.Exit(runRepl(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Exit(runExport(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(runDiff(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "assert" {
+		os.Exit(runAssert(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "get" {
+		os.Exit(runGet(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "walk" {
+		os.Exit(runWalk(os.Args[2:], os.Stdout))
+	}
+	os.Exit(runServer())
+}
+
+// runServer serves the program of the command line until it finishes or is stopped and returns the exit code,
+// so the deferred clean up such as writing the profiles is done whichever way it ends
+func runServer() int {
+	var config ServerConfig
+	var trapConfig TrapConfig
+	var versionFlag bool        // -v
+	var exitAfterProgram bool   // -exit-after-program
+	var keepServingOnError bool // -keep-serving-on-error
+	var httpAddr string         // -http localhost:8161
+	var seed int64              // -seed 42
+	var format string           // -format json
+	var mibIndexFile string     // -mib-index mibs.txt
+	var snmprecFile string      // -snmprec device.snmprec
+	var engineFlag bool         // -engine
+	var engineId string         // -engine-id 0x80001f8805aabbccdd
+	var engineBoots int         // -engine-boots 3
+	var cpuProfile string       // -cpuprofile cpu.prof
+	var memProfile string       // -memprofile mem.prof
+	var configFile string       // -config snmprun.toml
+	var listOidsFlag bool       // -list-oids
+	var stateFilename string    // -state state.json
+	var recordSetsFile string   // -record-sets sets.sim
+	var varInits VariableInits  // -V key1=val1 -V key2=val2
+	logLevel := LogInfo         // -log-level warn
+	var logMaxSize ByteSize     // -log-max-size 50MB
+	var logKeep int             // -log-keep 5
 	varInits = make(map[string]string)
 
-	flag.UintVar(&portNum, "p", 161, "port number for SNMP server")
-	flag.StringVar(&readCommunity, "c", "public", "community name")
-	flag.StringVar(&writeCommunity, "C", "private", "community name")
+	flag.UintVar(&config.portNum, "p", 161, "port number for SNMP server")
+	flag.StringVar(&config.readCommunity, "c", "public", "community name")
+	flag.StringVar(&config.writeCommunity, "C", "private", "community name")
+	flag.Var(&config.listenAddrs, "listen", "address to listen on, e.g. 10.1.1.1 or 10.1.1.1:1161, may be repeated (default is all addresses)")
+	flag.StringVar(&config.replyAddr, "reply-addr", "", "local address to send responses from (e.g. :0 for an ephemeral port)")
+	flag.BoolVar(&config.replyBroadcast, "reply-bcast", false, "respond to requests sent to broadcast/multicast addresses")
+	flag.BoolVar(&config.reusePort, "reuseport", false, "set SO_REUSEPORT so several instances can listen on the same port (Linux and the BSDs)")
+	flag.UintVar(&config.maxMsgSize, "max-msg-size", maxDatagramSize, "maximum response message size, larger responses get tooBig")
+	flag.UintVar(&config.maxWalk, "max-walk", 0, "OIDs a walk by GETNEXT or GETBULK returns before endOfMibView, 0 for no limit")
+	flag.UintVar(&config.maxVarbinds, "max-varbinds", 0, "requests with more variable bindings get the -max-varbinds-response, 0 for no limit")
+	flag.StringVar(&config.maxVarbindsResp, "max-varbinds-response", "tooBig", "response to too many variable bindings: tooBig, genErr or drop")
+	flag.UintVar(&config.maxInflight, "max-inflight", 0, "requests processed at once, more are dropped so the manager times out (default is one at a time per socket)")
+	flag.DurationVar(&config.startupDelay, "startup-delay", 0, "time after starting before requests are answered, like a device booting (e.g. 10s)")
+	flag.StringVar(&config.startupResp, "startup-response", "drop", "response to requests during the -startup-delay: drop or genErr")
+	flag.StringVar(&config.unsupportedPdu, "unsupported-pdu", "drop", "response to an inform, which an agent does not process: drop or genErr (traps are always dropped)")
+	flag.StringVar(&config.scalarLeniency, "scalar-leniency", "strict", "GET of a scalar without its .0 instance: strict for noSuchInstance like most devices or lenient to answer with the scalar")
+	flag.StringVar(&config.accessLogFile, "access-log", "", "file to log each request to with its request-id, - for stdout")
+	flag.StringVar(&config.accessLogFormat, "access-log-format", "text", "format of the -access-log: text or json")
+	flag.UintVar(&config.authLockout, "auth-lockout", 0, "requests with a bad community from a source within the -auth-lockout-window that lock it out, 0 for no lockout")
+	flag.DurationVar(&config.authLockoutWindow, "auth-lockout-window", time.Minute, "window the requests with a bad community are counted in for -auth-lockout")
+	flag.DurationVar(&config.authLockoutTime, "auth-lockout-time", 5*time.Minute, "how long a source is locked out for by -auth-lockout")
+	flag.StringVar(&config.authLockoutResp, "auth-lockout-response", "drop", "response to a locked out source: drop or authorizationError")
+	flag.StringVar(&config.pcapFile, "pcap", "", "pcap capture of a device whose responses are replayed to requests for the same OIDs")
+	flag.UintVar(&config.pcapPort, "pcap-port", 161, "UDP port of the device in the -pcap capture")
+	flag.StringVar(&config.recordFile, "record", "", "pcap capture file to write every request received and response sent to")
+	flag.Float64Var(&config.corruptRate, "corrupt-rate", 0, "fraction of the responses from 0 to 1 to send with a broken encoding, to test managers")
+	flag.BoolVar(&engineFlag, "engine", false, "serve the snmpEngine group (snmpEngineID, boots, time and maximum message size) for SNMPv3 discovery")
+	flag.StringVar(&engineId, "engine-id", "", "snmpEngineID in hex for -engine (default is from the run id)")
+	flag.IntVar(&engineBoots, "engine-boots", 1, "snmpEngineBoots at startup for -engine, each reboot of the program adds one")
+	flag.BoolVar(&config.backends, "backends", false, "serve the variables fetched from http backends, which are refused otherwise as the agent then makes requests to other hosts")
+	flag.DurationVar(&config.backendTimeout, "backend-timeout", defaultBackendTimeout, "how long a read waits for an http backend before serving the last value fetched")
+	flag.DurationVar(&config.backendCache, "backend-cache", defaultBackendCache, "how long a value fetched from an http backend is served again before it is fetched again, 0 to fetch on every read (a cache in the program overrides it)")
+	flag.StringVar(&config.responseCommunity, "response-community", "", "community to send in every response instead of echoing the request's, to emulate a broken device (not compliant)")
+	flag.BoolVar(&config.readOnly, "read-only", false, "refuse all SET requests with notWritable, whatever the community")
+	flag.UintVar(&config.rcvBufSize, "rcvbuf", 0, "socket receive buffer size in bytes (default is the system default)")
+	flag.UintVar(&config.sndBufSize, "sndbuf", 0, "socket send buffer size in bytes (default is the system default)")
+	flag.BoolVar(&config.stdMib, "stdmib", false, "serve placeholders for MIB-II system group objects the program does not declare")
+	flag.StringVar(&config.healthOid, "health-oid", "", "OID to serve the uptime and request count of snmprun itself under, e.g. .1.3.6.1.4.1.99999.1")
+	flag.StringVar(&config.clockOid, "clock-oid", "", "OID to serve the manual clocks of rates under, whose milliseconds a SET advances, e.g. .1.3.6.1.4.1.99999.2")
+	flag.StringVar(&config.vendor, "vendor", "", "serve the sysObjectID of a vendor (cisco, hp, juniper, microsoft, mikrotik, net-snmp) if the program does not declare it")
+	flag.StringVar(&trapConfig.dest, "trap-dest", "", "host:port to send traps to")
+	flag.StringVar(&trapConfig.community, "trap-community", "public", "community name for traps")
+	flag.StringVar(&trapConfig.enterprise, "trap-enterprise", ".1.3.6.1.4.1", "enterprise OID for v1 traps")
+	flag.StringVar(&trapConfig.agentAddr, "trap-agent-addr", "", "agent address for v1 traps (default is the local address used to send)")
+	flag.StringVar(&httpAddr, "http", "", "address for the HTTP status server (e.g. localhost:8161, a port alone is on localhost only), not started if empty")
+	flag.BoolVar(&keepServingOnError, "keep-serving-on-error", false, "with -exit-after-program keep serving the last values if the program fails")
+	flag.BoolVar(&exitAfterProgram, "exit-after-program", false, "stop serving when the program finishes (default is to keep serving the final values)")
+	flag.Int64Var(&seed, "seed", 0, "seed for random numbers such as rate jitter, to reproduce a run (default is time based)")
+	flag.StringVar(&format, "format", "", "format of the program file: sim, json or snmprec (default is from a .json or .snmprec extension otherwise sim)")
+	flag.StringVar(&snmprecFile, "snmprec", "", "snmprec data file of snmpsim to serve instead of a program")
+	flag.StringVar(&mibIndexFile, "mib-index", "", "file of MIB object names and OIDs, such as from smidump -f identifiers, for variables to be declared with names")
+	flag.StringVar(&cpuProfile, "cpuprofile", "", "write a CPU profile to the file")
+	flag.StringVar(&memProfile, "memprofile", "", "write a memory profile to the file on exit")
+	flag.StringVar(&stateFilename, "state", "", "file to persist the values set by SNMP SETs in, which override the initial values at startup")
+	flag.StringVar(&recordSetsFile, "record-sets", "", "file to append each variable set by an SNMP SET to as an assignment statement")
+	flag.StringVar(&runId, "run-id", runId, "id of this run in /info, the JSON access log and the -health-oid (default is a random UUID)")
+	flag.BoolVar(&listOidsFlag, "list-oids", false, "print the OIDs the program serves in order and exit")
+	flag.StringVar(&configFile, "config", "", "file of options, which the command line and SNMPRUN_ environment variables override")
 	flag.BoolVar(&versionFlag, "v", false, "print version number")
 	flag.Var(&varInits, "V", "variable initializers")
+	flag.Var(&logLevel, "log-level", "least severe messages to log: error, warn, info or debug")
+	flag.Var(&logMaxSize, "log-max-size", "rotate the log file when it reaches this size e.g. 50MB, 0 for no rotation")
+	flag.IntVar(&logKeep, "log-keep", 5, "number of rotated log files to keep")
 	flag.Parse()
 
+	// defaults < program config section < config file < command line < environment
+	err := applyEnv(flag.CommandLine)
+	if err == nil && len(configFile) > 0 {
+		err = applyConfig(flag.CommandLine, configFile)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
 	if versionFlag {
 		if version == "" {
 			version = "devel"
 		}
 		fmt.Printf("snmprun version %s\n", version)
-		os.Exit(0)
+		return 0
 	}
 
-	if len(flag.Args()) != 1 {
+	var filename string
+	switch {
+	case len(snmprecFile) > 0 && len(flag.Args()) > 0:
+		fmt.Print("Either a filename to run or -snmprec, not both\n")
+		return 1
+	case len(snmprecFile) > 0:
+		filename = snmprecFile
+		format = "snmprec"
+	case len(flag.Args()) != 1:
 		fmt.Print("Missing filename to run\n")
-		os.Exit(1)
+		return 1
+	default:
+		filename = flag.Args()[0]
 	}
 
-	filename := flag.Args()[0]
-
-	f, err := os.OpenFile(filename+".log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	var logOut io.Writer = ioutil.Discard
+	f, err := openRotatingFile(filename+".log", int64(logMaxSize), logKeep)
 	if err != nil {
 		log.Println(err)
+	} else {
+		defer f.Close()
+		logOut = f
 	}
-	defer f.Close()
-	logger = log.New(f, "snmpsim", log.LstdFlags)
+	logger = newLevelLogger(logOut, "snmpsim", log.LstdFlags, logLevel)
 
-	inputBuf, err := ioutil.ReadFile(filename)
+	// before any goroutine starts, such as the lexer's, so all of them are profiled, and once there is the log
+	// for the errors of writing the memory profile
+	stopProfiling, err := startProfiling(cpuProfile, memProfile)
 	if err != nil {
-		fmt.Printf("Unable to read file %s: %s\n", filename, err)
-		os.Exit(1)
+		fmt.Printf("Failed to start profiling: %s\n", err)
+		return 1
 	}
+	defer stopProfiling()
 
-	l := lex(filename, string(inputBuf))
-
-	parser := NewParser(l)
-	program, err := parser.ParseProgram()
+	var mibIndex *MibIndex
+	if len(mibIndexFile) > 0 {
+		mibIndex, err = loadMibIndex(mibIndexFile)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		logger.Infof("Loaded %d MIB names from %s\n", mibIndex.Len(), mibIndexFile)
+	}
+	program, err := loadProgramAs(filename, format, mibIndex)
+	if err == nil {
+		err = applyProgramConfig(flag.CommandLine, filename, program)
+	}
 	if err != nil {
-		fmt.Printf("Parsing error: %s\n", err)
-		os.Exit(1)
+		fmt.Println(err)
+		return 1
+	}
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	logger.Infof("Random seed %d\n", seed)
+	logger.Infof("Run id %s\n", runId)
+
+	if engineFlag {
+		engine := &EngineConfig{id: defaultEngineId(), boots: engineBoots}
+		if len(engineId) > 0 {
+			engine.id, err = parseEngineId(engineId)
+			if err != nil {
+				fmt.Println(err)
+				return 1
+			}
+		}
+		if engineBoots < 1 {
+			fmt.Printf("Invalid -engine-boots %d, expecting 1 or more\n", engineBoots)
+			return 1
+		}
+		config.engine = engine
+		logger.Infof("SNMP engine id %X\n", engine.id)
 	}
 
 	interp := new(Interpreter)
-	interp.Init(program, varInits)
+	interp.SetSeed(seed)
+	config.seed = seed
+	var state *StateFile
+	if len(stateFilename) > 0 {
+		state, err = loadStateFile(stateFilename)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		interp.SetStateFile(state)
+	}
+	if len(recordSetsFile) > 0 {
+		recorder, err := openSetRecorder(recordSetsFile)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		defer recorder.Close()
+		interp.SetSetRecorder(recorder)
+	}
+	err = interp.Init(program, varInits)
+	if err != nil {
+		fmt.Printf("Initialization error: %s\n", err)
+		return 1
+	}
 
-	agent, conn, err := initSNMPServer(interp, portNum, readCommunity, writeCommunity)
+	if listOidsFlag {
+		err = listOids(os.Stdout, interp, &config)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		return 0
+	}
+
+	server, err := initSNMPServer(interp, &config)
 	if err != nil {
 		fmt.Printf("Failed to init snmp server: %s\n", err)
-		os.Exit(1)
+		return 1
+	}
+
+	trapSender, err := newV1TrapSender(interp, &trapConfig)
+	if err != nil {
+		fmt.Printf("Failed to init trap sender: %s\n", err)
+		return 1
+	}
+	interp.SetTrapSender(trapSender)
+
+	programStatus := new(ProgramStatus)
+	if len(httpAddr) > 0 {
+		status, err := newStatusServer(httpAddr, filename, program, programStatus)
+		if err != nil {
+			fmt.Printf("Failed to init HTTP server: %s\n", err)
+			return 1
+		}
+		status.SetResponseSizes(server.responseSizes)
+		status.SetInflight(server.inflight)
+		go status.Serve()
+		defer status.Close()
 	}
 
 	var wg sync.WaitGroup
 	wg.Add(1)
 	quitServer := make(chan bool)
 	// SNMP server running in background
-	go runSNMPServer(agent, conn, quitServer, &wg)
+	go runSNMPServer(server, quitServer, &wg)
 
-	// now run program to set the OID values
-	err = interp.InterpProgram(program)
-	if err != nil {
-		logger.Printf("Interpreting error: %s\n", err)
+	if isStaticProgram(program) {
+		if exitAfterProgram {
+			logger.Warnf("The program has no loop, sleep or read so it finishes at once and -exit-after-program stops serving straight away\n")
+		} else {
+			logger.Infof("The program has no loop, sleep or read, its values are static and are served until stopped\n")
+		}
 	}
+	// now run program to set the OID values
+	serveProgram(server, interp, program, exitAfterProgram, keepServingOnError, programStatus)
 	quitServer <- true
 
 	wg.Wait()
+	logger.Infof("Response sizes: %s\n", server.responseSizes.Summary())
+	if state != nil {
+		// write any SETs still waiting for the debounce
+		err = state.Flush()
+		if err != nil {
+			logger.Errorf("Failed to save state: %v\n", err)
+		}
+	}
+	return 0
 }
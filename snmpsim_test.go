@@ -0,0 +1,698 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+func TestStringMaxLength(t *testing.T) {
+	val := &Value{valueType: ValueString, stringVal: "Toshiba e-STUDIO 2555c"}
+	tests := []struct {
+		maxLength uint
+		want      string
+	}{
+		{0, "Toshiba e-STUDIO 2555c"},
+		{7, "Toshiba"},
+		{22, "Toshiba e-STUDIO 2555c"},
+		{100, "Toshiba e-STUDIO 2555c"},
+	}
+	for _, test := range tests {
+		got, err := convertValueToSnmp(val, &Type{valueType: ValueString, maxLength: test.maxLength})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("max length %d: got %q, want %q", test.maxLength, got, test.want)
+		}
+	}
+}
+
+func TestLongStringEncoding(t *testing.T) {
+	ctx := snmp.Asn1Context()
+	long := strings.Repeat("0123456789", 500)
+	msg := snmp.Message{
+		Version:   snmp.V2C,
+		Community: []byte("public"),
+		Pdu: snmp.GetResponsePdu{
+			Identifier: 1,
+			Variables:  []snmp.Variable{{Name: asn1.Oid{1, 3, 6, 1, 2, 1, 1, 1, 0}, Value: long}},
+		},
+	}
+	buffer, err := ctx.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded snmp.Message
+	_, err = ctx.Decode(buffer, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdu := decoded.Pdu.(snmp.GetResponsePdu)
+	if pdu.Variables[0].Value != long {
+		t.Errorf("long string of %d bytes did not round trip", len(long))
+	}
+}
+
+// TestBitsEncoding checks a bitset is packed into octets as the BITS construct of RFC 2578 with bit 0
+// the most significant bit of the first octet, and that a SET of the octets gives the same bits
+func TestBitsEncoding(t *testing.T) {
+	agent, interp := newTestAgent(t, `
+var
+  features: 4.1.99.1.0 rw bits = [0, 3, 7]
+  flags: 4.1.99.2.0 bitset = [1, 9, 14]
+endvar
+run
+endrun`)
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil,
+		"1.3.6.1.4.1.99.1.0", "1.3.6.1.4.1.99.2.0")})
+	for i, want := range []string{"\x91", "\x40\x42"} {
+		if got := resp.Variables[i].Value; got != want {
+			t.Errorf("%s = %q, want %q", resp.Variables[i].Name, got, want)
+		}
+	}
+
+	resp = request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{"1.3.6.1.4.1.99.1.0": "\x00\x81"}, "1.3.6.1.4.1.99.1.0")})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("SET status %d", resp.ErrorStatus)
+	}
+	if val, _ := interp.GetValueForId("features"); val.bitsetVal.String() != (BitsetMap{8: true, 15: true}).String() {
+		t.Errorf("features = %s after a SET of 00 81, want bits 8 and 15", val.bitsetVal)
+	}
+}
+
+// TestUnsignedEncoding checks the application types are tagged as RFC 2578 requires
+// and are encoded big endian with a leading zero octet when the top bit is set
+func TestUnsignedEncoding(t *testing.T) {
+	program, interp := parseTestProgram(t, `
+var
+  gaugeMin: 4.1.99.1.0 guage
+  gaugeMax: 4.1.99.2.0 guage
+  gaugeOver: 4.1.99.3.0 guage
+  counterMin: 4.1.99.4.0 counter
+  counterMax: 4.1.99.5.0 counter
+  ticksMin: 4.1.99.6.0 timeticks
+  ticksMax: 4.1.99.7.0 timeticks
+  counter64Max: 4.1.99.8.0 counter64
+endvar
+run
+  gaugeMin = 0
+  gaugeMax = 4294967295
+  gaugeOver = 4294967296
+  counterMin = 0
+  counterMax = 4294967295
+  ticksMin = 0
+  ticksMax = 4294967295
+  counter64Max = 18446744073709551615
+endrun`)
+	agent := NewAgent()
+	if err := addProgramOIDs(agent, interp, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := interp.InterpProgram(program); err != nil {
+		t.Fatal(err)
+	}
+
+	max32 := []byte{0x00, 0xff, 0xff, 0xff, 0xff}
+	tests := []struct {
+		subId   byte
+		tag     byte
+		content []byte
+		value   interface{}
+	}{
+		{1, 0x42, []byte{0x00}, snmp.Unsigned32(0)},
+		{2, 0x42, max32, snmp.Unsigned32(4294967295)},
+		{3, 0x42, max32, snmp.Unsigned32(4294967295)},
+		{4, 0x41, []byte{0x00}, snmp.Counter32(0)},
+		{5, 0x41, max32, snmp.Counter32(4294967295)},
+		{6, 0x43, []byte{0x00}, snmp.TimeTicks(0)},
+		{7, 0x43, max32, snmp.TimeTicks(4294967295)},
+		{8, 0x46, append([]byte{0x00}, bytes.Repeat([]byte{0xff}, 8)...), snmp.Counter64(18446744073709551615)},
+	}
+	for _, test := range tests {
+		oid := asn1.Oid{1, 3, 6, 1, 4, 1, 99, uint(test.subId), 0}
+		msg := snmp.Message{Version: snmp.V2C, Community: []byte("public"),
+			Pdu: snmp.GetRequestPdu{Identifier: 1, Variables: []snmp.Variable{{Name: oid, Value: asn1.Null{}}}}}
+		reqBuf, err := agent.ctx.Encode(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		respBuf, err := agent.ProcessDatagram(reqBuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the variable binding is the OID followed by the tagged value
+		encodedOid := []byte{0x06, 0x08, 0x2b, 0x06, 0x01, 0x04, 0x01, 0x63, test.subId, 0x00}
+		want := append(encodedOid, test.tag, byte(len(test.content)))
+		want = append(want, test.content...)
+		if !bytes.Contains(respBuf, want) {
+			t.Errorf("%s: response % x does not contain % x", oid, respBuf, want)
+		}
+
+		var respMsg snmp.Message
+		if _, err = agent.ctx.Decode(respBuf, &respMsg); err != nil {
+			t.Fatal(err)
+		}
+		got := respMsg.Pdu.(snmp.GetResponsePdu).Variables[0].Value
+		if got != test.value {
+			t.Errorf("%s decoded as %v (%T), want %v (%T)", oid, got, got, test.value, test.value)
+		}
+	}
+}
+
+func TestTooBigResponse(t *testing.T) {
+	server := &SNMPServer{agent: NewAgent(), config: &ServerConfig{}, ctx: snmp.Asn1Context()}
+	oids := []asn1.Oid{{1, 3, 6, 1, 2, 1, 1, 1, 0}, {1, 3, 6, 1, 2, 1, 1, 5, 0}}
+	reqMsg := snmp.Message{
+		Version:   snmp.V1,
+		Community: []byte("public"),
+		Pdu: snmp.GetRequestPdu{
+			Identifier: 42,
+			Variables: []snmp.Variable{
+				{Name: oids[0], Value: asn1.Null{}},
+				{Name: oids[1], Value: asn1.Null{}},
+			},
+		},
+	}
+	request, err := server.ctx.Encode(reqMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := server.tooBigResponse(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var respMsg snmp.Message
+	_, err = server.ctx.Decode(response, &respMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdu, ok := respMsg.Pdu.(snmp.GetResponsePdu)
+	if !ok {
+		t.Fatalf("pdu type = %T, want snmp.GetResponsePdu", respMsg.Pdu)
+	}
+	if pdu.Identifier != 42 || pdu.ErrorStatus != snmp.TooBig || pdu.ErrorIndex != 0 {
+		t.Errorf("got id %d, status %d, index %d", pdu.Identifier, pdu.ErrorStatus, pdu.ErrorIndex)
+	}
+	if len(pdu.Variables) != len(oids) {
+		t.Fatalf("got %d variables, want %d", len(pdu.Variables), len(oids))
+	}
+	for i, v := range pdu.Variables {
+		if v.Name.String() != oids[i].String() {
+			t.Errorf("variable %d = %s, want %s", i, v.Name, oids[i])
+		}
+	}
+	if string(respMsg.Community) != "public" {
+		t.Errorf("community %q, want public", respMsg.Community)
+	}
+
+	// with -response-community like the responses of the agent
+	server.agent.SetResponseCommunity("fixed")
+	response, err = server.tooBigResponse(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = server.ctx.Decode(response, &respMsg); err != nil {
+		t.Fatal(err)
+	}
+	if string(respMsg.Community) != "fixed" {
+		t.Errorf("community %q with -response-community, want fixed", respMsg.Community)
+	}
+}
+
+func TestTruncatedBulkResponse(t *testing.T) {
+	server := &SNMPServer{config: &ServerConfig{}, ctx: snmp.Asn1Context()}
+	encode := func(pdu interface{}) []byte {
+		buffer, err := server.ctx.Encode(snmp.Message{Version: snmp.V2C, Community: []byte("public"), Pdu: pdu})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buffer
+	}
+	vars := make([]snmp.Variable, 10)
+	for i := range vars {
+		vars[i] = snmp.Variable{Name: asn1.Oid{1, 3, 6, 1, 2, 1, 2, 2, 1, 2, uint(i + 1)}, Value: "GigabitEthernet0/1"}
+	}
+	bulk := encode(snmp.GetBulkRequestPdu{Identifier: 9, MaxRepetitions: 10, Variables: vars[:1]})
+	response := encode(snmp.GetResponsePdu{Identifier: 9, Variables: vars})
+	fits := len(encode(snmp.GetResponsePdu{Identifier: 9, Variables: vars[:4]}))
+
+	// only the whole variable bindings which fit are left, in order
+	server.config.maxMsgSize = uint(fits + 1)
+	truncated, ok := server.truncatedBulkResponse(bulk, response)
+	if !ok {
+		t.Fatal("GetBulk response not truncated")
+	}
+	var respMsg snmp.Message
+	if _, err := server.ctx.Decode(truncated, &respMsg); err != nil {
+		t.Fatal(err)
+	}
+	pdu := respMsg.Pdu.(snmp.GetResponsePdu)
+	if len(truncated) != fits || pdu.Identifier != 9 || pdu.ErrorStatus != snmp.NoError || len(pdu.Variables) != 4 {
+		t.Fatalf("truncated to %d bytes: id %d, status %d, %d variables, want %d bytes and 4", len(truncated),
+			pdu.Identifier, pdu.ErrorStatus, len(pdu.Variables), fits)
+	}
+	for i, v := range pdu.Variables {
+		if v.Name.String() != vars[i].Name.String() {
+			t.Errorf("variable %d = %s, want %s", i, v.Name, vars[i].Name)
+		}
+	}
+
+	// other requests get tooBig
+	get := encode(snmp.GetRequestPdu{Identifier: 9, Variables: vars})
+	if _, ok := server.truncatedBulkResponse(get, response); ok {
+		t.Error("Get response truncated")
+	}
+}
+
+func TestStartupResponse(t *testing.T) {
+	ctx := snmp.Asn1Context()
+	request, err := ctx.Encode(snmp.Message{Version: snmp.V2C, Community: []byte("public"),
+		Pdu: snmp.GetRequestPdu{Identifier: 3, Variables: []snmp.Variable{{Name: asn1.Oid{1, 3, 6, 1, 2, 1, 1, 3, 0}, Value: asn1.Null{}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, resp := range []string{"", "drop"} {
+		server := &SNMPServer{agent: NewAgent(), config: &ServerConfig{startupResp: resp}, ctx: ctx}
+		buffer, err := server.startupResponse(request)
+		if err != nil || buffer != nil {
+			t.Errorf("%q: got %v, %v, want the request dropped", resp, buffer, err)
+		}
+	}
+
+	server := &SNMPServer{agent: NewAgent(), config: &ServerConfig{startupResp: "genErr"}, ctx: ctx}
+	buffer, err := server.startupResponse(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var respMsg snmp.Message
+	if _, err = ctx.Decode(buffer, &respMsg); err != nil {
+		t.Fatal(err)
+	}
+	pdu := respMsg.Pdu.(snmp.GetResponsePdu)
+	if pdu.Identifier != 3 || pdu.ErrorStatus != snmp.GenErr {
+		t.Errorf("got id %d, status %d, want genErr", pdu.Identifier, pdu.ErrorStatus)
+	}
+}
+
+func TestCompareOIDs(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.3.6.1.2.1.2", "1.3.6.1.2.1.10", -1},
+		{"1.3.6.1.2.1.10", "1.3.6.1.2.1.2", 1},
+		{"1.3.6.1.2.1.2", "1.3.6.1.2.1.2", 0},
+		{"1.3.6.1.2.1", "1.3.6.1.2.1.1", -1},
+		{"1.3.6.1.2.1.1", "1.3.6.1.2.1", 1},
+		{"1.3.6.1.2.1.2.2.1.9.1", "1.3.6.1.2.1.2.2.1.10.1", -1},
+		{"1.3.6.1.4.1.100", "1.3.6.1.4.1.99.1", 1},
+	}
+	for _, test := range tests {
+		a, _ := strToOID(test.a)
+		b, _ := strToOID(test.b)
+		if got := compareOIDs(a, b); got != test.want {
+			t.Errorf("compareOIDs(%s, %s) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestAppendOid(t *testing.T) {
+	for _, oidStr := range []string{".1.3.6.1.2.1.1.3.0", ".1.3.6.1.4.1.4294967295.0", ".0.0"} {
+		oid, err := strToOID(oidStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(appendOid(nil, oid)); got != oidStr || got != oid.String() {
+			t.Errorf("appendOid(%s) = %s, String() = %s", oidStr, got, oid.String())
+		}
+	}
+
+	_, interp := parseTestProgram(t, `var
+  uptime: 2.1.1.3.0 timeticks
+endvar
+run
+endrun`)
+	typ, found := interp.GetTypeForNumericOid(asn1.Oid{1, 3, 6, 1, 2, 1, 1, 3, 0})
+	if !found || typ.id != "uptime" {
+		t.Errorf("got %v, %t", typ, found)
+	}
+	if _, found := interp.GetTypeForNumericOid(asn1.Oid{1, 3, 6, 1, 2, 1, 1, 3}); found {
+		t.Error("found .1.3.6.1.2.1.1.3")
+	}
+}
+
+func TestSortOIDStrings(t *testing.T) {
+	oidStrs := []string{
+		".1.3.6.1.2.1.10",
+		".1.3.6.1.2.1.2.2.1.10.1",
+		".1.3.6.1.2.1.2",
+		".1.3.6.1.2.1.2.2.1.2.1",
+		".1.3.6.1.2.1.1.1.0",
+	}
+	want := []string{
+		".1.3.6.1.2.1.1.1.0",
+		".1.3.6.1.2.1.2",
+		".1.3.6.1.2.1.2.2.1.2.1",
+		".1.3.6.1.2.1.2.2.1.10.1",
+		".1.3.6.1.2.1.10",
+	}
+	err := sortOIDStrings(oidStrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range want {
+		if oidStrs[i] != want[i] {
+			t.Errorf("[%d] = %s, want %s", i, oidStrs[i], want[i])
+		}
+	}
+}
+
+func TestSetBufferSizes(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	server := &SNMPServer{conn: conn, replyConn: conn, config: &ServerConfig{rcvBufSize: 256 * 1024, sndBufSize: 128 * 1024}}
+	err = server.setBufferSizes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rcvBuf, sndBuf, err := socketBufferSizes(conn)
+	if err != nil {
+		t.Skip(err)
+	}
+	if rcvBuf <= 0 || sndBuf <= 0 {
+		t.Errorf("buffer sizes receive %d, send %d", rcvBuf, sndBuf)
+	}
+}
+
+func TestMultipleListenAddrs(t *testing.T) {
+	program, interp := parseTestProgram(t, queryTestProg)
+	config := &ServerConfig{readCommunity: "public", maxMsgSize: maxDatagramSize,
+		listenAddrs: ListenAddrs{"127.0.0.1:0", "127.0.0.1:0"}}
+	server, err := initSNMPServer(interp, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	if err := interp.InterpProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.moreConns) != 1 {
+		t.Fatalf("%d more sockets, want 1", len(server.moreConns))
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	quit := make(chan bool, 1)
+	go runSNMPServer(server, quit, &wg)
+	defer func() {
+		quit <- true
+		wg.Wait()
+	}()
+
+	// the client only takes responses from the address it sent to
+	for _, conn := range []*net.UDPConn{server.conn, server.moreConns[0]} {
+		client, err := newClient(conn.LocalAddr().String(), "public", snmp.V2C, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vars, err := client.Get(asn1.Oid{1, 3, 6, 1, 2, 1, 1, 1, 0})
+		client.Close()
+		if err != nil {
+			t.Errorf("%s: %v", conn.LocalAddr(), err)
+		} else if vars[0].Value != "query test" {
+			t.Errorf("%s: got %v", conn.LocalAddr(), vars[0].Value)
+		}
+	}
+}
+
+func TestReplyAddrAndBroadcast(t *testing.T) {
+	program, interp := parseTestProgram(t, queryTestProg)
+	if err := interp.InterpProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	request, err := snmp.Asn1Context().Encode(snmp.Message{
+		Version:   snmp.V2C,
+		Community: []byte("public"),
+		Pdu: snmp.GetRequestPdu{Identifier: 7,
+			Variables: []snmp.Variable{{Name: asn1.Oid{1, 3, 6, 1, 2, 1, 1, 1, 0}, Value: asn1.Null{}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// exchange sends the request from 127.0.0.1 to the address and returns where the response came from, nil for none
+	exchange := func(config *ServerConfig, to net.IP) net.Addr {
+		config.readCommunity, config.maxMsgSize = "public", maxDatagramSize
+		// on all addresses, as a socket bound to one does not get the datagrams to a broadcast address
+		config.listenAddrs = ListenAddrs{"0.0.0.0:0"}
+		server, err := initSNMPServer(interp, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Close()
+		var wg sync.WaitGroup
+		wg.Add(1)
+		quit := make(chan bool, 1)
+		go runSNMPServer(server, quit, &wg)
+		defer func() {
+			quit <- true
+			wg.Wait()
+		}()
+
+		client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		port := server.conn.LocalAddr().(*net.UDPAddr).Port
+		if _, err := client.WriteTo(request, &net.UDPAddr{IP: to, Port: port}); err != nil {
+			t.Fatal(err)
+		}
+		buffer := make([]byte, maxDatagramSize)
+		client.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		_, from, err := client.ReadFrom(buffer)
+		if err != nil {
+			return nil
+		}
+		if config.replyAddr != "" && from.String() != server.replyConn.LocalAddr().String() {
+			t.Errorf("response from %s, want the -reply-addr socket %s", from, server.replyConn.LocalAddr())
+		}
+		return from
+	}
+
+	loopback := net.IPv4(127, 0, 0, 1)
+	if from := exchange(&ServerConfig{}, loopback); from == nil {
+		t.Error("no response from the listening socket")
+	}
+	if from := exchange(&ServerConfig{replyAddr: "127.0.0.1:0"}, loopback); from == nil {
+		t.Error("no response from the -reply-addr socket")
+	}
+
+	// the broadcast address of the loopback network, the source still being 127.0.0.1
+	for _, test := range []struct {
+		ip   string
+		want bool
+	}{
+		{"127.255.255.255", true}, {"255.255.255.255", true}, {"224.0.0.1", true}, {"ff02::1", true},
+		{"127.0.0.1", false}, {"10.1.2.3", false},
+	} {
+		bcasts := []net.IP{net.IPv4(127, 255, 255, 255)}
+		if got := isBroadcastOrMulticast(net.ParseIP(test.ip), bcasts); got != test.want {
+			t.Errorf("destination %s: broadcast or multicast %t, want %t", test.ip, got, test.want)
+		}
+	}
+	if runtime.GOOS != "linux" {
+		t.Skip("the destination of a request is only known on Linux")
+	}
+	bcast := net.IPv4(127, 255, 255, 255)
+	if from := exchange(&ServerConfig{}, bcast); from != nil {
+		t.Errorf("response to a request to %s from %s, want none", bcast, from)
+	}
+	if from := exchange(&ServerConfig{replyBroadcast: true}, bcast); from == nil {
+		t.Errorf("no response to a request to %s with -reply-bcast", bcast)
+	}
+}
+
+func TestListOids(t *testing.T) {
+	_, interp := parseTestProgram(t, `
+var
+  ifDescr.[1..2]: 2.1.2.2.1.2 string
+  if-speed: 2.1.31.1.1.1.15.1 guage
+  alias 2.1.2.2.1.5.1 = 2.1.31.1.1.1.15.1
+  descr: 2.1.1.1.0 string
+endvar
+run
+endrun`)
+	var out bytes.Buffer
+	err := listOids(&out, interp, &ServerConfig{stdMib: true, vendor: "cisco"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{
+		".1.3.6.1.2.1.1.1.0 descr",
+		".1.3.6.1.2.1.1.2.0",
+		".1.3.6.1.2.1.1.3.0",
+	}
+	for i, w := range want {
+		if i >= len(lines) || lines[i] != w {
+			t.Fatalf("got\n%s\nwant %q at line %d", out.String(), w, i+1)
+		}
+	}
+	tail := []string{
+		".1.3.6.1.2.1.2.2.1.2.1 ifDescr.1",
+		".1.3.6.1.2.1.2.2.1.2.2 ifDescr.2",
+		".1.3.6.1.2.1.2.2.1.5.1 alias of .1.3.6.1.2.1.31.1.1.1.15.1",
+		".1.3.6.1.2.1.31.1.1.1.15.1 if-speed",
+	}
+	if got := lines[len(lines)-len(tail):]; strings.Join(got, "\n") != strings.Join(tail, "\n") {
+		t.Errorf("got\n%s\nwant it to end\n%s", out.String(), strings.Join(tail, "\n"))
+	}
+}
+
+func TestKeepServingOnError(t *testing.T) {
+	const prog = `
+var
+  a: 2.1.1.7.0 integer
+  b: 2.1.1.8.0 integer
+endvar
+run
+  a = 0
+  loop times 2
+    b = 10 / a
+  endloop
+endrun`
+	for _, keepServing := range []bool{false, true} {
+		program, interp := parseTestProgram(t, prog)
+		programStatus := new(ProgramStatus)
+		done := make(chan struct{})
+		go func() {
+			serveProgram(nil, interp, program, true, keepServing, programStatus)
+			close(done)
+		}()
+
+		var err error
+		for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+			var state string
+			if state, err = programStatus.Get(); state == ProgramFailed {
+				break
+			}
+		}
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || runtimeErr.Line != 9 {
+			t.Fatalf("program error %v, want one at line 9", err)
+		}
+		if val, _ := interp.GetValueForId("a"); val.intVal != 0 {
+			t.Errorf("a = %d, want the last value 0", val.intVal)
+		}
+
+		select {
+		case <-done:
+			if keepServing {
+				t.Error("stopped serving after the error")
+			}
+		case <-time.After(100 * time.Millisecond):
+			if !keepServing {
+				t.Error("still serving after the error")
+			}
+			syscall.Kill(os.Getpid(), syscall.SIGTERM)
+			<-done
+		}
+	}
+}
+
+func TestIsStaticProgram(t *testing.T) {
+	tests := []struct {
+		run    string
+		static bool
+	}{
+		{"", true},
+		{"a = 1", true},
+		{"loop times 3\n a = a + 1\n endloop", true},
+		{"if a = 0\n a = 1\n elseif a = 1\n a = 2\n else\n a = 3\n endif", true},
+		{"loop\n a = a + 1\n endloop", false},
+		{"loop times 3\n a = a + 1\n sleep 1 secs\n endloop", false},
+		{"if a = 0\n a = 1\n elseif a = 1\n sleep 1 secs\n endif", false},
+	}
+	for _, test := range tests {
+		program, _ := parseTestProgram(t, "var\n a: 2.1.1.7.0 integer\nendvar\nrun\n"+test.run+"\nendrun")
+		if got := isStaticProgram(program); got != test.static {
+			t.Errorf("%q: static %t, want %t", test.run, got, test.static)
+		}
+	}
+}
+
+func TestStrToOIDErrors(t *testing.T) {
+	tests := []struct {
+		str  string
+		want string
+	}{
+		{"", "OID is empty"},
+		{".", "OID component 1 is empty in '.'"},
+		{"1..3", "OID component 2 is empty in '1..3'"},
+		{"1.3.", "OID component 3 is empty in '1.3.'"},
+	}
+	for _, test := range tests {
+		_, err := strToOID(test.str)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("strToOID(%q) error = %v, want %q", test.str, err, test.want)
+		}
+	}
+
+	oid, err := strToOID(".1.3.6.1")
+	if err != nil || oid.String() != ".1.3.6.1" {
+		t.Errorf("strToOID(.1.3.6.1) = %v, %v", oid, err)
+	}
+}
+
+func TestListenError(t *testing.T) {
+	denied := &net.OpError{Op: "listen", Net: "udp", Err: os.NewSyscallError("bind", syscall.EACCES)}
+	err := listenError(denied, 161)
+	if !strings.Contains(err.Error(), "No permission to listen on UDP port 161") ||
+		!strings.Contains(err.Error(), "CAP_NET_BIND_SERVICE") || !strings.Contains(err.Error(), "-p 1161") {
+		t.Errorf("error = %s", err)
+	}
+
+	inUse := &net.OpError{Op: "listen", Net: "udp", Err: os.NewSyscallError("bind", syscall.EADDRINUSE)}
+	if err := listenError(inUse, 161); err != inUse {
+		t.Errorf("other error = %v, want it unchanged", err)
+	}
+}
+
+func TestReusePort(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	first, err := listenUDP(addr, true)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer first.Close()
+	addr.Port = first.LocalAddr().(*net.UDPAddr).Port
+
+	second, err := listenUDP(addr, true)
+	if err != nil {
+		t.Fatalf("second socket on port %d with -reuseport: %v", addr.Port, err)
+	}
+	second.Close()
+
+	conn, err := listenUDP(addr, false)
+	if err == nil {
+		conn.Close()
+		t.Errorf("socket on port %d without -reuseport: expecting an error", addr.Port)
+	}
+}
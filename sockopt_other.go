@@ -0,0 +1,14 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// socketBufferSizes is not supported on this platform
+func socketBufferSizes(conn *net.UDPConn) (rcvBuf int, sndBuf int, err error) {
+	return 0, 0, errors.New("socket buffer sizes not available on this platform")
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stateSaveDelay is how long after a SET the state file is written, so a burst of SETs is written once
+const stateSaveDelay = 500 * time.Millisecond
+
+// StateFile keeps the values of the variables set by SNMP SETs so they survive a restart,
+// like the non-volatile configuration of a device. The file is JSON mapping each variable
+// id to its value in the form of the -V option.
+type StateFile struct {
+	filename string
+	lock     sync.Mutex
+	values   map[string]string // variable id --> value text
+	timer    *time.Timer       // pending save, nil if none
+}
+
+// loadStateFile reads the state file, which need not exist yet
+func loadStateFile(filename string) (*StateFile, error) {
+	state := &StateFile{filename: filename, values: make(map[string]string)}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &state.values)
+	if err != nil {
+		return nil, fmt.Errorf("State file %s: %v", filename, err)
+	}
+	return state, nil
+}
+
+// Record keeps the value of a variable which has been set and schedules a save
+func (state *StateFile) Record(id string, val *Value) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.values[id] = stateText(val)
+	if state.timer == nil {
+		state.timer = time.AfterFunc(stateSaveDelay, func() {
+			err := state.Flush()
+			if err != nil {
+				logger.Errorf("Failed to save state: %v\n", err)
+			}
+		})
+	}
+}
+
+// Flush writes the state file if there is a pending save
+func (state *StateFile) Flush() error {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	if state.timer == nil {
+		return nil
+	}
+	state.timer.Stop()
+	state.timer = nil
+	return state.save()
+}
+
+// save writes the state file by replacing it, so it is never seen half written
+func (state *StateFile) save() error {
+	data, err := json.MarshalIndent(state.values, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(state.filename), filepath.Base(state.filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), state.filename)
+}
+
+// stateText formats a value so textToValue reads it back
+func stateText(val *Value) string {
+	switch val.valueType {
+	case ValueString:
+		return val.stringVal
+	case ValueBitset:
+		var bits []int
+		for bit := range val.bitsetVal {
+			bits = append(bits, int(bit))
+		}
+		sort.Ints(bits)
+		strs := make([]string, len(bits))
+		for i, bit := range bits {
+			strs[i] = fmt.Sprintf("%d", bit)
+		}
+		return "[" + strings.Join(strs, " ") + "]"
+	}
+	return formatValue(val)
+}
+
+// SetStateFile sets the file of persisted values, which override the initial values of the program
+// Must call before Init.
+func (interp *Interpreter) SetStateFile(state *StateFile) {
+	interp.state = state
+}
+
+// applyState overrides the initial values with the persisted ones
+// Variables no longer in the program are ignored.
+func (interp *Interpreter) applyState() error {
+	if interp.state == nil {
+		return nil
+	}
+	interp.state.lock.Lock()
+	defer interp.state.lock.Unlock()
+
+	ids := make([]string, 0, len(interp.state.values))
+	for id := range interp.state.values {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		typ, ok := interp.variables.types[id]
+		if !ok {
+			logger.Warnf("State file %s: %s is not a variable of the program, ignoring it\n", interp.state.filename, id)
+			continue
+		}
+		val := &Value{valueType: typ.valueType}
+		err := textToValue(interp.state.values[id], val, interp.variables)
+		if err != nil {
+			return fmt.Errorf("State file %s: %s: %v", interp.state.filename, id, err)
+		}
+		interp.values[id] = val
+		if len(typ.oid) > 0 {
+			interp.oid2Values[typ.oid] = val
+		}
+	}
+	return nil
+}
+
+// recordSet persists a value set by an SNMP SET if the variable is declared in the program, and records it
+// with -record-sets. Table rows are left out as they would not exist after a restart.
+func (interp *Interpreter) recordSet(typ *Type, val *Value) {
+	if interp.state == nil && interp.setRecorder == nil {
+		return
+	}
+	interp.valLock.RLock()
+	_, added := interp.addedTypes[typ.oid]
+	interp.valLock.RUnlock()
+	if added {
+		return
+	}
+	if interp.state != nil {
+		interp.state.Record(typ.id, val)
+	}
+	if interp.setRecorder != nil {
+		err := interp.setRecorder.Record(typ.id, val, time.Now())
+		if err != nil {
+			logger.Errorf("Failed to record the SET of %s in %s: %v\n", typ.id, interp.setRecorder.filename, err)
+		}
+	}
+}
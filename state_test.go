@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PromonLogicalis/snmp"
+)
+
+const stateTestProg = `
+var
+  contact: 2.1.1.4.0 rw string = "nobody"
+  location: 2.1.1.6.0 rw string = "lab"
+  flags: 4.1.99.1.0 rw bitset
+  hosts: 4.1.99.1.1 table {
+    name: 2 string,
+    status: 3 rowstatus
+  }
+endvar
+run
+endrun`
+
+func TestStatePersistence(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+	state, err := loadStateFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := Parse("state", stateTestProg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interp := new(Interpreter)
+	interp.SetStateFile(state)
+	if err := interp.Init(program, nil); err != nil {
+		t.Fatal(err)
+	}
+	agent := NewAgent()
+	if err := addProgramOIDs(agent, interp, false); err != nil {
+		t.Fatal(err)
+	}
+
+	contact := "1.3.6.1.2.1.1.4.0"
+	flags := "1.3.6.1.4.1.99.1.0"
+	resp := request(t, agent, snmp.V2C, "private", snmp.SetRequestPdu{
+		Variables: oidVars(t, map[string]interface{}{contact: "ops", flags: "\x50"}, contact, flags)})
+	if resp.ErrorStatus != snmp.NoError {
+		t.Fatalf("set status %d", resp.ErrorStatus)
+	}
+	// the save is debounced
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("state file written before the save delay: %v", err)
+	}
+	if err := state.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restart overlays the set values on the initial values of the program
+	state, err = loadStateFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interp = new(Interpreter)
+	interp.SetStateFile(state)
+	if err := interp.Init(program, nil); err != nil {
+		t.Fatal(err)
+	}
+	if val, _ := interp.GetValueForId("contact"); val.stringVal != "ops" {
+		t.Errorf("contact = %v, want ops", val)
+	}
+	if val, _ := interp.GetValueForId("location"); val.stringVal != "lab" {
+		t.Errorf("location = %v, want the initial value", val)
+	}
+	val, _ := interp.GetValueForId("flags")
+	if want := convertOctetStrToBitset("\x50"); val.bitsetVal.String() != want.String() {
+		t.Errorf("flags = %v, want %v", val.bitsetVal, want)
+	}
+
+	// as does a reset
+	interp.SetValueForIdOid("contact", ".1.3.6.1.2.1.1.4.0", &Value{valueType: ValueString, stringVal: "changed"})
+	interp.Reset()
+	if val, _ := interp.GetValueForId("contact"); val.stringVal != "ops" {
+		t.Errorf("contact after reset = %v, want ops", val)
+	}
+}
+
+func TestStateErrors(t *testing.T) {
+	program, err := Parse("state", stateTestProg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	tests := []struct {
+		contents string
+		initErr  bool
+	}{
+		{`{"contact": "ops", "removed": "x"}`, false},
+		{`{"flags": "[x"}`, true},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(dir, "state.json")
+		if err := os.WriteFile(filename, []byte(test.contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		state, err := loadStateFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		interp := new(Interpreter)
+		interp.SetStateFile(state)
+		err = interp.Init(program, nil)
+		if (err != nil) != test.initErr {
+			t.Errorf("%s: init error %v", test.contents, err)
+		}
+	}
+
+	filename := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(filename, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadStateFile(filename); err == nil {
+		t.Error("no error for a bad state file")
+	}
+}
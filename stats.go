@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// responseSizeBounds are the upper bounds in bytes of the buckets of response sizes
+// 484 is the smallest message size an SNMP agent must accept and 1472 fits an Ethernet frame.
+var responseSizeBounds = []int{128, 256, 484, 1024, 1472, 2048, 4096, 8192, 16384, 32768, maxDatagramSize}
+
+// SizeHistogram is the distribution of the sizes of responses, in buckets
+type SizeHistogram struct {
+	lock    sync.Mutex
+	count   int
+	total   int64
+	min     int
+	max     int
+	buckets []int // counts up to each bound of responseSizeBounds
+	tooBig  int   // responses over the maximum message size
+}
+
+// SizeBucket is the count of responses up to a size (and larger than the previous bucket)
+type SizeBucket struct {
+	UpTo  int `json:"upTo"`
+	Count int `json:"count"`
+}
+
+// SizeSummary is a snapshot of a SizeHistogram for the /stats endpoint
+// The percentiles are the upper bounds of the buckets they fall in, or the maximum if less.
+type SizeSummary struct {
+	Count   int          `json:"count"`
+	Min     int          `json:"min"`
+	Max     int          `json:"max"`
+	Mean    float64      `json:"mean"`
+	P50     int          `json:"p50"`
+	P90     int          `json:"p90"`
+	P99     int          `json:"p99"`
+	TooBig  int          `json:"tooBig"`
+	Buckets []SizeBucket `json:"buckets"`
+}
+
+func newSizeHistogram() *SizeHistogram {
+	return &SizeHistogram{buckets: make([]int, len(responseSizeBounds))}
+}
+
+// Record adds the size of a response, which is tooBig if it is over the maximum message size
+func (h *SizeHistogram) Record(size int, tooBig bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.count == 0 || size < h.min {
+		h.min = size
+	}
+	if size > h.max {
+		h.max = size
+	}
+	h.count++
+	h.total += int64(size)
+	if tooBig {
+		h.tooBig++
+	}
+	for i, bound := range responseSizeBounds {
+		if size <= bound || i == len(responseSizeBounds)-1 {
+			h.buckets[i]++
+			break
+		}
+	}
+}
+
+// Summary returns the counts and percentiles of the sizes so far
+func (h *SizeHistogram) Summary() SizeSummary {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	summary := SizeSummary{Count: h.count, Min: h.min, Max: h.max, TooBig: h.tooBig, Buckets: []SizeBucket{}}
+	if h.count == 0 {
+		return summary
+	}
+	summary.Mean = float64(h.total) / float64(h.count)
+	summary.P50 = h.percentile(50)
+	summary.P90 = h.percentile(90)
+	summary.P99 = h.percentile(99)
+	for i, count := range h.buckets {
+		if count > 0 {
+			summary.Buckets = append(summary.Buckets, SizeBucket{UpTo: responseSizeBounds[i], Count: count})
+		}
+	}
+	return summary
+}
+
+// percentile returns the upper bound of the bucket of the percentile, at most the maximum
+// Must be called with the lock held
+func (h *SizeHistogram) percentile(p int) int {
+	rank := (h.count*p + 99) / 100 // the smallest count with p% at or below it
+	seen := 0
+	for i, count := range h.buckets {
+		seen += count
+		if seen >= rank {
+			if responseSizeBounds[i] > h.max {
+				return h.max
+			}
+			return responseSizeBounds[i]
+		}
+	}
+	return h.max
+}
+
+func (summary SizeSummary) String() string {
+	return fmt.Sprintf("%d responses, %d to %d bytes, mean %.0f, p50 %d, p90 %d, p99 %d, %d tooBig",
+		summary.Count, summary.Min, summary.Max, summary.Mean, summary.P50, summary.P90, summary.P99, summary.TooBig)
+}
+
+// InflightLimit bounds the number of requests processed at once for -max-inflight
+type InflightLimit struct {
+	slots   chan struct{} // a slot is taken by each request in flight
+	dropped int64         // requests dropped as all the slots were taken, atomic
+}
+
+// InflightSummary is the current and maximum number of requests in flight for the /stats endpoint
+type InflightSummary struct {
+	Current int   `json:"current"`
+	Max     int   `json:"max"`
+	Dropped int64 `json:"dropped"`
+}
+
+func newInflightLimit(max int) *InflightLimit {
+	return &InflightLimit{slots: make(chan struct{}, max)}
+}
+
+// TryAcquire takes a slot for a request, false without waiting if there are none left
+func (limit *InflightLimit) TryAcquire() bool {
+	select {
+	case limit.slots <- struct{}{}:
+		return true
+	default:
+		atomic.AddInt64(&limit.dropped, 1)
+		return false
+	}
+}
+
+// Release gives back the slot of a request when it has been processed
+func (limit *InflightLimit) Release() {
+	<-limit.slots
+}
+
+func (limit *InflightLimit) Summary() InflightSummary {
+	return InflightSummary{Current: len(limit.slots), Max: cap(limit.slots), Dropped: atomic.LoadInt64(&limit.dropped)}
+}
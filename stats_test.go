@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSizeHistogram(t *testing.T) {
+	h := newSizeHistogram()
+	if summary := h.Summary(); summary.Count != 0 || len(summary.Buckets) != 0 {
+		t.Errorf("empty summary %+v", summary)
+	}
+
+	// 90 small responses, 9 around an Ethernet frame and one too big
+	for i := 0; i < 90; i++ {
+		h.Record(50+i, false)
+	}
+	for i := 0; i < 9; i++ {
+		h.Record(1400, false)
+	}
+	h.Record(70000, true)
+
+	summary := h.Summary()
+	want := SizeSummary{
+		Count: 100, Min: 50, Max: 70000, Mean: float64(90*50+4005+9*1400+70000) / 100,
+		P50: 128, P90: 256, P99: 1472, TooBig: 1,
+		Buckets: []SizeBucket{{128, 79}, {256, 11}, {1472, 9}, {maxDatagramSize, 1}},
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("summary\n%+v\nwant\n%+v", summary, want)
+	}
+
+	h = newSizeHistogram()
+	h.Record(100, false)
+	if summary := h.Summary(); summary.P50 != 100 || summary.P99 != 100 {
+		t.Errorf("percentiles %d and %d are more than the maximum 100", summary.P50, summary.P99)
+	}
+}
+
+func TestInflightLimit(t *testing.T) {
+	limit := newInflightLimit(2)
+	if !limit.TryAcquire() || !limit.TryAcquire() {
+		t.Fatal("expecting 2 slots")
+	}
+	if limit.TryAcquire() {
+		t.Error("acquired a third slot")
+	}
+	if got, want := limit.Summary(), (InflightSummary{Current: 2, Max: 2, Dropped: 1}); got != want {
+		t.Errorf("summary %+v, want %+v", got, want)
+	}
+	limit.Release()
+	if !limit.TryAcquire() {
+		t.Error("released slot not acquired")
+	}
+	limit.Release()
+	limit.Release()
+	if got, want := limit.Summary(), (InflightSummary{Current: 0, Max: 2, Dropped: 1}); got != want {
+		t.Errorf("summary %+v, want %+v", got, want)
+	}
+}
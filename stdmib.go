@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+// standardObject is a MIB-II object served with a placeholder value by -stdmib
+type standardObject struct {
+	oid    string
+	getter GetHandler
+}
+
+func constantValue(value interface{}) GetHandler {
+	return func(ctx context.Context, oid asn1.Oid) (interface{}, error) {
+		return value, nil
+	}
+}
+
+// standardObjects returns the MIB-II system group scalars (RFC 3418)
+// sysORTable is left empty so only sysORLastChange is served for it.
+func standardObjects(interp *Interpreter) []standardObject {
+	const services = 72 // application and end-to-end layers
+	return []standardObject{
+		{".1.3.6.1.2.1.1.1.0", constantValue("snmprun simulated device")}, // sysDescr
+		{sysObjectIdOid, constantValue(asn1.Oid{1, 3, 6, 1, 4, 1})},       // sysObjectID
+		{sysUpTimeOid, func(ctx context.Context, oid asn1.Oid) (interface{}, error) {
+			return snmp.TimeTicks(interp.UptimeTicks()), nil
+		}},
+		{".1.3.6.1.2.1.1.4.0", constantValue("")},                // sysContact
+		{".1.3.6.1.2.1.1.5.0", constantValue("snmprun")},         // sysName
+		{".1.3.6.1.2.1.1.6.0", constantValue("")},                // sysLocation
+		{".1.3.6.1.2.1.1.7.0", constantValue(services)},          // sysServices
+		{".1.3.6.1.2.1.1.8.0", constantValue(snmp.TimeTicks(0))}, // sysORLastChange
+	}
+}
+
+// addStandardMib serves placeholders for the MIB-II system group objects the program does not declare,
+// so discovery by a manager does not stop at the first missing OID
+func addStandardMib(agent *Agent, interp *Interpreter) {
+	for _, object := range standardObjects(interp) {
+		if _, declared := interp.GetTypeForOid(object.oid); declared {
+			continue
+		}
+		oid, err := strToOID(object.oid)
+		if err != nil {
+			logger.Errorf("Bad standard OID %s: %v\n", object.oid, err)
+			continue
+		}
+		agent.AddRoManagedObject(oid, object.getter)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+// RowStatus values as per RFC 2579
+const (
+	RowStatusActive        = 1
+	RowStatusNotInService  = 2
+	RowStatusNotReady      = 3
+	RowStatusCreateAndGo   = 4
+	RowStatusCreateAndWait = 5
+	RowStatusDestroy       = 6
+)
+
+// splitCellOid splits the OID of a table cell into its column sub-id and its index
+func splitCellOid(entryOid asn1.Oid, oid asn1.Oid) (subId uint, index asn1.Oid, ok bool) {
+	if len(oid) < len(entryOid)+2 || !isOidPrefix(entryOid, oid) {
+		return 0, nil, false
+	}
+	return oid[len(entryOid)], oid[len(entryOid)+1:], true
+}
+
+// cellType returns the type of the cell of a column for a row index
+func (table *Table) cellType(column *TableColumn, index asn1.Oid) *Type {
+	return &Type{
+		valueType: column.valueType,
+		oid:       fmt.Sprintf("%s.%d%s", table.oid, column.subId, index),
+		snmpMode:  SnmpModeReadWrite,
+		id:        fmt.Sprintf("%s.%s%s", table.id, column.id, index),
+		latency:   table.latency,
+	}
+}
+
+// column returns the column of a sub-id, nil if there is none
+func (table *Table) column(subId uint) *TableColumn {
+	for _, column := range table.columns {
+		if column.subId == subId {
+			return column
+		}
+	}
+	return nil
+}
+
+// zeroCellValue returns the initial value of a column in a new row
+func zeroCellValue(valueType ValueType) *Value {
+	val := &Value{valueType: valueType}
+	switch valueType {
+	case ValueOid:
+		val.oidVal = ".0.0"
+	case ValueIpv4address:
+		val.addrVal = "0.0.0.0"
+	}
+	return val
+}
+
+// addTableFunc lets the agent create rows of the table
+// A SET of createAndGo or createAndWait to the RowStatus column of a new index creates the row,
+// and a SET of destroy removes it.
+func addTableFunc(agent *Agent, interp *Interpreter, table *Table) error {
+	entryOid, err := strToOID(table.oid)
+	if err != nil {
+		return err
+	}
+
+	destroyRow := func(index asn1.Oid) {
+		for _, column := range table.columns {
+			typ := table.cellType(column, index)
+			interp.RemoveValueForType(typ)
+			oid, _ := strToOID(typ.oid)
+			agent.RemoveManagedObject(oid)
+		}
+		logger.Infof("Destroyed row %s of table %s\n", index, table.id)
+	}
+
+	// the RowStatus column of an existing row
+	statusReadFunc := func(ctx context.Context, oid asn1.Oid) (interface{}, error) {
+		time.Sleep(table.latency)
+		val, found := interp.GetValueForOid(oid.String())
+		if !found {
+			return nil, varErrorf(snmp.NoSuchName, "Row of %s no longer exists", oid)
+		}
+		return val.intVal, nil
+	}
+	statusWriteFunc := func(ctx context.Context, oid asn1.Oid, value interface{}) (func() error, error) {
+		status, ok := value.(int)
+		if !ok {
+			return nil, varErrorf(snmp.WrongType, "Bad row status type")
+		}
+		_, index, _ := splitCellOid(entryOid, oid)
+		switch status {
+		case RowStatusActive, RowStatusNotInService:
+			return func() error {
+				typ := table.cellType(table.statusColumn, index)
+				interp.SetValueForIdOid(typ.id, typ.oid, &Value{valueType: ValueInteger, intVal: status})
+				return nil
+			}, nil
+		case RowStatusDestroy:
+			return func() error {
+				destroyRow(index)
+				return nil
+			}, nil
+		case RowStatusCreateAndGo, RowStatusCreateAndWait:
+			return nil, varErrorf(snmp.InconsistentValue, "Row %s of table %s already exists", index, table.id)
+		}
+		return nil, varErrorf(snmp.WrongValue, "Bad row status value %d", status)
+	}
+
+	createRow := func(index asn1.Oid, status int) {
+		for _, column := range table.columns {
+			typ := table.cellType(column, index)
+			val := zeroCellValue(column.valueType)
+			if column == table.statusColumn {
+				val.intVal = status
+			}
+			interp.AddValueForType(typ, val)
+			if column == table.statusColumn {
+				oid, _ := strToOID(typ.oid)
+				agent.AddRwManagedObject(oid, statusReadFunc, statusWriteFunc)
+			} else if column.valueType == ValueCounter || column.valueType == ValueCounter64 {
+				addOIDFunc(agent, interp, typ.oid, SnmpModeRead)
+			} else {
+				addOIDFunc(agent, interp, typ.oid, SnmpModeReadWrite)
+			}
+		}
+		logger.Infof("Created row %s of table %s\n", index, table.id)
+	}
+
+	// creatingStatus returns the status a new row gets from its RowStatus column, false if the value
+	// does not create one
+	creatingStatus := func(value interface{}) (int, bool) {
+		switch value {
+		case RowStatusCreateAndGo:
+			return RowStatusActive, true
+		case RowStatusCreateAndWait:
+			return RowStatusNotInService, true
+		}
+		return 0, false
+	}
+
+	// creations returns the number of variables of the request creating the row
+	creations := func(index asn1.Oid, reqVars []snmp.Variable) int {
+		statusOid := table.cellType(table.statusColumn, index).oid
+		count := 0
+		for _, reqVar := range reqVars {
+			if _, creates := creatingStatus(reqVar.Value); creates && reqVar.Name.String() == statusOid {
+				count++
+			}
+		}
+		return count
+	}
+
+	creator := func(ctx context.Context, oid asn1.Oid, value interface{}, reqVars []snmp.Variable) (func() error, bool, error) {
+		subId, index, ok := splitCellOid(entryOid, oid)
+		column := table.column(subId)
+		if !ok || column == nil {
+			return nil, false, varErrorf(snmp.NoCreation, "%s is not a cell of table %s", oid, table.id)
+		}
+		if column != table.statusColumn {
+			// only the RowStatus column creates rows, so another variable of the request has to
+			if creations(index, reqVars) == 0 {
+				return nil, false, varErrorf(snmp.InconsistentName, "Row %s of table %s does not exist", index, table.id)
+			}
+			typ := table.cellType(column, index)
+			val, err := interp.checkSetValue(typ, typ.oid, value)
+			if err != nil {
+				return nil, false, err
+			}
+			return func() error {
+				// the cell of the row created by then
+				cell, found := interp.GetTypeForOid(typ.oid)
+				if !found {
+					return fmt.Errorf("Row %s of table %s was not created", index, table.id)
+				}
+				interp.commitSetValue(ctx, cell, cell.oid, val, SnmpModeReadWrite)
+				return nil
+			}, false, nil
+		}
+
+		status, ok := value.(int)
+		if !ok {
+			return nil, false, varErrorf(snmp.WrongType, "Bad row status type")
+		}
+		if status == RowStatusDestroy {
+			// destroying a row that does not exist is fine
+			return func() error { return nil }, false, nil
+		}
+		status, creates := creatingStatus(status)
+		if !creates {
+			return nil, false, varErrorf(snmp.InconsistentValue, "Row %s of table %s does not exist", index, table.id)
+		}
+		if creations(index, reqVars) > 1 {
+			return nil, false, varErrorf(snmp.InconsistentValue, "Row %s of table %s is created more than once", index, table.id)
+		}
+		return func() error {
+			createRow(index, status)
+			return nil
+		}, true, nil
+	}
+
+	agent.AddTable(entryOid, creator)
+	return nil
+}
+
+// countOfValue sets a count-of variable to the number of rows of its table, or instances of its range, and
+// returns it so ifNumber can not drift from the rows of ifTable as they are created and destroyed
+func (interp *Interpreter) countOfValue(typ *Type) *Value {
+	interp.valLock.Lock()
+	defer interp.valLock.Unlock()
+
+	count := typ.countOf.instances
+	if table := typ.countOf.table; table != nil {
+		// a row has a cell in the RowStatus column
+		prefix := fmt.Sprintf("%s.%d.", table.oid, table.statusColumn.subId)
+		count = 0
+		for oid := range interp.addedTypes {
+			if strings.HasPrefix(oid, prefix) {
+				count++
+			}
+		}
+	}
+	val := &Value{valueType: typ.valueType, intVal: count}
+	interp.oid2Values[typ.oid] = val
+	interp.values[typ.id] = val
+	return val
+}
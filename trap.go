@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+// TrapConfig holds the command line options for sending traps
+type TrapConfig struct {
+	dest       string // host:port of the trap receiver, empty means traps are not sent
+	community  string // community name put in the trap message
+	enterprise string // enterprise OID of the v1 trap
+	agentAddr  string // agent address of the v1 trap, empty means our local address
+}
+
+// V1TrapSender sends SNMPv1 Trap-PDUs for the trap statement
+type V1TrapSender struct {
+	config     *TrapConfig
+	interp     *Interpreter
+	ctx        *asn1.Context
+	conn       *net.UDPConn
+	enterprise asn1.Oid
+	agentAddr  snmp.IPAddress
+}
+
+func newV1TrapSender(interp *Interpreter, config *TrapConfig) (sender *V1TrapSender, err error) {
+	sender = &V1TrapSender{config: config, interp: interp, ctx: snmp.Asn1Context()}
+
+	sender.enterprise, err = strToOID(config.enterprise)
+	if err != nil {
+		return nil, fmt.Errorf("Bad trap enterprise OID %s: %v", config.enterprise, err)
+	}
+
+	if len(config.dest) == 0 {
+		// nowhere to send traps
+		return sender, nil
+	}
+
+	destAddr, err := net.ResolveUDPAddr("udp", config.dest)
+	if err != nil {
+		return nil, err
+	}
+	sender.conn, err = net.DialUDP("udp", nil, destAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// agent-addr is our address as seen by the trap receiver unless told otherwise
+	addrStr := config.agentAddr
+	if len(addrStr) == 0 {
+		localIP := sender.conn.LocalAddr().(*net.UDPAddr).IP.To4()
+		if localIP == nil {
+			localIP = net.IPv4zero.To4()
+		}
+		addrStr = localIP.String()
+	}
+	if err := isValidIpv4Address(addrStr); err != nil {
+		return nil, fmt.Errorf("Bad trap agent address %s: %v", addrStr, err)
+	}
+	sender.agentAddr, err = strToAddr(addrStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return sender, nil
+}
+
+// buildTrap creates the trap message for the given trap numbers and variables
+// The variables have the values a GET of their OIDs would, e.g. a counter with a rate is brought up to date.
+func (sender *V1TrapSender) buildTrap(generic int, specific int, ids []string) (msg snmp.Message, err error) {
+	pdu := snmp.V1TrapPdu{
+		Enterprise:   sender.enterprise,
+		AgentAddr:    sender.agentAddr,
+		GenericTrap:  generic,
+		SpecificTrap: specific,
+		Timestamp:    snmp.TimeTicks(sender.interp.UptimeTicks()),
+		Variables:    make([]snmp.Variable, 0, len(ids)),
+	}
+
+	for _, id := range ids {
+		typ := sender.interp.variables.types[id]
+		oid, err := strToOID(typ.oid)
+		if err != nil {
+			return msg, err
+		}
+		val, err := sender.interp.valueSource(typ, typ.oid).Resolve(context.Background())
+		if err != nil {
+			return msg, fmt.Errorf("Bad trap variable %s: %v", id, err)
+		}
+		snmpVal, err := convertValueToSnmp(val, typ)
+		if err != nil {
+			return msg, fmt.Errorf("Bad trap variable %s: %v", id, err)
+		}
+		pdu.Variables = append(pdu.Variables, snmp.Variable{Name: oid, Value: snmpVal})
+	}
+
+	msg = snmp.Message{
+		Version:   snmp.V1,
+		Community: []byte(sender.config.community),
+		Pdu:       pdu,
+	}
+	return msg, nil
+}
+
+// SendTrap sends a trap to the configured receiver
+func (sender *V1TrapSender) SendTrap(generic int, specific int, ids []string) error {
+	const writeTimeoutSecs = 1
+
+	if sender.conn == nil {
+		logger.Debugf("Trap %d/%d not sent as there is no trap destination\n", generic, specific)
+		return nil
+	}
+
+	msg, err := sender.buildTrap(generic, specific, ids)
+	if err != nil {
+		return err
+	}
+	buffer, err := sender.ctx.Encode(msg)
+	if err != nil {
+		return err
+	}
+
+	// a trap receiver that is not there must not hold up the program
+	sender.conn.SetWriteDeadline(time.Now().Add(writeTimeoutSecs * time.Second))
+	_, err = sender.conn.Write(buffer)
+	if err != nil {
+		logger.Warnf("Failed to send trap: %s\n", err)
+	}
+	return nil
+}
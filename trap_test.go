@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/PromonLogicalis/snmp"
+)
+
+func parseTestProgram(t testing.TB, progStr string) (*Program, *Interpreter) {
+	if logger == nil {
+		logger = newLevelLogger(ioutil.Discard, "", 0, LogError)
+	}
+	parser := NewParser(lex("test", progStr))
+	program, err := parser.ParseProgram()
+	if err != nil {
+		t.Fatalf("Parsing error: %s", err)
+	}
+	interp := new(Interpreter)
+	err = interp.Init(program, make(VariableInits))
+	if err != nil {
+		t.Fatalf("Init error: %s", err)
+	}
+	return program, interp
+}
+
+func TestV1TrapFields(t *testing.T) {
+	prog := `
+var
+  status: .1.3.6.1.2.1.2.2.1.8.1 integer [1 = 'up', 2 = 'down']
+  descr: .1.3.6.1.2.1.2.2.1.2.1 string
+endvar
+run
+  status = 'down'
+  descr = "eth0"
+  trap 6 specific 3 with status, descr
+endrun`
+	program, interp := parseTestProgram(t, prog)
+
+	receiver, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	config := &TrapConfig{
+		dest:       receiver.LocalAddr().String(),
+		community:  "traps",
+		enterprise: ".1.3.6.1.4.1.99",
+	}
+	sender, err := newV1TrapSender(interp, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interp.SetTrapSender(sender)
+
+	time.Sleep(20 * time.Millisecond) // so the uptime is non-zero
+	err = interp.InterpProgram(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := make([]byte, 1500)
+	receiver.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := receiver.Read(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg snmp.Message
+	_, err = snmp.Asn1Context().Decode(buffer[:n], &msg)
+	if err != nil {
+		t.Fatalf("Failed to decode trap: %s", err)
+	}
+	if msg.Version != snmp.V1 {
+		t.Errorf("version = %d, want %d", msg.Version, snmp.V1)
+	}
+	if string(msg.Community) != "traps" {
+		t.Errorf("community = %s, want traps", msg.Community)
+	}
+	pdu, ok := msg.Pdu.(snmp.V1TrapPdu)
+	if !ok {
+		t.Fatalf("pdu type = %T, want snmp.V1TrapPdu", msg.Pdu)
+	}
+	if pdu.Enterprise.String() != ".1.3.6.1.4.1.99" {
+		t.Errorf("enterprise = %s", pdu.Enterprise)
+	}
+	if pdu.AgentAddr != (snmp.IPAddress{127, 0, 0, 1}) {
+		t.Errorf("agent-addr = %s, want 127.0.0.1", pdu.AgentAddr)
+	}
+	if pdu.GenericTrap != 6 || pdu.SpecificTrap != 3 {
+		t.Errorf("generic/specific = %d/%d, want 6/3", pdu.GenericTrap, pdu.SpecificTrap)
+	}
+	if pdu.Timestamp == 0 || uint32(pdu.Timestamp) > interp.UptimeTicks() {
+		t.Errorf("timestamp = %d, uptime = %d", pdu.Timestamp, interp.UptimeTicks())
+	}
+	if len(pdu.Variables) != 2 {
+		t.Fatalf("got %d variables, want 2", len(pdu.Variables))
+	}
+	if pdu.Variables[0].Name.String() != ".1.3.6.1.2.1.2.2.1.8.1" || pdu.Variables[0].Value != 2 {
+		t.Errorf("variable 0 = %v: %v", pdu.Variables[0].Name, pdu.Variables[0].Value)
+	}
+	if pdu.Variables[1].Name.String() != ".1.3.6.1.2.1.2.2.1.2.1" || pdu.Variables[1].Value != "eth0" {
+		t.Errorf("variable 1 = %v: %v", pdu.Variables[1].Name, pdu.Variables[1].Value)
+	}
+}
+
+func TestTrapGenericRange(t *testing.T) {
+	prog := `
+run
+  trap 7
+endrun`
+	program, interp := parseTestProgram(t, prog)
+	if err := interp.InterpProgram(program); err == nil {
+		t.Error("expected error for generic trap 7")
+	}
+}
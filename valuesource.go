@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ValueSource works out the value of a variable each time its OID is read
+type ValueSource interface {
+	Resolve(ctx context.Context) (*Value, error)
+}
+
+// cacheableSource is a source whose values can be served again for a time as they are expensive to work out.
+// Sources with the same key resolve to the same value, so they share it in the cache.
+type cacheableSource interface {
+	ValueSource
+	cacheKey() string
+	cacheTime() time.Duration
+}
+
+// cachedSource is a cacheable source resolved only if the cache has no value of its key
+type cachedSource struct {
+	source cacheableSource
+	cache  *SourceCache
+}
+
+func (source cachedSource) Resolve(ctx context.Context) (*Value, error) {
+	key := source.source.cacheKey()
+	now := time.Now()
+	if val, found := source.cache.get(key, now); found {
+		return val, nil
+	}
+	val, err := source.source.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	source.cache.put(key, val, now.Add(source.source.cacheTime()))
+	return val, nil
+}
+
+// staticSource is the value the program, a SET or the initial value last gave the OID
+type staticSource struct {
+	interp *Interpreter
+	oidStr string
+}
+
+func (source staticSource) Resolve(ctx context.Context) (*Value, error) {
+	val, found := source.interp.GetValueForOid(source.oidStr)
+	if !found {
+		return nil, &OIDError{Oid: source.oidStr, Kind: ErrUnknownOID}
+	}
+	return val, nil
+}
+
+// rateSource is the value of a counter increased at its rate for the time since it was last read
+type rateSource struct {
+	staticSource
+	typ *Type
+}
+
+func (source rateSource) Resolve(ctx context.Context) (*Value, error) {
+	source.interp.applyRate(source.typ)
+	return source.staticSource.Resolve(ctx)
+}
+
+// cycleSource is the next of the values of a cycle or once
+type cycleSource struct {
+	interp *Interpreter
+	typ    *Type
+}
+
+func (source cycleSource) Resolve(ctx context.Context) (*Value, error) {
+	return source.interp.nextCycleValue(source.typ), nil
+}
+
+// countOfSource is the number of rows of the table or range of a count-of
+type countOfSource struct {
+	interp *Interpreter
+	typ    *Type
+}
+
+func (source countOfSource) Resolve(ctx context.Context) (*Value, error) {
+	return source.interp.countOfValue(source.typ), nil
+}
+
+// waveSource is the value of a wave at the time of the read
+type waveSource struct {
+	interp *Interpreter
+	typ    *Type
+}
+
+func (source waveSource) Resolve(ctx context.Context) (*Value, error) {
+	return source.interp.waveValue(source.typ), nil
+}
+
+// backendSource is the value fetched from a backend, or what its on-error policy gives if the fetch fails.
+// The last or default value served for a failed fetch is cached like one fetched, so a walk does not wait
+// for the timeout of a failing backend at each OID.
+type backendSource struct {
+	interp *Interpreter
+	typ    *Type
+}
+
+func (source backendSource) Resolve(ctx context.Context) (*Value, error) {
+	return source.interp.backendValue(ctx, source.typ)
+}
+
+// cacheKey is the backend and the type it is converted to, so the OIDs fetching the same URL share the fetch
+func (source backendSource) cacheKey() string {
+	return fmt.Sprintf("%s %s", source.typ.backend.source, Type{valueType: source.typ.valueType})
+}
+
+func (source backendSource) cacheTime() time.Duration {
+	return source.typ.backend.cache
+}
+
+// cached returns the source with its values kept in the cache of the interpreter, or the source itself
+// if it has no cache time
+func (interp *Interpreter) cached(source cacheableSource) ValueSource {
+	if source.cacheTime() <= 0 || interp.sourceCache == nil {
+		return source
+	}
+	return cachedSource{source: source, cache: interp.sourceCache}
+}
+
+// valueSource returns where the value served for the OID of a variable comes from,
+// the type being nil for an OID that is not a declared variable
+func (interp *Interpreter) valueSource(typ *Type, oidStr string) ValueSource {
+	static := staticSource{interp: interp, oidStr: oidStr}
+	switch {
+	case typ == nil:
+		return static
+	case typ.cycle != nil:
+		return cycleSource{interp: interp, typ: typ}
+	case typ.countOf != nil:
+		return countOfSource{interp: interp, typ: typ}
+	case typ.wave != nil:
+		return waveSource{interp: interp, typ: typ}
+	case typ.backend != nil:
+		return interp.cached(backendSource{interp: interp, typ: typ})
+	case typ.rate != nil:
+		return rateSource{staticSource: static, typ: typ}
+	}
+	return static
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestValueSource(t *testing.T) {
+	_, interp := parseTestProgram(t, `
+var
+  name: 2.1.1.5.0 string = "router"
+  state: 4.1.99.1.0 integer cycle [1, 2]
+  ifNumber: 2.1.2.1.0 integer count-of ifDescr
+  ifDescr.[1..3]: 2.1.2.2.1.2 string = "eth%d"
+endvar
+run
+endrun`)
+	resolve := func(typ *Type, oidStr string) *Value {
+		val, err := interp.valueSource(typ, oidStr).Resolve(context.Background())
+		if err != nil {
+			t.Fatalf("resolve %s: %v", oidStr, err)
+		}
+		return val
+	}
+	types := interp.variables.types
+
+	if val := resolve(types["name"], types["name"].oid); val.stringVal != "router" {
+		t.Errorf("name = %v, want router", val)
+	}
+	for _, want := range []int{1, 2, 1} {
+		if val := resolve(types["state"], types["state"].oid); val.intVal != want {
+			t.Errorf("state = %d, want %d", val.intVal, want)
+		}
+	}
+	if val := resolve(types["ifNumber"], types["ifNumber"].oid); val.intVal != 3 {
+		t.Errorf("ifNumber = %d, want 3", val.intVal)
+	}
+
+	_, err := interp.valueSource(nil, ".1.3.6.1.4.1.99.9.0").Resolve(context.Background())
+	var oidErr *OIDError
+	if !errors.As(err, &oidErr) || oidErr.Kind != ErrUnknownOID {
+		t.Errorf("undeclared OID: error %v, want unknown OID", err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PromonLogicalis/asn1"
+)
+
+// sysObjectIdOid is the OID of sysObjectID, which managers use to identify the type of device
+const sysObjectIdOid = ".1.3.6.1.2.1.1.2.0"
+
+// vendorObjectIds are the sysObjectID values used by -vendor
+// Each is a product OID under the vendor's enterprise number, which is what device type detection keys on.
+var vendorObjectIds = map[string]string{
+	"cisco":     ".1.3.6.1.4.1.9.1.1",         // ciscoProducts (enterprise 9)
+	"hp":        ".1.3.6.1.4.1.11.2.3.7.11",   // hpEtherSwitch (enterprise 11)
+	"microsoft": ".1.3.6.1.4.1.311.1.1.3.1.2", // Windows server (enterprise 311)
+	"juniper":   ".1.3.6.1.4.1.2636.1.1.1.1",  // jnxProductName (enterprise 2636)
+	"net-snmp":  ".1.3.6.1.4.1.8072.3.2.10",   // Linux (enterprise 8072)
+	"mikrotik":  ".1.3.6.1.4.1.14988.1",       // RouterOS (enterprise 14988)
+}
+
+// vendorObjectId returns the sysObjectID for a vendor name given to -vendor
+func vendorObjectId(vendor string) (asn1.Oid, error) {
+	oidStr, ok := vendorObjectIds[strings.ToLower(vendor)]
+	if !ok {
+		vendors := make([]string, 0, len(vendorObjectIds))
+		for name := range vendorObjectIds {
+			vendors = append(vendors, name)
+		}
+		sort.Strings(vendors)
+		return nil, fmt.Errorf("Unknown vendor %s, expecting one of %s", vendor, strings.Join(vendors, ", "))
+	}
+	return strToOID(oidStr)
+}
+
+// addVendorObjectId serves the sysObjectID of the vendor unless the program declares sysObjectID
+// It replaces the -stdmib placeholder.
+func addVendorObjectId(agent *Agent, interp *Interpreter, vendor string) error {
+	objectId, err := vendorObjectId(vendor)
+	if err != nil {
+		return err
+	}
+	if _, declared := interp.GetTypeForOid(sysObjectIdOid); declared {
+		logger.Warnf("Program declares sysObjectID so -vendor %s is ignored\n", vendor)
+		return nil
+	}
+	oid, _ := strToOID(sysObjectIdOid)
+	agent.AddRoManagedObject(oid, constantValue(objectId))
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/PromonLogicalis/snmp"
+)
+
+// walkTimeout is how long a walk is remembered after its last request
+const walkTimeout = time.Minute
+
+// WalkLimit ends a walk with endOfMibView after a number of OIDs, so a discovery tool walking from the root
+// does not get every instance of a program with large tables. A walk is the GETNEXT and GETBULK requests of a
+// manager which each start from an OID the one before returned.
+type WalkLimit struct {
+	lock      sync.Mutex
+	max       int
+	walks     map[string]*walk // by the manager's address and an OID of the last response of the walk
+	lastSweep time.Time        // of the walks which have timed out
+}
+
+type walk struct {
+	returned int      // OIDs returned so far
+	keys     []string // into walks of the OIDs of the last response
+	last     time.Time
+	ended    bool // the limit has been reached
+}
+
+// walkBudget is the number of OIDs a request may still return, in the context of its handlers
+type walkBudget struct {
+	remaining int
+}
+
+type walkBudgetKey struct{}
+
+func newWalkLimit(max int) *WalkLimit {
+	return &WalkLimit{max: max, walks: make(map[string]*walk)}
+}
+
+// begin returns the walk a request continues, or a new one, and the context with the OIDs it may return
+func (limit *WalkLimit) begin(ctx context.Context, source string, reqVars []snmp.Variable, now time.Time) (context.Context, *walk) {
+	limit.lock.Lock()
+	defer limit.lock.Unlock()
+
+	if now.Sub(limit.lastSweep) >= walkTimeout {
+		limit.sweep(now)
+	}
+	var w *walk
+	for _, reqVar := range reqVars {
+		if found, ok := limit.walks[source+" "+reqVar.Name.String()]; ok {
+			w = found
+			break
+		}
+	}
+	if w == nil {
+		w = new(walk)
+	}
+	return context.WithValue(ctx, walkBudgetKey{}, &walkBudget{remaining: limit.max - w.returned}), w
+}
+
+// end records the OIDs of the response so the next request of the walk is found from any of them
+func (limit *WalkLimit) end(w *walk, source string, vars []snmp.Variable, now time.Time) {
+	limit.lock.Lock()
+	defer limit.lock.Unlock()
+
+	for _, key := range w.keys {
+		if limit.walks[key] == w {
+			delete(limit.walks, key)
+		}
+	}
+	w.keys = w.keys[:0]
+	for _, v := range vars {
+		if _, ok := v.Value.(snmp.EndOfMibView); ok {
+			continue
+		}
+		key := source + " " + v.Name.String()
+		w.keys = append(w.keys, key)
+		limit.walks[key] = w
+		w.returned++
+	}
+	w.last = now
+	if w.returned >= limit.max && !w.ended {
+		w.ended = true
+		logger.Infof("Walk by %s ended after %d OIDs (-max-walk)\n", source, w.returned)
+	}
+}
+
+// sweep forgets the walks with no request within the timeout
+// Must be called with the lock held
+func (limit *WalkLimit) sweep(now time.Time) {
+	for key, w := range limit.walks {
+		if now.Sub(w.last) >= walkTimeout {
+			delete(limit.walks, key)
+		}
+	}
+	limit.lastSweep = now
+}
+
+// walkEnded returns true if the request can return no more OIDs of its walk, and otherwise counts one more
+func walkEnded(ctx context.Context) bool {
+	budget, ok := ctx.Value(walkBudgetKey{}).(*walkBudget)
+	if !ok {
+		return false
+	}
+	if budget.remaining <= 0 {
+		return true
+	}
+	budget.remaining--
+	return false
+}
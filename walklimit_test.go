@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/PromonLogicalis/asn1"
+	"github.com/PromonLogicalis/snmp"
+)
+
+const walkTestProg = `
+var
+  descr: 2.1.1.1.0 string = "walk"
+  contact: 2.1.1.4.0 string
+  ifNumber: 2.1.2.1.0 integer = 2
+  ifDescr.[1..2]: 2.1.2.2.1.2 string = "eth%d"
+endvar
+run
+endrun`
+
+// walkFrom walks from the OID with GETNEXT requests from the source and returns the OIDs
+func walkFrom(t *testing.T, agent *Agent, source string, oid asn1.Oid) []string {
+	var oids []string
+	for {
+		msg := snmp.Message{Version: snmp.V2C, Community: []byte("public"),
+			Pdu: snmp.GetNextRequestPdu{Variables: []snmp.Variable{{Name: oid, Value: asn1.Null{}}}}}
+		reqBuf, err := agent.ctx.Encode(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		respBuf, _, err := agent.ProcessRequestFrom(reqBuf, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var respMsg snmp.Message
+		if _, err = agent.ctx.Decode(respBuf, &respMsg); err != nil {
+			t.Fatal(err)
+		}
+		v := respMsg.Pdu.(snmp.GetResponsePdu).Variables[0]
+		if _, ok := v.Value.(snmp.EndOfMibView); ok {
+			return oids
+		}
+		oid = v.Name
+		oids = append(oids, oid.String())
+	}
+}
+
+func TestRootWalk(t *testing.T) {
+	agent, _ := newTestAgent(t, walkTestProg)
+	all := []string{".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.4.0", ".1.3.6.1.2.1.2.1.0",
+		".1.3.6.1.2.1.2.2.1.2.1", ".1.3.6.1.2.1.2.2.1.2.2"}
+
+	for _, root := range []asn1.Oid{{1, 3}, {0}} {
+		if got := walkFrom(t, agent, "", root); len(got) != len(all) || got[0] != all[0] || got[4] != all[4] {
+			t.Errorf("walk from %s = %v, want %v", root, got, all)
+		}
+	}
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetBulkRequestPdu{MaxRepetitions: 10,
+		Variables: []snmp.Variable{{Name: asn1.Oid{1, 3}, Value: asn1.Null{}}}})
+	if len(resp.Variables) != len(all)+1 || resp.Variables[0].Name.String() != all[0] {
+		t.Fatalf("bulk from the root = %v", resp.Variables)
+	}
+	if _, ok := resp.Variables[len(all)].Value.(snmp.EndOfMibView); !ok {
+		t.Errorf("bulk from the root ends with %v, want endOfMibView", resp.Variables[len(all)])
+	}
+}
+
+func TestMaxWalk(t *testing.T) {
+	agent, _ := newTestAgent(t, walkTestProg)
+	agent.SetMaxWalk(3)
+
+	want := []string{".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.4.0", ".1.3.6.1.2.1.2.1.0"}
+	got := walkFrom(t, agent, "192.0.2.1:4000", asn1.Oid{1, 3})
+	if len(got) != 3 || got[0] != want[0] || got[2] != want[2] {
+		t.Errorf("limited walk = %v, want %v", got, want)
+	}
+	// each walk has its own limit, including another from the same manager
+	if got := walkFrom(t, agent, "192.0.2.1:4000", asn1.Oid{1, 3, 6, 1, 2, 1, 2}); len(got) != 3 {
+		t.Errorf("walk of the interfaces = %v, want 3 OIDs", got)
+	}
+	if got := walkFrom(t, agent, "192.0.2.2:4000", asn1.Oid{1, 3}); len(got) != 3 {
+		t.Errorf("walk by another manager = %v, want 3 OIDs", got)
+	}
+
+	// a bulk walk is cut short within a response and across them
+	resp := request(t, agent, snmp.V2C, "public", snmp.GetBulkRequestPdu{MaxRepetitions: 2,
+		Variables: []snmp.Variable{{Name: asn1.Oid{1, 3}, Value: asn1.Null{}}}})
+	if len(resp.Variables) != 2 {
+		t.Fatalf("first bulk = %v", resp.Variables)
+	}
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetBulkRequestPdu{MaxRepetitions: 5,
+		Variables: []snmp.Variable{{Name: resp.Variables[1].Name, Value: asn1.Null{}}}})
+	if len(resp.Variables) != 2 || resp.Variables[0].Name.String() != want[2] {
+		t.Fatalf("second bulk = %v", resp.Variables)
+	}
+	if _, ok := resp.Variables[1].Value.(snmp.EndOfMibView); !ok {
+		t.Errorf("second bulk ends with %v, want endOfMibView", resp.Variables[1])
+	}
+
+	// v1 gets noSuchName at the limit
+	resp = request(t, agent, snmp.V1, "public", snmp.GetNextRequestPdu{Variables: oidVars(t, nil, want[2])})
+	if resp.ErrorStatus != snmp.NoSuchName {
+		t.Errorf("v1 past the limit: status %d, want noSuchName", resp.ErrorStatus)
+	}
+
+	// a GET is not limited
+	resp = request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{Variables: oidVars(t, nil, want[0])})
+	if resp.ErrorStatus != snmp.NoError || resp.Variables[0].Value != "walk" {
+		t.Errorf("get = %v", resp.Variables)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// The shapes of waves
+const (
+	WaveSine     = "sine"
+	WaveSawtooth = "sawtooth"
+	WaveSquare   = "square"
+)
+
+// Wave is the waveform the value of a variable follows over time, such as a temperature going up and down.
+// It swings by the amplitude either side of the base and repeats every period, from the start by the uptime
+// or by a manual clock.
+type Wave struct {
+	shape     string
+	base      int
+	amplitude int
+	period    time.Duration
+	clock     string // manual clock the wave follows, empty for the uptime
+}
+
+// valueAt returns the value of the wave after the elapsed time
+// A sine starts at the base going up, a sawtooth rises from the bottom to the top and a square is at the top
+// for the first half of each period and at the bottom for the second.
+func (wave Wave) valueAt(elapsed time.Duration) int {
+	phase := float64(elapsed%wave.period) / float64(wave.period)
+	amplitude := float64(wave.amplitude)
+	var offset float64
+	switch wave.shape {
+	case WaveSine:
+		offset = amplitude * math.Sin(2*math.Pi*phase)
+	case WaveSawtooth:
+		offset = amplitude * (2*phase - 1)
+	case WaveSquare:
+		offset = amplitude
+		if phase >= 0.5 {
+			offset = -amplitude
+		}
+	}
+	return wave.base + int(math.Round(offset))
+}
+
+// waveValue returns the value of the wave of a variable now
+func (interp *Interpreter) waveValue(typ *Type) *Value {
+	elapsed := interp.Uptime()
+	if typ.wave.clock != "" && typ.wave.clock != wallClock {
+		clockElapsed, err := interp.ClockElapsed(typ.wave.clock)
+		if err == nil {
+			elapsed = clockElapsed
+		}
+	}
+	return &Value{valueType: typ.valueType, intVal: typ.wave.valueAt(elapsed)}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PromonLogicalis/snmp"
+)
+
+func TestWaveValueAt(t *testing.T) {
+	tests := []struct {
+		shape   string
+		elapsed time.Duration
+		want    int
+	}{
+		{WaveSine, 0, 25},
+		{WaveSine, 15 * time.Second, 30},
+		{WaveSine, 30 * time.Second, 25},
+		{WaveSine, 45 * time.Second, 20},
+		{WaveSine, 75 * time.Second, 30},
+		{WaveSawtooth, 0, 20},
+		{WaveSawtooth, 30 * time.Second, 25},
+		{WaveSawtooth, 54 * time.Second, 29},
+		{WaveSawtooth, 60 * time.Second, 20},
+		{WaveSquare, 0, 30},
+		{WaveSquare, 29 * time.Second, 30},
+		{WaveSquare, 30 * time.Second, 20},
+		{WaveSquare, 90 * time.Second, 20},
+	}
+	for _, test := range tests {
+		wave := Wave{shape: test.shape, base: 25, amplitude: 5, period: time.Minute}
+		if got := wave.valueAt(test.elapsed); got != test.want {
+			t.Errorf("%s after %s = %d, want %d", test.shape, test.elapsed, got, test.want)
+		}
+	}
+}
+
+func TestWave(t *testing.T) {
+	agent, interp := newTestAgent(t, `
+var
+  temperature: 4.1.99.5.0 integer wave sine base 25 amplitude 5 period 60 secs clock lab
+  queue: 4.1.99.6.0 guage wave square base 50 amplitude 50 period 10 secs clock lab
+endvar
+run
+endrun`)
+	get := func() []interface{} {
+		resp := request(t, agent, snmp.V2C, "public", snmp.GetRequestPdu{
+			Variables: oidVars(t, nil, "1.3.6.1.4.1.99.5.0", "1.3.6.1.4.1.99.6.0")})
+		return []interface{}{resp.Variables[0].Value, resp.Variables[1].Value}
+	}
+	if got := get(); got[0] != 25 || got[1] != snmp.Unsigned32(100) {
+		t.Errorf("at the start = %v, want [25 100]", got)
+	}
+	if err := interp.AdvanceClock("lab", 15*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(); got[0] != 30 || got[1] != snmp.Unsigned32(0) {
+		t.Errorf("after 15s = %v, want [30 0]", got)
+	}
+
+	tests := []struct {
+		decl string
+		want string
+	}{
+		{"x: 4.1.99.1.0 counter wave sine base 5 amplitude 1 period 1 secs", "Only an integer or guage"},
+		{"x: integer wave sine base 5 amplitude 1 period 1 secs", "A wave needs an OID"},
+		{"x: 4.1.99.1.0 integer wave triangle base 5 amplitude 1 period 1 secs", "Invalid wave triangle"},
+		{"x: 4.1.99.1.0 integer wave sine amplitude 1 base 5 period 1 secs", "Expecting base in the wave"},
+		{"x: 4.1.99.1.0 integer wave sine base 5 amplitude -1 period 1 secs", "wave amplitude"},
+		{"x: 4.1.99.1.0 integer wave sine base 5 amplitude 1 period 0 secs", "Invalid wave period"},
+		{"x: 4.1.99.1.0 guage wave sine base 5 amplitude 10 period 1 secs", "can not go below 0"},
+		{"x: 4.1.99.1.0 integer(1..10) wave sine base 5 amplitude 10 period 1 secs", "outside the range 1..10"},
+	}
+	for _, test := range tests {
+		_, err := Parse("test", "var\n  "+test.decl+"\nendvar\nrun\nendrun")
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error %v, want %s", test.decl, err, test.want)
+		}
+	}
+}